@@ -9,6 +9,7 @@ import (
 	"yc-agent/internal/agent/common"
 	"yc-agent/internal/agent/m3"
 	"yc-agent/internal/agent/ondemand"
+	"yc-agent/internal/agent/schedule"
 	"yc-agent/internal/capture"
 	"yc-agent/internal/capture/executils"
 	"yc-agent/internal/config"
@@ -27,9 +28,10 @@ func Run() error {
 	onDemandMode := len(config.GlobalConfig.Pid) > 0
 	m3Mode := config.GlobalConfig.M3
 	apiMode := config.GlobalConfig.Port > 0
+	scheduleMode := len(config.GlobalConfig.Schedules) > 0 && !onDemandMode
 
-	// Validation: if no mode is specified (neither M3, OnDemand, nor API Mode), abort here
-	if !onDemandMode && !apiMode && !m3Mode {
+	// Validation: if no mode is specified (neither M3, OnDemand, API nor schedules), abort here
+	if !onDemandMode && !apiMode && !m3Mode && !scheduleMode {
 		logger.Warn().Msg("M3 mode is not enabled. API mode is not enabled. The yc-360 script is about to run OnDemand mode but no PID is specified.")
 
 		return ErrNothingCanBeDone
@@ -48,7 +50,11 @@ func Run() error {
 	// I think we should clean it up eventually.
 	// On demand (short lived) run along with API mode feels strange.
 	// To clean it up: API mode can run standalone or along with M3, but not with on demand.
+	// Scheduled captures must not overlap with the captures of the other modes
+	var captureLocks []sync.Locker
+
 	if apiMode {
+		captureLocks = append(captureLocks, api.CaptureLock())
 		go runAPIMode()
 	}
 
@@ -56,11 +62,17 @@ func Run() error {
 		runOnDemandMode()
 	} else {
 		if m3Mode {
-			go runM3Mode()
+			m3App := m3.NewM3App()
+			captureLocks = append(captureLocks, m3App.CaptureLock())
+			go runM3Mode(m3App)
+		}
+
+		if scheduleMode {
+			go runScheduleMode(captureLocks)
 		}
 
-		if m3Mode || apiMode {
-			// M3 and API mode keep running until the process is killed with a SIGTERM signal,
+		if m3Mode || apiMode || scheduleMode {
+			// M3, API and schedule mode keep running until the process is killed with a SIGTERM signal,
 			// so they need to block here
 			for {
 				dailyAttendance()
@@ -106,10 +118,9 @@ func runAPIMode() {
 	}
 }
 
-func runM3Mode() {
+func runM3Mode(m3App *m3.M3App) {
 	logger.Log("Running M3 mode")
 
-	m3App := m3.NewM3App()
 	m3AppMu.Lock()
 	runningM3App = m3App
 	m3AppMu.Unlock()
@@ -125,6 +136,28 @@ func runM3Mode() {
 	m3App.RunLoop()
 }
 
+func runScheduleMode(captureLocks []sync.Locker) {
+	logger.Log("Running scheduled captures")
+
+	scheduler := schedule.New(config.GlobalConfig.Schedules, lockAll(captureLocks), ondemand.ProcessPids)
+	scheduler.Run(nil)
+}
+
+// lockAll is a lock that holds all locks, taken in order.
+type lockAll []sync.Locker
+
+func (l lockAll) Lock() {
+	for _, lock := range l {
+		lock.Lock()
+	}
+}
+
+func (l lockAll) Unlock() {
+	for i := len(l) - 1; i >= 0; i-- {
+		l[i].Unlock()
+	}
+}
+
 func runOnDemandMode() {
 	pidStr := config.GlobalConfig.Pid
 	if config.GlobalConfig.OnlyCapture {
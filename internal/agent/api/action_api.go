@@ -350,3 +350,8 @@ func ProcessPidsWithMutex(pids []int, pid2Name map[int]string, hd bool, tags str
 
 	return ondemand.ProcessPids(pids, pid2Name, hd, tmp, []string{""})
 }
+
+// CaptureLock returns the lock held while an API request runs a capture.
+func CaptureLock() sync.Locker {
+	return &one
+}
@@ -0,0 +1,169 @@
+package m3
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+)
+
+const defaultCadenceQuietPeriod = 10 * time.Minute
+
+// Cadence tracks the M3 cadence of every process for adaptive M3. A process
+// whose signals hold after a cycle is captured every fast interval, in
+// focused cycles between the regular ones, until no signal held for the
+// quiet period.
+type Cadence struct {
+	base, fast, quiet time.Duration
+	// signals evaluates the signals like triggers; without Admit no
+	// cooldown applies, so a signal fires on every cycle it holds.
+	signals *TriggerEngine
+	now     func() time.Time
+
+	pids map[int]*pidCadence
+}
+
+type pidCadence struct {
+	// lastHot is the end of the last cycle a signal held in, zero while
+	// the process runs at the base cadence.
+	lastHot time.Time
+	// next is when the next focused cycle of the process is due.
+	next time.Time
+}
+
+// NewCadence validates the config; adaptive M3 is disabled when the fast
+// frequency isn't shorter than base or no signal is configured.
+func NewCadence(cfg config.AdaptiveM3, base time.Duration) *Cadence {
+	c := &Cadence{
+		base:  base,
+		fast:  cfg.Frequency.Duration(),
+		quiet: cfg.QuietPeriod.Duration(),
+		now:   time.Now,
+		pids:  make(map[int]*pidCadence),
+	}
+	if c.quiet <= 0 {
+		c.quiet = defaultCadenceQuietPeriod
+	}
+	if len(cfg.Signals) == 0 {
+		return c
+	}
+	if c.fast <= 0 || c.fast >= base {
+		logger.Log("WARNING: ignoring adaptiveM3, frequency %s should be shorter than m3Frequency %s", c.fast, base)
+		return c
+	}
+
+	c.signals = NewTriggerEngine(cfg.Signals, 0)
+	return c
+}
+
+// Enabled reports whether adaptive M3 is configured.
+func (c *Cadence) Enabled() bool {
+	return c != nil && c.signals.Enabled()
+}
+
+// Observe evaluates the signals of pid after a cycle captured it, and
+// tightens or relaxes its cadence.
+func (c *Cadence) Observe(pid int, appName, gcPath string, appLogs config.AppLogs, healthCheckFailed *bool) {
+	sample := c.signals.Collect(pid, appName, gcPath, appLogs, healthCheckFailed)
+	firings := c.signals.Evaluate(pid, appName, sample)
+	now := c.now()
+
+	pc, ok := c.pids[pid]
+	if !ok {
+		pc = &pidCadence{}
+		c.pids[pid] = pc
+	}
+
+	if len(firings) > 0 {
+		reasons := make([]string, len(firings))
+		for i, f := range firings {
+			reasons[i] = f.Trigger + ": " + f.Observed
+		}
+		if pc.lastHot.IsZero() {
+			logger.Log("Tightening the m3 cadence of pid %d to %s, %s", pid, c.fast, strings.Join(reasons, "; "))
+		}
+		pc.lastHot = now
+	} else if !pc.lastHot.IsZero() && now.Sub(pc.lastHot) >= c.quiet {
+		logger.Log("Relaxing the m3 cadence of pid %d to %s, quiet for %s", pid, c.base, now.Sub(pc.lastHot).Round(time.Second))
+		pc.lastHot = time.Time{}
+	}
+
+	if !pc.lastHot.IsZero() {
+		pc.next = now.Add(c.fast)
+	}
+}
+
+// Frequency returns the current cadence of pid.
+func (c *Cadence) Frequency(pid int) time.Duration {
+	if c.Enabled() {
+		if pc, ok := c.pids[pid]; ok && !pc.lastHot.IsZero() {
+			return c.fast
+		}
+	}
+	return c.base
+}
+
+// Frequencies returns the current cadence of each of pids.
+func (c *Cadence) Frequencies(pids map[int]string) map[int]time.Duration {
+	frequencies := make(map[int]time.Duration, len(pids))
+	for pid := range pids {
+		frequencies[pid] = c.Frequency(pid)
+	}
+	return frequencies
+}
+
+// NextFocused returns when the next focused cycle is due, or the zero time
+// when no process runs at the fast cadence.
+func (c *Cadence) NextFocused() time.Time {
+	var at time.Time
+	for _, pc := range c.pids {
+		if !pc.lastHot.IsZero() && (at.IsZero() || pc.next.Before(at)) {
+			at = pc.next
+		}
+	}
+	return at
+}
+
+// TakeFocused returns the processes a focused cycle at now captures: the
+// ones due by then, and the ones due shortly after, so processes that got
+// hot in the same cycle stay in step. Their next focused cycle is moved a
+// fast interval on, also when the cycle fails to observe them.
+func (c *Cadence) TakeFocused(now time.Time) []int {
+	var pids []int
+	for pid, pc := range c.pids {
+		if !pc.lastHot.IsZero() && !pc.next.After(now.Add(c.fast/4)) {
+			pids = append(pids, pid)
+			pc.next = now.Add(c.fast)
+		}
+	}
+	slices.Sort(pids)
+	return pids
+}
+
+// RetainOnly drops the state of processes that are no longer monitored.
+func (c *Cadence) RetainOnly(pids map[int]string) {
+	for pid := range c.pids {
+		if _, ok := pids[pid]; !ok {
+			delete(c.pids, pid)
+		}
+	}
+	c.signals.RetainOnly(pids)
+}
+
+// runFocusedCycles runs the focused cycles of adaptive M3 that are due
+// before the regular cycle at until; one due shortly before it is left to
+// the regular cycle.
+func (m3 *M3App) runFocusedCycles(until time.Time) {
+	for {
+		at := m3.cadence.NextFocused()
+		if at.IsZero() || until.Sub(at) < m3.cadence.fast/2 {
+			return
+		}
+		m3.cycles.sleep(at.Sub(m3.cycles.now()))
+		if err := m3.RunFocused(m3.cadence.TakeFocused(m3.cycles.now())); err != nil {
+			logger.Log("WARNING: focused m3 cycle failed, %s", err)
+		}
+	}
+}
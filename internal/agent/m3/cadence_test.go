@@ -0,0 +1,63 @@
+package m3
+
+import (
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCadence(t *testing.T) {
+	signals := config.Triggers{{Metric: "healthCheck"}}
+
+	assert.True(t, NewCadence(config.AdaptiveM3{Frequency: config.Duration(30 * time.Second), Signals: signals}, 3*time.Minute).Enabled())
+	assert.False(t, NewCadence(config.AdaptiveM3{Frequency: config.Duration(30 * time.Second)}, 3*time.Minute).Enabled())
+	assert.False(t, NewCadence(config.AdaptiveM3{Signals: signals}, 3*time.Minute).Enabled())
+	assert.False(t, NewCadence(config.AdaptiveM3{Frequency: config.Duration(5 * time.Minute), Signals: signals}, 3*time.Minute).Enabled())
+}
+
+func TestCadenceObserve(t *testing.T) {
+	c := NewCadence(config.AdaptiveM3{
+		Frequency:   config.Duration(30 * time.Second),
+		QuietPeriod: config.Duration(5 * time.Minute),
+		Signals:     config.Triggers{{Name: "unhealthy", Metric: "healthCheck"}},
+	}, 3*time.Minute)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.signals.now = c.now
+
+	failed, passed := true, false
+	pids := map[int]string{100: "app", 200: "app"}
+
+	c.Observe(100, "app", "", nil, &passed)
+	c.Observe(200, "app", "", nil, nil)
+	assert.Equal(t, map[int]time.Duration{100: 3 * time.Minute, 200: 3 * time.Minute}, c.Frequencies(pids))
+	assert.True(t, c.NextFocused().IsZero())
+
+	c.Observe(100, "app", "", nil, &failed)
+	assert.Equal(t, map[int]time.Duration{100: 30 * time.Second, 200: 3 * time.Minute}, c.Frequencies(pids))
+	assert.Equal(t, now.Add(30*time.Second), c.NextFocused())
+
+	// A focused cycle takes the process and moves its next cycle on.
+	now = now.Add(30 * time.Second)
+	assert.Empty(t, c.TakeFocused(now.Add(-10*time.Second)))
+	assert.Equal(t, []int{100}, c.TakeFocused(now))
+	assert.Equal(t, now.Add(30*time.Second), c.NextFocused())
+
+	// Stays tight until quiet for the quiet period.
+	now = now.Add(4 * time.Minute)
+	c.Observe(100, "app", "", nil, &passed)
+	assert.Equal(t, 30*time.Second, c.Frequency(100))
+
+	now = now.Add(time.Minute)
+	c.Observe(100, "app", "", nil, &passed)
+	assert.Equal(t, 3*time.Minute, c.Frequency(100))
+	assert.True(t, c.NextFocused().IsZero())
+
+	c.Observe(200, "app", "", nil, &failed)
+	c.RetainOnly(map[int]string{100: "app"})
+	assert.True(t, c.NextFocused().IsZero())
+	assert.Equal(t, 3*time.Minute, c.Frequency(200))
+}
@@ -0,0 +1,151 @@
+package m3
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"yc-agent/internal/logger"
+)
+
+// Policies of M3OverrunPolicy for the cycles missed while a cycle overran
+// its period.
+const (
+	OverrunSkip  = "skip"
+	OverrunQueue = "queue"
+)
+
+// cycleScheduler starts M3 cycles at a fixed rate: the first one right
+// away, the later ones at the wall clock boundaries of the period (:00, :03,
+// :06... for 3 minutes) plus a random offset of at most the jitter. A slow cycle doesn't push the later ones
+// back, and agents started at the same time don't all report at once.
+type cycleScheduler struct {
+	period time.Duration
+	offset time.Duration
+	policy string
+	now    func() time.Time
+	sleep  func(time.Duration)
+	// idle, when set, is called with the start of the next cycle while
+	// waiting for it.
+	idle func(until time.Time)
+
+	mu    sync.Mutex
+	stats cycleStats
+}
+
+// cycleStats are reported to the server with every fin request.
+type cycleStats struct {
+	// Last is how long the last finished cycle took.
+	Last time.Duration
+	// Overruns counts the cycles that took longer than the period, and
+	// Skipped the cycles left out because of them.
+	Overruns int
+	Skipped  int
+}
+
+func newCycleScheduler(period, jitter time.Duration, policy string) *cycleScheduler {
+	if period <= 0 {
+		period = 3 * time.Minute
+	}
+	switch policy {
+	case OverrunSkip, OverrunQueue:
+	case "":
+		policy = OverrunSkip
+	default:
+		logger.Log("WARNING: unknown m3OverrunPolicy %q, should be %s or %s, using %s", policy, OverrunSkip, OverrunQueue, OverrunSkip)
+		policy = OverrunSkip
+	}
+
+	s := &cycleScheduler{
+		period: period,
+		policy: policy,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+	if jitter > 0 {
+		s.offset = rand.N(min(jitter, period))
+	}
+	return s
+}
+
+// Run runs cycle right away, then at every slot until stop is closed. The
+// first cycle isn't delayed to a boundary, so a new agent reports as soon
+// as it starts.
+func (s *cycleScheduler) Run(stop <-chan struct{}, cycle func()) {
+	logger.Log("Running m3 cycles every %s, the first right away", s.period)
+	start := s.now()
+	cycle()
+	end := s.now()
+	s.mu.Lock()
+	s.stats.Last = end.Sub(start)
+	s.mu.Unlock()
+
+	slot := s.first(end)
+	runAt := slot
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if s.idle != nil {
+			s.idle(runAt)
+		}
+		s.sleep(runAt.Sub(s.now()))
+		start := s.now()
+		cycle()
+		slot, runAt = s.next(slot, start, s.now())
+	}
+}
+
+// first returns the first slot at or after now.
+func (s *cycleScheduler) first(now time.Time) time.Time {
+	slot := now.Add(-s.offset).Truncate(s.period).Add(s.offset)
+	if slot.Before(now) {
+		slot = slot.Add(s.period)
+	}
+	return slot
+}
+
+// next returns the slot of the cycle after the one of slot, which ran from
+// start to end, and when to run it. A cycle that ends after the following
+// slot overran: its missed slots are skipped, or with OverrunQueue the
+// latest of them runs right away.
+func (s *cycleScheduler) next(slot, start, end time.Time) (time.Time, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Last = end.Sub(start)
+	following := slot.Add(s.period)
+	if !end.After(following) {
+		return following, following
+	}
+
+	missed := int(end.Sub(slot) / s.period)
+	s.stats.Overruns++
+	if s.policy == OverrunQueue {
+		s.stats.Skipped += missed - 1
+		logger.Log("WARNING: m3 cycle took %s, longer than m3Frequency %s; running the next cycle right away", s.stats.Last.Round(time.Millisecond), s.period)
+		return slot.Add(time.Duration(missed) * s.period), end
+	}
+
+	s.stats.Skipped += missed
+	next := slot.Add(time.Duration(missed+1) * s.period)
+	logger.Log("WARNING: m3 cycle took %s, longer than m3Frequency %s; skipping %d cycles until %s",
+		s.stats.Last.Round(time.Millisecond), s.period, missed, next.Format(time.RFC3339))
+	return next, next
+}
+
+// Stats returns the stats of the cycles finished so far.
+func (s *cycleScheduler) Stats() cycleStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// endpointParameters reports the stats as parameters of the fin endpoint.
+func (st cycleStats) endpointParameters() string {
+	return fmt.Sprintf("&cycleMs=%d&overruns=%d&skippedCycles=%d", st.Last.Milliseconds(), st.Overruns, st.Skipped)
+}
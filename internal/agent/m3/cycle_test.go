@@ -0,0 +1,104 @@
+package m3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCycleSchedulerFirst(t *testing.T) {
+	s := newCycleScheduler(3*time.Minute, 0, "")
+	assert.Equal(t, OverrunSkip, s.policy)
+
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 3, 0, 0, time.UTC),
+		s.first(time.Date(2026, 10, 19, 9, 1, 20, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 3, 0, 0, time.UTC),
+		s.first(time.Date(2026, 10, 19, 9, 3, 0, 0, time.UTC)))
+
+	s.offset = 40 * time.Second
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 0, 40, 0, time.UTC),
+		s.first(time.Date(2026, 10, 19, 9, 0, 20, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 3, 40, 0, time.UTC),
+		s.first(time.Date(2026, 10, 19, 9, 1, 20, 0, time.UTC)))
+}
+
+func TestCycleSchedulerJitter(t *testing.T) {
+	for range 100 {
+		s := newCycleScheduler(time.Minute, 10*time.Second, OverrunSkip)
+		assert.GreaterOrEqual(t, s.offset, time.Duration(0))
+		assert.Less(t, s.offset, 10*time.Second)
+	}
+
+	s := newCycleScheduler(time.Minute, time.Hour, OverrunSkip)
+	assert.Less(t, s.offset, time.Minute)
+}
+
+func TestCycleSchedulerNext(t *testing.T) {
+	slot := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	t.Run("in time", func(t *testing.T) {
+		s := newCycleScheduler(time.Minute, 0, OverrunSkip)
+		next, runAt := s.next(slot, slot, slot.Add(50*time.Second))
+		assert.Equal(t, slot.Add(time.Minute), next)
+		assert.Equal(t, next, runAt)
+		assert.Equal(t, cycleStats{Last: 50 * time.Second}, s.Stats())
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		s := newCycleScheduler(time.Minute, 0, OverrunSkip)
+		next, runAt := s.next(slot, slot, slot.Add(150*time.Second))
+		assert.Equal(t, slot.Add(3*time.Minute), next)
+		assert.Equal(t, next, runAt)
+		assert.Equal(t, cycleStats{Last: 150 * time.Second, Overruns: 1, Skipped: 2}, s.Stats())
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		s := newCycleScheduler(time.Minute, 0, OverrunQueue)
+		end := slot.Add(150 * time.Second)
+		next, runAt := s.next(slot, slot, end)
+		assert.Equal(t, slot.Add(2*time.Minute), next)
+		assert.Equal(t, end, runAt)
+		assert.Equal(t, cycleStats{Last: 150 * time.Second, Overruns: 1, Skipped: 1}, s.Stats())
+
+		// The queued cycle keeps the boundaries.
+		next, runAt = s.next(next, end, end.Add(10*time.Second))
+		assert.Equal(t, slot.Add(3*time.Minute), next)
+		assert.Equal(t, next, runAt)
+	})
+}
+
+func TestCycleSchedulerRun(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 30, 0, time.UTC)
+	s := newCycleScheduler(time.Minute, 0, OverrunSkip)
+	s.now = func() time.Time { return now }
+	s.sleep = func(d time.Duration) {
+		if d > 0 {
+			now = now.Add(d)
+		}
+	}
+
+	// The first cycle runs right away, the third overruns, the others
+	// take 10s.
+	durations := []time.Duration{10 * time.Second, 10 * time.Second, 70 * time.Second, 10 * time.Second}
+	var starts []time.Time
+	stop := make(chan struct{})
+	s.Run(stop, func() {
+		starts = append(starts, now)
+		now = now.Add(durations[len(starts)-1])
+		if len(starts) == len(durations) {
+			close(stop)
+		}
+	})
+
+	require.Len(t, starts, 4)
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 10, 19, 9, 0, 30, 0, time.UTC),
+		time.Date(2026, 10, 19, 9, 1, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 9, 2, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 9, 4, 0, 0, time.UTC),
+	}, starts)
+	assert.Equal(t, cycleStats{Last: 10 * time.Second, Overruns: 1, Skipped: 1}, s.Stats())
+	assert.Equal(t, "&cycleMs=10000&overruns=1&skippedCycles=1", s.Stats().endpointParameters())
+}
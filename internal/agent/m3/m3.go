@@ -5,14 +5,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	"yc-agent/internal/agent/common"
 	"yc-agent/internal/agent/ondemand"
@@ -34,10 +35,17 @@ type M3App struct {
 	AsyncDotNetGCCapture *capture.DotnetGCAsync
 	dotnetGCReadySeen    map[int]bool
 	nodeGCTracker        *capture.NodeGCTracker
+	triggers             *TriggerEngine
+	cycles               *cycleScheduler
+	cadence              *Cadence
+	// triggerFirings are collected during captureAndTransmit and captured
+	// by runTriggeredCaptures in the same cycle.
+	triggerFirings []TriggerFiring
 }
 
 func NewM3App() *M3App {
 	appLogM3 := capture.NewAppLogM3()
+	appLogM3.Exceptions = config.GlobalConfig.AppLogExceptions
 	accessLogM3 := capture.NewAccessLogM3()
 
 	dotNetGCBaseDir := ""
@@ -51,6 +59,10 @@ func NewM3App() *M3App {
 		AsyncDotNetGCCapture: capture.NewDotnetGCAsync(dotNetGCBaseDir),
 		dotnetGCReadySeen:    make(map[int]bool),
 		nodeGCTracker:        capture.NewNodeGCTracker(),
+		triggers:             NewTriggerEngine(config.GlobalConfig.Triggers, config.GlobalConfig.TriggerMaxCaptures),
+		cycles: newCycleScheduler(config.GlobalConfig.M3Frequency.Duration(),
+			config.GlobalConfig.M3Jitter.Duration(), config.GlobalConfig.M3OverrunPolicy),
+		cadence: NewCadence(config.GlobalConfig.AdaptiveM3, config.GlobalConfig.M3Frequency.Duration()),
 	}
 }
 
@@ -60,11 +72,21 @@ func (m3 *M3App) Shutdown() {
 	}
 }
 
+// CaptureLock returns the lock held while an M3 cycle runs, including the
+// incident captures it starts.
+func (m3 *M3App) CaptureLock() sync.Locker {
+	return &m3.runLock
+}
+
+// RunLoop runs RunSingle at a fixed rate of M3Frequency, see
+// cycleScheduler, and the focused cycles of adaptive M3 in between.
 func (m3 *M3App) RunLoop() {
-	for {
-		m3.RunSingle()
-		time.Sleep(config.GlobalConfig.M3Frequency.Duration())
+	if m3.cadence.Enabled() {
+		m3.cycles.idle = m3.runFocusedCycles
 	}
+	m3.cycles.Run(nil, func() {
+		m3.RunSingle()
+	})
 }
 
 func (m3 *M3App) RunSingle() error {
@@ -73,9 +95,6 @@ func (m3 *M3App) RunSingle() error {
 	m3.runLock.Lock()
 	defer m3.runLock.Unlock()
 
-	now, timezone := common.GetAgentCurrentTime()
-	timestamp := now.Format("2006-01-02T15-04-05")
-
 	pids, err := capture.GetProcessIds(config.GlobalConfig.ProcessTokens, config.GlobalConfig.ExcludeProcessTokens)
 	logger.Debug().Msgf("M3App.RunSingle: got process IDs: %v", pids)
 
@@ -86,6 +105,45 @@ func (m3 *M3App) RunSingle() error {
 			config.GlobalConfig.ProcessTokens, config.GlobalConfig.ExcludeProcessTokens)
 	}
 
+	return m3.runCycle(pids, false)
+}
+
+// RunFocused runs a cycle of adaptive M3 for the processes of pids that are
+// still monitored.
+func (m3 *M3App) RunFocused(pids []int) error {
+	logger.Debug().Msgf("M3App.RunFocused: running M3 capture of %v", pids)
+
+	m3.runLock.Lock()
+	defer m3.runLock.Unlock()
+
+	monitored, err := capture.GetProcessIds(config.GlobalConfig.ProcessTokens, config.GlobalConfig.ExcludeProcessTokens)
+	if err != nil {
+		logger.Log("WARNING: failed to get PID cause %v", err)
+		return err
+	}
+	m3.cadence.RetainOnly(monitored)
+
+	focused := make(map[int]string)
+	for _, pid := range pids {
+		if appName, ok := monitored[pid]; ok {
+			focused[pid] = appName
+		}
+	}
+	if len(focused) == 0 {
+		return nil
+	}
+
+	return m3.runCycle(focused, true)
+}
+
+// runCycle captures and transmits the data of pids. A focused cycle covers
+// only some of the monitored processes, so it keeps the state of the others,
+// and only uploads their data.
+func (m3 *M3App) runCycle(pids map[int]string, focused bool) error {
+	now, timezone := common.GetAgentCurrentTime()
+	timestamp := now.Format("2006-01-02T15-04-05")
+	var err error
+
 	// Init directory
 	// TODO: This has a similar functionality with ondemand. It might be good to extract this to a common reusable function.
 	{
@@ -138,35 +196,56 @@ func (m3 *M3App) RunSingle() error {
 	{
 		logger.Debug().Msgf("M3App.RunSingle: about to call captureAndTransmit")
 
-		m3.captureAndTransmit(pids, GetM3ReceiverEndpoint(timestamp, timezone))
+		m3.captureAndTransmit(pids, GetM3ReceiverEndpoint(timestamp, timezone), focused)
+	}
+
+	// A focused cycle only collects the data of its processes; triggers and
+	// the server see the regular cycles only, so neither the Cycles of a
+	// trigger nor the fin rate depend on the cadence.
+	if focused {
+		return nil
 	}
 
 	// Finish
-	{
-		logger.Debug().Msgf("M3App.RunSingle: about to call fin endpoint")
+	captured, err := m3.finish(timestamp, timezone, pids)
 
-		finEndpoint := GetM3FinEndpoint(timestamp, timezone, pids)
-		resp, err := ondemand.RequestFin(finEndpoint)
+	// Local triggers run after fin, so the server gets the data of the cycle
+	// without waiting for a capture, and also when it is unreachable. The
+	// processes the server just had captured are left out.
+	m3.runTriggeredCaptures(pids, captured)
 
-		if err != nil {
-			logger.Log("WARNING: Request M3 Fin failed, %s", err)
-			return err
-		}
+	return err
+}
 
-		if len(resp) == 0 {
-			logger.Log("WARNING: skip empty resp")
-			return err
-		}
+// finish calls the fin endpoint and starts the captures the server asks
+// for, returning their pids.
+func (m3 *M3App) finish(timestamp, timezone string, pids map[int]string) (map[int]bool, error) {
+	logger.Debug().Msgf("M3App.RunSingle: about to call fin endpoint")
+
+	finEndpoint := GetM3FinEndpoint(timestamp, timezone, pids)
+	if m3.cycles != nil {
+		finEndpoint += m3.cycles.Stats().endpointParameters()
+	}
+	resp, err := ondemand.RequestFin(finEndpoint)
 
-		err = m3.processM3FinResponse(resp, pids)
+	if err != nil {
+		logger.Log("WARNING: Request M3 Fin failed, %s", err)
+		return nil, err
+	}
 
-		if err != nil {
-			logger.Log("WARNING: processResp failed, %s", err)
-			return err
-		}
+	if len(resp) == 0 {
+		logger.Log("WARNING: skip empty resp")
+		return nil, nil
 	}
 
-	return nil
+	captured, err := m3.processM3FinResponse(resp, pids)
+
+	if err != nil {
+		logger.Log("WARNING: processResp failed, %s", err)
+		return captured, err
+	}
+
+	return captured, nil
 }
 
 func GetM3ReceiverEndpoint(timestamp string, timezone string) string {
@@ -225,7 +304,7 @@ func GetM3CommonEndpointParameters(timestamp string, timezone string) string {
 }
 
 //nolint:unparam // error return kept for future error handling
-func (m3 *M3App) captureAndTransmit(pids map[int]string, endpoint string) {
+func (m3 *M3App) captureAndTransmit(pids map[int]string, endpoint string, focused bool) {
 	logger.Log("yc-360 script version: %s", executils.SCRIPT_VERSION)
 	logger.Log("yc-360 script starting in m3 mode...")
 
@@ -236,6 +315,9 @@ func (m3 *M3App) captureAndTransmit(pids map[int]string, endpoint string) {
 
 	logger.Log("Starting collection of lp data...")
 	capLPM3 := capture.NewLPM3(pids)
+	if m3.cadence.Enabled() {
+		capLPM3.Frequencies = m3.cadence.Frequencies(pids)
+	}
 	lpM3Chan := capture.GoCapture(endpoint, capture.WrapRun(capLPM3))
 	logger.Log("Collection of lp data started.")
 
@@ -252,7 +334,7 @@ func (m3 *M3App) captureAndTransmit(pids map[int]string, endpoint string) {
 			}
 		}
 
-		if m3.AsyncDotNetGCCapture != nil {
+		if m3.AsyncDotNetGCCapture != nil && !focused {
 			// Reconcile creates/updates async GC capture sessions for current .NET PIDs.
 			// In the per-PID loop below, uploadDotnetGCM3 reads and uploads artifacts from
 			// those reconciled sessions in this same capture cycle.
@@ -296,25 +378,47 @@ func (m3 *M3App) captureAndTransmit(pids map[int]string, endpoint string) {
 			logger.Log("Starting collection of access logs data...")
 			m3.uploadAccessLogM3(endpoint, pid, appName)
 
+			var healthCheckFailed *bool
 			if healthCheckCfg, ok := config.GlobalConfig.HealthChecks[appName]; ok {
-				uploadHealthCheck(endpoint, appName, healthCheckCfg)
+				failed := !uploadHealthCheck(endpoint, appName, healthCheckCfg)
+				healthCheckFailed = &failed
+			}
+
+			if m3.triggers.Enabled() && !focused {
+				sample := m3.triggers.Collect(pid, appName, gcPath, m3.appLogM3.Paths[pid], healthCheckFailed)
+				m3.triggerFirings = append(m3.triggerFirings, m3.triggers.Evaluate(pid, appName, sample)...)
 			}
-		}
 
-		// Cleanup stale readiness state:
-		// `dotnetGCReadySeen` tracks whether we already observed and uploaded a "ready" artifact
-		// for a PID in previous cycles. If a PID is no longer a .NET target in this cycle,
-		// remove it so state does not leak across process restarts/PID reuse.
-		for pid := range m3.dotnetGCReadySeen {
-			if _, ok := dotnetPIDs[pid]; !ok {
-				delete(m3.dotnetGCReadySeen, pid)
+			if m3.cadence.Enabled() {
+				m3.cadence.Observe(pid, appName, gcPath, m3.appLogM3.Paths[pid], healthCheckFailed)
 			}
 		}
 
-		// Drop Node.js GC offset state for PIDs no longer monitored, so it does
-		// not leak across process restarts / PID reuse.
-		if m3.nodeGCTracker != nil {
-			m3.nodeGCTracker.RetainOnly(pids)
+		// The state of the processes a focused cycle doesn't cover is kept.
+		if !focused {
+			// Cleanup stale readiness state:
+			// `dotnetGCReadySeen` tracks whether we already observed and uploaded a "ready" artifact
+			// for a PID in previous cycles. If a PID is no longer a .NET target in this cycle,
+			// remove it so state does not leak across process restarts/PID reuse.
+			for pid := range m3.dotnetGCReadySeen {
+				if _, ok := dotnetPIDs[pid]; !ok {
+					delete(m3.dotnetGCReadySeen, pid)
+				}
+			}
+
+			// Drop Node.js GC offset state for PIDs no longer monitored, so it does
+			// not leak across process restarts / PID reuse.
+			if m3.nodeGCTracker != nil {
+				m3.nodeGCTracker.RetainOnly(pids)
+			}
+
+			if m3.triggers.Enabled() {
+				m3.triggers.RetainOnly(pids)
+			}
+
+			if m3.cadence.Enabled() {
+				m3.cadence.RetainOnly(pids)
+			}
 		}
 	}
 
@@ -670,7 +774,9 @@ Resps: %s
 	}
 }
 
-func uploadHealthCheck(endpoint, appName string, healthCheckCfg config.HealthCheck) {
+// uploadHealthCheck runs the health check of appName and reports whether
+// it passed.
+func uploadHealthCheck(endpoint, appName string, healthCheckCfg config.HealthCheck) bool {
 	capHealthCheck := &capture.HealthCheck{
 		AppName: appName,
 		Cfg:     healthCheckCfg,
@@ -687,26 +793,72 @@ Resp: %s
 --------------------------------
 `, result.Ok, result.Msg)
 	}
+
+	return capHealthCheck.Passed
 }
 
-func (m3 *M3App) processM3FinResponse(resp []byte, pid2Name map[int]string) (err error) {
+// processM3FinResponse starts the captures the server asked for and returns
+// their pids.
+func (m3 *M3App) processM3FinResponse(resp []byte, pid2Name map[int]string) (captured map[int]bool, err error) {
 	pids, tags, timestamps, err := ParseM3FinResponse(resp)
 	if err != nil {
 		logger.Log("WARNING: Get PID from ParseJsonResp failed, %s", err)
 		return
 	}
-	t := strings.Join(tags, ",")
 
-	tmp := config.GlobalConfig.Tags
-	if len(tmp) > 0 {
-		ts := strings.Trim(tmp, ",")
-		tmp = strings.Trim(ts+","+t, ",")
-	} else {
-		tmp = strings.Trim(t, ",")
+	_, err = ondemand.ProcessPids(pids, pid2Name, config.GlobalConfig.HeapDump, mergeTags(config.GlobalConfig.Tags, strings.Join(tags, ",")), timestamps, m3.captureOptions(pids))
+	if err == nil && len(pids) > 0 {
+		captured = make(map[int]bool, len(pids))
+		for _, pid := range pids {
+			captured[pid] = true
+		}
 	}
+	return
+}
+
+// runTriggeredCaptures starts a full capture of every process a local
+// trigger fired for in this cycle, within the global rate limit, except for
+// the processes the server had captured, and returns the captured pids.
+func (m3 *M3App) runTriggeredCaptures(pid2Name map[int]string, serverCaptured map[int]bool) map[int]bool {
+	firings := m3.triggerFirings
+	m3.triggerFirings = nil
+	firings = slices.DeleteFunc(firings, func(f TriggerFiring) bool {
+		if serverCaptured[f.Pid] {
+			logger.Log("Skipping the capture of trigger %s for pid %d, the server already had it captured", f.Trigger, f.Pid)
+			return true
+		}
+		return false
+	})
+	if len(firings) == 0 {
+		return nil
+	}
+
+	admitted := m3.triggers.Admit(firings)
+	pids := slices.Sorted(maps.Keys(admitted))
 
-	// Collect async GC log paths for .NET PIDs so incident capture
-	// uploads the accumulated log instead of spawning a fresh capture.
+	captured := make(map[int]bool)
+	for _, pid := range pids {
+		var names []string
+		for _, f := range admitted[pid] {
+			logger.Log("Trigger %s fired for pid %d: %s", f.Trigger, pid, f.Observed)
+			names = append(names, "trigger:"+f.Trigger)
+		}
+
+		tags := mergeTags(config.GlobalConfig.Tags, strings.Join(names, ","))
+		_, err := ondemand.ProcessPids([]int{pid}, pid2Name, config.GlobalConfig.HeapDump, tags, nil, m3.captureOptions([]int{pid}))
+		if err != nil {
+			logger.Log("WARNING: triggered capture of pid %d failed, %s", pid, err)
+			continue
+		}
+		captured[pid] = true
+	}
+
+	return captured
+}
+
+// captureOptions collects async GC log paths for .NET PIDs so incident
+// capture uploads the accumulated log instead of spawning a fresh capture.
+func (m3 *M3App) captureOptions(pids []int) ondemand.CaptureOptions {
 	var opts ondemand.CaptureOptions
 	if m3.AsyncDotNetGCCapture != nil {
 		asyncPaths := make(map[int]string)
@@ -719,9 +871,16 @@ func (m3 *M3App) processM3FinResponse(resp []byte, pid2Name map[int]string) (err
 			opts.DotnetAsyncGCPaths = asyncPaths
 		}
 	}
+	return opts
+}
 
-	_, err = ondemand.ProcessPids(pids, pid2Name, config.GlobalConfig.HeapDump, tmp, timestamps, opts)
-	return
+// mergeTags appends the comma separated tags to the configured ones.
+func mergeTags(configured, tags string) string {
+	if len(configured) > 0 {
+		ts := strings.Trim(configured, ",")
+		return strings.Trim(ts+","+tags, ",")
+	}
+	return strings.Trim(tags, ",")
 }
 
 type M3FinResponse struct {
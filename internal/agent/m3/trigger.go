@@ -0,0 +1,429 @@
+package m3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+
+	"github.com/mattn/go-zglob"
+	psv3 "github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	defaultTriggerCooldown   = 30 * time.Minute
+	defaultTriggerMaxCapture = 4
+	triggerRateWindow        = time.Hour
+
+	// maxTriggerLogRead caps how much new log content is scanned per file
+	// and cycle; with more, only the most recent part is scanned.
+	maxTriggerLogRead = 4 << 20
+)
+
+// triggerMetrics are the metrics a trigger can watch, see config.Trigger.
+var triggerMetrics = []string{"cpu", "rss", "threads", "fds", "gcPause", "healthCheck", "appLog"}
+
+// gcPausePatterns extract a pause time in ms from a line of a GC log:
+// JDK 9+ unified logging, JDK 8 -XX:+PrintGCDetails and Node.js --trace-gc.
+var gcPausePatterns = []struct {
+	re    *regexp.Regexp
+	scale float64
+}{
+	{regexp.MustCompile(`\bPause\b.*\s(\d+(?:\.\d+)?)ms\s*$`), 1},
+	{regexp.MustCompile(`real=(\d+(?:\.\d+)?) secs`), 1000},
+	{regexp.MustCompile(`\b(?:Scavenge|Mark-Compact|Mark-sweep|Minor Mark-Sweep)\b.*MB, (\d+(?:\.\d+)?) / \d+(?:\.\d+)? ms`), 1},
+}
+
+// TriggerEngine evaluates the local triggers of the M3 config on every cycle
+// and decides which processes get a full incident capture. Each trigger has
+// a cooldown per process, and all triggers together are limited to
+// maxPerHour captures.
+type TriggerEngine struct {
+	triggers   []compiledTrigger
+	maxPerHour int
+	now        func() time.Time
+
+	state map[triggerKey]*triggerState
+	// captures holds the start times of the captures in the last hour.
+	captures []time.Time
+	cpu      map[int]cpuReading
+	// logOffsets is the read position of every tailed GC and app log.
+	logOffsets map[string]int64
+}
+
+type compiledTrigger struct {
+	config.Trigger
+	pattern *regexp.Regexp
+}
+
+type triggerKey struct {
+	trigger int
+	pid     int
+}
+
+type triggerState struct {
+	consecutive int
+	lastFired   time.Time
+}
+
+type cpuReading struct {
+	total float64
+	at    time.Time
+}
+
+// TriggerSample holds what the triggers are evaluated against for one
+// process in one cycle.
+type TriggerSample struct {
+	// Metrics are the measured cpu, rss, threads, fds and gcPause values; a
+	// metric that couldn't be measured is missing and doesn't hold.
+	Metrics map[string]float64
+	// HealthCheckFailed is nil when the application has no health check.
+	HealthCheckFailed *bool
+	// AppLog is the content appended to the application logs since the
+	// previous cycle.
+	AppLog []byte
+}
+
+// TriggerFiring is a trigger whose condition held long enough.
+type TriggerFiring struct {
+	Pid      int
+	Trigger  string
+	Observed string
+
+	index int
+}
+
+// NewTriggerEngine validates the triggers; invalid ones are logged and
+// left out.
+func NewTriggerEngine(triggers config.Triggers, maxPerHour int) *TriggerEngine {
+	if maxPerHour <= 0 {
+		maxPerHour = defaultTriggerMaxCapture
+	}
+	e := &TriggerEngine{
+		maxPerHour: maxPerHour,
+		now:        time.Now,
+		state:      make(map[triggerKey]*triggerState),
+		cpu:        make(map[int]cpuReading),
+		logOffsets: make(map[string]int64),
+	}
+
+	for i, t := range triggers {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("trigger-%d", i+1)
+		}
+		if !slices.Contains(triggerMetrics, t.Metric) {
+			logger.Log("WARNING: ignoring trigger %s, unknown metric %q", t.Name, t.Metric)
+			continue
+		}
+		ct := compiledTrigger{Trigger: t}
+		if t.Metric == "appLog" {
+			re, err := regexp.Compile(t.Pattern)
+			if err != nil || t.Pattern == "" {
+				logger.Log("WARNING: ignoring trigger %s, invalid pattern %q: %v", t.Name, t.Pattern, err)
+				continue
+			}
+			ct.pattern = re
+		}
+		e.triggers = append(e.triggers, ct)
+	}
+
+	return e
+}
+
+// Enabled reports whether any trigger is configured.
+func (e *TriggerEngine) Enabled() bool {
+	return e != nil && len(e.triggers) > 0
+}
+
+// Collect measures the metrics the triggers of appName need. gcPath and
+// appLogs are tailed from where the previous cycle stopped; the first cycle
+// only records the current end of the files.
+func (e *TriggerEngine) Collect(pid int, appName, gcPath string, appLogs config.AppLogs, healthCheckFailed *bool) TriggerSample {
+	sample := TriggerSample{Metrics: make(map[string]float64)}
+	needed := e.metricsFor(appName)
+
+	var proc *psv3.Process
+	if needed["cpu"] || needed["rss"] || needed["threads"] || needed["fds"] {
+		p, err := psv3.NewProcess(int32(pid))
+		if err != nil {
+			logger.Log("WARNING: triggers: failed to read pid %d: %v", pid, err)
+		} else {
+			proc = p
+		}
+	}
+
+	if proc != nil {
+		if needed["cpu"] {
+			if times, err := proc.Times(); err == nil {
+				now := e.now()
+				total := times.User + times.System
+				if prev, ok := e.cpu[pid]; ok && now.After(prev.at) {
+					sample.Metrics["cpu"] = (total - prev.total) / now.Sub(prev.at).Seconds() * 100
+				}
+				e.cpu[pid] = cpuReading{total: total, at: now}
+			}
+		}
+		if needed["rss"] {
+			if mem, err := proc.MemoryInfo(); err == nil {
+				sample.Metrics["rss"] = float64(mem.RSS) / (1024 * 1024)
+			}
+		}
+		if needed["threads"] {
+			if n, err := proc.NumThreads(); err == nil {
+				sample.Metrics["threads"] = float64(n)
+			}
+		}
+		if needed["fds"] {
+			if n, err := proc.NumFDs(); err == nil {
+				sample.Metrics["fds"] = float64(n)
+			}
+		}
+	}
+
+	// Relative GC log paths are per-cycle captures (jstat) without pauses.
+	if needed["gcPause"] && filepath.IsAbs(gcPath) {
+		if pause, ok := maxGCPause(e.readNew(gcPath)); ok {
+			sample.Metrics["gcPause"] = pause
+		}
+	}
+
+	if needed["appLog"] {
+		for _, pattern := range appLogs {
+			matches, err := zglob.Glob(string(pattern))
+			if err != nil {
+				continue
+			}
+			for _, match := range matches {
+				sample.AppLog = append(sample.AppLog, e.readNew(match)...)
+			}
+		}
+	}
+
+	if needed["healthCheck"] {
+		sample.HealthCheckFailed = healthCheckFailed
+	}
+
+	return sample
+}
+
+// Evaluate updates the consecutive cycle count of every trigger of appName
+// for pid and returns the ones that fire, i.e. held for Cycles cycles and
+// are out of their cooldown.
+func (e *TriggerEngine) Evaluate(pid int, appName string, sample TriggerSample) []TriggerFiring {
+	var firings []TriggerFiring
+	now := e.now()
+
+	for i, t := range e.triggers {
+		if t.AppName != "" && t.AppName != appName {
+			continue
+		}
+
+		key := triggerKey{trigger: i, pid: pid}
+		st, ok := e.state[key]
+		if !ok {
+			st = &triggerState{}
+			e.state[key] = st
+		}
+
+		holds, observed := t.holds(sample)
+		if !holds {
+			st.consecutive = 0
+			continue
+		}
+		st.consecutive++
+
+		cycles := max(t.Cycles, 1)
+		if st.consecutive < cycles {
+			continue
+		}
+
+		cooldown := t.Cooldown.Duration()
+		if cooldown <= 0 {
+			cooldown = defaultTriggerCooldown
+		}
+		if !st.lastFired.IsZero() && now.Sub(st.lastFired) < cooldown {
+			logger.Debug().Msgf("trigger %s for pid %d is in its cooldown", t.Name, pid)
+			continue
+		}
+
+		firings = append(firings, TriggerFiring{Pid: pid, Trigger: t.Name, Observed: observed, index: i})
+	}
+
+	return firings
+}
+
+// Admit applies the global rate limit to firings and returns the admitted
+// ones by pid. A process gets one capture however many of its triggers
+// fired; the triggers of an admitted capture start their cooldown.
+func (e *TriggerEngine) Admit(firings []TriggerFiring) map[int][]TriggerFiring {
+	now := e.now()
+	e.captures = slices.DeleteFunc(e.captures, func(at time.Time) bool {
+		return now.Sub(at) >= triggerRateWindow
+	})
+
+	byPid := make(map[int][]TriggerFiring)
+	var pids []int
+	for _, f := range firings {
+		if _, ok := byPid[f.Pid]; !ok {
+			pids = append(pids, f.Pid)
+		}
+		byPid[f.Pid] = append(byPid[f.Pid], f)
+	}
+
+	admitted := make(map[int][]TriggerFiring)
+	for _, pid := range pids {
+		if len(e.captures) >= e.maxPerHour {
+			logger.Log("WARNING: trigger %s for pid %d suppressed, %d captures in the last hour reached the limit",
+				byPid[pid][0].Trigger, pid, len(e.captures))
+			continue
+		}
+		e.captures = append(e.captures, now)
+		admitted[pid] = byPid[pid]
+
+		for _, f := range byPid[pid] {
+			if st, ok := e.state[triggerKey{trigger: f.index, pid: pid}]; ok {
+				st.lastFired = now
+				st.consecutive = 0
+			}
+		}
+	}
+
+	return admitted
+}
+
+// RetainOnly drops the state of processes that are no longer monitored.
+func (e *TriggerEngine) RetainOnly(pids map[int]string) {
+	for key := range e.state {
+		if _, ok := pids[key.pid]; !ok {
+			delete(e.state, key)
+		}
+	}
+	for pid := range e.cpu {
+		if _, ok := pids[pid]; !ok {
+			delete(e.cpu, pid)
+		}
+	}
+}
+
+func (e *TriggerEngine) metricsFor(appName string) map[string]bool {
+	needed := make(map[string]bool)
+	for _, t := range e.triggers {
+		if t.AppName == "" || t.AppName == appName {
+			needed[t.Metric] = true
+		}
+	}
+	return needed
+}
+
+// readNew returns what was appended to path since the previous call. A file
+// that shrank was rotated and is read from the start.
+func (e *TriggerEngine) readNew(path string) []byte {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	offset, seen := e.logOffsets[path]
+	e.logOffsets[path] = info.Size()
+	if !seen {
+		return nil
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size()-offset > maxTriggerLogRead {
+		offset = info.Size() - maxTriggerLogRead
+	}
+	if info.Size() == offset {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		logger.Log("WARNING: triggers: failed to read %s: %v", path, err)
+		return nil
+	}
+	return data
+}
+
+func (t compiledTrigger) holds(sample TriggerSample) (bool, string) {
+	switch t.Metric {
+	case "healthCheck":
+		if sample.HealthCheckFailed != nil && *sample.HealthCheckFailed {
+			return true, "health check failed"
+		}
+		return false, ""
+	case "appLog":
+		if t.pattern == nil || len(sample.AppLog) == 0 {
+			return false, ""
+		}
+		loc := t.pattern.FindIndex(sample.AppLog)
+		if loc == nil {
+			return false, ""
+		}
+		return true, matchedLine(sample.AppLog, loc)
+	default:
+		v, ok := sample.Metrics[t.Metric]
+		if !ok || v <= t.Threshold {
+			return false, ""
+		}
+		return true, fmt.Sprintf("%s %.1f exceeds %g", t.Metric, v, t.Threshold)
+	}
+}
+
+// matchedLine returns the log line containing the match at loc, shortened
+// for the capture log.
+func matchedLine(data []byte, loc []int) string {
+	start := 0
+	if i := bytes.LastIndexByte(data[:loc[0]], '\n'); i >= 0 {
+		start = i + 1
+	}
+	end := len(data)
+	if i := bytes.IndexByte(data[loc[1]:], '\n'); i >= 0 {
+		end = loc[1] + i
+	}
+	line := strings.TrimSpace(string(data[start:end]))
+	if len(line) > 200 {
+		line = line[:200] + "..."
+	}
+	return line
+}
+
+// maxGCPause returns the longest pause in ms of the GC log lines in data.
+func maxGCPause(data []byte) (float64, bool) {
+	var longest float64
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, p := range gcPausePatterns {
+			m := p.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			v, err := strconv.ParseFloat(m[1], 64)
+			if err != nil {
+				continue
+			}
+			if v*p.scale > longest || !found {
+				longest = v * p.scale
+			}
+			found = true
+			break
+		}
+	}
+	return longest, found
+}
@@ -0,0 +1,176 @@
+package m3
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTriggerEngine(triggers config.Triggers, maxPerHour int) (*TriggerEngine, *time.Time) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	e := NewTriggerEngine(triggers, maxPerHour)
+	e.now = func() time.Time { return now }
+	return e, &now
+}
+
+func metricSample(metric string, v float64) TriggerSample {
+	return TriggerSample{Metrics: map[string]float64{metric: v}}
+}
+
+func TestTriggerEngine_Cycles(t *testing.T) {
+	e, _ := newTestTriggerEngine(config.Triggers{
+		{Name: "high-cpu", Metric: "cpu", Threshold: 90, Cycles: 3},
+	}, 0)
+
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("cpu", 95)))
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("cpu", 95)))
+	// A cycle below the threshold starts the count over.
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("cpu", 50)))
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("cpu", 95)))
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("cpu", 95)))
+
+	firings := e.Evaluate(1, "app", metricSample("cpu", 95))
+	require.Len(t, firings, 1)
+	assert.Equal(t, "high-cpu", firings[0].Trigger)
+	assert.Equal(t, "cpu 95.0 exceeds 90", firings[0].Observed)
+
+	// A metric that couldn't be measured doesn't hold.
+	assert.Empty(t, e.Evaluate(2, "app", TriggerSample{}))
+}
+
+func TestTriggerEngine_CooldownAndRateLimit(t *testing.T) {
+	e, now := newTestTriggerEngine(config.Triggers{
+		{Name: "rss", Metric: "rss", Threshold: 1024, Cooldown: config.Duration(10 * time.Minute)},
+	}, 2)
+
+	admitted := e.Admit(e.Evaluate(1, "app", metricSample("rss", 2048)))
+	assert.Contains(t, admitted, 1)
+
+	// Still above the threshold, but in the cooldown.
+	*now = now.Add(5 * time.Minute)
+	assert.Empty(t, e.Evaluate(1, "app", metricSample("rss", 2048)))
+
+	*now = now.Add(6 * time.Minute)
+	admitted = e.Admit(e.Evaluate(1, "app", metricSample("rss", 2048)))
+	assert.Contains(t, admitted, 1)
+
+	// Two captures in the last hour reached the limit.
+	admitted = e.Admit(e.Evaluate(2, "app", metricSample("rss", 2048)))
+	assert.Empty(t, admitted)
+
+	// The suppressed trigger fires once the first capture left the window.
+	*now = now.Add(50 * time.Minute)
+	admitted = e.Admit(e.Evaluate(2, "app", metricSample("rss", 2048)))
+	assert.Contains(t, admitted, 2)
+}
+
+func TestTriggerEngine_OneCapturePerProcess(t *testing.T) {
+	e, _ := newTestTriggerEngine(config.Triggers{
+		{Name: "threads", Metric: "threads", Threshold: 500},
+		{Name: "fds", Metric: "fds", Threshold: 1000},
+	}, 0)
+
+	firings := e.Evaluate(1, "app", TriggerSample{Metrics: map[string]float64{"threads": 800, "fds": 4000}})
+	require.Len(t, firings, 2)
+
+	admitted := e.Admit(firings)
+	assert.Len(t, admitted, 1)
+	assert.Len(t, admitted[1], 2)
+	assert.Len(t, e.captures, 1)
+}
+
+func TestTriggerEngine_AppNameHealthCheckAndAppLog(t *testing.T) {
+	e, _ := newTestTriggerEngine(config.Triggers{
+		{Name: "unhealthy", AppName: "orders", Metric: "healthCheck", Cycles: 2},
+		{Name: "oom", Metric: "appLog", Pattern: `OutOfMemoryError`},
+		{Name: "bad", Metric: "appLog", Pattern: `(`},
+		{Name: "unknown", Metric: "latency"},
+	}, 0)
+	require.Len(t, e.triggers, 2)
+
+	failed := true
+	sample := TriggerSample{HealthCheckFailed: &failed}
+	assert.Empty(t, e.Evaluate(1, "billing", sample))
+	assert.Empty(t, e.Evaluate(1, "billing", sample))
+	assert.Empty(t, e.Evaluate(1, "orders", sample))
+	firings := e.Evaluate(1, "orders", sample)
+	require.Len(t, firings, 1)
+	assert.Equal(t, "unhealthy", firings[0].Trigger)
+
+	firings = e.Evaluate(2, "billing", TriggerSample{AppLog: []byte("INFO started\nERROR java.lang.OutOfMemoryError: Java heap space\nINFO next\n")})
+	require.Len(t, firings, 1)
+	assert.Equal(t, "ERROR java.lang.OutOfMemoryError: Java heap space", firings[0].Observed)
+}
+
+func TestTriggerEngine_CollectTailsLogs(t *testing.T) {
+	dir := t.TempDir()
+	gcLog := filepath.Join(dir, "gc.log")
+	appLog := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(gcLog, []byte("[0.100s][info][gc] GC(0) Pause Young (Normal) (G1 Evacuation Pause) 24M->4M(256M) 950.000ms\n"), 0o644))
+	require.NoError(t, os.WriteFile(appLog, []byte("OutOfMemoryError before the agent started\n"), 0o644))
+
+	e, _ := newTestTriggerEngine(config.Triggers{
+		{Name: "gc", Metric: "gcPause", Threshold: 500},
+		{Name: "oom", Metric: "appLog", Pattern: `OutOfMemoryError`},
+	}, 0)
+
+	// The first cycle only records where the logs end.
+	sample := e.Collect(1, "app", gcLog, config.AppLogs{config.AppLog(filepath.Join(dir, "*.log"))}, nil)
+	assert.Empty(t, e.Evaluate(1, "app", sample))
+
+	appendFile(t, gcLog, "[5.000s][info][gc] GC(1) Pause Young (Normal) (G1 Evacuation Pause) 30M->5M(256M) 12.500ms\n"+
+		"[6.000s][info][gc] GC(2) Pause Full (G1 Compaction Pause) 200M->150M(256M) 812.250ms\n")
+	appendFile(t, appLog, "java.lang.OutOfMemoryError: Metaspace\n")
+
+	sample = e.Collect(1, "app", gcLog, config.AppLogs{config.AppLog(appLog)}, nil)
+	assert.Equal(t, 812.25, sample.Metrics["gcPause"])
+	assert.Equal(t, "java.lang.OutOfMemoryError: Metaspace\n", string(sample.AppLog))
+	assert.Len(t, e.Evaluate(1, "app", sample), 2)
+
+	// Nothing new since the previous cycle.
+	sample = e.Collect(1, "app", gcLog, config.AppLogs{config.AppLog(appLog)}, nil)
+	assert.NotContains(t, sample.Metrics, "gcPause")
+	assert.Empty(t, sample.AppLog)
+}
+
+func TestMaxGCPause(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   string
+		pause float64
+		found bool
+	}{
+		{"unified", "[2.5s][info][gc] GC(3) Pause Young (Normal) (G1 Evacuation Pause) 24M->4M(256M) 3.456ms\n", 3.456, true},
+		{"jdk8", "2026-10-19T12:00:00.000+0000: [GC (Allocation Failure) [PSYoungGen: 1024K->512K(2048K)] 1024K->600K(8192K), 0.0123 secs] [Times: user=0.02 sys=0.00, real=0.25 secs]\n", 250, true},
+		{"nodejs", "[4711:0x5e1e8a0]   120 ms: Mark-Compact 190.5 (200.2) -> 150.1 (202.0) MB, 42.3 / 0.0 ms  (average mu = 0.9)\n", 42.3, true},
+		{"no pauses", "[0.010s][info][gc] Using G1\n", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pause, found := maxGCPause([]byte(tt.log))
+			assert.Equal(t, tt.found, found)
+			assert.InDelta(t, tt.pause, pause, 0.0001)
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	assert.Equal(t, "env:prod,trigger:oom", mergeTags("env:prod,", "trigger:oom"))
+	assert.Equal(t, "trigger:oom", mergeTags("", "trigger:oom,"))
+	assert.Equal(t, "env:prod", mergeTags("env:prod", ""))
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+}
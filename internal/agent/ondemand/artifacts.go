@@ -0,0 +1,61 @@
+package ondemand
+
+import "slices"
+
+// Artifacts are the names CaptureOptions.Artifacts selects the captures of
+// FullCapture by. The meta info, manifest and agent log are always sent.
+var Artifacts = []string{
+	"gc",
+	"threadDump",
+	"hdsub",
+	"heapDump",
+	"openj9Dumps",
+	"jvmAudit",
+	"cpuProfile",
+	"nodeDiagnostics",
+	"netstat",
+	"netConnections",
+	"top",
+	"vmstat",
+	"iostat",
+	"cgroup",
+	"psi",
+	"proc",
+	"ps",
+	"dmesg",
+	"journal",
+	"disk",
+	"ping",
+	"probes",
+	"healthCheck",
+	"kernel",
+	"kernelAudit",
+	"kubernetes",
+	"containerLogs",
+	"appLogs",
+	"extendedData",
+	"customCommands",
+}
+
+// IsArtifact reports whether name is one of Artifacts.
+func IsArtifact(name string) bool {
+	return slices.Contains(Artifacts, name)
+}
+
+// artifactSet is the selection of a capture; nil selects every artifact.
+type artifactSet map[string]bool
+
+func newArtifactSet(opts []CaptureOptions) artifactSet {
+	if len(opts) == 0 || len(opts[0].Artifacts) == 0 {
+		return nil
+	}
+	s := make(artifactSet)
+	for _, name := range opts[0].Artifacts {
+		s[name] = true
+	}
+	return s
+}
+
+func (s artifactSet) includes(name string) bool {
+	return s == nil || s[name]
+}
@@ -40,6 +40,9 @@ var Wg sync.WaitGroup
 // additional information to pass into FullCapture.
 type CaptureOptions struct {
 	DotnetAsyncGCPaths map[int]string // pid → absolute path to accumulated async GC log
+	// Artifacts restricts the capture to a subset of Artifacts; empty
+	// captures everything.
+	Artifacts []string
 }
 
 func ProcessPids(pids []int, pid2Name map[int]string, hd bool, tags string, timestamps []string, opts ...CaptureOptions) (rUrls []string, err error) {
@@ -288,6 +291,9 @@ Ignored errors: %v
 	var gc chan capture.Result
 	var threadDump chan capture.Result
 	var hdsubLog chan capture.Result
+	var openJ9Dumps chan capture.Result
+	var capJVMAudit *capture.JVMAudit
+	var jvmAudit chan capture.Result
 	var nodeCPUProfile chan capture.Result
 	// nodeExtraCaptures collects the Node.js artifacts that don't map onto the
 	// shared gc/threadDump/hdsub/cpuprofile channels.
@@ -297,8 +303,22 @@ Ignored errors: %v
 	}
 	var nodeExtraCaptures []nodeNamedCapture
 
+	// manifest collects notes from capture tasks on how their artifacts were produced.
+	manifest := capture.NewManifest()
+
 	appRuntime := config.GetAppRuntime(pid)
 
+	// goArtifact starts a capture task unless the caller selected a subset
+	// of the artifacts without it.
+	selected := newArtifactSet(opts)
+	goArtifact := func(artifact string, fn func(endpoint string, c chan capture.Result), wait ...capture.Task) chan capture.Result {
+		if !selected.includes(artifact) {
+			logger.Log("Skipping %s, it is not in the selected artifacts", artifact)
+			return nil
+		}
+		return goCapture(endpoint, fn, wait...)
+	}
+
 	switch appRuntime {
 	case "dotnet":
 		// ------------------------------------------------------------------------------
@@ -316,15 +336,15 @@ Ignored errors: %v
 				dotnetGC.AsyncLogPath = asyncPath
 			}
 		}
-		gc = goCapture(endpoint, capture.WrapRun(dotnetGC))
+		gc = goArtifact("gc", capture.WrapRun(dotnetGC))
 
 		// Capture .NET heap statistics
-		hdsubLog = goCapture(endpoint, capture.WrapRun(&capture.DotnetHeap{
+		hdsubLog = goArtifact("hdsub", capture.WrapRun(&capture.DotnetHeap{
 			Pid: pid,
 		}))
 
 		// Capture .NET thread dump
-		threadDump = goCapture(endpoint, capture.WrapRun(&capture.DotnetThread{
+		threadDump = goArtifact("threadDump", capture.WrapRun(&capture.DotnetThread{
 			Pid: pid,
 		}))
 	case "nodejs":
@@ -342,46 +362,47 @@ Ignored errors: %v
 		}
 
 		// GC log (continuous split, or on-demand dumpGC fallback).
-		gc = goCapture(endpoint, capture.WrapRun(&capture.NodeGC{
+		gc = goArtifact("gc", capture.WrapRun(&capture.NodeGC{
 			Pid: pid,
 			Ctx: nodeCtx,
 		}))
 
 		// Process overview.
-		nodeExtraCaptures = append(nodeExtraCaptures, nodeNamedCapture{"PROCESS OVERVIEW", goCapture(endpoint, capture.WrapRun(&capture.NodeProcessOverview{
+		nodeExtraCaptures = append(nodeExtraCaptures, nodeNamedCapture{"PROCESS OVERVIEW", goArtifact("nodeDiagnostics", capture.WrapRun(&capture.NodeProcessOverview{
 			Pid: pid,
 			Ctx: nodeCtx,
 		}))})
 
 		// Heap summary (heap substitute).
-		hdsubLog = goCapture(endpoint, capture.WrapRun(&capture.NodeHeapSummary{
+		hdsubLog = goArtifact("hdsub", capture.WrapRun(&capture.NodeHeapSummary{
 			Pid: pid,
 			Ctx: nodeCtx,
 		}))
 
 		// CPU profile (hook-only).
-		nodeCPUProfile = goCapture(endpoint, capture.WrapRun(&capture.NodeCPUProfile{
+		nodeCPUProfile = goArtifact("cpuProfile", capture.WrapRun(&capture.NodeCPUProfile{
 			Pid: pid,
 			Ctx: nodeCtx,
 		}))
 
 		// Diagnostic Report page artifacts (hook-only).
 		nodeExtraCaptures = append(nodeExtraCaptures,
-			nodeNamedCapture{"EVENT LOOP LAG", goCapture(endpoint, capture.WrapRun(&capture.NodeEventLoopLag{Pid: pid, Ctx: nodeCtx}))},
-			nodeNamedCapture{"UNHANDLED REJECTIONS", goCapture(endpoint, capture.WrapRun(&capture.NodeUnhandledRejections{Pid: pid, Ctx: nodeCtx}))},
-			nodeNamedCapture{"MODULE INVENTORY", goCapture(endpoint, capture.WrapRun(&capture.NodeModuleInventory{Pid: pid, Ctx: nodeCtx}))},
-			nodeNamedCapture{"HANDLE GROWTH", goCapture(endpoint, capture.WrapRun(&capture.NodeHandleGrowth{Pid: pid, Ctx: nodeCtx}))},
+			nodeNamedCapture{"EVENT LOOP LAG", goArtifact("nodeDiagnostics", capture.WrapRun(&capture.NodeEventLoopLag{Pid: pid, Ctx: nodeCtx}))},
+			nodeNamedCapture{"UNHANDLED REJECTIONS", goArtifact("nodeDiagnostics", capture.WrapRun(&capture.NodeUnhandledRejections{Pid: pid, Ctx: nodeCtx}))},
+			nodeNamedCapture{"MODULE INVENTORY", goArtifact("nodeDiagnostics", capture.WrapRun(&capture.NodeModuleInventory{Pid: pid, Ctx: nodeCtx}))},
+			nodeNamedCapture{"HANDLE GROWTH", goArtifact("nodeDiagnostics", capture.WrapRun(&capture.NodeHandleGrowth{Pid: pid, Ctx: nodeCtx}))},
 		)
 	default:
 		// ------------------------------------------------------------------------------
 		//   				Java runtime captures (default)
 		// ------------------------------------------------------------------------------
 		// Capture gc
-		gc = goCapture(endpoint, capture.WrapRun(&capture.GC{
+		gc = goArtifact("gc", capture.WrapRun(&capture.GC{
 			Pid:      pid,
 			JavaHome: config.GlobalConfig.JavaHomePath,
 			DockerID: dockerID,
 			GCPath:   gcPath,
+			Manifest: manifest,
 		}))
 
 		// Capture thread dumps
@@ -390,22 +411,49 @@ Ignored errors: %v
 			TdPath:            tdPath,
 			JavaHome:          config.GlobalConfig.JavaHomePath,
 			TdCaptureDuration: config.GlobalConfig.TDCaptureDuration.Duration(),
+			JSONDump:          true,
+			Manifest:          manifest,
 		}
-		threadDump = goCapture(endpoint, capture.WrapRun(capThreadDump))
+		threadDump = goArtifact("threadDump", capture.WrapRun(capThreadDump))
 
 		// Capture hdsub log
-		hdsubLog = goCapture(endpoint, capture.WrapRun(&capture.HDSub{
+		hdsubLog = goArtifact("hdsub", capture.WrapRun(&capture.HDSub{
 			Pid:      pid,
 			JavaHome: config.GlobalConfig.JavaHomePath,
 		}))
+
+		// Capture extra OpenJ9 dumps (snap, system) when requested
+		if pid > 0 && config.GlobalConfig.OpenJ9Dumps != "" && capture.IsOpenJ9(pid) {
+			openJ9Dumps = goArtifact("openj9Dumps", capture.WrapRun(&capture.OpenJ9Dumps{
+				Pid:      pid,
+				JavaHome: config.GlobalConfig.JavaHomePath,
+			}))
+		}
+
+		// Audit the JVM configuration against the container and kernel limits
+		if pid > 0 {
+			capJVMAudit = &capture.JVMAudit{
+				Pid:      pid,
+				JavaHome: config.GlobalConfig.JavaHomePath,
+				GCPath:   gcPath,
+			}
+			jvmAudit = goArtifact("jvmAudit", capture.WrapRun(capJVMAudit))
+		}
 	}
 	var capNetStat *capture.NetStat
 	var netStat chan capture.Result
+	var netConnections chan capture.Result
 	var capTop *capture.Top
 	var top chan capture.Result
 	var capVMStat *capture.VMStat
 	var vmstat chan capture.Result
+	var capIOStat *capture.IOStat
+	var iostat chan capture.Result
+	var cgroupStats chan capture.Result
+	var psi chan capture.Result
+	var procSnapshot chan capture.Result
 	var dmesg chan capture.Result
+	var journal chan capture.Result
 	var capPS *capture.PS
 	var ps chan capture.Result
 	var disk chan capture.Result
@@ -415,7 +463,12 @@ Ignored errors: %v
 		// ------------------------------------------------------------------------------
 		//  Collect the first netstat: date at the top, data, and then a blank line
 		capNetStat = &capture.NetStat{}
-		netStat = goCapture(endpoint, capture.WrapRun(capNetStat))
+		netStat = goArtifact("netstat", capture.WrapRun(capNetStat))
+
+		// Analyze the connections of the process itself over the capture window
+		if runtime.GOOS == "linux" {
+			netConnections = goArtifact("netConnections", capture.WrapRun(&capture.NetConnections{Pid: pid}))
+		}
 
 		// ------------------------------------------------------------------------------
 		//                   Capture top
@@ -423,7 +476,7 @@ Ignored errors: %v
 		//  It runs in the background so that other tasks can be completed while this runs.
 		logger.Log("Starting collection of top data...")
 		capTop = &capture.Top{}
-		top = goCapture(endpoint, capture.WrapRun(capTop))
+		top = goArtifact("top", capture.WrapRun(capTop))
 		logger.Log("Collection of top data started.")
 
 		// ------------------------------------------------------------------------------
@@ -432,23 +485,68 @@ Ignored errors: %v
 		//  It runs in the background so that other tasks can be completed while this runs.
 		logger.Log("Starting collection of vmstat data...")
 		capVMStat = &capture.VMStat{}
-		vmstat = goCapture(endpoint, capture.WrapRun(capVMStat))
+		vmstat = goArtifact("vmstat", capture.WrapRun(capVMStat))
 		logger.Log("Collection of vmstat data started.")
 
+		// ------------------------------------------------------------------------------
+		//                   Capture iostat
+		// ------------------------------------------------------------------------------
+		//  Sampled natively from /proc/diskstats alongside vmstat, and stopped with it.
+		if runtime.GOOS == "linux" {
+			logger.Log("Starting collection of iostat data...")
+			capIOStat = &capture.IOStat{}
+			iostat = goArtifact("iostat", capture.WrapRun(capIOStat))
+		}
+
+		// ------------------------------------------------------------------------------
+		//                   Capture cgroup stats
+		// ------------------------------------------------------------------------------
+		//  Host-level top and vmstat are misleading for containers, so sample the
+		//  container's own cgroup over the same window.
+		if runtime.GOOS == "linux" {
+			if cg, err := capture.ResolveCgroup(pid); err == nil && (dockerID != "" || cg.IsContainer()) {
+				logger.Log("Starting collection of cgroup stats...")
+				cgroupStats = goArtifact("cgroup", capture.WrapRun(&capture.CgroupStats{Pid: pid}))
+			}
+		}
+
+		// ------------------------------------------------------------------------------
+		//                   Capture pressure stall information
+		// ------------------------------------------------------------------------------
+		if runtime.GOOS == "linux" {
+			logger.Log("Starting collection of PSI data...")
+			psi = goArtifact("psi", capture.WrapRun(&capture.PSI{Pid: pid}))
+		}
+
+		// ------------------------------------------------------------------------------
+		//                   Capture /proc snapshot of the process
+		// ------------------------------------------------------------------------------
+		if runtime.GOOS == "linux" {
+			procSnapshot = goArtifact("proc", capture.WrapRun(&capture.ProcSnapshot{Pid: pid}))
+		}
+
 		logger.Log("Collecting ps snapshot...")
 		capPS = capture.NewPS()
-		ps = goCapture(endpoint, capture.WrapRun(capPS))
+		ps = goArtifact("ps", capture.WrapRun(capPS))
 		logger.Log("Collected ps snapshot.")
 
 		// ------------------------------------------------------------------------------
 		//  				Capture dmesg
 		// ------------------------------------------------------------------------------
 		logger.Log("Collecting other data.  This may take a few moments...")
-		dmesg = goCapture(endpoint, capture.WrapRun(&capture.DMesg{}), capVMStat)
+		dmesg = goArtifact("dmesg", capture.WrapRun(&capture.DMesg{Pid: pid, Window: config.GlobalConfig.DMesgWindow.Duration()}), capVMStat)
+
+		// ------------------------------------------------------------------------------
+		//  				Capture systemd journal
+		// ------------------------------------------------------------------------------
+		//  Services often log to journald rather than to a file app log discovery finds.
+		if runtime.GOOS == "linux" {
+			journal = goArtifact("journal", capture.WrapRun(&capture.Journal{Pid: pid, Window: config.GlobalConfig.JournalWindow.Duration()}))
+		}
 		// ------------------------------------------------------------------------------
 		//  				Capture Disk Usage
 		// ------------------------------------------------------------------------------
-		disk = goCapture(endpoint, capture.WrapRun(&capture.Disk{}))
+		disk = goArtifact("disk", capture.WrapRun(&capture.Disk{}))
 
 		logger.Log("Collected other data.")
 	}
@@ -456,12 +554,56 @@ Ignored errors: %v
 	// ------------------------------------------------------------------------------
 	//   				Capture ping
 	// ------------------------------------------------------------------------------
-	ping := goCapture(endpoint, capture.WrapRun(&capture.Ping{Host: config.GlobalConfig.PingHost}))
+	ping := goArtifact("ping", capture.WrapRun(&capture.Ping{Host: config.GlobalConfig.PingHost}))
+
+	// ------------------------------------------------------------------------------
+	//   				Capture dependency probes
+	// ------------------------------------------------------------------------------
+	var probes chan capture.Result
+	if len(config.GlobalConfig.Probes) > 0 {
+		probes = goArtifact("probes", capture.WrapRun(&capture.Probes{Cfg: config.GlobalConfig.Probes}))
+	}
+
+	// ------------------------------------------------------------------------------
+	//   				Capture health check
+	// ------------------------------------------------------------------------------
+	var healthCheck chan capture.Result
+	if healthCheckCfg, ok := config.GlobalConfig.HealthChecks[appName]; ok {
+		healthCheck = goArtifact("healthCheck", capture.WrapRun(&capture.HealthCheck{AppName: appName, Cfg: healthCheckCfg}))
+	}
 
 	// ------------------------------------------------------------------------------
 	//   				Capture kernel params
 	// ------------------------------------------------------------------------------
-	kernel := goCapture(endpoint, capture.WrapRun(&capture.Kernel{}))
+	kernel := goArtifact("kernel", capture.WrapRun(&capture.Kernel{}))
+
+	// Compare the kernel tuning and the ulimits of the process with the
+	// baseline of its runtime
+	var capKernelAudit *capture.KernelAudit
+	var kernelAudit chan capture.Result
+	if runtime.GOOS == "linux" {
+		capKernelAudit = &capture.KernelAudit{Pid: pid, Runtime: appRuntime}
+		kernelAudit = goArtifact("kernelAudit", capture.WrapRun(capKernelAudit))
+	}
+
+	// ------------------------------------------------------------------------------
+	//   				Capture Kubernetes context
+	// ------------------------------------------------------------------------------
+	//  The spec, statuses and events of the pod, its node and its workload.
+	var kubernetesContext chan capture.Result
+	if config.GlobalConfig.Kubernetes {
+		kubernetesContext = goArtifact("kubernetes", capture.WrapRun(&capture.KubernetesContext{}))
+	}
+
+	// ------------------------------------------------------------------------------
+	//   				Capture container logs
+	// ------------------------------------------------------------------------------
+	//  Apps logging to stdout have no file for the app log captures to find, and
+	//  the log of the previous instance tells why a container restarted.
+	var containerLogs chan capture.Result
+	if config.GlobalConfig.Kubernetes && config.GlobalConfig.AppLogLineCount != 0 {
+		containerLogs = goArtifact("containerLogs", capture.WrapRun(&capture.ContainerLogs{LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration()}))
+	}
 
 	useGlobalConfigAppLogs := false
 	// ------------------------------------------------------------------------------
@@ -470,7 +612,7 @@ Ignored errors: %v
 	var appLog chan capture.Result
 	if len(config.GlobalConfig.AppLog) > 0 && config.GlobalConfig.AppLogLineCount != 0 {
 		configAppLogs := config.AppLogs{config.AppLog(config.GlobalConfig.AppLog)}
-		appLog = goCapture(endpoint, capture.WrapRun(&capture.AppLog{Paths: configAppLogs, LineLimit: config.GlobalConfig.AppLogLineCount}))
+		appLog = goArtifact("appLogs", capture.WrapRun(&capture.AppLog{Paths: configAppLogs, LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration(), Exceptions: config.GlobalConfig.AppLogExceptions}))
 		useGlobalConfigAppLogs = true
 	}
 
@@ -506,7 +648,7 @@ Falling back to capture all configured appLogs without appName filtering.`)
 					allAppLogs = append(allAppLogs, config.AppLog(logPath))
 				}
 
-				appLogs = goCapture(endpoint, capture.WrapRun(&capture.AppLog{Paths: allAppLogs, LineLimit: config.GlobalConfig.AppLogLineCount}))
+				appLogs = goArtifact("appLogs", capture.WrapRun(&capture.AppLog{Paths: allAppLogs, LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration(), Exceptions: config.GlobalConfig.AppLogExceptions}))
 				useGlobalConfigAppLogs = true
 			} else {
 				// If any of the appLogs contain '$', choose only the matched appName
@@ -522,12 +664,12 @@ Falling back to capture all configured appLogs without appName filtering.`)
 				}
 
 				if len(appLogsMatchingAppName) > 0 {
-					appLogs = goCapture(endpoint, capture.WrapRun(&capture.AppLog{Paths: appLogsMatchingAppName, LineLimit: config.GlobalConfig.AppLogLineCount}))
+					appLogs = goArtifact("appLogs", capture.WrapRun(&capture.AppLog{Paths: appLogsMatchingAppName, LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration(), Exceptions: config.GlobalConfig.AppLogExceptions}))
 					useGlobalConfigAppLogs = true
 				}
 			}
 		} else {
-			appLogs = goCapture(endpoint, capture.WrapRun(&capture.AppLog{Paths: config.GlobalConfig.AppLogs, LineLimit: config.GlobalConfig.AppLogLineCount}))
+			appLogs = goArtifact("appLogs", capture.WrapRun(&capture.AppLog{Paths: config.GlobalConfig.AppLogs, LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration(), Exceptions: config.GlobalConfig.AppLogExceptions}))
 			useGlobalConfigAppLogs = true
 		}
 	}
@@ -573,7 +715,7 @@ Falling back to capture all configured appLogs without appName filtering.`)
 			}
 		}
 
-		appLogs = goCapture(endpoint, capture.WrapRun(&capture.AppLog{Paths: paths, LineLimit: config.GlobalConfig.AppLogLineCount}))
+		appLogs = goArtifact("appLogs", capture.WrapRun(&capture.AppLog{Paths: paths, LineLimit: config.GlobalConfig.AppLogLineCount, Window: config.GlobalConfig.AppLogWindow.Duration(), Exceptions: config.GlobalConfig.AppLogExceptions}))
 	}
 
 	// ------------------------------------------------------------------------------
@@ -581,7 +723,7 @@ Falling back to capture all configured appLogs without appName filtering.`)
 	// ------------------------------------------------------------------------------
 	var extendedData chan capture.Result
 	if config.GlobalConfig.EdScript != "" && config.GlobalConfig.EdDataFolder != "" {
-		extendedData = goCapture(endpoint, capture.WrapRun(&capture.ExtendedData{Script: config.GlobalConfig.EdScript, DataFolder: config.GlobalConfig.EdDataFolder}))
+		extendedData = goArtifact("extendedData", capture.WrapRun(&capture.ExtendedData{Script: config.GlobalConfig.EdScript, DataFolder: config.GlobalConfig.EdDataFolder}))
 	}
 
 	// stop started tasks
@@ -591,6 +733,9 @@ Falling back to capture all configured appLogs without appName filtering.`)
 	if capVMStat != nil {
 		capVMStat.Kill()
 	}
+	if capIOStat != nil {
+		capIOStat.Kill()
+	}
 
 	// -------------------------------
 	//     Transmit Top data
@@ -633,6 +778,21 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit process connections
+	// -------------------------------
+	if netConnections != nil {
+		logger.Log("Reading result from netConnections channel")
+		result := <-netConnections
+		logger.Log(
+			`NET CONNECTIONS DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -663,6 +823,66 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit iostat data
+	// -------------------------------
+	if iostat != nil {
+		logger.Log("Reading result from iostat channel")
+		result := <-iostat
+		logger.Log(
+			`IOSTAT DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit cgroup stats
+	// -------------------------------
+	if cgroupStats != nil {
+		logger.Log("Reading result from cgroupStats channel")
+		result := <-cgroupStats
+		logger.Log(
+			`CGROUP STATS DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit PSI data
+	// -------------------------------
+	if psi != nil {
+		logger.Log("Reading result from psi channel")
+		result := <-psi
+		logger.Log(
+			`PSI DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit /proc snapshot
+	// -------------------------------
+	if procSnapshot != nil {
+		logger.Log("Reading result from procSnapshot channel")
+		result := <-procSnapshot
+		logger.Log(
+			`PROC SNAPSHOT DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -678,6 +898,21 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit journal
+	// -------------------------------
+	if journal != nil {
+		logger.Log("Reading result from journal channel")
+		result := <-journal
+		logger.Log(
+			`JOURNAL DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -711,6 +946,36 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit dependency probes
+	// -------------------------------
+	if probes != nil {
+		logger.Log("Reading result from probes channel")
+		result := <-probes
+		logger.Log(
+			`PROBES DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit health check
+	// -------------------------------
+	if healthCheck != nil {
+		logger.Log("Reading result from healthCheck channel")
+		result := <-healthCheck
+		logger.Log(
+			`HEALTH CHECK DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -773,6 +1038,52 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit kernel audit
+	// -------------------------------
+	if kernelAudit != nil {
+		logger.Log("Reading result from kernelAudit channel")
+		result := <-kernelAudit
+		logger.Log(
+			`KERNEL AUDIT DATA
+Findings: %s
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, capture.SummarizeAuditFindings(capKernelAudit.Findings), result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit Kubernetes context
+	// -------------------------------
+	if kubernetesContext != nil {
+		logger.Log("Reading result from kubernetes channel")
+		result := <-kubernetesContext
+		logger.Log(
+			`KUBERNETES CONTEXT DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit container logs
+	// -------------------------------
+	if containerLogs != nil {
+		logger.Log("Reading result from containerLogs channel")
+		result := <-containerLogs
+		logger.Log(
+			`CONTAINER LOGS DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -797,6 +1108,39 @@ Resp: %s
 `, absTDPath, result.Ok, result.Msg)
 	}
 
+	// -------------------------------
+	//     Transmit OpenJ9 dumps
+	// -------------------------------
+	if openJ9Dumps != nil {
+		logger.Log("Reading result from openJ9Dumps channel")
+		result := <-openJ9Dumps
+		logger.Log(
+			`OPENJ9 DUMPS DATA
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit JVM audit
+	// -------------------------------
+	var auditFindings []capture.AuditFinding
+	if jvmAudit != nil {
+		logger.Log("Reading result from jvmAudit channel")
+		result := <-jvmAudit
+		auditFindings = capJVMAudit.Findings
+		logger.Log(
+			`JVM AUDIT DATA
+Findings: %s
+Is transmission completed: %t
+Resp: %s
+
+--------------------------------
+`, capture.SummarizeAuditFindings(auditFindings), result.Ok, result.Msg)
+	}
+
 	// -------------------------------
 	//     Transmit Node.js CPU profile
 	// -------------------------------
@@ -833,7 +1177,7 @@ Resp: %s
 	// -------------------------------
 	//     Transmit Heap dump result (Java only)
 	// -------------------------------
-	if appRuntime != "dotnet" && appRuntime != "nodejs" {
+	if appRuntime != "dotnet" && appRuntime != "nodejs" && selected.includes("heapDump") {
 		ep := fmt.Sprintf("%s/yc-receiver-heap?%s", config.GlobalConfig.Server, parameters)
 		effectiveHd := hd && !config.GlobalConfig.MinimalTouch
 		if hd && config.GlobalConfig.MinimalTouch {
@@ -865,6 +1209,24 @@ Resp: %s
 Is transmission completed: %t
 Resp: %s
 
+--------------------------------
+`, result.Ok, result.Msg)
+	}
+
+	// -------------------------------
+	//     Transmit capture manifest
+	// -------------------------------
+	if manifest.Len() > 0 {
+		manifest.SetEndpoint(endpoint)
+		result, err := manifest.Run()
+		if err != nil {
+			result.Msg = fmt.Sprintf("capture manifest failed: %s", err.Error())
+		}
+		logger.Log(
+			`MANIFEST DATA
+Is transmission completed: %t
+Resp: %s
+
 --------------------------------
 `, result.Ok, result.Msg)
 	}
@@ -873,7 +1235,11 @@ Resp: %s
 	//  				Execute custom commands
 	// ------------------------------------------------------------------------------
 	logger.Log("Executing custom commands")
-	for i, command := range config.GlobalConfig.Commands {
+	customCommands := config.GlobalConfig.Commands
+	if !selected.includes("customCommands") {
+		customCommands = nil
+	}
+	for i, command := range customCommands {
 		customCmd := capture.Custom{
 			Index:     i,
 			UrlParams: string(command.UrlParams),
@@ -913,7 +1279,7 @@ Resp: %s
 
 		endTime := time.Now()
 		var result string
-		rUrl, result = printResult(true, endTime.Sub(startTime).String(), resp)
+		rUrl, result = printResult(true, endTime.Sub(startTime).String(), resp, auditFindings...)
 
 		// A big customer is relying on this stdout.
 		// They probably uses it with their own script / automation.
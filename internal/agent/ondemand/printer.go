@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"yc-agent/internal/capture"
 	"yc-agent/internal/config"
 
 	"github.com/pterm/pterm"
@@ -17,7 +18,9 @@ var col1 = []string{
 	"RunTime",
 }
 
-func printResult(success bool, runtime string, resp []byte) (reportUrl string, result string) {
+// printResult renders the capture summary table. Audit findings, if any, are
+// listed below the server response, most severe first.
+func printResult(success bool, runtime string, resp []byte, findings ...capture.AuditFinding) (reportUrl string, result string) {
 	m := make(map[string]string)
 	err := json.Unmarshal(resp, &m)
 	if err != nil {
@@ -55,6 +58,12 @@ func printResult(success bool, runtime string, resp []byte) (reportUrl string, r
 			d = append(d, []string{pterm.LightGreen(s), c})
 		}
 	}
+	if len(findings) > 0 {
+		d = append(d, []string{"JVM Audit", capture.SummarizeAuditFindings(findings)})
+		for _, f := range findings {
+			d = append(d, []string{auditSeverityColor(f.Severity), f.ID + ": " + f.Message})
+		}
+	}
 
 	srender, err := TablePrinter{
 		TablePrinter: pterm.DefaultTable.WithHasHeader(false).WithData(d),
@@ -67,6 +76,17 @@ func printResult(success bool, runtime string, resp []byte) (reportUrl string, r
 	return
 }
 
+func auditSeverityColor(severity string) string {
+	switch severity {
+	case capture.AuditSeverityCritical:
+		return pterm.LightRed(severity)
+	case capture.AuditSeverityWarning:
+		return pterm.LightYellow(severity)
+	default:
+		return severity
+	}
+}
+
 func format(width int, s string) (result []string) {
 	s = strings.TrimSpace(s)
 	if len(s) == 0 {
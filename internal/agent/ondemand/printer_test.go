@@ -3,6 +3,11 @@ package ondemand
 import (
 	"fmt"
 	"testing"
+
+	"yc-agent/internal/capture"
+
+	"github.com/pterm/pterm"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPrintResult(t *testing.T) {
@@ -14,3 +19,17 @@ func TestFormat(t *testing.T) {
 	s := "https://gceasy.io/yc-reader?ou=testCompany&de=1721802&app=yc&ts=2020-12-30T09-19-13&dt=td&apiKey=testCompany@e094a34e-c3eb-4c9a-8254-f0dd107245cc"
 	t.Log("\n", format(10, s))
 }
+
+func TestPrintResultWithAuditFindings(t *testing.T) {
+	s := `{"dashboardReportURL":"https://gceasy.io/yc-report.jsp?ou=testCompany&de=1721802&app=yc&ts=2020-12-30T09-19-13"}`
+	_, result := printResult(true, "2m10s", []byte(s),
+		capture.AuditFinding{ID: "heap-exceeds-container-limit", Severity: capture.AuditSeverityCritical, Message: "Max heap exceeds the container memory limit"},
+		capture.AuditFinding{ID: "gc-logging-disabled", Severity: capture.AuditSeverityWarning, Message: "GC logging is not enabled"},
+	)
+	result = pterm.RemoveColorFromString(result)
+
+	assert.Contains(t, result, "1 critical, 1 warning")
+	// Long rows wrap with the terminal width, so only the ids are checked.
+	assert.Contains(t, result, "heap-exceeds-container-limit:")
+	assert.Contains(t, result, "gc-logging-disabled:")
+}
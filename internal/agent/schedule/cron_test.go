@@ -0,0 +1,135 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 10,14 * * MON-FRI", false},
+		{"*/15 9-17 * * 1-5", false},
+		{"30 22 * * sun", false},
+		{"5/20 * 1,15 jan-jun *", false},
+		{"@daily", false},
+		{"0 0 * * 7", false},
+		{"0 24 * * *", true},
+		{"60 * * * *", true},
+		{"* * * *", true},
+		{"*/0 * * * *", true},
+		{"0 0 * * FOO", true},
+		{"0 10-5 * * *", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{
+			name:  "weekday peak hours",
+			expr:  "0 10,14 * * MON-FRI",
+			after: time.Date(2026, 10, 16, 14, 0, 0, 0, utc), // Friday 14:00
+			want:  time.Date(2026, 10, 19, 10, 0, 0, 0, utc), // Monday 10:00
+		},
+		{
+			name:  "steps",
+			expr:  "*/15 * * * *",
+			after: time.Date(2026, 10, 19, 9, 50, 30, 0, utc),
+			want:  time.Date(2026, 10, 19, 10, 0, 0, 0, utc),
+		},
+		{
+			name:  "day of month or day of week",
+			expr:  "0 0 13 * FRI",
+			after: time.Date(2026, 10, 10, 0, 0, 0, 0, utc),
+			want:  time.Date(2026, 10, 13, 0, 0, 0, 0, utc), // the 13th, a Tuesday
+		},
+		{
+			name:  "sunday as 7",
+			expr:  "30 22 * * 7",
+			after: time.Date(2026, 10, 19, 0, 0, 0, 0, utc),
+			want:  time.Date(2026, 10, 25, 22, 30, 0, 0, utc),
+		},
+		{
+			name:  "leap day",
+			expr:  "0 0 29 2 *",
+			after: time.Date(2026, 3, 1, 0, 0, 0, 0, utc),
+			want:  time.Date(2028, 2, 29, 0, 0, 0, 0, utc),
+		},
+		{
+			name:  "never",
+			expr:  "0 0 30 2 *",
+			after: time.Date(2026, 3, 1, 0, 0, 0, 0, utc),
+			want:  time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c.Next(tt.after, utc))
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	t.Run("wall clock time is kept across the change", func(t *testing.T) {
+		c, err := ParseCron("0 9 * * *")
+		require.NoError(t, err)
+
+		// 2026-03-08 is the spring forward day in New York.
+		next := c.Next(time.Date(2026, 3, 7, 9, 0, 0, 0, ny), ny)
+		assert.Equal(t, time.Date(2026, 3, 8, 9, 0, 0, 0, ny), next)
+		assert.Equal(t, 23*time.Hour, next.Sub(time.Date(2026, 3, 7, 9, 0, 0, 0, ny)))
+	})
+
+	t.Run("skipped time runs at the end of the gap", func(t *testing.T) {
+		c, err := ParseCron("30 2 * * *")
+		require.NoError(t, err)
+
+		next := c.Next(time.Date(2026, 3, 8, 0, 0, 0, 0, ny), ny)
+		assert.Equal(t, time.Date(2026, 3, 8, 3, 0, 0, 0, ny), next)
+
+		next = c.Next(next, ny)
+		assert.Equal(t, time.Date(2026, 3, 9, 2, 30, 0, 0, ny), next)
+	})
+
+	t.Run("repeated time runs once", func(t *testing.T) {
+		c, err := ParseCron("30 1 * * *")
+		require.NoError(t, err)
+
+		// 2026-11-01 is the fall back day; 01:30 happens twice.
+		first := c.Next(time.Date(2026, 11, 1, 0, 0, 0, 0, ny), ny)
+		assert.Equal(t, 1, first.Hour())
+		assert.Equal(t, 30, first.Minute())
+
+		next := c.Next(first, ny)
+		assert.Equal(t, 2, next.Day())
+		assert.Equal(t, 1, next.Hour())
+		assert.Equal(t, 30, next.Minute())
+	})
+}
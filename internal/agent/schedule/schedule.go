@@ -0,0 +1,231 @@
+// Package schedule runs full captures on cron schedules in the long-running
+// agent.
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yc-agent/internal/agent/ondemand"
+	"yc-agent/internal/capture"
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+
+	"github.com/thlib/go-timezone-local/tzlocal"
+)
+
+// CaptureFunc starts the full captures of pids; ondemand.ProcessPids in
+// the agent.
+type CaptureFunc func(pids []int, pid2Name map[int]string, hd bool, tags string, timestamps []string, opts ...ondemand.CaptureOptions) ([]string, error)
+
+// Scheduler runs the captures of the configured schedules at their cron
+// times, one at a time.
+type Scheduler struct {
+	entries  []*entry
+	location *time.Location
+	// lock is held while a capture runs, so it doesn't overlap with the
+	// captures of the M3 and API modes; they all change the working
+	// directory of the agent.
+	lock    sync.Locker
+	capture CaptureFunc
+	now     func() time.Time
+}
+
+type entry struct {
+	config.Schedule
+	cron *Cron
+}
+
+// New validates the schedules; invalid ones are logged and left out. The
+// schedules are evaluated in the zone of TimezoneID, or the zone of the
+// host when it isn't set.
+func New(schedules config.Schedules, lock sync.Locker, capture CaptureFunc) *Scheduler {
+	s := &Scheduler{
+		location: Location(config.GlobalConfig.TimezoneID),
+		lock:     lock,
+		capture:  capture,
+		now:      time.Now,
+	}
+
+	for i, sc := range schedules {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("schedule-%d", i+1)
+		}
+		cron, err := ParseCron(sc.Cron)
+		if err != nil {
+			logger.Log("WARNING: ignoring schedule %s: %v", sc.Name, err)
+			continue
+		}
+		if i := slices.IndexFunc(sc.Artifacts, func(a string) bool { return !ondemand.IsArtifact(a) }); i >= 0 {
+			logger.Log("WARNING: ignoring schedule %s: unknown artifact %q, should be one of %s",
+				sc.Name, sc.Artifacts[i], strings.Join(ondemand.Artifacts, ", "))
+			continue
+		}
+		s.entries = append(s.entries, &entry{Schedule: sc, cron: cron})
+	}
+
+	return s
+}
+
+// Location returns the zone schedules are evaluated in: the IANA zone id,
+// or the zone of the host when it is empty or unknown.
+func Location(timezoneID string) *time.Location {
+	if timezoneID == "" {
+		tz, err := tzlocal.RuntimeTZ()
+		if err != nil {
+			return time.Local
+		}
+		timezoneID = tz
+	}
+
+	loc, err := time.LoadLocation(timezoneID)
+	if err != nil {
+		logger.Log("WARNING: unknown time zone %q for schedules, using the zone of the host: %v", timezoneID, err)
+		return time.Local
+	}
+	return loc
+}
+
+// Run waits for the next cron time and runs the due schedules, until stop
+// is closed or no schedule has a next run. A run that is still busy when
+// the next cron time passes makes the schedule skip that time.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	if len(s.entries) == 0 {
+		return
+	}
+	logger.Log("Running %d schedules in time zone %s", len(s.entries), s.location)
+
+	for {
+		now := s.now()
+		at, due := s.next(now)
+		if len(due) == 0 {
+			logger.Log("WARNING: no schedule has a next run, stopping the scheduler")
+			return
+		}
+		logger.Log("Next scheduled capture: %s at %s", due[0].Name, at.Format(time.RFC3339))
+
+		timer := time.NewTimer(at.Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, e := range due {
+			s.runSchedule(e)
+		}
+	}
+}
+
+// next returns the earliest next run after now and the schedules due then.
+func (s *Scheduler) next(now time.Time) (time.Time, []*entry) {
+	var at time.Time
+	var due []*entry
+	for _, e := range s.entries {
+		t := e.cron.Next(now, s.location)
+		switch {
+		case t.IsZero():
+			continue
+		case at.IsZero() || t.Before(at):
+			at, due = t, []*entry{e}
+		case t.Equal(at):
+			due = append(due, e)
+		}
+	}
+	return at, due
+}
+
+func (s *Scheduler) runSchedule(e *entry) {
+	logger.Log("Running scheduled capture %s", e.Name)
+
+	tokens, excludeTokens := e.ProcessTokens, e.ExcludeProcessTokens
+	if len(tokens) == 0 {
+		tokens, excludeTokens = config.GlobalConfig.ProcessTokens, config.GlobalConfig.ExcludeProcessTokens
+	}
+	pid2Name, err := capture.GetProcessIds(tokens, excludeTokens)
+	if err != nil {
+		logger.Log("WARNING: schedule %s: failed to get PID cause %v", e.Name, err)
+		return
+	}
+	if len(pid2Name) == 0 {
+		logger.Log("WARNING: schedule %s: no PID includes ProcessTokens(%v) without ExcludeTokens(%v)", e.Name, tokens, excludeTokens)
+		return
+	}
+
+	pids := make([]int, 0, len(pid2Name))
+	for pid := range pid2Name {
+		pids = append(pids, pid)
+	}
+	slices.Sort(pids)
+
+	hd := config.GlobalConfig.HeapDump
+	if e.HeapDump != nil {
+		hd = *e.HeapDump
+	}
+	tags := joinTags(config.GlobalConfig.Tags, e.Tags, "schedule:"+e.Name)
+	opts := ondemand.CaptureOptions{Artifacts: e.Artifacts}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err = inCaptureDir(func() error {
+		_, err := s.capture(pids, pid2Name, hd, tags, nil, opts)
+		return err
+	})
+	if err != nil {
+		logger.Log("WARNING: scheduled capture %s failed, %s", e.Name, err)
+	}
+}
+
+// inCaptureDir runs fn in a capture directory of its own in M3 mode, where
+// FullCapture expects the caller to have created one, as M3App.RunSingle
+// does. Otherwise FullCapture creates it.
+func inCaptureDir(fn func() error) error {
+	if !config.GlobalConfig.M3 {
+		return fn()
+	}
+
+	captureDir := "yc-schedule-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if len(config.GlobalConfig.StoragePath) > 0 {
+		captureDir = filepath.Join(config.GlobalConfig.StoragePath, captureDir)
+	}
+	if err := os.Mkdir(captureDir, 0777); err != nil {
+		return err
+	}
+	if config.GlobalConfig.DeferDelete {
+		defer func() {
+			if err := os.RemoveAll(captureDir); err != nil {
+				logger.Log("WARNING: Can not remove the current directory: %s", err)
+			}
+		}()
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(captureDir); err != nil {
+		return err
+	}
+	defer os.Chdir(dir)
+
+	return fn()
+}
+
+// joinTags joins comma delimited tag lists, dropping empty ones.
+func joinTags(tags ...string) string {
+	var parts []string
+	for _, t := range tags {
+		if t = strings.Trim(t, ","); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,131 @@
+package schedule
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"yc-agent/internal/agent/ondemand"
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturedRun struct {
+	pids     []int
+	pid2Name map[int]string
+	hd       bool
+	tags     string
+	opts     []ondemand.CaptureOptions
+}
+
+// recordingLock counts how often it was held.
+type recordingLock struct {
+	sync.Mutex
+	held int
+}
+
+func (l *recordingLock) Lock() {
+	l.Mutex.Lock()
+	l.held++
+}
+
+func TestNew(t *testing.T) {
+	s := New(config.Schedules{
+		{Name: "peak", Cron: "0 10,14 * * MON-FRI"},
+		{Cron: "@daily", Artifacts: []string{"gc", "threadDump"}},
+		{Name: "bad-cron", Cron: "0 25 * * *"},
+		{Name: "bad-artifact", Cron: "@hourly", Artifacts: []string{"gc", "coredump"}},
+	}, &sync.Mutex{}, nil)
+
+	require.Len(t, s.entries, 2)
+	assert.Equal(t, "peak", s.entries[0].Name)
+	assert.Equal(t, "schedule-2", s.entries[1].Name)
+}
+
+func TestSchedulerNext(t *testing.T) {
+	s := New(config.Schedules{
+		{Name: "hourly", Cron: "@hourly"},
+		{Name: "batch", Cron: "0 22 * * *"},
+		{Name: "quarter", Cron: "*/15 * * * *"},
+	}, &sync.Mutex{}, nil)
+	s.location = time.UTC
+
+	at, due := s.next(time.Date(2026, 10, 19, 21, 50, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC), at)
+	require.Len(t, due, 3)
+
+	at, due = s.next(time.Date(2026, 10, 19, 22, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 19, 22, 15, 0, 0, time.UTC), at)
+	require.Len(t, due, 1)
+	assert.Equal(t, "quarter", due[0].Name)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep as the target process")
+	}
+
+	target := exec.Command("sleep", "4242.5")
+	require.NoError(t, target.Start())
+	defer func() {
+		target.Process.Kill()
+		target.Wait()
+	}()
+
+	oldTags, oldHeapDump := config.GlobalConfig.Tags, config.GlobalConfig.HeapDump
+	config.GlobalConfig.Tags = "env:prod"
+	config.GlobalConfig.HeapDump = true
+	defer func() {
+		config.GlobalConfig.Tags, config.GlobalConfig.HeapDump = oldTags, oldHeapDump
+	}()
+
+	stop := make(chan struct{})
+	var runs []capturedRun
+	lock := &recordingLock{}
+	noHeapDump := false
+
+	s := New(config.Schedules{{
+		Name:          "nightly-batch",
+		Cron:          "* * * * *",
+		ProcessTokens: config.ProcessTokens{"4242.5$batch"},
+		HeapDump:      &noHeapDump,
+		Tags:          "team:perf",
+		Artifacts:     []string{"gc", "threadDump", "top"},
+	}}, lock, func(pids []int, pid2Name map[int]string, hd bool, tags string, timestamps []string, opts ...ondemand.CaptureOptions) ([]string, error) {
+		runs = append(runs, capturedRun{pids: pids, pid2Name: pid2Name, hd: hd, tags: tags, opts: opts})
+		close(stop)
+		return nil, nil
+	})
+	// Just before a minute boundary, so the run is due right away.
+	s.now = func() time.Time { return time.Now().Truncate(time.Minute).Add(time.Minute - 10*time.Millisecond) }
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(stop)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("scheduler did not run the capture")
+	}
+
+	require.Len(t, runs, 1)
+	assert.Equal(t, []int{target.Process.Pid}, runs[0].pids)
+	assert.Equal(t, "batch", runs[0].pid2Name[target.Process.Pid])
+	assert.False(t, runs[0].hd)
+	assert.Equal(t, "env:prod,team:perf,schedule:nightly-batch", runs[0].tags)
+	require.Len(t, runs[0].opts, 1)
+	assert.Equal(t, []string{"gc", "threadDump", "top"}, runs[0].opts[0].Artifacts)
+	assert.Equal(t, 1, lock.held)
+}
+
+func TestJoinTags(t *testing.T) {
+	assert.Equal(t, "a,b,schedule:x", joinTags("a,", ",b", "schedule:x"))
+	assert.Equal(t, "schedule:x", joinTags("", "", "schedule:x"))
+}
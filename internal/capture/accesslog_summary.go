@@ -0,0 +1,603 @@
+package capture
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modes of the accessLogSummary option.
+const (
+	AccessLogSummaryOff  = "off"
+	AccessLogSummaryOn   = "on"
+	AccessLogSummaryOnly = "only"
+)
+
+// Units of the accessLogDurationUnit option.
+const (
+	AccessLogDurationMicros = "us"
+	AccessLogDurationMillis = "ms"
+)
+
+const (
+	// maxAccessLogLatencySamples bounds the latencies the percentiles of a
+	// window are computed from; beyond it a uniform sample is kept.
+	maxAccessLogLatencySamples = 100000
+	// maxAccessLogURLs bounds the distinct URL templates of a window; the
+	// requests of further ones are counted under accessLogOtherURL.
+	maxAccessLogURLs  = 2000
+	accessLogOtherURL = "(other)"
+	accessLogTopURLs  = 10
+)
+
+// accessLogFormatAliases are the named formats of Apache httpd, NGINX and
+// the Tomcat AccessLogValve.
+var accessLogFormatAliases = map[string]string{
+	"common":   `%h %l %u %t "%r" %>s %b`,
+	"clf":      `%h %l %u %t "%r" %>s %b`,
+	"combined": `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`,
+}
+
+// accessLogRecord is what the summary uses of an access log line.
+type accessLogRecord struct {
+	Method string
+	Path   string
+	Status int
+	// Latency is negative when the line has none.
+	Latency time.Duration
+}
+
+// accessLogParser parses the lines of one access log format.
+type accessLogParser interface {
+	parse(line []byte) (accessLogRecord, bool)
+}
+
+// newAccessLogParser returns the parser of format: a named format (common,
+// combined, json, envoy, alb), an Apache httpd or Tomcat AccessLogValve
+// pattern (%h %t "%r" %>s ...) or an NGINX log_format ($remote_addr ...).
+// durationUnit is the unit of %D: microseconds (the default), as Apache
+// httpd and Tomcat 10.1+ write it, or milliseconds, as older Tomcat does.
+func newAccessLogParser(format, durationUnit string) (accessLogParser, error) {
+	var unit time.Duration
+	switch durationUnit {
+	case "", AccessLogDurationMicros:
+		unit = time.Microsecond
+	case AccessLogDurationMillis:
+		unit = time.Millisecond
+	default:
+		return nil, fmt.Errorf("unsupported access log duration unit %q, expected us or ms", durationUnit)
+	}
+
+	format = strings.TrimSpace(format)
+	name := strings.ToLower(format)
+	if alias, ok := accessLogFormatAliases[name]; ok {
+		format = alias
+	}
+
+	switch {
+	case name == "json" || name == "envoy" || name == "alb":
+		return jsonAccessLogParser{}, nil
+	case strings.Contains(format, "%"):
+		return newPatternAccessLogParser(format, unit)
+	case strings.Contains(format, "$"):
+		return newNginxAccessLogParser(format)
+	}
+	return nil, fmt.Errorf("unsupported access log format %q", format)
+}
+
+// patternAccessLogParser parses lines with a regexp compiled from an Apache
+// httpd, Tomcat or NGINX format; groups names which field each group holds.
+type patternAccessLogParser struct {
+	re     *regexp.Regexp
+	groups []string
+	// durationUnit is the unit of a "duration" group.
+	durationUnit time.Duration
+}
+
+// apacheDirective matches %>s, %{Referer}i, %{ms}T and the like.
+var apacheDirective = regexp.MustCompile(`%[<>]?(?:\{([^}]*)\})?([a-zA-Z%])`)
+
+func newPatternAccessLogParser(format string, durationUnit time.Duration) (*patternAccessLogParser, error) {
+	p := &patternAccessLogParser{durationUnit: durationUnit}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, m := range apacheDirective.FindAllStringSubmatchIndex(format, -1) {
+		expr.WriteString(regexp.QuoteMeta(format[last:m[0]]))
+		last = m[1]
+
+		arg := ""
+		if m[2] >= 0 {
+			arg = format[m[2]:m[3]]
+		}
+		switch directive := format[m[4]:m[5]]; directive {
+		case "%":
+			expr.WriteString("%")
+			continue
+		case "t":
+			if arg == "" {
+				p.group(&expr, "", `\[[^\]]*\]`)
+				continue
+			}
+			p.group(&expr, "", `.*?`)
+		case "r":
+			p.group(&expr, "request", `(?:[^"\\]|\\.)*`)
+		case "m":
+			p.group(&expr, "method", `\S+`)
+		case "U":
+			p.group(&expr, "path", `\S+`)
+		case "s":
+			p.group(&expr, "status", `\d{3}|-`)
+		case "D":
+			p.group(&expr, "duration", `[\d.]+|-`)
+		case "T":
+			switch arg {
+			case "ms":
+				p.group(&expr, "ms", `[\d.]+|-`)
+			case "us":
+				p.group(&expr, "us", `[\d.]+|-`)
+			default:
+				p.group(&expr, "seconds", `[\d.]+|-`)
+			}
+		case "h", "a", "A", "l", "u", "v", "V", "p", "b", "B", "O", "I", "H", "q":
+			p.group(&expr, "", `\S*`)
+		default:
+			p.group(&expr, "", `.*?`)
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(format[last:]))
+	expr.WriteString("$")
+
+	return p.compile(expr.String(), format)
+}
+
+// nginxVariable matches $remote_addr, ${request_time} and the like.
+var nginxVariable = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+func newNginxAccessLogParser(format string) (*patternAccessLogParser, error) {
+	p := &patternAccessLogParser{}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, m := range nginxVariable.FindAllStringSubmatchIndex(format, -1) {
+		expr.WriteString(regexp.QuoteMeta(format[last:m[0]]))
+		last = m[1]
+
+		name := ""
+		if m[2] >= 0 {
+			name = format[m[2]:m[3]]
+		} else {
+			name = format[m[4]:m[5]]
+		}
+		switch name {
+		case "request":
+			p.group(&expr, "request", `(?:[^"\\]|\\.)*`)
+		case "request_method":
+			p.group(&expr, "method", `\S+`)
+		case "uri", "request_uri":
+			p.group(&expr, "path", `\S+`)
+		case "status":
+			p.group(&expr, "status", `\d{3}|-`)
+		case "request_time":
+			p.group(&expr, "seconds", `[\d.]+|-`)
+		case "time_local":
+			p.group(&expr, "", `[^\]]*`)
+		default:
+			p.group(&expr, "", `.*?`)
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(format[last:]))
+	expr.WriteString("$")
+
+	return p.compile(expr.String(), format)
+}
+
+func (p *patternAccessLogParser) group(expr *strings.Builder, name, re string) {
+	expr.WriteString("(" + re + ")")
+	p.groups = append(p.groups, name)
+}
+
+func (p *patternAccessLogParser) compile(expr, format string) (*patternAccessLogParser, error) {
+	if !slices.Contains(p.groups, "status") {
+		return nil, fmt.Errorf("access log format %q has no status", format)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("access log format %q: %w", format, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+func (p *patternAccessLogParser) parse(line []byte) (accessLogRecord, bool) {
+	m := p.re.FindSubmatch(line)
+	if m == nil {
+		return accessLogRecord{}, false
+	}
+
+	r := accessLogRecord{Latency: -1}
+	for i, name := range p.groups {
+		v := string(m[i+1])
+		switch name {
+		case "request":
+			r.Method, r.Path = splitRequestLine(v)
+		case "method":
+			r.Method = v
+		case "path":
+			r.Path = v
+		case "status":
+			r.Status, _ = strconv.Atoi(v)
+		case "duration":
+			r.Latency = parseLatency(v, p.durationUnit)
+		case "seconds":
+			r.Latency = parseLatency(v, time.Second)
+		case "ms":
+			r.Latency = parseLatency(v, time.Millisecond)
+		case "us":
+			r.Latency = parseLatency(v, time.Microsecond)
+		}
+	}
+	return r, r.Status > 0
+}
+
+// jsonAccessLogParser parses JSON access logs, e.g. of Envoy or AWS ALB
+// logs converted to JSON, by the usual names of their fields.
+type jsonAccessLogParser struct{}
+
+var (
+	jsonAccessLogStatusKeys = []string{"status", "response_code", "status_code", "elb_status_code", "statusCode"}
+	jsonAccessLogPathKeys   = []string{"path", "request_uri", "uri", "url", "request_path"}
+	jsonAccessLogMethodKeys = []string{"method", "request_method", "http_method"}
+	// jsonAccessLogLatencyKeys are tried in order with their unit.
+	jsonAccessLogLatencyKeys = []struct {
+		key  string
+		unit time.Duration
+	}{
+		{"duration", time.Millisecond},
+		{"duration_ms", time.Millisecond},
+		{"latency_ms", time.Millisecond},
+		{"response_time_ms", time.Millisecond},
+		{"request_time", time.Second},
+		{"latency", time.Second},
+	}
+	// albProcessingTimeKeys add up to the latency of an ALB request.
+	albProcessingTimeKeys = []string{"request_processing_time", "target_processing_time", "response_processing_time"}
+)
+
+func (jsonAccessLogParser) parse(line []byte) (accessLogRecord, bool) {
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return accessLogRecord{}, false
+	}
+
+	r := accessLogRecord{Latency: -1}
+	if v, ok := firstField(fields, jsonAccessLogStatusKeys); ok {
+		r.Status, _ = strconv.Atoi(v)
+	}
+	if v, ok := firstField(fields, jsonAccessLogMethodKeys); ok {
+		r.Method = v
+	}
+	if v, ok := firstField(fields, jsonAccessLogPathKeys); ok {
+		r.Path = v
+	}
+	// ALB logs the request line, with the full URL.
+	if v, ok := fields["request"].(string); ok && r.Path == "" {
+		r.Method, r.Path = splitRequestLine(v)
+	}
+
+	for _, k := range jsonAccessLogLatencyKeys {
+		if v, ok := firstField(fields, []string{k.key}); ok {
+			r.Latency = parseLatency(v, k.unit)
+			break
+		}
+	}
+	if r.Latency < 0 {
+		var total time.Duration
+		for _, key := range albProcessingTimeKeys {
+			v, ok := firstField(fields, []string{key})
+			if !ok {
+				total = -1
+				break
+			}
+			// -1 marks a request the target never answered.
+			d := parseLatency(v, time.Second)
+			if d < 0 {
+				total = -1
+				break
+			}
+			total += d
+		}
+		r.Latency = total
+	}
+
+	return r, r.Status > 0
+}
+
+// firstField returns the first of keys present in fields as a string.
+func firstField(fields map[string]any, keys []string) (string, bool) {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
+
+// splitRequestLine splits "GET /path?q HTTP/1.1" into method and URL.
+func splitRequestLine(request string) (string, string) {
+	parts := strings.Fields(request)
+	switch len(parts) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", parts[0]
+	default:
+		return parts[0], parts[1]
+	}
+}
+
+func parseLatency(v string, unit time.Duration) time.Duration {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return -1
+	}
+	return time.Duration(f * float64(unit))
+}
+
+var (
+	uuidSegment  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment   = regexp.MustCompile(`^[0-9a-fA-F]{8,}$`)
+	tokenSegment = regexp.MustCompile(`^[A-Za-z0-9_\-=]{20,}$`)
+)
+
+// templatePath reduces a URL to its path with IDs replaced by {id}, so
+// /orders/1234/items?x=1 and /orders/5678/items count as one URL.
+func templatePath(rawURL string) string {
+	path := rawURL
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	// An absolute URL, as in ALB logs.
+	if strings.Contains(path, "://") {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if isIDSegment(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isIDSegment(s string) bool {
+	if s == "" {
+		return false
+	}
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return true
+	}
+	if uuidSegment.MatchString(s) {
+		return true
+	}
+	hasDigit := strings.ContainsAny(s, "0123456789")
+	return hasDigit && (hexSegment.MatchString(s) || tokenSegment.MatchString(s))
+}
+
+// AccessLogSummary is the summary of the access log lines of one window.
+type AccessLogSummary struct {
+	LogName string    `json:"logName"`
+	Format  string    `json:"format"`
+	From    time.Time `json:"from,omitzero"`
+	To      time.Time `json:"to"`
+
+	Requests int `json:"requests"`
+	// Unparsed counts the lines that didn't match the format.
+	Unparsed      int            `json:"unparsed"`
+	StatusClasses map[string]int `json:"statusClasses"`
+	// LatencyMs is missing when the format has no latency.
+	LatencyMs *LatencyPercentiles `json:"latencyMs,omitempty"`
+	// TopSlow are the URLs with the highest average latency, TopErrors the
+	// ones with the most 5xx responses.
+	TopSlow   []AccessLogURLStat `json:"topSlow,omitempty"`
+	TopErrors []AccessLogURLStat `json:"topErrors,omitempty"`
+}
+
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// AccessLogURLStat are the requests of one URL template.
+type AccessLogURLStat struct {
+	URL      string  `json:"url"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	AvgMs    float64 `json:"avgMs,omitempty"`
+	MaxMs    float64 `json:"maxMs,omitempty"`
+
+	timed int
+	total time.Duration
+	max   time.Duration
+}
+
+// accessLogSummarizer builds the summary of the lines written to it.
+type accessLogSummarizer struct {
+	parser  accessLogParser
+	summary AccessLogSummary
+
+	partial   []byte
+	latencies []time.Duration
+	seen      int
+	urls      map[string]*AccessLogURLStat
+}
+
+func newAccessLogSummarizer(parser accessLogParser, logName, format string) *accessLogSummarizer {
+	return &accessLogSummarizer{
+		parser: parser,
+		summary: AccessLogSummary{
+			LogName:       logName,
+			Format:        format,
+			StatusClasses: make(map[string]int),
+		},
+		urls: make(map[string]*AccessLogURLStat),
+	}
+}
+
+// Write adds the complete lines of p; a trailing partial line is kept for
+// the next write or Summary.
+func (s *accessLogSummarizer) Write(p []byte) (int, error) {
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+		s.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		s.addLine(data[:i])
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		s.partial = append([]byte(nil), data...)
+	}
+	return len(p), nil
+}
+
+func (s *accessLogSummarizer) addLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	r, ok := s.parser.parse(line)
+	if !ok {
+		s.summary.Unparsed++
+		return
+	}
+
+	s.summary.Requests++
+	class := "other"
+	if r.Status >= 100 && r.Status < 600 {
+		class = strconv.Itoa(r.Status/100) + "xx"
+	}
+	s.summary.StatusClasses[class]++
+
+	key := templatePath(r.Path)
+	if r.Method != "" {
+		key = r.Method + " " + key
+	}
+	u, ok := s.urls[key]
+	if !ok {
+		if len(s.urls) >= maxAccessLogURLs {
+			key = accessLogOtherURL
+			u = s.urls[key]
+		}
+		if u == nil {
+			u = &AccessLogURLStat{URL: key}
+			s.urls[key] = u
+		}
+	}
+	u.Requests++
+	if r.Status >= 500 {
+		u.Errors++
+	}
+
+	if r.Latency >= 0 {
+		u.timed++
+		u.total += r.Latency
+		u.max = max(u.max, r.Latency)
+		s.sampleLatency(r.Latency)
+	}
+}
+
+// sampleLatency keeps a uniform sample of at most maxAccessLogLatencySamples
+// latencies (reservoir sampling).
+func (s *accessLogSummarizer) sampleLatency(d time.Duration) {
+	s.seen++
+	if len(s.latencies) < maxAccessLogLatencySamples {
+		s.latencies = append(s.latencies, d)
+		return
+	}
+	if i := rand.IntN(s.seen); i < maxAccessLogLatencySamples {
+		s.latencies[i] = d
+	}
+}
+
+// Summary returns the summary of the lines written so far.
+func (s *accessLogSummarizer) Summary() AccessLogSummary {
+	if len(s.partial) > 0 {
+		s.addLine(s.partial)
+		s.partial = nil
+	}
+
+	summary := s.summary
+	if len(s.latencies) > 0 {
+		sorted := slices.Clone(s.latencies)
+		slices.Sort(sorted)
+		summary.LatencyMs = &LatencyPercentiles{
+			P50: durationMs(percentile(sorted, 50)),
+			P95: durationMs(percentile(sorted, 95)),
+			P99: durationMs(percentile(sorted, 99)),
+			Max: durationMs(sorted[len(sorted)-1]),
+		}
+	}
+
+	var stats []AccessLogURLStat
+	for _, u := range s.urls {
+		stat := *u
+		if stat.timed > 0 {
+			stat.AvgMs = durationMs(stat.total / time.Duration(stat.timed))
+			stat.MaxMs = durationMs(stat.max)
+		}
+		stats = append(stats, stat)
+	}
+
+	slow := slices.DeleteFunc(slices.Clone(stats), func(u AccessLogURLStat) bool { return u.timed == 0 })
+	slices.SortFunc(slow, func(a, b AccessLogURLStat) int {
+		if a.AvgMs != b.AvgMs {
+			return cmp.Compare(b.AvgMs, a.AvgMs)
+		}
+		return strings.Compare(a.URL, b.URL)
+	})
+	summary.TopSlow = slow[:min(len(slow), accessLogTopURLs)]
+
+	failing := slices.DeleteFunc(stats, func(u AccessLogURLStat) bool { return u.Errors == 0 })
+	slices.SortFunc(failing, func(a, b AccessLogURLStat) int {
+		if a.Errors != b.Errors {
+			return b.Errors - a.Errors
+		}
+		return strings.Compare(a.URL, b.URL)
+	})
+	summary.TopErrors = failing[:min(len(failing), accessLogTopURLs)]
+
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
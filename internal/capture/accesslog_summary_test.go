@@ -0,0 +1,208 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		unit   string
+		line   string
+		want   accessLogRecord
+	}{
+		{
+			name:   "common",
+			format: "common",
+			line:   `10.0.0.1 - frank [10/Oct/2026:13:55:36 -0700] "GET /orders/1234?x=1 HTTP/1.1" 200 2326`,
+			want:   accessLogRecord{Method: "GET", Path: "/orders/1234?x=1", Status: 200, Latency: -1},
+		},
+		{
+			name:   "combined",
+			format: "COMBINED",
+			line:   `10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "POST /login HTTP/1.1" 302 - "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64)"`,
+			want:   accessLogRecord{Method: "POST", Path: "/login", Status: 302, Latency: -1},
+		},
+		{
+			name:   "apache with microseconds",
+			format: `%h %l %u %t "%r" %>s %b %D`,
+			line:   `10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /a HTTP/1.1" 500 12 250000`,
+			want:   accessLogRecord{Method: "GET", Path: "/a", Status: 500, Latency: 250 * time.Millisecond},
+		},
+		{
+			name:   "tomcat with milliseconds",
+			format: `%h %l %u %t "%r" %s %b %D`,
+			unit:   AccessLogDurationMillis,
+			line:   `10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /a HTTP/1.1" 200 12 250`,
+			want:   accessLogRecord{Method: "GET", Path: "/a", Status: 200, Latency: 250 * time.Millisecond},
+		},
+		{
+			name:   "apache with a unit of %T",
+			format: `%a %m %U %>s %{ms}T`,
+			line:   `10.0.0.1 DELETE /items/9 204 17`,
+			want:   accessLogRecord{Method: "DELETE", Path: "/items/9", Status: 204, Latency: 17 * time.Millisecond},
+		},
+		{
+			name:   "nginx",
+			format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`,
+			line:   `10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /api/v1/users/42 HTTP/2.0" 404 0 "-" "curl/8.0" 0.120`,
+			want:   accessLogRecord{Method: "GET", Path: "/api/v1/users/42", Status: 404, Latency: 120 * time.Millisecond},
+		},
+		{
+			name:   "envoy",
+			format: "envoy",
+			line:   `{"method":"GET","path":"/health","response_code":200,"duration":3}`,
+			want:   accessLogRecord{Method: "GET", Path: "/health", Status: 200, Latency: 3 * time.Millisecond},
+		},
+		{
+			name:   "alb",
+			format: "alb",
+			line:   `{"elb_status_code":"502","request":"GET https://shop.example.com:443/cart/abc123def456?x=1 HTTP/1.1","request_processing_time":"0.001","target_processing_time":"0.5","response_processing_time":"0.002"}`,
+			want:   accessLogRecord{Method: "GET", Path: "https://shop.example.com:443/cart/abc123def456?x=1", Status: 502, Latency: 503 * time.Millisecond},
+		},
+		{
+			name:   "alb without a target response",
+			format: "json",
+			line:   `{"elb_status_code":503,"request":"GET https://shop.example.com:443/ HTTP/1.1","request_processing_time":-1,"target_processing_time":-1,"response_processing_time":-1}`,
+			want:   accessLogRecord{Method: "GET", Path: "https://shop.example.com:443/", Status: 503, Latency: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newAccessLogParser(tt.format, tt.unit)
+			require.NoError(t, err)
+
+			got, ok := p.parse([]byte(tt.line))
+			require.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewAccessLogParserErrors(t *testing.T) {
+	_, err := newAccessLogParser("W3C", "")
+	assert.Error(t, err)
+
+	_, err = newAccessLogParser(`%h %t "%r"`, "")
+	assert.Error(t, err, "a format without status can't be summarized")
+
+	_, err = newAccessLogParser("common", "s")
+	assert.Error(t, err, "the duration unit is us or ms")
+}
+
+func TestTemplatePath(t *testing.T) {
+	tests := map[string]string{
+		"/orders/1234/items?page=2":                          "/orders/{id}/items",
+		"/users/3f2504e0-4f89-11d3-9a0c-0305e82c3301":        "/users/{id}",
+		"/blobs/deadbeef00112233":                            "/blobs/{id}",
+		"/sessions/dGhpcyBpcyBhIHRva2VuMTIz":                 "/sessions/{id}",
+		"/api/v2/health":                                     "/api/v2/health",
+		"/static/app.js":                                     "/static/app.js",
+		"https://shop.example.com:443/cart/abc123def456?x=1": "/cart/{id}",
+		"":  "/",
+		"/": "/",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, templatePath(in), in)
+	}
+}
+
+func TestAccessLogSummarizer(t *testing.T) {
+	p, err := newAccessLogParser(`%m %U %>s %D`, "")
+	require.NoError(t, err)
+	s := newAccessLogSummarizer(p, "access.log", `%m %U %>s %D`)
+
+	// 100 requests of 1..100ms, the last ten to /slow/<n>; every tenth fails.
+	for i := 1; i <= 100; i++ {
+		status, path := 200, fmt.Sprintf("/fast/%d", i)
+		if i > 90 {
+			path = fmt.Sprintf("/slow/%d", i)
+		}
+		if i%10 == 0 {
+			status = 503
+		}
+		fmt.Fprintf(s, "GET %s %d %d\n", path, status, i*1000)
+	}
+	// A line split over writes, a garbage line and a last line without a
+	// newline.
+	s.Write([]byte("POST /upl"))
+	s.Write([]byte("oad 201 1000\nnot an access log line\n"))
+	s.Write([]byte("GET /fast/1 404 1000"))
+
+	summary := s.Summary()
+	assert.Equal(t, 102, summary.Requests)
+	assert.Equal(t, 1, summary.Unparsed)
+	assert.Equal(t, map[string]int{"2xx": 91, "4xx": 1, "5xx": 10}, summary.StatusClasses)
+	require.NotNil(t, summary.LatencyMs)
+	assert.Equal(t, LatencyPercentiles{P50: 49, P95: 95, P99: 99, Max: 100}, *summary.LatencyMs)
+
+	require.NotEmpty(t, summary.TopSlow)
+	assert.Equal(t, "GET /slow/{id}", summary.TopSlow[0].URL)
+	assert.Equal(t, 10, summary.TopSlow[0].Requests)
+	assert.Equal(t, 95.5, summary.TopSlow[0].AvgMs)
+	assert.Equal(t, 100.0, summary.TopSlow[0].MaxMs)
+
+	require.Len(t, summary.TopErrors, 2)
+	assert.Equal(t, "GET /fast/{id}", summary.TopErrors[0].URL)
+	assert.Equal(t, 9, summary.TopErrors[0].Errors)
+	assert.Equal(t, "GET /slow/{id}", summary.TopErrors[1].URL)
+	assert.Equal(t, 1, summary.TopErrors[1].Errors)
+}
+
+func TestAccessLogM3Summary(t *testing.T) {
+	oldSummary, oldOnlyCapture := config.GlobalConfig.AccessLogSummary, config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.AccessLogSummary = AccessLogSummaryOnly
+	config.GlobalConfig.OnlyCapture = true
+	defer func() {
+		config.GlobalConfig.AccessLogSummary, config.GlobalConfig.OnlyCapture = oldSummary, oldOnlyCapture
+	}()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	logPath := filepath.Join(dir, "access.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("old line\n"), 0644))
+
+	a := NewAccessLogM3()
+	_, err = a.CaptureSingleAccessLog(logPath, 42, "common", "")
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	fmt.Fprintln(f, `10.0.0.1 - - [10/Oct/2026:13:55:36 +0000] "GET /orders/1 HTTP/1.1" 200 10`)
+	fmt.Fprintln(f, `10.0.0.1 - - [10/Oct/2026:13:55:37 +0000] "GET /orders/2 HTTP/1.1" 500 10`)
+	require.NoError(t, f.Close())
+
+	_, err = a.CaptureSingleAccessLog(logPath, 42, "common", "")
+	require.NoError(t, err)
+
+	_, err = os.Stat("1.accessLogs.access.log")
+	assert.True(t, os.IsNotExist(err), "raw lines aren't kept in only mode")
+
+	data, err := os.ReadFile("1.accessLogs.access.log.summary.json")
+	require.NoError(t, err)
+	var summary AccessLogSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.Equal(t, "access.log", summary.LogName)
+	assert.Equal(t, 2, summary.Requests)
+	assert.Equal(t, map[string]int{"2xx": 1, "5xx": 1}, summary.StatusClasses)
+	assert.Nil(t, summary.LatencyMs)
+	require.Len(t, summary.TopErrors, 1)
+	assert.Equal(t, "GET /orders/{id}", summary.TopErrors[0].URL)
+	assert.False(t, summary.From.IsZero())
+	assert.False(t, summary.To.Before(summary.From))
+}
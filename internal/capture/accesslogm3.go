@@ -1,6 +1,7 @@
 package capture
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -44,6 +45,10 @@ type accessLogM3ReadStat struct {
 
 	// readPosition marks where we left off in previous read
 	readPosition int64
+
+	// readAt is when the previous read happened, the start of the window
+	// of the access log summary
+	readAt time.Time
 }
 
 func NewAccessLogM3() *AccessLogM3 {
@@ -120,6 +125,7 @@ func (a *AccessLogM3) CaptureSingleAccessLog(filePath string, pid int, format, s
 		// so that the next run will read from there.
 		readStat.fileSize = fileInfo.Size()
 		readStat.readPosition = fileInfo.Size()
+		readStat.readAt = time.Now()
 		a.readStats[filePath] = readStat
 
 		return Result{
@@ -156,43 +162,118 @@ func (a *AccessLogM3) CaptureSingleAccessLog(filePath string, pid int, format, s
 
 	logger.Log("accesslogm3: reading %q from pos %d", filePath, readStat.readPosition)
 
-	// Generate a unique destination filename to prevent conflicting file names.
-	dstPath := generateUniqueAccessLogPath(filepath.Base(filePath))
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
-	}
-	defer dst.Close()
+	// The summary of the new lines is computed while copying them; with
+	// AccessLogSummaryOnly the raw lines aren't uploaded.
+	summarizer := newAccessLogSummarizerFor(filePath, format)
+	rawLines := summarizer == nil || config.GlobalConfig.AccessLogSummary != AccessLogSummaryOnly
+
+	var out io.Writer = io.Discard
+	var dst *os.File
+	if rawLines {
+		// Generate a unique destination filename to prevent conflicting file names.
+		dstPath := generateUniqueAccessLogPath(filepath.Base(filePath))
+		dst, err = os.Create(dstPath)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+		}
+		defer dst.Close()
 
-	// Write the format header to the destination file)
-	dst.WriteString(format + "\n")
+		// Write the format header to the destination file)
+		dst.WriteString(format + "\n")
 
-	if source != "" {
-		// Write the source header
-		dst.WriteString("accessLogSource: " + source + "\n")
+		if source != "" {
+			// Write the source header
+			dst.WriteString("accessLogSource: " + source + "\n")
+		}
+		out = dst
+	}
+	if summarizer != nil {
+		out = io.MultiWriter(out, summarizer)
 	}
 
 	// Copy new content from the source log.
-	bytesCopied, err := io.Copy(dst, src)
+	bytesCopied, err := io.Copy(out, src)
 	if err != nil {
 		return Result{}, fmt.Errorf("failed to copy content from %q: %w", filePath, err)
 	}
 
 	// Update readStats for next run
+	from := readStat.readAt
 	readStat.readPosition += bytesCopied
 	readStat.fileSize = fileInfo.Size()
+	readStat.readAt = time.Now()
 	a.readStats[filePath] = readStat
 
-	// Ensure all writes are flushed to disk.
-	if err := dst.Sync(); err != nil {
-		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	var msgs []string
+	ok := true
+	if rawLines {
+		// Ensure all writes are flushed to disk.
+		if err := dst.Sync(); err != nil {
+			return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dst.Name(), err)
+		}
+
+		// Build the data string for posting.
+		dt := fmt.Sprintf("accessLog&logName=%s&pid=%d", filepath.Base(filePath), pid)
+		msg, rawOk := PostData(a.Endpoint(), dt, dst)
+		msgs = append(msgs, msg)
+		ok = ok && rawOk
+	}
+
+	if summarizer != nil {
+		summary := summarizer.Summary()
+		summary.From, summary.To = from, readStat.readAt
+		msg, summaryOk, err := a.postAccessLogSummary(summary, filePath, pid)
+		if err != nil {
+			return Result{}, err
+		}
+		msgs = append(msgs, msg)
+		ok = ok && summaryOk
 	}
 
-	// Build the data string for posting.
-	dt := fmt.Sprintf("accessLog&logName=%s&pid=%d", filepath.Base(filePath), pid)
-	msg, ok := PostData(a.Endpoint(), dt, dst)
+	return Result{Msg: strings.Join(msgs, "\n"), Ok: ok}, nil
+}
+
+// newAccessLogSummarizerFor returns the summarizer of the access log at
+// filePath, or nil when summaries are off or the format isn't supported.
+func newAccessLogSummarizerFor(filePath, format string) *accessLogSummarizer {
+	switch config.GlobalConfig.AccessLogSummary {
+	case AccessLogSummaryOn, AccessLogSummaryOnly:
+	default:
+		return nil
+	}
+
+	parser, err := newAccessLogParser(format, config.GlobalConfig.AccessLogDurationUnit)
+	if err != nil {
+		logger.Log("accesslogm3: not summarizing %q, uploading the raw lines: %v", filePath, err)
+		return nil
+	}
+	return newAccessLogSummarizer(parser, filepath.Base(filePath), format)
+}
+
+// postAccessLogSummary writes summary to a JSON file and posts it.
+func (a *AccessLogM3) postAccessLogSummary(summary AccessLogSummary, filePath string, pid int) (string, bool, error) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode access log summary of %q: %w", filePath, err)
+	}
+
+	dstPath := generateUniqueAccessLogPath(filepath.Base(filePath) + ".summary.json")
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return "", false, fmt.Errorf("failed to write access log summary %q: %w", dstPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		return "", false, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
 
-	return Result{Msg: msg, Ok: ok}, nil
+	dt := fmt.Sprintf("accessLogSummary&logName=%s&pid=%d", filepath.Base(filePath), pid)
+	msg, ok := PostData(a.Endpoint(), dt, f)
+	return msg, ok, nil
 }
 
 // generateUniqueAccessLogPath creates a unique file path for storing the log content.
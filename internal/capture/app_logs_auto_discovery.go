@@ -1,56 +1,192 @@
 package capture
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"strings"
 	"unicode"
+
+	"yc-agent/internal/config"
 	"yc-agent/internal/logger"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 // logPatterns contains precompiled regex patterns so they are compiled once at startup rather than each function call.
 var logPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`.*\.log$`),    // Matches *.log
-	regexp.MustCompile(`.*log.*\..*`), // Matches *log*.*
+	regexp.MustCompile(`.*\.log$`),        // Matches *.log
+	regexp.MustCompile(`.*log.*\..*`),     // Matches *log*.*
+	regexp.MustCompile(`^catalina\.out$`), // Tomcat's redirected stdout and stderr
+}
+
+// logExcludes are globs of files that match logPatterns but are not logs,
+// like logback-core.jar.
+var logExcludes = []string{"*.jar", "*.war", "*.ear", "*.class", "*.so", "*.so.*", "*.dll", "*.dylib"}
+
+// AppLogCandidate is a file opened by a process, and whether it was
+// discovered as an app log.
+type AppLogCandidate struct {
+	// Path is the path the process opened, ResolvedPath the one the agent
+	// reads it at, through /proc/<pid>/root for a process in a container.
+	Path         string
+	ResolvedPath string
+	Accepted     bool
+	Reason       string
 }
 
 // DiscoverOpenedLogFilesByProcess returns a list of file paths for log files that are
 // opened by the given process identified by pid. A file is considered a log file if:
-// - its name matches any of the precompiled log patterns,
+// - its name matches any of the precompiled log patterns or the include rules of
+// config.GlobalConfig.AppLogDiscovery, and no exclude rule,
+// - its size is within the size bounds of the rules,
 // - and if its last 1000 bytes contain mostly ASCII characters.
 //
+// The returned paths are readable by the agent, also for a process in a
+// container. Every candidate is reported at the debug level.
+//
 // If the runtime is not Linux, it returns an empty slice with no error.
 func DiscoverOpenedLogFilesByProcess(pid int) ([]string, error) {
-	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
-		return []string{}, nil
+	candidates, err := DiscoverAppLogCandidates(pid, config.GlobalConfig.AppLogDiscovery)
+	if err != nil {
+		return nil, err
 	}
 
-	openedFiles, err := GetOpenedFilesByProcess(pid)
+	logger.Debug().Msgf("DiscoverOpenedLogFilesByProcess: app log candidates of pid %d:\n%s", pid, FormatAppLogCandidates(candidates))
+
 	openedLogFiles := []string{}
+	for _, c := range candidates {
+		if c.Accepted {
+			openedLogFiles = append(openedLogFiles, c.ResolvedPath)
+		}
+	}
+
+	return openedLogFiles, nil
+}
+
+// DiscoverAppLogCandidates evaluates rules against every file opened by the
+// process pid.
+func DiscoverAppLogCandidates(pid int, rules config.AppLogDiscovery) ([]AppLogCandidate, error) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return []AppLogCandidate{}, nil
+	}
 
+	openedFiles, err := GetOpenedFilesByProcess(pid)
 	if err != nil {
 		return nil, err
 	}
 
+	candidates := []AppLogCandidate{}
+	seen := make(map[string]bool)
 	for _, filePath := range openedFiles {
-		logger.Debug().Msgf("DiscoverOpenedLogFilesByProcess: opened file by process (pid=%d): %s", pid, filePath)
-
-		fileBaseName := filepath.Base(filePath)
-		if matchLogPattern(fileBaseName) {
-			last1000Text, err := getLastNBytes(filePath, 1000)
-			if err != nil {
-				continue
-			}
-
-			if IsMostlyASCII(last1000Text) {
-				openedLogFiles = append(openedLogFiles, filePath)
-			}
+		// A file is often open more than once, e.g. as stdout and stderr.
+		if seen[filePath] {
+			continue
 		}
+		seen[filePath] = true
+
+		candidates = append(candidates, evaluateAppLogCandidate(filePath, resolveProcessPath(pid, filePath), rules))
 	}
 
-	return openedLogFiles, nil
+	return candidates, nil
+}
+
+// evaluateAppLogCandidate decides whether the file the process opened at
+// path, readable at resolvedPath, is an app log.
+func evaluateAppLogCandidate(path, resolvedPath string, rules config.AppLogDiscovery) AppLogCandidate {
+	c := AppLogCandidate{Path: path, ResolvedPath: resolvedPath}
+	reject := func(format string, args ...any) AppLogCandidate {
+		c.Reason = fmt.Sprintf(format, args...)
+		return c
+	}
+
+	// Sockets, pipes and the like are like "socket:[1234]".
+	if !filepath.IsAbs(path) {
+		return reject("not a file")
+	}
+	if strings.HasSuffix(path, " (deleted)") {
+		return reject("deleted")
+	}
+
+	for _, glob := range slices.Concat(rules.Exclude, logExcludes) {
+		if matchDiscoveryGlob(glob, path) {
+			return reject("excluded by %q", glob)
+		}
+	}
+
+	included := ""
+	if matchLogPattern(filepath.Base(path)) {
+		included = "log file name"
+	}
+	for _, glob := range rules.Include {
+		if included == "" && matchDiscoveryGlob(glob, path) {
+			included = fmt.Sprintf("included by %q", glob)
+		}
+	}
+	if included == "" {
+		return reject("no include rule matched")
+	}
+
+	info, err := os.Stat(resolvedPath)
+	if err != nil {
+		return reject("%v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return reject("not a regular file")
+	}
+	if info.Size() == 0 {
+		return reject("empty")
+	}
+	if rules.MinSize > 0 && info.Size() < rules.MinSize {
+		return reject("smaller than %d bytes", rules.MinSize)
+	}
+	if rules.MaxSize > 0 && info.Size() > rules.MaxSize {
+		return reject("larger than %d bytes", rules.MaxSize)
+	}
+
+	last1000Text, err := getLastNBytes(resolvedPath, 1000)
+	if err != nil {
+		return reject("%v", err)
+	}
+	if !IsMostlyASCII(last1000Text) {
+		return reject("binary content")
+	}
+
+	c.Accepted = true
+	c.Reason = included
+	return c
+}
+
+// matchDiscoveryGlob matches a glob with a / against path, and others
+// against its file name.
+func matchDiscoveryGlob(glob, path string) bool {
+	if strings.Contains(glob, "/") {
+		ok, _ := doublestar.Match(glob, filepath.ToSlash(path))
+		return ok
+	}
+	ok, _ := doublestar.Match(glob, filepath.Base(path))
+	return ok
+}
+
+// FormatAppLogCandidates returns a line per candidate with its decision.
+func FormatAppLogCandidates(candidates []AppLogCandidate) string {
+	var b strings.Builder
+	for _, c := range candidates {
+		decision := "rejected"
+		if c.Accepted {
+			decision = "accepted"
+		}
+		fmt.Fprintf(&b, "%s %s: %s", decision, c.Path, c.Reason)
+		if c.ResolvedPath != c.Path {
+			fmt.Fprintf(&b, " (read at %s)", c.ResolvedPath)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
 }
 
 // matchLogPattern checks if the filename matches any of the precompiled log patterns.
@@ -49,3 +49,31 @@ func GetOpenedFilesByProcess(pid int) ([]string, error) {
 
 	return openedFiles, err
 }
+
+// resolveProcessPath returns the path the agent reads the file the process
+// pid opened at path at. A process in another mount namespace, like a
+// container, sees its own root, which the agent reads through
+// /proc/<pid>/root.
+func resolveProcessPath(pid int, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+
+	self, selfErr := os.Readlink("/proc/self/ns/mnt")
+	other, otherErr := os.Readlink(fmt.Sprintf("/proc/%d/ns/mnt", pid))
+	if selfErr == nil && otherErr == nil && self == other {
+		return path
+	}
+
+	rooted := filepath.Join("/proc", fmt.Sprintf("%d", pid), "root", path)
+	if selfErr != nil || otherErr != nil {
+		// Without the namespaces, prefer the path when the agent sees it.
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		if _, err := os.Stat(rooted); err != nil {
+			return path
+		}
+	}
+	return rooted
+}
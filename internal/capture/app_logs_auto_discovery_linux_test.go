@@ -72,3 +72,9 @@ func TestAppLogsAutoDiscovery_GetOpenedFilesByProcess(t *testing.T) {
 		require.Empty(t, openFiles, "Expected no files for non-existent PID")
 	})
 }
+
+func TestResolveProcessPath(t *testing.T) {
+	// The agent shares the mount namespace of its own process.
+	require.Equal(t, "/var/log/app.log", resolveProcessPath(os.Getpid(), "/var/log/app.log"))
+	require.Equal(t, "socket:[1234]", resolveProcessPath(os.Getpid(), "socket:[1234]"))
+}
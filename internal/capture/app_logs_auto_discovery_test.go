@@ -1,11 +1,14 @@
 package capture
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
 
+	"yc-agent/internal/config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -79,6 +82,7 @@ func TestMatchLogPattern(t *testing.T) {
 		{"logfile", false},              // no match: missing extension (no dot after 'log')
 		{"output.LOG", false},           // no match: case-sensitive patterns
 		{"test.txt", false},             // no match: not a log file
+		{"catalina.out", true},          // Tomcat's stdout and stderr
 	}
 
 	for _, tt := range tests {
@@ -91,6 +95,62 @@ func TestMatchLogPattern(t *testing.T) {
 	}
 }
 
+// TestEvaluateAppLogCandidate verifies the include, exclude, size and
+// binary content rules, and the reason of every decision.
+func TestEvaluateAppLogCandidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, content, 0644))
+		return path
+	}
+	text := []byte("2026-10-19 09:00:00 INFO started\n")
+
+	rules := config.AppLogDiscovery{
+		Include: []string{"*.txt", "**/stdout"},
+		Exclude: []string{"**/audit/*"},
+		MinSize: 10,
+		MaxSize: 1000,
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		accepted bool
+		reason   string
+	}{
+		{name: "log", path: write("app.log", text), accepted: true, reason: "log file name"},
+		{name: "catalina.out", path: write("catalina.out", text), accepted: true, reason: "log file name"},
+		{name: "included by name", path: write("server.txt", text), accepted: true, reason: `included by "*.txt"`},
+		{name: "included by path", path: write("app/stdout", text), accepted: true, reason: `included by "**/stdout"`},
+		{name: "jar with a text tail", path: write("logback-core-1.5.jar", text), reason: `excluded by "*.jar"`},
+		{name: "excluded by path", path: write("audit/audit.log", text), reason: `excluded by "**/audit/*"`},
+		{name: "no rule", path: write("data.bin", text), reason: "no include rule matched"},
+		{name: "too small", path: write("small.log", []byte("hi\n")), reason: "smaller than 10 bytes"},
+		{name: "too large", path: write("large.log", bytes.Repeat(text, 100)), reason: "larger than 1000 bytes"},
+		{name: "empty", path: write("empty.log", nil), reason: "empty"},
+		{name: "binary", path: write("binary.log", bytes.Repeat([]byte{0, 1, 2, 0xff}, 10)), reason: "binary content"},
+		{name: "socket", path: "socket:[1234]", reason: "not a file"},
+		{name: "deleted", path: filepath.Join(dir, "old.log") + " (deleted)", reason: "deleted"},
+		{name: "directory", path: filepath.Dir(write("dir.log/app.log", text)), reason: "not a regular file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := evaluateAppLogCandidate(tt.path, tt.path, rules)
+			assert.Equal(t, tt.accepted, c.Accepted)
+			assert.Equal(t, tt.reason, c.Reason)
+		})
+	}
+
+	// The rules are evaluated against the path the process opened, and the
+	// file is read at the resolved one.
+	resolved := write("root/var/log/app.log", text)
+	c := evaluateAppLogCandidate("/var/log/app.log", resolved, config.AppLogDiscovery{})
+	assert.True(t, c.Accepted)
+	assert.Contains(t, FormatAppLogCandidates([]AppLogCandidate{c}), "accepted /var/log/app.log: log file name (read at "+resolved+")")
+}
+
 // TestGetLastNBytes verifies the behavior of reading the last N bytes from files
 // under different scenarios: files smaller than requested size, exact size matches,
 // partial reads, and error conditions.
@@ -6,7 +6,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"yc-agent/internal/config"
 	"yc-agent/internal/logger"
@@ -21,11 +23,21 @@ var compressedFileExtensions = []string{
 
 // AppLog handles the capture and processing of application log files.
 // It supports both compressed and uncompressed log files and can limit
-// the number of lines processed from each file.
+// the number of lines processed from each file, or extract the lines of a
+// time window before the capture.
 type AppLog struct {
 	Capture
 	Paths     config.AppLogs
 	LineLimit int
+	// Window, when set, replaces LineLimit for logs with a known timestamp
+	// format: the lines of the window are extracted from the log and its
+	// rotated siblings.
+	Window time.Duration
+	// Exceptions aggregates the stack traces of the uploaded lines into
+	// exceptions-summary.json.
+	Exceptions bool
+
+	exceptions *exceptionAggregator
 }
 
 // Run executes the log capture process for all configured paths.
@@ -50,6 +62,16 @@ func (al *AppLog) Run() (Result, error) {
 		logger.Warn().Err(expansionErr).Msg("AppLog: path expansion error")
 	}
 
+	// The rotated siblings of a log are searched with it for the window.
+	if al.Window > 0 {
+		expandedPaths = withoutRotatedSiblings(expandedPaths)
+	}
+
+	if al.Exceptions {
+		al.exceptions = newExceptionAggregator()
+		defer func() { al.exceptions = nil }()
+	}
+
 	// Process each expanded file path
 	for _, filePath := range expandedPaths {
 		logger.Debug().Msgf("AppLog: expanded path: %s", filePath)
@@ -59,6 +81,12 @@ func (al *AppLog) Run() (Result, error) {
 		errs = append(errs, err)
 	}
 
+	if al.exceptions != nil {
+		r, err := postExceptionsSummary(al.Endpoint(), al.exceptions.Summary())
+		results = append(results, r)
+		errs = append(errs, err)
+	}
+
 	return summarizeResults(results, errs)
 }
 
@@ -89,8 +117,21 @@ func (al *AppLog) CaptureSingleAppLog(filePath string) (Result, error) {
 	}
 	defer dst.Close()
 
+	// The stack traces are read from the uploaded lines; compressed files
+	// are uploaded as they are.
+	var out io.Writer = dst
+	if al.exceptions != nil && !isCompressed {
+		scanner := al.exceptions.writer(fileBaseName)
+		defer scanner.Flush()
+		out = io.MultiWriter(dst, scanner)
+	}
+
 	// Copy content with special handling for compressed files
-	if err := al.copyLogContent(src, dst, isCompressed); err != nil {
+	if window := al.window(filePath, isCompressed); window != nil {
+		if _, err := window.extract(out, filePath); err != nil {
+			return Result{}, fmt.Errorf("applog failed to extract the window of %q: %w", filePath, err)
+		}
+	} else if err := al.copyLogContent(src, out, isCompressed); err != nil {
 		return Result{}, fmt.Errorf("applog failed to copy log content: %w", err)
 	}
 
@@ -123,11 +164,46 @@ func generateUniqueLogPath(baseFileName string) string {
 	}
 }
 
+// window returns the window to extract from the log at filePath, or nil to
+// copy the last LineLimit lines.
+func (al *AppLog) window(filePath string, isCompressed bool) *logWindow {
+	if al.Window <= 0 || isCompressed {
+		return nil
+	}
+
+	to := time.Now()
+	window, err := newLogWindow(filePath, to.Add(-al.Window), to)
+	if err != nil {
+		logger.Log("applog: failed to detect the timestamp format of %q: %v", filePath, err)
+		return nil
+	}
+	if window == nil {
+		logger.Log("applog: no known timestamp format in %q, uploading the last %d lines instead of the last %s", filePath, al.LineLimit, al.Window)
+		return nil
+	}
+	logger.Debug().Msgf("applog: extracting the last %s of %q, %s timestamps", al.Window, filePath, window.format.name)
+	return window
+}
+
+// withoutRotatedSiblings drops the paths that are rotated siblings of
+// another one.
+func withoutRotatedSiblings(paths []string) []string {
+	siblings := make(map[string]bool)
+	for _, p := range paths {
+		for _, s := range rotatedSiblings(p) {
+			siblings[s] = true
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(paths), func(p string) bool {
+		return siblings[p]
+	})
+}
+
 // copyLogContent copies the content from the source file to the destination file.
 // For uncompressed files, it positions the reader at the last N lines (specified by LineLimit).
 // For compressed files, it copies the entire content.
 // Returns an error if any operation fails.
-func (al *AppLog) copyLogContent(src, dst *os.File, isCompressed bool) error {
+func (al *AppLog) copyLogContent(src *os.File, dst io.Writer, isCompressed bool) error {
 	if !isCompressed && al.LineLimit != -1 {
 		// For uncompressed files, we only want the last N lines to avoid
 		// processing extremely large log files
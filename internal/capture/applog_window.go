@@ -0,0 +1,467 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/logger"
+)
+
+const (
+	// logTimestampPrefix is how far into a line its timestamp is looked
+	// for, past a level, thread name or bracket.
+	logTimestampPrefix = 100
+	// logFormatSample is how much of the end of a log is read to detect
+	// its timestamp format.
+	logFormatSample = 64 << 10
+	// logClockSkew is how far in the future a timestamp without a year or
+	// date may be before it is taken for one of the previous year or day.
+	logClockSkew = 5 * time.Minute
+)
+
+const monthNames = `(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)`
+
+// logTimestampFormat is a timestamp format application logs commonly start
+// their lines with.
+type logTimestampFormat struct {
+	name string
+	re   *regexp.Regexp
+	// parse returns the time of the submatches of re; now resolves the
+	// missing year or date of syslog and time-only formats.
+	parse func(m [][]byte, now time.Time) (time.Time, bool)
+}
+
+// logTimestampFormats are tried in order when detecting the format of a log.
+var logTimestampFormats = []*logTimestampFormat{
+	{
+		// 2026-10-19T09:15:30.123Z, 2026-10-19 09:15:30,123 (log4j and
+		// logback %d), 2026-10-19T09:15:30+02:00
+		name:  "iso8601",
+		re:    regexp.MustCompile(`(\d{4}-\d{2}-\d{2})[T ](\d{2}:\d{2}:\d{2})(?:[.,](\d{1,9}))?(?: ?(Z|[+-]\d{2}:?\d{2})\b)?`),
+		parse: parseISOLogTimestamp,
+	},
+	{
+		// 19 Oct 2026 09:15:30,123 (log4j %d{DATE})
+		name: "log4j-date",
+		re:   regexp.MustCompile(`(\d{2}) ` + monthNames + ` (\d{4}) (\d{2}:\d{2}:\d{2})(?:[.,](\d{1,9}))?`),
+		parse: func(m [][]byte, now time.Time) (time.Time, bool) {
+			t, err := time.ParseInLocation("02 Jan 2006 15:04:05", fmt.Sprintf("%s %s %s %s", m[1], m[2], m[3], m[4]), time.Local)
+			return t.Add(fraction(m[5])), err == nil
+		},
+	},
+	{
+		// Oct 19 09:15:30 (syslog)
+		name: "syslog",
+		re:   regexp.MustCompile(monthNames + ` ([ \d]\d) (\d{2}:\d{2}:\d{2})`),
+		parse: func(m [][]byte, now time.Time) (time.Time, bool) {
+			t, err := time.ParseInLocation("2006 Jan _2 15:04:05", fmt.Sprintf("%d %s %s %s", now.Year(), m[1], m[2], m[3]), time.Local)
+			if err != nil {
+				return time.Time{}, false
+			}
+			if t.After(now.Add(logClockSkew)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t, true
+		},
+	},
+	{
+		// 09:15:30.123 at the start of the line (logback default console
+		// pattern, log4j %d{ABSOLUTE}), taken as the last such time
+		name: "time",
+		re:   regexp.MustCompile(`^\[?(\d{2}):(\d{2}):(\d{2})[.,](\d{3})`),
+		parse: func(m [][]byte, now time.Time) (time.Time, bool) {
+			h, _ := strconv.Atoi(string(m[1]))
+			mi, _ := strconv.Atoi(string(m[2]))
+			s, _ := strconv.Atoi(string(m[3]))
+			if h > 23 || mi > 59 || s > 59 {
+				return time.Time{}, false
+			}
+			local := now.In(time.Local)
+			t := time.Date(local.Year(), local.Month(), local.Day(), h, mi, s, 0, time.Local).Add(fraction(m[4]))
+			if t.After(now.Add(logClockSkew)) {
+				t = t.AddDate(0, 0, -1)
+			}
+			return t, true
+		},
+	},
+}
+
+func parseISOLogTimestamp(m [][]byte, now time.Time) (time.Time, bool) {
+	loc := time.Local
+	switch zone := string(m[4]); {
+	case zone == "Z":
+		loc = time.UTC
+	case zone != "":
+		zone = strings.ReplaceAll(zone, ":", "")
+		h, _ := strconv.Atoi(zone[1:3])
+		mi, _ := strconv.Atoi(zone[3:5])
+		offset := h*3600 + mi*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone(zone, offset)
+	}
+
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", string(m[1])+" "+string(m[2]), loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.Add(fraction(m[3])), true
+}
+
+// fraction returns the duration of the fractional second digits.
+func fraction(digits []byte) time.Duration {
+	if len(digits) == 0 {
+		return 0
+	}
+	ns, _ := strconv.Atoi((string(digits) + "000000000")[:9])
+	return time.Duration(ns)
+}
+
+// timestamp returns the time at the start of line, if it has one.
+func (f *logTimestampFormat) timestamp(line []byte, now time.Time) (time.Time, bool) {
+	if len(line) > logTimestampPrefix {
+		line = line[:logTimestampPrefix]
+	}
+	m := f.re.FindSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	return f.parse(m, now)
+}
+
+// detectLogTimestampFormat returns the format most lines of sample start
+// with, or nil when none does.
+func detectLogTimestampFormat(sample []byte, now time.Time) *logTimestampFormat {
+	var best *logTimestampFormat
+	bestCount := 0
+	for _, f := range logTimestampFormats {
+		count := 0
+		for line := range bytes.Lines(sample) {
+			if _, ok := f.timestamp(line, now); ok {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = f, count
+		}
+	}
+	return best
+}
+
+// logWindow extracts the lines of a log between from and to. Lines without
+// a timestamp, like the frames of a stack trace, belong to the timestamped
+// line before them.
+type logWindow struct {
+	from, to time.Time
+	format   *logTimestampFormat
+}
+
+// newLogWindow detects the timestamp format of the log at path; it returns
+// nil when the log has no known one.
+func newLogWindow(path string, from, to time.Time) (*logWindow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-logFormatSample, 0)
+	sample := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(sample, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(sample, '\n'); i >= 0 {
+			sample = sample[i+1:]
+		}
+	}
+
+	format := detectLogTimestampFormat(sample, to)
+	if format == nil {
+		return nil, nil
+	}
+	return &logWindow{from: from, to: to, format: format}, nil
+}
+
+// extract writes the lines of the window from path and from the rotated
+// siblings next to it to dst, oldest first. Siblings are searched newest
+// first, until one starts before the window.
+func (w *logWindow) extract(dst io.Writer, path string) (int64, error) {
+	files := append([]string{path}, rotatedSiblings(path)...)
+
+	// The files with lines in the window, newest first; the last one is
+	// searched for the start of the window, the others are copied whole.
+	var inWindow []string
+	for i, file := range files {
+		if i > 0 {
+			info, err := os.Stat(file)
+			if err != nil || info.ModTime().Before(w.from) {
+				break
+			}
+		}
+		first, ok, err := w.firstTimestamp(file)
+		if err != nil {
+			logger.Log("applog: failed to read %s: %v", file, err)
+			break
+		}
+		if !ok {
+			continue
+		}
+		inWindow = append(inWindow, file)
+		if first.Before(w.from) {
+			break
+		}
+	}
+
+	var written int64
+	for i := len(inWindow) - 1; i >= 0; i-- {
+		n, done, err := w.copyFile(dst, inWindow[i], i == len(inWindow)-1)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if done {
+			break
+		}
+	}
+	return written, nil
+}
+
+// copyFile copies the lines of the window from file; search seeks to the
+// start of the window first. done reports that a line after the window
+// was reached.
+func (w *logWindow) copyFile(dst io.Writer, file string, search bool) (int64, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if isGzipFile(file) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to decompress %s: %w", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else if search {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, false, err
+		}
+		start, err := w.search(f, info.Size())
+		if err != nil {
+			return 0, false, err
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return 0, false, err
+		}
+	}
+
+	// A file copied whole starts with the rest of an entry of the previous
+	// one.
+	var written int64
+	in := !search
+	br := bufio.NewReaderSize(r, 64<<10)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if ts, ok := w.format.timestamp(line, w.to); ok {
+				if ts.After(w.to) {
+					return written, true, nil
+				}
+				in = !ts.Before(w.from)
+			}
+			if in {
+				n, werr := dst.Write(line)
+				written += int64(n)
+				if werr != nil {
+					return written, false, werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return written, false, nil
+		}
+		if err != nil {
+			return written, false, err
+		}
+	}
+}
+
+// search returns the offset of a line at or before the first line of the
+// window, by binary search over the timestamps of the file.
+func (w *logWindow) search(f *os.File, size int64) (int64, error) {
+	lo, hi := int64(0), size
+	for hi-lo > 4096 {
+		mid := lo + (hi-lo)/2
+		start, ts, ok, err := w.nextTimestamp(f, mid, size)
+		if err != nil {
+			return 0, err
+		}
+		if ok && ts.Before(w.from) {
+			lo = start
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// nextTimestamp returns the first line starting at or after offset that
+// has a timestamp.
+func (w *logWindow) nextTimestamp(f *os.File, offset, size int64) (int64, time.Time, bool, error) {
+	start := offset
+	r := bufio.NewReader(io.NewSectionReader(f, offset, size-offset))
+	if offset > 0 {
+		// Skip to the start of the next line, unless offset is one.
+		var prev [1]byte
+		if _, err := f.ReadAt(prev[:], offset-1); err != nil {
+			return 0, time.Time{}, false, err
+		}
+		if prev[0] != '\n' {
+			skipped, err := r.ReadBytes('\n')
+			if err != nil {
+				return 0, time.Time{}, false, nil
+			}
+			start += int64(len(skipped))
+		}
+	}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if ts, ok := w.format.timestamp(line, w.to); ok {
+			return start, ts, true, nil
+		}
+		start += int64(len(line))
+		if err != nil {
+			return 0, time.Time{}, false, nil
+		}
+	}
+}
+
+// firstTimestamp returns the time of the first timestamped line of file.
+func (w *logWindow) firstTimestamp(file string) (time.Time, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if isGzipFile(file) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if ts, ok := w.format.timestamp(line, w.to); ok {
+			return ts, true, nil
+		}
+		if err == io.EOF {
+			return time.Time{}, false, nil
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+}
+
+// rotatedSiblings returns the rotated files of the log at path in its
+// directory, newest first: app.log.1, app.log.2.gz, app-2026-10-18.log.gz,
+// app.2026-10-18.1.log and the like. Zip archives aren't searched.
+func rotatedSiblings(path string) []string {
+	dir, base := filepath.Split(path)
+
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+
+	type sibling struct {
+		path    string
+		modTime time.Time
+	}
+	var siblings []sibling
+	for _, e := range entries {
+		name := e.Name()
+		if name == base || e.IsDir() || strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		if !isRotationOf(name, base) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		siblings = append(siblings, sibling{path: filepath.Join(dir, name), modTime: info.ModTime()})
+	}
+
+	slices.SortFunc(siblings, func(a, b sibling) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	paths := make([]string, len(siblings))
+	for i, s := range siblings {
+		paths[i] = s.path
+	}
+	return paths
+}
+
+// rotationSuffix matches what tells a rotated file from its log: an index or
+// a date, optionally with a time and an index (1, 20261018,
+// 2026-10-18_13, 2026-10-18.1).
+var rotationSuffix = regexp.MustCompile(`^(?:\d+|\d{4}-?\d{2}-?\d{2}(?:[T_.-]?\d{2}(?:-?\d{2}){0,2})?(?:[._-]\d+)?)$`)
+
+// isRotationOf reports whether name is a rotated file of the log named base,
+// either base followed by the rotation suffix (app.log.1, app.log-20261018)
+// or the suffix inserted before the extension (app.1.log,
+// app-2026-10-18.log, app_2026-10-18.0.log), optionally gzipped. Other logs
+// sharing the prefix, as app-access-2026-10-18.log, aren't.
+func isRotationOf(name, base string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	for _, sep := range []string{".", "-"} {
+		if rest, ok := strings.CutPrefix(name, base+sep); ok && rotationSuffix.MatchString(rest) {
+			return true
+		}
+	}
+
+	ext := filepath.Ext(base)
+	rest, ok := strings.CutSuffix(name, ext)
+	if ext == "" || !ok {
+		return false
+	}
+	stem := strings.TrimSuffix(base, ext)
+	for _, sep := range []string{".", "-", "_"} {
+		if r, ok := strings.CutPrefix(rest, stem+sep); ok && rotationSuffix.MatchString(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isGzipFile(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
@@ -0,0 +1,245 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLogTimestampFormat(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		sample string
+		want   string
+		ts     time.Time
+	}{
+		{
+			name:   "logback",
+			sample: "2026-10-19 09:15:30.123 [main] INFO  c.e.App - started\n2026-10-19 09:15:31.000 [main] INFO  c.e.App - ready\n",
+			want:   "iso8601",
+			ts:     time.Date(2026, 10, 19, 9, 15, 30, 123e6, time.Local),
+		},
+		{
+			name:   "iso with zone",
+			sample: `{"@timestamp":"2026-10-19T09:15:30.5+02:00","level":"INFO"}` + "\n",
+			want:   "iso8601",
+			ts:     time.Date(2026, 10, 19, 7, 15, 30, 5e8, time.UTC),
+		},
+		{
+			name:   "log4j date",
+			sample: "INFO  19 Oct 2026 09:15:30,123 [main] started\n",
+			want:   "log4j-date",
+			ts:     time.Date(2026, 10, 19, 9, 15, 30, 123e6, time.Local),
+		},
+		{
+			name:   "syslog",
+			sample: "Oct 19 09:15:30 host app[42]: started\nOct  9 09:15:30 host app[42]: started\n",
+			want:   "syslog",
+			ts:     time.Date(2026, 10, 19, 9, 15, 30, 0, time.Local),
+		},
+		{
+			name:   "syslog of last year",
+			sample: "Dec 31 23:59:59 host app[42]: started\n",
+			want:   "syslog",
+			ts:     time.Date(2025, 12, 31, 23, 59, 59, 0, time.Local),
+		},
+		{
+			name:   "time only of yesterday",
+			sample: "13:00:00.250 [main] INFO  c.e.App - started\n",
+			want:   "time",
+			ts:     time.Date(2026, 10, 18, 13, 0, 0, 250e6, time.Local),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := detectLogTimestampFormat([]byte(tt.sample), now)
+			require.NotNil(t, f)
+			assert.Equal(t, tt.want, f.name)
+
+			line, _, _ := strings.Cut(tt.sample, "\n")
+			ts, ok := f.timestamp([]byte(line), now)
+			require.True(t, ok)
+			assert.True(t, tt.ts.Equal(ts), "got %s", ts)
+		})
+	}
+
+	assert.Nil(t, detectLogTimestampFormat([]byte("no\ntimestamps\nhere\n"), now))
+}
+
+func TestRotatedSiblings(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"app.log.2.gz", "app-2026-10-18.log.gz", "app.log.1", "app.log", "app-error.log", "app.log.zip", "other.log.1", "app-access-2026-10-18.log", "app_gc.1.log"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+		at := base.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(path, at, at))
+	}
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "app.log.1"),
+		filepath.Join(dir, "app-2026-10-18.log.gz"),
+		filepath.Join(dir, "app.log.2.gz"),
+	}, rotatedSiblings(filepath.Join(dir, "app.log")))
+
+	assert.Equal(t, []string{filepath.Join(dir, "app.log"), filepath.Join(dir, "app-error.log"), filepath.Join(dir, "app_gc.1.log")},
+		withoutRotatedSiblings([]string{filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1"), filepath.Join(dir, "app-error.log"), filepath.Join(dir, "app_gc.1.log")}))
+}
+
+func TestIsRotationOf(t *testing.T) {
+	tests := map[string]bool{
+		"app.log.1":                 true,
+		"app.log.2.gz":              true,
+		"app.log-20261018":          true,
+		"app.log-2026-10-18.gz":     true,
+		"app.1.log":                 true,
+		"app-2026-10-18.log.gz":     true,
+		"app.2026-10-18.1.log":      true,
+		"app_2026-10-18_13.log":     true,
+		"app-access-2026-10-18.log": false,
+		"app_gc.1.log":              false,
+		"app-error.log":             false,
+		"app.log.old":               false,
+		"app-v2.log":                false,
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, isRotationOf(name, "app.log"), name)
+	}
+}
+
+// writeMinuteLog writes one line per minute from start, with a stack trace
+// after every tenth.
+func writeMinuteLog(t *testing.T, path string, start time.Time, minutes int, gz bool) {
+	var buf bytes.Buffer
+	for i := range minutes {
+		at := start.Add(time.Duration(i) * time.Minute)
+		fmt.Fprintf(&buf, "%s INFO line %s\n", at.UTC().Format("2006-01-02T15:04:05.000Z"), at.UTC().Format("15:04"))
+		if i%10 == 9 {
+			fmt.Fprintf(&buf, "java.lang.IllegalStateException: at %s\n\tat com.example.App.run(App.java:42)\n", at.UTC().Format("15:04"))
+		}
+	}
+
+	data := buf.Bytes()
+	if gz {
+		var zipped bytes.Buffer
+		w := gzip.NewWriter(&zipped)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data = zipped.Bytes()
+	}
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	end := start.Add(time.Duration(minutes-1) * time.Minute)
+	require.NoError(t, os.Chtimes(path, end, end))
+}
+
+func TestLogWindowExtract(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	live := filepath.Join(dir, "app.log")
+
+	writeMinuteLog(t, filepath.Join(dir, "app.log.2.gz"), start, 30, true)
+	writeMinuteLog(t, filepath.Join(dir, "app.log.1"), start.Add(30*time.Minute), 30, false)
+	writeMinuteLog(t, live, start.Add(60*time.Minute), 30, false)
+	// Older than the window, so it must not even be opened.
+	old := filepath.Join(dir, "app.log.3.gz")
+	require.NoError(t, os.WriteFile(old, []byte("not gzip"), 0644))
+	require.NoError(t, os.Chtimes(old, start.Add(-time.Minute), start.Add(-time.Minute)))
+
+	to := start.Add(89*time.Minute + 30*time.Second)
+	w, err := newLogWindow(live, start.Add(20*time.Minute), to)
+	require.NoError(t, err)
+	require.NotNil(t, w)
+
+	var out bytes.Buffer
+	_, err = w.extract(&out, live)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Contains(t, lines[0], "INFO line 10:20")
+	assert.Contains(t, lines[len(lines)-1], "com.example.App.run")
+	assert.Contains(t, lines[len(lines)-3], "INFO line 11:29")
+	assert.Equal(t, 70+7*2, len(lines), "70 minutes with 7 stack traces")
+	assert.Contains(t, out.String(), "\tat com.example.App.run(App.java:42)\n2026-10-19T10:30:00.000Z INFO line 10:30\n", "continues from the gzip into the rotated file")
+
+	t.Run("window end", func(t *testing.T) {
+		w, err := newLogWindow(live, start.Add(65*time.Minute), start.Add(70*time.Minute))
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		_, err = w.extract(&out, live)
+		require.NoError(t, err)
+		assert.Equal(t, 6, strings.Count(out.String(), "INFO line"))
+		assert.Contains(t, out.String(), "INFO line 11:05")
+		assert.Contains(t, out.String(), "INFO line 11:10")
+	})
+}
+
+func TestLogWindowSearch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.log")
+	start := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	// A week of lines, about 900KB.
+	writeMinuteLog(t, path, start, 7*24*60, false)
+
+	to := start.Add(7*24*time.Hour - time.Minute)
+	w, err := newLogWindow(path, to.Add(-15*time.Minute), to)
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.NoError(t, err)
+
+	offset, err := w.search(f, info.Size())
+	require.NoError(t, err)
+	assert.Greater(t, offset, info.Size()-8192, "search ends close to the window")
+
+	var out bytes.Buffer
+	_, err = w.extract(&out, path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out.String(), "2026-10-18T23:44:00.000Z INFO line 23:44\n"), out.String())
+	assert.Equal(t, 16, strings.Count(out.String(), "INFO line"))
+}
+
+func TestAppLogWindow(t *testing.T) {
+	oldOnlyCapture := config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture = oldOnlyCapture }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	// The last line is half a minute old.
+	writeMinuteLog(t, filepath.Join(dir, "app.log"), time.Now().Add(-2*time.Hour+30*time.Second), 120, false)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.log"), []byte("a\nb\nc\n"), 0644))
+
+	al := &AppLog{Paths: config.AppLogs{config.AppLog(filepath.Join(dir, "*.log"))}, LineLimit: 2, Window: 10 * time.Minute}
+	_, err = al.Run()
+	require.NoError(t, err)
+
+	windowed, err := os.ReadFile("1.appLogs.app.log")
+	require.NoError(t, err)
+	assert.Equal(t, 10, strings.Count(string(windowed), "INFO line"))
+
+	// Without timestamps it falls back to the last lines.
+	plain, err := os.ReadFile("1.appLogs.plain.log")
+	require.NoError(t, err)
+	assert.Equal(t, "b\nc\n", string(plain))
+}
@@ -20,8 +20,15 @@ type AppLogM3 struct {
 	// Paths maps a process ID to its configured log file patterns.
 	Paths map[int]config.AppLogs // int=pid
 
+	// Exceptions aggregates the stack traces of the new lines of each
+	// process into an exceptions summary.
+	Exceptions bool
+
 	// readStats tracks the last read position and file size per file.
 	readStats map[string]appLogM3ReadStat
+
+	// exceptions aggregates the stack traces of the process being captured.
+	exceptions *exceptionAggregator
 }
 
 // appLogM3ReadStat tracks the essential state needed for incremental log reading.
@@ -61,6 +68,10 @@ func (a *AppLogM3) Run() (Result, error) {
 
 	// Loop over process IDs and their associated log path patterns.
 	for pid, paths := range a.Paths {
+		if a.Exceptions {
+			a.exceptions = newExceptionAggregator()
+		}
+
 		for _, path := range paths {
 			matches, err := zglob.Glob(string(path))
 
@@ -81,6 +92,18 @@ func (a *AppLogM3) Run() (Result, error) {
 				errs = append(errs, e)
 			}
 		}
+
+		// The summary is only posted when there are new stack traces.
+		if a.exceptions != nil {
+			summary := a.exceptions.Summary()
+			summary.Pid = pid
+			if summary.Total > 0 {
+				r, e := postExceptionsSummary(a.Endpoint(), summary)
+				results = append(results, r)
+				errs = append(errs, e)
+			}
+			a.exceptions = nil
+		}
 	}
 
 	return summarizeResults(results, errs)
@@ -148,8 +171,15 @@ func (a *AppLogM3) CaptureSingleAppLog(filePath string, pid int) (Result, error)
 	}
 	defer dst.Close()
 
+	var out io.Writer = dst
+	if a.exceptions != nil {
+		scanner := a.exceptions.writer(filepath.Base(filePath))
+		defer scanner.Flush()
+		out = io.MultiWriter(dst, scanner)
+	}
+
 	// Copy new content from the source log.
-	bytesCopied, err := io.Copy(dst, src)
+	bytesCopied, err := io.Copy(out, src)
 	if err != nil {
 		return Result{}, fmt.Errorf("failed to copy content from %q: %w", filePath, err)
 	}
@@ -0,0 +1,326 @@
+package capture
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Audit rule severities, from least to most severe.
+const (
+	AuditSeverityInfo     = "info"
+	AuditSeverityWarning  = "warning"
+	AuditSeverityCritical = "critical"
+)
+
+// AuditRule flags a problem when all of its conditions hold against the
+// collected facts. Rules are loaded from YAML:
+//
+//	rules:
+//	  - id: heap-exceeds-container-limit
+//	    severity: critical
+//	    message: "Max heap {observed} exceeds the container memory limit {expected}"
+//	    recommendation: Lower -Xmx or raise the container memory limit.
+//	    conditions:
+//	      - fact: flag.MaxHeapSize
+//	        op: gt
+//	        valueFact: cgroup.memoryLimit
+//
+// A rule file given by the user is merged into the built-in rules by id: a
+// rule with a known id replaces the built-in one (or removes it when
+// disabled), any other rule is added.
+type AuditRule struct {
+	ID             string           `yaml:"id" json:"id"`
+	Severity       string           `yaml:"severity" json:"severity"`
+	Message        string           `yaml:"message" json:"message"`
+	Recommendation string           `yaml:"recommendation" json:"recommendation,omitempty"`
+	Runtimes       []string         `yaml:"runtimes" json:"runtimes,omitempty"`
+	Disabled       bool             `yaml:"disabled" json:"-"`
+	Conditions     []AuditCondition `yaml:"conditions" json:"conditions"`
+}
+
+// AuditCondition compares a fact with either a literal value or another
+// fact (optionally scaled). Supported ops: eq, ne, lt, le, gt, ge (numeric,
+// sizes like 512m are understood), contains, notContains, matches (regex),
+// present and missing. Apart from missing, a condition never holds for a
+// fact that wasn't collected.
+type AuditCondition struct {
+	Fact      string  `yaml:"fact" json:"fact"`
+	Op        string  `yaml:"op" json:"op"`
+	Value     string  `yaml:"value" json:"value,omitempty"`
+	ValueFact string  `yaml:"valueFact" json:"valueFact,omitempty"`
+	Scale     float64 `yaml:"scale" json:"scale,omitempty"`
+}
+
+// AuditFinding is a rule whose conditions all held.
+type AuditFinding struct {
+	ID             string `json:"id"`
+	Severity       string `json:"severity"`
+	Message        string `json:"message"`
+	Recommendation string `json:"recommendation,omitempty"`
+	// Observed and Expected are the values of the first condition.
+	Observed string `json:"observed,omitempty"`
+	Expected string `json:"expected,omitempty"`
+}
+
+type auditRuleFile struct {
+	Rules []AuditRule `yaml:"rules"`
+}
+
+// ParseAuditRules parses a YAML rule file.
+func ParseAuditRules(data []byte) ([]AuditRule, error) {
+	var file auditRuleFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse audit rules: %w", err)
+	}
+
+	for i, rule := range file.Rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("audit rule #%d has no id", i+1)
+		}
+		switch rule.Severity {
+		case "":
+			file.Rules[i].Severity = AuditSeverityWarning
+		case AuditSeverityInfo, AuditSeverityWarning, AuditSeverityCritical:
+		default:
+			return nil, fmt.Errorf("audit rule %s has unknown severity %q", rule.ID, rule.Severity)
+		}
+		if !rule.Disabled && len(rule.Conditions) == 0 {
+			return nil, fmt.Errorf("audit rule %s has no conditions", rule.ID)
+		}
+		for _, c := range rule.Conditions {
+			if !slices.Contains(auditOps, c.Op) {
+				return nil, fmt.Errorf("audit rule %s has unknown op %q", rule.ID, c.Op)
+			}
+		}
+	}
+
+	return file.Rules, nil
+}
+
+// LoadAuditRules parses the built-in rules and merges the user's rule file at
+// path into them, if path is set.
+func LoadAuditRules(builtin []byte, path string) ([]AuditRule, error) {
+	rules, err := ParseAuditRules(builtin)
+	if err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit rules %s: %w", path, err)
+	}
+	overrides, err := ParseAuditRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return MergeAuditRules(rules, overrides), nil
+}
+
+// MergeAuditRules merges overrides into rules by id.
+func MergeAuditRules(rules, overrides []AuditRule) []AuditRule {
+	merged := slices.Clone(rules)
+	for _, override := range overrides {
+		i := slices.IndexFunc(merged, func(r AuditRule) bool { return r.ID == override.ID })
+		if i >= 0 {
+			merged[i] = override
+		} else {
+			merged = append(merged, override)
+		}
+	}
+
+	return slices.DeleteFunc(merged, func(r AuditRule) bool { return r.Disabled })
+}
+
+// EvaluateAuditRules returns the findings of rules against facts, most severe
+// first. Rules restricted to other runtimes are skipped; an empty runtime
+// matches every rule.
+func EvaluateAuditRules(rules []AuditRule, facts map[string]string, runtime string) []AuditFinding {
+	findings := []AuditFinding{}
+
+	for _, rule := range rules {
+		if rule.Disabled || (runtime != "" && len(rule.Runtimes) > 0 && !slices.Contains(rule.Runtimes, runtime)) {
+			continue
+		}
+
+		holds := true
+		for _, c := range rule.Conditions {
+			if !c.holds(facts) {
+				holds = false
+				break
+			}
+		}
+		if !holds {
+			continue
+		}
+
+		observed, expected := rule.Conditions[0].values(facts)
+		message := strings.NewReplacer("{observed}", observed, "{expected}", expected).Replace(rule.Message)
+		findings = append(findings, AuditFinding{
+			ID:             rule.ID,
+			Severity:       rule.Severity,
+			Message:        message,
+			Recommendation: rule.Recommendation,
+			Observed:       observed,
+			Expected:       expected,
+		})
+	}
+
+	slices.SortStableFunc(findings, func(a, b AuditFinding) int {
+		return auditSeverityRank(b.Severity) - auditSeverityRank(a.Severity)
+	})
+
+	return findings
+}
+
+// SummarizeAuditFindings counts findings by severity, e.g. "1 critical, 2 warning".
+func SummarizeAuditFindings(findings []AuditFinding) string {
+	if len(findings) == 0 {
+		return "no findings"
+	}
+
+	var parts []string
+	for _, severity := range []string{AuditSeverityCritical, AuditSeverityWarning, AuditSeverityInfo} {
+		count := 0
+		for _, f := range findings {
+			if f.Severity == severity {
+				count++
+			}
+		}
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, severity))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func auditSeverityRank(severity string) int {
+	switch severity {
+	case AuditSeverityCritical:
+		return 2
+	case AuditSeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+var auditOps = []string{"eq", "ne", "lt", "le", "gt", "ge", "contains", "notContains", "matches", "present", "missing"}
+
+// values returns the observed fact and the value it is compared with.
+func (c AuditCondition) values(facts map[string]string) (observed, expected string) {
+	observed = facts[c.Fact]
+	expected = c.Value
+	if c.ValueFact != "" {
+		expected = facts[c.ValueFact]
+		if c.Scale != 0 {
+			if n, ok := parseAuditNumber(expected); ok {
+				expected = strconv.FormatFloat(n*c.Scale, 'f', -1, 64)
+			}
+		}
+	}
+	return observed, expected
+}
+
+func (c AuditCondition) holds(facts map[string]string) bool {
+	_, present := facts[c.Fact]
+	switch c.Op {
+	case "present":
+		return present
+	case "missing":
+		return !present
+	}
+	if !present {
+		return false
+	}
+	if c.ValueFact != "" {
+		if _, ok := facts[c.ValueFact]; !ok {
+			return false
+		}
+	}
+
+	observed, expected := c.values(facts)
+	switch c.Op {
+	case "eq":
+		return auditEqual(observed, expected)
+	case "ne":
+		return !auditEqual(observed, expected)
+	case "contains":
+		return strings.Contains(observed, expected)
+	case "notContains":
+		return !strings.Contains(observed, expected)
+	case "matches":
+		re, err := regexp.Compile(expected)
+		return err == nil && re.MatchString(observed)
+	}
+
+	o, ok := parseAuditNumber(observed)
+	if !ok {
+		return false
+	}
+	e, ok := parseAuditNumber(expected)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case "lt":
+		return o < e
+	case "le":
+		return o <= e
+	case "gt":
+		return o > e
+	case "ge":
+		return o >= e
+	}
+	return false
+}
+
+func auditEqual(a, b string) bool {
+	if x, ok := parseAuditNumber(a); ok {
+		if y, ok := parseAuditNumber(b); ok {
+			return x == y
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// parseAuditNumber parses numbers and JVM-style sizes (512k, 2m, 4g, 1t).
+func parseAuditNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) {
+		return 0, false
+	}
+	return n * multiplier, true
+}
@@ -0,0 +1,144 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditConditionHolds(t *testing.T) {
+	facts := map[string]string{
+		"flag.MaxHeapSize":   "4294967296",
+		"cgroup.memoryLimit": "2147483648",
+		"flag.UseSerialGC":   "true",
+		"cmdline":            "java -Xms1g -jar app.jar",
+		"empty":              "",
+	}
+
+	tests := []struct {
+		name      string
+		condition AuditCondition
+		want      bool
+	}{
+		{"gt value fact", AuditCondition{Fact: "flag.MaxHeapSize", Op: "gt", ValueFact: "cgroup.memoryLimit"}, true},
+		{"lt value fact", AuditCondition{Fact: "flag.MaxHeapSize", Op: "lt", ValueFact: "cgroup.memoryLimit"}, false},
+		{"scaled value fact", AuditCondition{Fact: "cgroup.memoryLimit", Op: "gt", ValueFact: "flag.MaxHeapSize", Scale: 0.25}, true},
+		{"size suffix", AuditCondition{Fact: "flag.MaxHeapSize", Op: "eq", Value: "4g"}, true},
+		{"bool eq is case insensitive", AuditCondition{Fact: "flag.UseSerialGC", Op: "eq", Value: "True"}, true},
+		{"ne", AuditCondition{Fact: "flag.UseSerialGC", Op: "ne", Value: "false"}, true},
+		{"contains", AuditCondition{Fact: "cmdline", Op: "contains", Value: "-Xms"}, true},
+		{"notContains", AuditCondition{Fact: "cmdline", Op: "notContains", Value: "-Xmx"}, true},
+		{"matches", AuditCondition{Fact: "cmdline", Op: "matches", Value: `-Xms\d+g`}, true},
+		{"eq empty", AuditCondition{Fact: "empty", Op: "eq", Value: ""}, true},
+		{"present", AuditCondition{Fact: "cgroup.memoryLimit", Op: "present"}, true},
+		{"missing", AuditCondition{Fact: "cgroup.cpuLimit", Op: "missing"}, true},
+		{"missing fact never compares", AuditCondition{Fact: "cgroup.cpuLimit", Op: "ne", Value: "1"}, false},
+		{"missing value fact never compares", AuditCondition{Fact: "flag.MaxHeapSize", Op: "gt", ValueFact: "cgroup.cpuLimit"}, false},
+		{"non numeric compare", AuditCondition{Fact: "cmdline", Op: "gt", Value: "1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.condition.holds(facts))
+		})
+	}
+}
+
+func TestEvaluateAuditRules(t *testing.T) {
+	rules, err := ParseAuditRules([]byte(`
+rules:
+  - id: low-limit
+    severity: info
+    message: "limit is {observed}, want {expected}"
+    conditions:
+      - fact: limit
+        op: lt
+        value: "10"
+  - id: heap-too-big
+    severity: critical
+    message: heap too big
+    conditions:
+      - fact: heap
+        op: gt
+        valueFact: limit
+  - id: node-only
+    runtimes: [nodejs]
+    message: node only
+    conditions:
+      - fact: limit
+        op: present
+`))
+	require.NoError(t, err)
+
+	findings := EvaluateAuditRules(rules, map[string]string{"limit": "5", "heap": "6"}, "java")
+
+	require.Len(t, findings, 2)
+	assert.Equal(t, "heap-too-big", findings[0].ID)
+	assert.Equal(t, AuditSeverityCritical, findings[0].Severity)
+	assert.Equal(t, "low-limit", findings[1].ID)
+	assert.Equal(t, "limit is 5, want 10", findings[1].Message)
+	assert.Equal(t, "1 critical, 1 info", SummarizeAuditFindings(findings))
+}
+
+func TestParseAuditRulesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"no id", "rules:\n  - conditions: [{fact: a, op: present}]\n"},
+		{"bad severity", "rules:\n  - id: a\n    severity: fatal\n    conditions: [{fact: a, op: present}]\n"},
+		{"bad op", "rules:\n  - id: a\n    conditions: [{fact: a, op: between}]\n"},
+		{"no conditions", "rules:\n  - id: a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAuditRules([]byte(tt.yaml))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadAuditRulesMergesOverrides(t *testing.T) {
+	builtin := []byte(`
+rules:
+  - id: a
+    message: a
+    conditions: [{fact: x, op: present}]
+  - id: b
+    message: b
+    conditions: [{fact: x, op: present}]
+`)
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - id: a
+    disabled: true
+  - id: b
+    severity: critical
+    message: b overridden
+    conditions: [{fact: x, op: present}]
+  - id: c
+    message: c
+    conditions: [{fact: x, op: present}]
+`), 0644))
+
+	rules, err := LoadAuditRules(builtin, path)
+	require.NoError(t, err)
+
+	require.Len(t, rules, 2)
+	assert.Equal(t, "b", rules[0].ID)
+	assert.Equal(t, "b overridden", rules[0].Message)
+	assert.Equal(t, AuditSeverityCritical, rules[0].Severity)
+	assert.Equal(t, "c", rules[1].ID)
+	assert.Equal(t, AuditSeverityWarning, rules[1].Severity)
+}
+
+func TestJVMAuditBuiltinRules(t *testing.T) {
+	rules, err := ParseAuditRules(jvmAuditBuiltinRules)
+	require.NoError(t, err)
+	assert.NotEmpty(t, rules)
+}
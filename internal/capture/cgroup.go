@@ -0,0 +1,202 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procFSRoot and cgroupFSRoot are where procfs and the cgroup hierarchy are
+// mounted. They are variables so tests can point them at fixtures.
+var (
+	procFSRoot   = "/proc"
+	cgroupFSRoot = "/sys/fs/cgroup"
+)
+
+// cgroupUnlimitedV1 is the threshold above which a cgroup v1 limit means
+// "no limit" (the kernel reports PAGE_COUNTER_MAX rounded to pages).
+const cgroupUnlimitedV1 = int64(1) << 62
+
+// Cgroup locates the cgroup of a process on the host.
+type Cgroup struct {
+	// Version is 1 or 2.
+	Version int
+	// Path is the cgroup path as listed in /proc/<pid>/cgroup. For v1 it is
+	// the path of the memory controller.
+	Path string
+	// dirs maps a controller to its directory; for v2 all controllers share
+	// the "" entry.
+	dirs map[string]string
+}
+
+// ResolveCgroup resolves the cgroup directories of pid from /proc/<pid>/cgroup.
+//
+// When the cgroup path doesn't exist under the cgroup mount, the agent is
+// most likely running in the target's cgroup namespace (e.g. as a sidecar),
+// where the target's cgroup is the root of the mount.
+func ResolveCgroup(pid int) (*Cgroup, error) {
+	data, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cgroup of pid %d: %w", pid, err)
+	}
+
+	unified, controllers := parseProcCgroup(data)
+
+	if _, err := os.Stat(filepath.Join(cgroupFSRoot, "cgroup.controllers")); err == nil && unified != "" {
+		return &Cgroup{
+			Version: 2,
+			Path:    unified,
+			dirs:    map[string]string{"": existingCgroupDir(cgroupFSRoot, unified)},
+		}, nil
+	}
+
+	if len(controllers) == 0 {
+		return nil, fmt.Errorf("no cgroup controllers found for pid %d", pid)
+	}
+
+	cg := &Cgroup{Version: 1, Path: controllers["memory"], dirs: map[string]string{}}
+	for name, path := range controllers {
+		// cpu and cpuacct are usually co-mounted as "cpu,cpuacct", with
+		// per-controller symlinks next to it.
+		mount := filepath.Join(cgroupFSRoot, name)
+		if _, err := os.Stat(mount); err != nil {
+			for joined, p := range controllers {
+				if p == path && strings.Contains(joined, ",") && strings.Contains(","+joined+",", ","+name+",") {
+					mount = filepath.Join(cgroupFSRoot, joined)
+				}
+			}
+		}
+		cg.dirs[name] = existingCgroupDir(mount, path)
+	}
+
+	return cg, nil
+}
+
+// parseProcCgroup parses /proc/<pid>/cgroup, i.e:
+//
+//	0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-abc.scope
+//	4:memory:/docker/abc
+//	3:cpu,cpuacct:/docker/abc
+//
+// It returns the unified (v2) path and the v1 paths by controller; co-mounted
+// controllers are listed both joined and individually.
+func parseProcCgroup(data []byte) (unified string, controllers map[string]string) {
+	controllers = map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+			continue
+		}
+		if parts[1] == "" {
+			continue
+		}
+		controllers[parts[1]] = parts[2]
+		for name := range strings.SplitSeq(parts[1], ",") {
+			name = strings.TrimPrefix(name, "name=")
+			controllers[name] = parts[2]
+		}
+	}
+
+	return unified, controllers
+}
+
+func existingCgroupDir(mount, path string) string {
+	dir := filepath.Join(mount, path)
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	return mount
+}
+
+// Dir returns the directory of controller ("memory", "cpu", "pids", "blkio"
+// or "io"); for cgroup v2 the controller is ignored.
+func (c *Cgroup) Dir(controller string) string {
+	if c.Version == 2 {
+		return c.dirs[""]
+	}
+	return c.dirs[controller]
+}
+
+// ReadFile reads a file of controller's cgroup directory.
+func (c *Cgroup) ReadFile(controller, name string) (string, error) {
+	dir := c.Dir(controller)
+	if dir == "" {
+		return "", fmt.Errorf("cgroup controller %s not found", controller)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// MemoryLimit returns the memory limit in bytes; ok is false when there is
+// no limit or it can't be read.
+func (c *Cgroup) MemoryLimit() (limit int64, ok bool) {
+	if c.Version == 2 {
+		value, err := c.ReadFile("memory", "memory.max")
+		if err != nil || value == "max" {
+			return 0, false
+		}
+		limit, err = strconv.ParseInt(value, 10, 64)
+		return limit, err == nil
+	}
+
+	value, err := c.ReadFile("memory", "memory.limit_in_bytes")
+	if err != nil {
+		return 0, false
+	}
+	limit, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || limit >= cgroupUnlimitedV1 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// CPULimit returns the CPU quota in cores; ok is false when there is no
+// quota or it can't be read.
+func (c *Cgroup) CPULimit() (cores float64, ok bool) {
+	var quota, period string
+
+	if c.Version == 2 {
+		value, err := c.ReadFile("cpu", "cpu.max")
+		if err != nil {
+			return 0, false
+		}
+		fields := strings.Fields(value)
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, period = fields[0], fields[1]
+	} else {
+		var err error
+		if quota, err = c.ReadFile("cpu", "cpu.cfs_quota_us"); err != nil {
+			return 0, false
+		}
+		if period, err = c.ReadFile("cpu", "cpu.cfs_period_us"); err != nil {
+			return 0, false
+		}
+	}
+
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return math.Round(q/p*100) / 100, true
+}
@@ -0,0 +1,365 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/logger"
+)
+
+const cgroupStatsOut = "cgroup-stats.json"
+
+// cgroupContainerMarkers are path fragments of cgroups created by container
+// runtimes and orchestrators.
+var cgroupContainerMarkers = []string{"docker", "kubepods", "containerd", "cri-o", "crio", "libpod", "lxc", "garden", "ecs/"}
+
+// IsContainer reports whether the cgroup belongs to a container.
+func (c *Cgroup) IsContainer() bool {
+	for _, marker := range cgroupContainerMarkers {
+		if strings.Contains(c.Path, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CgroupStats samples the resource usage of the target's cgroup over the
+// capture window, so throttling and near-OOM conditions of a container are
+// visible next to the host-level top and vmstat. cgroup v1 files are mapped
+// onto the v2 names (memory.current, cpu.max, cpu.stat throttled_usec,
+// io.stat rbytes/wbytes, ...).
+type CgroupStats struct {
+	Capture
+	Pid int
+	// Interval between samples; defaults to VMSTAT_INTERVAL.
+	Interval time.Duration
+	// Samples to take; defaults to the vmstat sample count.
+	Samples int
+}
+
+// CgroupSample is the state of a cgroup at one point in time.
+type CgroupSample struct {
+	Time          time.Time                   `json:"time"`
+	MemoryCurrent *int64                      `json:"memory.current,omitempty"`
+	MemoryMax     string                      `json:"memory.max,omitempty"`
+	MemoryEvents  map[string]int64            `json:"memory.events,omitempty"`
+	MemoryStat    map[string]int64            `json:"memory.stat,omitempty"`
+	CPUMax        string                      `json:"cpu.max,omitempty"`
+	CPUStat       map[string]int64            `json:"cpu.stat,omitempty"`
+	PidsCurrent   *int64                      `json:"pids.current,omitempty"`
+	PidsMax       string                      `json:"pids.max,omitempty"`
+	IOStat        map[string]map[string]int64 `json:"io.stat,omitempty"`
+}
+
+// CgroupStatsSummary highlights what changed over the sampled window.
+type CgroupStatsSummary struct {
+	PeakMemoryCurrent int64 `json:"peakMemoryCurrent,omitempty"`
+	MemoryLimit       int64 `json:"memoryLimit,omitempty"`
+	// PeakMemoryPercent is the peak memory.current as a percentage of the limit.
+	PeakMemoryPercent float64 `json:"peakMemoryPercent,omitempty"`
+	OOMEvents         int64   `json:"oomEvents"`
+	OOMKills          int64   `json:"oomKills"`
+	NrThrottled       int64   `json:"nrThrottled"`
+	ThrottledUsec     int64   `json:"throttledUsec"`
+	// ThrottledPercent is the share of CFS periods that were throttled.
+	ThrottledPercent float64 `json:"throttledPercent"`
+}
+
+type cgroupStatsReport struct {
+	Pid      int                `json:"pid"`
+	Version  int                `json:"version"`
+	Path     string             `json:"path"`
+	Interval string             `json:"interval"`
+	Summary  CgroupStatsSummary `json:"summary"`
+	Samples  []CgroupSample     `json:"samples"`
+}
+
+// Run samples the cgroup and uploads the time series.
+func (t *CgroupStats) Run() (Result, error) {
+	file, err := t.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "cgroupstats", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile samples the cgroup into cgroup-stats.json.
+func (t *CgroupStats) CaptureToFile() (*os.File, error) {
+	cg, err := ResolveCgroup(t.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Duration(executils.VMSTAT_INTERVAL) * time.Second
+	}
+	samples := t.Samples
+	if samples <= 0 {
+		samples = vmstatCount
+	}
+
+	logger.Log("Sampling cgroup v%d %s every %s", cg.Version, cg.Path, interval)
+
+	report := cgroupStatsReport{
+		Pid:      t.Pid,
+		Version:  cg.Version,
+		Path:     cg.Path,
+		Interval: interval.String(),
+	}
+	for i := range samples {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		report.Samples = append(report.Samples, sampleCgroup(cg))
+	}
+	report.Summary = summarizeCgroupSamples(report.Samples)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cgroup stats: %w", err)
+	}
+
+	file, err := os.Create(cgroupStatsOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", cgroupStatsOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", cgroupStatsOut, err)
+	}
+
+	return file, nil
+}
+
+// sampleCgroup reads the current state of cg. Files that don't exist (a
+// controller not enabled, an older kernel) are left out of the sample.
+func sampleCgroup(cg *Cgroup) CgroupSample {
+	sample := CgroupSample{Time: time.Now()}
+
+	read := func(controller, name string) (string, bool) {
+		value, err := cg.ReadFile(controller, name)
+		return value, err == nil
+	}
+	readInt := func(controller, name string) *int64 {
+		value, ok := read(controller, name)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	readKeyed := func(controller, name string) map[string]int64 {
+		value, ok := read(controller, name)
+		if !ok {
+			return nil
+		}
+		return parseCgroupKeyedFile(value)
+	}
+
+	sample.PidsCurrent = readInt("pids", "pids.current")
+	sample.PidsMax, _ = read("pids", "pids.max")
+	sample.MemoryStat = readKeyed("memory", "memory.stat")
+
+	if cg.Version == 2 {
+		sample.MemoryCurrent = readInt("memory", "memory.current")
+		sample.MemoryMax, _ = read("memory", "memory.max")
+		sample.MemoryEvents = readKeyed("memory", "memory.events")
+		sample.CPUMax, _ = read("cpu", "cpu.max")
+		sample.CPUStat = readKeyed("cpu", "cpu.stat")
+		if value, ok := read("io", "io.stat"); ok {
+			sample.IOStat = parseCgroupIOStat(value)
+		}
+		return sample
+	}
+
+	sample.MemoryCurrent = readInt("memory", "memory.usage_in_bytes")
+	if limit := readInt("memory", "memory.limit_in_bytes"); limit != nil {
+		sample.MemoryMax = cgroupV1Max(*limit)
+	}
+	// v1 has no memory.events; oom_control carries the oom_kill counter and
+	// failcnt counts the times the limit was hit.
+	sample.MemoryEvents = readKeyed("memory", "memory.oom_control")
+	if failcnt := readInt("memory", "memory.failcnt"); failcnt != nil {
+		if sample.MemoryEvents == nil {
+			sample.MemoryEvents = map[string]int64{}
+		}
+		sample.MemoryEvents["max"] = *failcnt
+	}
+
+	if quota := readInt("cpu", "cpu.cfs_quota_us"); quota != nil {
+		period, _ := read("cpu", "cpu.cfs_period_us")
+		if *quota < 0 {
+			sample.CPUMax = "max " + period
+		} else {
+			sample.CPUMax = strconv.FormatInt(*quota, 10) + " " + period
+		}
+	}
+	if stat := readKeyed("cpu", "cpu.stat"); stat != nil {
+		sample.CPUStat = map[string]int64{
+			"nr_periods":     stat["nr_periods"],
+			"nr_throttled":   stat["nr_throttled"],
+			"throttled_usec": stat["throttled_time"] / 1000,
+		}
+		if usage := readInt("cpuacct", "cpuacct.usage"); usage != nil {
+			sample.CPUStat["usage_usec"] = *usage / 1000
+		}
+	}
+
+	if value, ok := read("blkio", "blkio.throttle.io_service_bytes"); ok {
+		sample.IOStat = parseBlkioStat(value, "rbytes", "wbytes", nil)
+		if value, ok := read("blkio", "blkio.throttle.io_serviced"); ok {
+			sample.IOStat = parseBlkioStat(value, "rios", "wios", sample.IOStat)
+		}
+	}
+
+	return sample
+}
+
+func cgroupV1Max(limit int64) string {
+	if limit >= cgroupUnlimitedV1 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// parseCgroupKeyedFile parses flat keyed files such as memory.stat or cpu.stat:
+//
+//	nr_periods 100
+//	nr_throttled 3
+func parseCgroupKeyedFile(data string) map[string]int64 {
+	values := map[string]int64{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = n
+	}
+
+	return values
+}
+
+// parseCgroupIOStat parses the v2 io.stat file:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func parseCgroupIOStat(data string) map[string]map[string]int64 {
+	devices := map[string]map[string]int64{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		stats := map[string]int64{}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				stats[key] = n
+			}
+		}
+		devices[fields[0]] = stats
+	}
+
+	return devices
+}
+
+// parseBlkioStat parses v1 blkio.throttle.* files into io.stat style keys:
+//
+//	8:0 Read 1459200
+//	8:0 Write 314773504
+//	Total 316232704
+func parseBlkioStat(data, readKey, writeKey string, devices map[string]map[string]int64) map[string]map[string]int64 {
+	if devices == nil {
+		devices = map[string]map[string]int64{}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		var key string
+		switch fields[1] {
+		case "Read":
+			key = readKey
+		case "Write":
+			key = writeKey
+		default:
+			continue
+		}
+		n, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if devices[fields[0]] == nil {
+			devices[fields[0]] = map[string]int64{}
+		}
+		devices[fields[0]][key] = n
+	}
+
+	return devices
+}
+
+// summarizeCgroupSamples computes peaks and the change of the cumulative
+// counters between the first and the last sample.
+func summarizeCgroupSamples(samples []CgroupSample) CgroupStatsSummary {
+	var summary CgroupStatsSummary
+	if len(samples) == 0 {
+		return summary
+	}
+
+	for _, s := range samples {
+		if s.MemoryCurrent != nil && *s.MemoryCurrent > summary.PeakMemoryCurrent {
+			summary.PeakMemoryCurrent = *s.MemoryCurrent
+		}
+		if limit, err := strconv.ParseInt(s.MemoryMax, 10, 64); err == nil {
+			summary.MemoryLimit = limit
+		}
+	}
+	if summary.MemoryLimit > 0 {
+		summary.PeakMemoryPercent = roundPercent(float64(summary.PeakMemoryCurrent) / float64(summary.MemoryLimit))
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	delta := func(before, after map[string]int64, key string) int64 {
+		return after[key] - before[key]
+	}
+
+	summary.OOMEvents = delta(first.MemoryEvents, last.MemoryEvents, "oom")
+	summary.OOMKills = delta(first.MemoryEvents, last.MemoryEvents, "oom_kill")
+	summary.NrThrottled = delta(first.CPUStat, last.CPUStat, "nr_throttled")
+	summary.ThrottledUsec = delta(first.CPUStat, last.CPUStat, "throttled_usec")
+	if periods := delta(first.CPUStat, last.CPUStat, "nr_periods"); periods > 0 {
+		summary.ThrottledPercent = roundPercent(float64(summary.NrThrottled) / float64(periods))
+	}
+
+	return summary
+}
+
+func roundPercent(ratio float64) float64 {
+	return float64(int64(ratio*10000+0.5)) / 100
+}
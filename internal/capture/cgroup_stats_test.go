@@ -0,0 +1,123 @@
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupStatsV2(t *testing.T) {
+	withCgroupFixture(t, "0::/kubepods/pod1/abc\n", map[string]string{
+		"cgroup.controllers":               "cpu memory pids io",
+		"kubepods/pod1/abc/memory.current": "1073741824\n",
+		"kubepods/pod1/abc/memory.max":     "2147483648\n",
+		"kubepods/pod1/abc/memory.events":  "low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\n",
+		"kubepods/pod1/abc/memory.stat":    "anon 800000000\nfile 200000000\n",
+		"kubepods/pod1/abc/cpu.max":        "100000 100000\n",
+		"kubepods/pod1/abc/cpu.stat":       "usage_usec 5000\nnr_periods 200\nnr_throttled 50\nthrottled_usec 900000\n",
+		"kubepods/pod1/abc/pids.current":   "42\n",
+		"kubepods/pod1/abc/pids.max":       "max\n",
+		"kubepods/pod1/abc/io.stat":        "8:0 rbytes=100 wbytes=200 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+
+	dir := t.TempDir()
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(oldWd) })
+
+	task := &CgroupStats{Pid: 42, Interval: time.Millisecond, Samples: 2}
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, cgroupStatsOut))
+	require.NoError(t, err)
+
+	var report cgroupStatsReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.Equal(t, 2, report.Version)
+	assert.Equal(t, "/kubepods/pod1/abc", report.Path)
+	require.Len(t, report.Samples, 2)
+
+	sample := report.Samples[0]
+	assert.Equal(t, int64(1073741824), *sample.MemoryCurrent)
+	assert.Equal(t, "2147483648", sample.MemoryMax)
+	assert.Equal(t, int64(1), sample.MemoryEvents["oom_kill"])
+	assert.Equal(t, int64(800000000), sample.MemoryStat["anon"])
+	assert.Equal(t, "100000 100000", sample.CPUMax)
+	assert.Equal(t, int64(900000), sample.CPUStat["throttled_usec"])
+	assert.Equal(t, int64(42), *sample.PidsCurrent)
+	assert.Equal(t, "max", sample.PidsMax)
+	assert.Equal(t, int64(200), sample.IOStat["8:0"]["wbytes"])
+
+	assert.Equal(t, 50.0, report.Summary.PeakMemoryPercent)
+}
+
+func TestSampleCgroupV1(t *testing.T) {
+	withCgroupFixture(t, "5:pids:/docker/abc\n4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n2:blkio:/docker/abc\n", map[string]string{
+		"memory/docker/abc/memory.usage_in_bytes":          "524288000\n",
+		"memory/docker/abc/memory.limit_in_bytes":          "9223372036854771712\n",
+		"memory/docker/abc/memory.oom_control":             "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n",
+		"memory/docker/abc/memory.failcnt":                 "7\n",
+		"memory/docker/abc/memory.stat":                    "cache 100\nrss 200\n",
+		"cpu,cpuacct/docker/abc/cpu.cfs_quota_us":          "-1\n",
+		"cpu,cpuacct/docker/abc/cpu.cfs_period_us":         "100000\n",
+		"cpu,cpuacct/docker/abc/cpu.stat":                  "nr_periods 10\nnr_throttled 4\nthrottled_time 3000000\n",
+		"cpu,cpuacct/docker/abc/cpuacct.usage":             "8000000\n",
+		"pids/docker/abc/pids.current":                     "9\n",
+		"pids/docker/abc/pids.max":                         "1024\n",
+		"blkio/docker/abc/blkio.throttle.io_service_bytes": "8:0 Read 100\n8:0 Write 200\n8:0 Total 300\nTotal 300\n",
+		"blkio/docker/abc/blkio.throttle.io_serviced":      "8:0 Read 1\n8:0 Write 2\n8:0 Total 3\nTotal 3\n",
+	})
+
+	cg, err := ResolveCgroup(42)
+	require.NoError(t, err)
+	assert.True(t, cg.IsContainer())
+
+	sample := sampleCgroup(cg)
+
+	assert.Equal(t, int64(524288000), *sample.MemoryCurrent)
+	assert.Equal(t, "max", sample.MemoryMax)
+	assert.Equal(t, map[string]int64{"oom_kill_disable": 0, "under_oom": 0, "oom_kill": 2, "max": 7}, sample.MemoryEvents)
+	assert.Equal(t, "max 100000", sample.CPUMax)
+	assert.Equal(t, map[string]int64{"nr_periods": 10, "nr_throttled": 4, "throttled_usec": 3000, "usage_usec": 8000}, sample.CPUStat)
+	assert.Equal(t, int64(9), *sample.PidsCurrent)
+	assert.Equal(t, "1024", sample.PidsMax)
+	assert.Equal(t, map[string]map[string]int64{"8:0": {"rbytes": 100, "wbytes": 200, "rios": 1, "wios": 2}}, sample.IOStat)
+}
+
+func TestSummarizeCgroupSamples(t *testing.T) {
+	current := func(n int64) *int64 { return &n }
+	samples := []CgroupSample{
+		{
+			MemoryCurrent: current(900),
+			MemoryMax:     "1000",
+			MemoryEvents:  map[string]int64{"oom": 1, "oom_kill": 0},
+			CPUStat:       map[string]int64{"nr_periods": 100, "nr_throttled": 10, "throttled_usec": 1000},
+		},
+		{
+			MemoryCurrent: current(990),
+			MemoryMax:     "1000",
+			MemoryEvents:  map[string]int64{"oom": 3, "oom_kill": 1},
+			CPUStat:       map[string]int64{"nr_periods": 200, "nr_throttled": 35, "throttled_usec": 6000},
+		},
+	}
+
+	assert.Equal(t, CgroupStatsSummary{
+		PeakMemoryCurrent: 990,
+		MemoryLimit:       1000,
+		PeakMemoryPercent: 99,
+		OOMEvents:         2,
+		OOMKills:          1,
+		NrThrottled:       25,
+		ThrottledUsec:     5000,
+		ThrottledPercent:  25,
+	}, summarizeCgroupSamples(samples))
+}
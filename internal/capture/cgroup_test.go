@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withCgroupFixture points procFSRoot and cgroupFSRoot at temp dirs for the
+// duration of the test.
+func withCgroupFixture(t *testing.T, procCgroup string, files map[string]string) {
+	t.Helper()
+
+	proc := t.TempDir()
+	cgroup := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "42"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "42", "cgroup"), []byte(procCgroup), 0644))
+
+	for name, content := range files {
+		path := filepath.Join(cgroup, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	oldProc, oldCgroup := procFSRoot, cgroupFSRoot
+	procFSRoot, cgroupFSRoot = proc, cgroup
+	t.Cleanup(func() { procFSRoot, cgroupFSRoot = oldProc, oldCgroup })
+}
+
+func TestResolveCgroupV2(t *testing.T) {
+	withCgroupFixture(t, "0::/kubepods.slice/pod1/cri-abc.scope\n", map[string]string{
+		"cgroup.controllers":                              "cpu memory pids",
+		"kubepods.slice/pod1/cri-abc.scope/memory.max":    "2147483648\n",
+		"kubepods.slice/pod1/cri-abc.scope/cpu.max":       "150000 100000\n",
+		"kubepods.slice/pod1/cri-abc.scope/memory.events": "oom 0\n",
+	})
+
+	cg, err := ResolveCgroup(42)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, cg.Version)
+	assert.Equal(t, "/kubepods.slice/pod1/cri-abc.scope", cg.Path)
+
+	limit, ok := cg.MemoryLimit()
+	assert.True(t, ok)
+	assert.Equal(t, int64(2147483648), limit)
+
+	cores, ok := cg.CPULimit()
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, cores)
+}
+
+func TestResolveCgroupV2Namespaced(t *testing.T) {
+	// Inside a cgroup namespace the process's cgroup is the mount root.
+	withCgroupFixture(t, "0::/\n", map[string]string{
+		"cgroup.controllers": "cpu memory",
+		"memory.max":         "max\n",
+		"cpu.max":            "max 100000\n",
+	})
+
+	cg, err := ResolveCgroup(42)
+	require.NoError(t, err)
+
+	_, ok := cg.MemoryLimit()
+	assert.False(t, ok)
+	_, ok = cg.CPULimit()
+	assert.False(t, ok)
+}
+
+func TestResolveCgroupV1(t *testing.T) {
+	withCgroupFixture(t, "12:pids:/docker/abc\n4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n", map[string]string{
+		"memory/docker/abc/memory.limit_in_bytes":     "1073741824\n",
+		"cpu,cpuacct/docker/abc/cpu.cfs_quota_us":     "50000\n",
+		"cpu,cpuacct/docker/abc/cpu.cfs_period_us":    "100000\n",
+		"pids/docker/abc/pids.max":                    "max\n",
+		"cpu,cpuacct/docker/abc/cpuacct.usage_percpu": "1 2\n",
+	})
+
+	cg, err := ResolveCgroup(42)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, cg.Version)
+	assert.Equal(t, "/docker/abc", cg.Path)
+
+	limit, ok := cg.MemoryLimit()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1073741824), limit)
+
+	cores, ok := cg.CPULimit()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, cores)
+
+	pids, err := cg.ReadFile("pids", "pids.max")
+	require.NoError(t, err)
+	assert.Equal(t, "max", pids)
+}
+
+func TestResolveCgroupV1Unlimited(t *testing.T) {
+	withCgroupFixture(t, "4:memory:/\n3:cpu,cpuacct:/\n", map[string]string{
+		"memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+		"cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+	})
+
+	cg, err := ResolveCgroup(42)
+	require.NoError(t, err)
+
+	_, ok := cg.MemoryLimit()
+	assert.False(t, ok)
+	_, ok = cg.CPULimit()
+	assert.False(t, ok)
+}
@@ -0,0 +1,466 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// containerLogMaxBytes bounds the log of a container instance read from the
+// API.
+const containerLogMaxBytes = 100 << 20
+
+// podLogsRoot is where the kubelet writes the logs of the containers. It is
+// a variable so tests can point it at fixtures.
+var podLogsRoot = "/var/log/pods"
+
+// ContainerLogs captures what the containers of the pod the agent runs in
+// wrote to stdout and stderr, which neither AppLog nor auto-discovery finds.
+// The log of the previous instance of a container is captured too, as after
+// a crash loop it is the one telling why the container restarted.
+//
+// The logs are read from the kubelet files,
+// <podLogsRoot>/<namespace>_<pod>_<uid>/<container>/<restart>.log, when the
+// directory is mounted, or from the API otherwise. The CRI prefix of the
+// lines is stripped, and the last LineLimit lines or the lines of Window are
+// uploaded as app logs, <container>.log and <container>-previous.log.
+type ContainerLogs struct {
+	Capture
+	// PodName and Namespace select the pod as for KubernetesContext.
+	PodName   string
+	Namespace string
+	// Container, when set, captures this container only.
+	Container string
+	LineLimit int
+	// Window, when set, replaces LineLimit.
+	Window time.Duration
+	// Client defaults to the in-cluster configuration. It is only used when
+	// the kubelet files can't be read.
+	Client kubernetes.Interface
+}
+
+// containerInstance is the log files of an instance of a container, oldest
+// first.
+type containerInstance struct {
+	container string
+	restart   int
+	// previous is set for the instance before the current one.
+	previous bool
+	files    []string
+}
+
+// Run captures and uploads the container logs.
+func (c *ContainerLogs) Run() (Result, error) {
+	podName := c.PodName
+	if podName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to get the pod name: %w", err)
+		}
+		podName = hostname
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		if data, err := os.ReadFile(kubernetesNamespacePath); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	podDir, err := findPodLogDir(namespace, podName)
+	if err != nil {
+		logger.Log("container logs: %v, reading the logs from the API", err)
+		return c.captureFromAPI(namespace, podName)
+	}
+
+	instances, err := containerInstances(podDir, c.Container)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(instances) == 0 {
+		logger.Log("container logs: no log files in %s, reading the logs from the API", podDir)
+		return c.captureFromAPI(namespace, podName)
+	}
+
+	var results []Result
+	var errs []error
+	for _, instance := range instances {
+		r, err := c.captureInstance(instance)
+		results = append(results, r)
+		errs = append(errs, err)
+	}
+	return summarizeResults(results, errs)
+}
+
+// findPodLogDir returns the log directory of the pod, searching every
+// namespace when namespace is empty.
+func findPodLogDir(namespace, podName string) (string, error) {
+	if namespace == "" {
+		namespace = "*"
+	}
+	dirs, err := filepath.Glob(filepath.Join(podLogsRoot, namespace+"_"+podName+"_*"))
+	if err != nil {
+		return "", err
+	}
+	// A pod name is unique in its namespace; another directory would be a
+	// former pod of the same StatefulSet not yet cleaned up, so the latest
+	// one is taken.
+	var latest string
+	var latestMod time.Time
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestMod) {
+			latest, latestMod = dir, info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no log directory of pod %s in %s", podName, podLogsRoot)
+	}
+	return latest, nil
+}
+
+// containerInstances returns the current and previous instances of the
+// containers of the pod log directory, or of container only when set. The
+// kubelet names the log of an instance after its restart count, and rotates
+// it to <restart>.log.<timestamp>, compressing all but the latest rotated
+// file.
+func containerInstances(podDir, container string) ([]containerInstance, error) {
+	containers, err := os.ReadDir(podDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", podDir, err)
+	}
+
+	var instances []containerInstance
+	for _, dir := range containers {
+		if !dir.IsDir() || (container != "" && dir.Name() != container) {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(podDir, dir.Name()))
+		if err != nil {
+			logger.Log("container logs: %v", err)
+			continue
+		}
+
+		byRestart := make(map[int][]string)
+		for _, e := range entries {
+			name, _, _ := strings.Cut(e.Name(), ".log")
+			restart, err := strconv.Atoi(name)
+			if err != nil || e.IsDir() || !strings.HasPrefix(e.Name(), name+".log") {
+				continue
+			}
+			byRestart[restart] = append(byRestart[restart], filepath.Join(podDir, dir.Name(), e.Name()))
+		}
+
+		restarts := make([]int, 0, len(byRestart))
+		for restart := range byRestart {
+			restarts = append(restarts, restart)
+		}
+		slices.Sort(restarts)
+		// The kubelet keeps the last terminated instance only; older ones
+		// are leftovers.
+		restarts = restarts[max(len(restarts)-2, 0):]
+		for i, restart := range restarts {
+			files := byRestart[restart]
+			// The timestamps sort the rotated files; the live one, without a
+			// timestamp, is the latest.
+			slices.SortFunc(files, func(a, b string) int {
+				return strings.Compare(strings.TrimSuffix(a, ".gz"), strings.TrimSuffix(b, ".gz"))
+			})
+			live := filepath.Join(podDir, dir.Name(), strconv.Itoa(restart)+".log")
+			if j := slices.Index(files, live); j >= 0 {
+				files = append(slices.Delete(files, j, j+1), live)
+			}
+			instances = append(instances, containerInstance{
+				container: dir.Name(),
+				restart:   restart,
+				previous:  i < len(restarts)-1,
+				files:     files,
+			})
+		}
+	}
+	return instances, nil
+}
+
+// captureInstance uploads the log of a container instance.
+func (c *ContainerLogs) captureInstance(instance containerInstance) (Result, error) {
+	dstPath := generateUniqueLogPath(containerLogName(instance.container, instance.previous))
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	var from time.Time
+	if c.Window > 0 {
+		from = time.Now().Add(-c.Window)
+	}
+	w := newContainerLogWriter(dst, from, c.LineLimit)
+	for _, path := range instance.files {
+		if err := w.readFile(path); err != nil {
+			return Result{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("failed to write %q: %w", dstPath, err)
+	}
+	if err := dst.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
+	logger.Log("container logs: captured %d lines of %s, restart %d", w.lines, instance.container, instance.restart)
+
+	msg, ok := PostData(c.Endpoint(), buildPostData(filepath.Base(dstPath), "log", false), dst)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// captureFromAPI uploads the logs of the current and previous instances of
+// the containers of the pod, read from the API.
+func (c *ContainerLogs) captureFromAPI(namespace, podName string) (Result, error) {
+	client := c.Client
+	if client == nil {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to configure the in-cluster client: %w", err)
+		}
+		if client, err = kubernetes.NewForConfig(cfg); err != nil {
+			return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to create the kubernetes client: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	if namespace == "" {
+		namespace = podNamespace(ctx, client, podName)
+	}
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to get pod %s/%s: %w", namespace, podName, err)
+	}
+
+	var results []Result
+	var errs []error
+	for _, status := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		if c.Container != "" && status.Name != c.Container {
+			continue
+		}
+		for _, previous := range []bool{true, false} {
+			// Only a restarted container has a previous instance.
+			if previous && status.RestartCount == 0 && status.LastTerminationState.Terminated == nil {
+				continue
+			}
+			r, err := c.captureAPILog(ctx, client, pod, status.Name, previous)
+			results = append(results, r)
+			errs = append(errs, err)
+		}
+	}
+	if len(results) == 0 {
+		return Result{Msg: "skipped capturing container logs: no containers", Ok: true}, nil
+	}
+	return summarizeResults(results, errs)
+}
+
+func (c *ContainerLogs) captureAPILog(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod, container string, previous bool) (Result, error) {
+	limitBytes := int64(containerLogMaxBytes)
+	opts := &corev1.PodLogOptions{Container: container, Previous: previous, LimitBytes: &limitBytes}
+	if c.Window > 0 {
+		since := int64(c.Window.Seconds())
+		opts.SinceSeconds = &since
+	} else if c.LineLimit > 0 {
+		tail := int64(c.LineLimit)
+		opts.TailLines = &tail
+	}
+
+	stream, err := client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to get the logs of container %s (previous: %t): %w", container, previous, err)
+	}
+	defer stream.Close()
+
+	dstPath := generateUniqueLogPath(containerLogName(container, previous))
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, stream); err != nil {
+		return Result{}, fmt.Errorf("failed to read the logs of container %s: %w", container, err)
+	}
+	if err := dst.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
+
+	msg, ok := PostData(c.Endpoint(), buildPostData(filepath.Base(dstPath), "log", false), dst)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// containerLogName returns the app log name of the log of a container
+// instance.
+func containerLogName(container string, previous bool) string {
+	if previous {
+		return container + "-previous.log"
+	}
+	return container + ".log"
+}
+
+// containerLogWriter writes the messages of kubelet log lines to dst,
+// joining partial lines. Lines before from are dropped, and when limit isn't
+// -1 only the last limit messages are written, on Flush.
+type containerLogWriter struct {
+	dst   io.Writer
+	from  time.Time
+	limit int
+
+	partial []byte
+	// last is a ring of the last limit messages, next the index of the
+	// oldest once it is full.
+	last  [][]byte
+	next  int
+	lines int
+	err   error
+}
+
+func newContainerLogWriter(dst io.Writer, from time.Time, limit int) *containerLogWriter {
+	w := &containerLogWriter{dst: dst, from: from, limit: limit}
+	// The window replaces the line limit.
+	if !from.IsZero() {
+		w.limit = -1
+	}
+	return w
+}
+
+// readFile reads the kubelet log file at path, gzip compressed or not.
+func (w *containerLogWriter) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if len(line) > 0 {
+			w.addLine(line)
+		}
+		if errors.Is(readErr, io.EOF) {
+			return w.err
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// addLine adds a line of the CRI format,
+// "2026-10-19T09:15:30.123456789Z stdout F message", where P marks a partial
+// line continued by the next one, or of the docker json-file format,
+// {"log":"message\n","stream":"stdout","time":"..."}.
+func (w *containerLogWriter) addLine(line []byte) {
+	line = bytes.TrimRight(line, "\r\n")
+
+	var at time.Time
+	var msg []byte
+	partial := false
+	if bytes.HasPrefix(line, []byte("{")) {
+		var entry struct {
+			Log  string    `json:"log"`
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return
+		}
+		at, msg = entry.Time, []byte(entry.Log)
+		partial = !strings.HasSuffix(entry.Log, "\n")
+		msg = bytes.TrimSuffix(msg, []byte("\n"))
+	} else {
+		fields := bytes.SplitN(line, []byte(" "), 4)
+		if len(fields) < 3 {
+			return
+		}
+		t, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+		if err != nil {
+			return
+		}
+		at = t
+		partial = string(fields[2]) == "P"
+		if len(fields) == 4 {
+			msg = fields[3]
+		}
+	}
+
+	if !w.from.IsZero() && at.Before(w.from) {
+		return
+	}
+	w.partial = append(w.partial, msg...)
+	if partial {
+		return
+	}
+	w.addMessage(append(w.partial, '\n'))
+	w.partial = nil
+}
+
+func (w *containerLogWriter) addMessage(msg []byte) {
+	switch {
+	case w.limit < 0:
+		w.write(msg)
+	case w.limit == 0:
+	case len(w.last) < w.limit:
+		w.last = append(w.last, msg)
+	default:
+		w.last[w.next] = msg
+		w.next = (w.next + 1) % w.limit
+	}
+}
+
+func (w *containerLogWriter) write(msg []byte) {
+	if w.err != nil {
+		return
+	}
+	if _, w.err = w.dst.Write(msg); w.err == nil {
+		w.lines++
+	}
+}
+
+// Flush writes a trailing partial line and the last lines kept for the line
+// limit.
+func (w *containerLogWriter) Flush() error {
+	if len(w.partial) > 0 {
+		w.addMessage(append(w.partial, '\n'))
+		w.partial = nil
+	}
+	for i := range w.last {
+		w.write(w.last[(w.next+i)%len(w.last)])
+	}
+	w.last, w.next = nil, 0
+	return w.err
+}
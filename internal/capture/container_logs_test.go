@@ -0,0 +1,161 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestContainerLogWriter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	cri := func(ago time.Duration, tag, msg string) string {
+		return now.Add(-ago).Format(time.RFC3339Nano) + " stdout " + tag + " " + msg + "\n"
+	}
+	log := cri(3*time.Hour, "F", "starting") +
+		cri(30*time.Minute, "P", "a long ") +
+		cri(30*time.Minute, "F", "line") +
+		cri(20*time.Minute, "F", "") +
+		"not a kubelet line\n" +
+		`{"log":"from docker\n","stream":"stderr","time":"` + now.Add(-10*time.Minute).Format(time.RFC3339Nano) + `"}` + "\n" +
+		cri(time.Minute, "P", "cut off")
+	path := filepath.Join(t.TempDir(), "0.log")
+	require.NoError(t, os.WriteFile(path, []byte(log), 0644))
+
+	tests := []struct {
+		name  string
+		from  time.Time
+		limit int
+		want  string
+	}{
+		{name: "all", limit: -1, want: "starting\na long line\n\nfrom docker\ncut off\n"},
+		{name: "last lines", limit: 2, want: "from docker\ncut off\n"},
+		{name: "no lines", limit: 0, want: ""},
+		{name: "window", from: now.Add(-time.Hour), limit: 1, want: "a long line\n\nfrom docker\ncut off\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst bytes.Buffer
+			w := newContainerLogWriter(&dst, tt.from, tt.limit)
+			require.NoError(t, w.readFile(path))
+			require.NoError(t, w.Flush())
+			assert.Equal(t, tt.want, dst.String())
+			assert.Equal(t, strings.Count(tt.want, "\n"), w.lines)
+		})
+	}
+}
+
+func TestContainerLogsFromPodLogDir(t *testing.T) {
+	oldOnlyCapture, oldRoot := config.GlobalConfig.OnlyCapture, podLogsRoot
+	config.GlobalConfig.OnlyCapture = true
+	podLogsRoot = t.TempDir()
+	defer func() { config.GlobalConfig.OnlyCapture, podLogsRoot = oldOnlyCapture, oldRoot }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	line := func(msg string) string {
+		return time.Now().UTC().Format(time.RFC3339Nano) + " stdout F " + msg + "\n"
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(line("run 1, rotated")))
+	require.NoError(t, zw.Close())
+
+	appDir := filepath.Join(podLogsRoot, "shop_web-0_uid-1", "app")
+	files := map[string]string{
+		"0.log":                    line("run 0, a leftover"),
+		"1.log.20261019-080000.gz": gz.String(),
+		"1.log":                    line("run 1") + line("OutOfMemoryError"),
+		"2.log":                    line("run 2"),
+	}
+	require.NoError(t, os.MkdirAll(appDir, 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(appDir, name), []byte(content), 0644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(podLogsRoot, "shop_web-0_uid-1", "sidecar"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(podLogsRoot, "shop_web-0_uid-1", "sidecar", "0.log"), []byte(line("sidecar")), 0644))
+
+	c := &ContainerLogs{PodName: "web-0", Container: "app", LineLimit: 10}
+	_, err = c.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("1.appLogs.app-previous.log")
+	require.NoError(t, err)
+	assert.Equal(t, "run 1, rotated\nrun 1\nOutOfMemoryError\n", string(data))
+	data, err = os.ReadFile("1.appLogs.app.log")
+	require.NoError(t, err)
+	assert.Equal(t, "run 2\n", string(data))
+	assert.False(t, fileExists("1.appLogs.sidecar.log"))
+}
+
+func TestContainerLogsFromAPI(t *testing.T) {
+	oldOnlyCapture, oldRoot := config.GlobalConfig.OnlyCapture, podLogsRoot
+	config.GlobalConfig.OnlyCapture = true
+	podLogsRoot = t.TempDir()
+	defer func() { config.GlobalConfig.OnlyCapture, podLogsRoot = oldOnlyCapture, oldRoot }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	client := fake.NewClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "shop"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "app", RestartCount: 2},
+			{Name: "sidecar"},
+		}},
+	})
+
+	c := &ContainerLogs{PodName: "web-0", Namespace: "shop", LineLimit: 10, Client: client}
+	_, err = c.Run()
+	require.NoError(t, err)
+
+	// The fake clientset answers every log request with "fake logs".
+	assert.True(t, fileExists("1.appLogs.app-previous.log"))
+	assert.True(t, fileExists("1.appLogs.app.log"))
+	assert.True(t, fileExists("1.appLogs.sidecar.log"))
+	assert.False(t, fileExists("1.appLogs.sidecar-previous.log"))
+}
+
+func TestContainerLogsEmptyPodLogDirFallsBackToAPI(t *testing.T) {
+	oldOnlyCapture, oldRoot := config.GlobalConfig.OnlyCapture, podLogsRoot
+	config.GlobalConfig.OnlyCapture = true
+	podLogsRoot = t.TempDir()
+	defer func() { config.GlobalConfig.OnlyCapture, podLogsRoot = oldOnlyCapture, oldRoot }()
+	t.Chdir(t.TempDir())
+
+	// The kubelet created the directories, but the logs went elsewhere.
+	require.NoError(t, os.MkdirAll(filepath.Join(podLogsRoot, "shop_web-0_uid-1", "app"), 0755))
+
+	client := fake.NewClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "shop"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "app"},
+			{Name: "sidecar"},
+		}},
+	})
+
+	c := &ContainerLogs{PodName: "web-0", Namespace: "shop", Container: "app", LineLimit: 10, Client: client}
+	_, err := c.Run()
+	require.NoError(t, err)
+
+	assert.True(t, fileExists("1.appLogs.app.log"))
+	assert.False(t, fileExists("1.appLogs.sidecar.log"))
+}
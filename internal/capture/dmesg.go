@@ -1,28 +1,61 @@
 package capture
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"time"
 
 	"yc-agent/internal/capture/executils"
 	"yc-agent/internal/logger"
 )
 
-const dmesgOutputPath = "dmesg.out"
+const (
+	dmesgOutputPath  = "dmesg.out"
+	dmesgSummaryPath = "dmesg-summary.json"
+)
 
 // ErrNonZeroExit indicates that a command exited with a non-zero status code.
 var ErrNonZeroExit = errors.New("command exited with non-zero status")
 
 // DMesgCapture handles the capture of kernel message buffer data.
+//
+// On Linux the whole kernel log of the window is captured, along with a
+// summary of the OOM kills, crashes, hung tasks, lockups and disk and NIC
+// errors it contains. Elsewhere, or when the kernel log can't be read, the
+// last warnings of the dmesg command are captured.
 type DMesg struct {
 	Capture
+	// Pid is the target process. Its OOM kills are flagged in the summary.
+	Pid int
+	// Window of messages to capture. When zero, messages since the start of
+	// Pid are captured, or the whole buffer when Pid isn't set.
+	Window time.Duration
+}
+
+type dmesgSummaryReport struct {
+	Source   string           `json:"source"`
+	Pid      int              `json:"pid,omitempty"`
+	Since    *time.Time       `json:"since,omitempty"`
+	Messages int              `json:"messages"`
+	Levels   map[string]int   `json:"levels"`
+	Summary  KernelLogSummary `json:"summary"`
 }
 
 // Run executes the dmesg capture process and uploads the captured file
 // to the specified endpoint.
 func (d *DMesg) Run() (Result, error) {
+	if runtime.GOOS == "linux" {
+		result, err := d.runKernelLog()
+		if err == nil {
+			return result, nil
+		}
+		logger.Log("failed to read the kernel log, falling back to dmesg command: %v", err)
+	}
+
 	if executils.DMesg == nil && executils.DMesg2 == nil {
 		return Result{
 			Msg: "skipped capturing DMesg",
@@ -40,6 +73,83 @@ func (d *DMesg) Run() (Result, error) {
 	return result, nil
 }
 
+// runKernelLog captures the kernel log of the window to dmesg.out and its
+// summary to dmesg-summary.json, and uploads both.
+func (d *DMesg) runKernelLog() (Result, error) {
+	entries, source, err := readKernelLog()
+	if err != nil {
+		return Result{}, err
+	}
+
+	report := dmesgSummaryReport{Source: source, Pid: d.Pid, Levels: map[string]int{}}
+	if since, ok := d.since(); ok {
+		report.Since = &since
+		entries = kernelLogSince(entries, since)
+	}
+	report.Messages = len(entries)
+	for _, e := range entries {
+		report.Levels[e.LevelName()]++
+	}
+	report.Summary = parseKernelEvents(entries, d.Pid)
+
+	logFile, err := os.Create(dmesgOutputPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer logFile.Close()
+	if err := writeKernelLog(logFile, entries); err != nil {
+		return Result{}, fmt.Errorf("failed to write %s: %w", dmesgOutputPath, err)
+	}
+	if _, err := logFile.Seek(0, io.SeekStart); err != nil {
+		return Result{}, fmt.Errorf("failed to seek to start: %w", err)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to marshal dmesg summary: %w", err)
+	}
+	summaryFile, err := os.Create(dmesgSummaryPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create %s: %w", dmesgSummaryPath, err)
+	}
+	defer summaryFile.Close()
+	if _, err := summaryFile.Write(data); err != nil {
+		return Result{}, fmt.Errorf("failed to write %s: %w", dmesgSummaryPath, err)
+	}
+
+	logger.Log("Captured %d kernel messages from %s, %d OOM kills", report.Messages, source, len(report.Summary.OOMKills))
+
+	logResult := d.UploadCapturedFile(logFile)
+	msg, ok := PostData(d.Endpoint(), "dmesgsummary", summaryFile)
+	return summarizeResults([]Result{logResult, {Msg: msg, Ok: ok}}, []error{nil, nil})
+}
+
+// since returns the start of the window, if any.
+func (d *DMesg) since() (time.Time, bool) {
+	if d.Window > 0 {
+		return time.Now().Add(-d.Window), true
+	}
+	if d.Pid > 0 {
+		ts, err := GetProcessStartTimestamp(d.Pid)
+		if err != nil {
+			logger.Log("failed to get the start time of pid %d, capturing the whole kernel log: %v", d.Pid, err)
+			return time.Time{}, false
+		}
+		return time.Unix(0, ts), true
+	}
+	return time.Time{}, false
+}
+
+// kernelLogSince returns the entries logged at or after since.
+func kernelLogSince(entries []KernelLogEntry, since time.Time) []KernelLogEntry {
+	for i, e := range entries {
+		if !e.Time.Before(since) {
+			return entries[i:]
+		}
+	}
+	return nil
+}
+
 // CaptureToFile captures dmesg output to a file, handling both primary and fallback commands.
 // It returns the file handle for the captured data.
 func (d *DMesg) CaptureToFile() (*os.File, error) {
@@ -0,0 +1,433 @@
+package capture
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// exceptionFingerprintFrames is how many top frames, with the
+	// exception type, identify an exception.
+	exceptionFingerprintFrames = 3
+	// exceptionReportedFrames is how many top frames of the first
+	// occurrence the summary reports.
+	exceptionReportedFrames = 5
+	// maxExceptionStats bounds the distinct exceptions of a summary; the
+	// occurrences of the others are only counted.
+	maxExceptionStats = 500
+	// maxExceptionLogs bounds the logs reported per exception.
+	maxExceptionLogs = 10
+	// maxExceptionMessage truncates the reported message.
+	maxExceptionMessage = 500
+
+	exceptionsSummaryFile = "exceptions-summary.json"
+)
+
+var (
+	// stackFrame matches a frame of a Java, .NET or Node stack trace:
+	// "\tat com.example.App.run(App.java:42)",
+	// "   at Example.App.Run() in /src/App.cs:line 42",
+	// "    at run (/app/index.js:42:7)".
+	stackFrame = regexp.MustCompile(`^\s+at \S`)
+	// stackOmitted matches Java's "... 12 more" and
+	// "... 12 common frames omitted".
+	stackOmitted = regexp.MustCompile(`^\s*\.\.\. \d+ (more|common frames omitted)`)
+	// exceptionLine matches a line that is an exception, like
+	// "java.lang.IllegalStateException: boom", "System.Exception" or
+	// "TypeError: x is undefined".
+	exceptionLine = regexp.MustCompile(`^\s*(?:Exception in thread "[^"]*" |Uncaught |Unhandled exception\. )?([A-Za-z_$][\w$.]*)(?::\s?(.*))?$`)
+	// exceptionInLine matches an exception type in a log line with a
+	// prefix, like "ERROR [main] App - java.io.IOException: disk full".
+	exceptionInLine = regexp.MustCompile(`((?:[A-Za-z_$][\w$]*\.)*[A-Za-z_$][\w$]*(?:Exception|Error|Throwable|Fault))(?::\s?(.*))?`)
+	// nodeFrameLocation matches the location of a Node frame,
+	// "run (/app/index.js:42:7)" or "/app/index.js:42:7".
+	nodeFrameLocation = regexp.MustCompile(`^(?:(\S.*) \()?([^()]+?):\d+:\d+\)?$`)
+	// generatedFrameName matches the parts of a class name that change
+	// between runs of a JVM, like "$$Lambda$123/0x0000000800c0b040".
+	generatedFrameName = regexp.MustCompile(`(\$\$Lambda|\$Proxy|GeneratedMethodAccessor|\$\$EnhancerBySpringCGLIB)[$\w/]*`)
+)
+
+// ExceptionsSummary aggregates the stack traces found in app logs.
+type ExceptionsSummary struct {
+	Pid        int       `json:"pid,omitempty"`
+	CapturedAt time.Time `json:"capturedAt"`
+	// Logs are the names of the analyzed logs.
+	Logs []string `json:"logs"`
+	// Total counts all the stack traces, Dropped the ones of exceptions
+	// past the distinct limit.
+	Total      int             `json:"total"`
+	Dropped    int             `json:"dropped,omitempty"`
+	Exceptions []ExceptionStat `json:"exceptions"`
+}
+
+// ExceptionStat are the occurrences of one exception: a type thrown from
+// the same top frames.
+type ExceptionStat struct {
+	Fingerprint string `json:"fingerprint"`
+	Type        string `json:"type"`
+	// Message, Causes and Frames are of the first occurrence.
+	Message   string    `json:"message,omitempty"`
+	Causes    []string  `json:"causes,omitempty"`
+	Frames    []string  `json:"frames"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen,omitzero"`
+	LastSeen  time.Time `json:"lastSeen,omitzero"`
+	Logs      []string  `json:"logs"`
+}
+
+// exceptionAggregator aggregates the stack traces of the logs written to
+// its writers.
+type exceptionAggregator struct {
+	now   func() time.Time
+	logs  []string
+	stats map[string]*ExceptionStat
+
+	total, dropped int
+}
+
+func newExceptionAggregator() *exceptionAggregator {
+	return &exceptionAggregator{
+		now:   time.Now,
+		stats: make(map[string]*ExceptionStat),
+	}
+}
+
+// writer returns the writer the lines of the log logName are written to.
+// It must be flushed once the log is written.
+func (a *exceptionAggregator) writer(logName string) *exceptionScanner {
+	if !slices.Contains(a.logs, logName) {
+		a.logs = append(a.logs, logName)
+	}
+	return &exceptionScanner{agg: a, logName: logName}
+}
+
+func (a *exceptionAggregator) add(t *stackTrace, logName string) {
+	a.total++
+
+	fingerprint := t.fingerprint()
+	s, ok := a.stats[fingerprint]
+	if !ok {
+		if len(a.stats) >= maxExceptionStats {
+			a.dropped++
+			return
+		}
+		s = &ExceptionStat{
+			Fingerprint: fingerprint,
+			Type:        t.typ,
+			Message:     t.message,
+			Causes:      t.causes,
+			Frames:      t.frames,
+			FirstSeen:   t.at,
+		}
+		a.stats[fingerprint] = s
+	}
+
+	s.Count++
+	if !t.at.IsZero() {
+		if s.FirstSeen.IsZero() || t.at.Before(s.FirstSeen) {
+			s.FirstSeen = t.at
+		}
+		if t.at.After(s.LastSeen) {
+			s.LastSeen = t.at
+		}
+	}
+	if len(s.Logs) < maxExceptionLogs && !slices.Contains(s.Logs, logName) {
+		s.Logs = append(s.Logs, logName)
+	}
+}
+
+// Summary returns the exceptions of the flushed logs, the most frequent
+// first.
+func (a *exceptionAggregator) Summary() ExceptionsSummary {
+	summary := ExceptionsSummary{
+		CapturedAt: a.now(),
+		Logs:       slices.Clone(a.logs),
+		Total:      a.total,
+		Dropped:    a.dropped,
+		Exceptions: []ExceptionStat{},
+	}
+	for _, s := range a.stats {
+		summary.Exceptions = append(summary.Exceptions, *s)
+	}
+	slices.SortFunc(summary.Exceptions, func(a, b ExceptionStat) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		if c := a.FirstSeen.Compare(b.FirstSeen); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Fingerprint, b.Fingerprint)
+	})
+	return summary
+}
+
+// stackTrace is a stack trace being read.
+type stackTrace struct {
+	typ     string
+	message string
+	at      time.Time
+	causes  []string
+	// frames are the top frames of the outermost exception, without the
+	// "at ".
+	frames []string
+	// nested is set past the frames of the outermost exception: in a Java
+	// cause or suppressed exception, or in a .NET inner exception, which
+	// are printed before the outer frames.
+	nested bool
+	inner  int
+}
+
+// newStackTrace returns the stack trace of the exception in header, the
+// line before the first frame, or nil when header isn't an exception.
+func newStackTrace(header []byte, at time.Time) *stackTrace {
+	line := string(header)
+	// .NET prints the inner exceptions on the same line:
+	// "System.Exception: outer ---> System.IO.IOException: inner".
+	parts := strings.Split(line, " ---> ")
+
+	typ, message, ok := parseExceptionLine(parts[0])
+	if !ok {
+		return nil
+	}
+	t := &stackTrace{typ: typ, message: truncateMessage(message), at: at, inner: len(parts) - 1}
+	for _, p := range parts[1:] {
+		t.addCause(p)
+	}
+	return t
+}
+
+// parseExceptionLine returns the type and message of the exception in line.
+func parseExceptionLine(line string) (string, string, bool) {
+	if m := exceptionLine.FindStringSubmatch(line); m != nil {
+		return m[1], strings.TrimSpace(m[2]), true
+	}
+	if m := exceptionInLine.FindStringSubmatch(line); m != nil {
+		return m[1], strings.TrimSpace(m[2]), true
+	}
+	return "", "", false
+}
+
+func (t *stackTrace) addCause(line string) {
+	if typ, _, ok := parseExceptionLine(strings.TrimSpace(line)); ok {
+		t.causes = append(t.causes, typ)
+	}
+}
+
+// add adds a line following the frames read so far, and reports whether
+// it continues the stack trace.
+func (t *stackTrace) add(line []byte) bool {
+	s := string(line)
+	trimmed := strings.TrimSpace(s)
+	switch {
+	case stackFrame.MatchString(s):
+		if !t.nested && t.inner == 0 && len(t.frames) < exceptionReportedFrames {
+			t.frames = append(t.frames, strings.TrimPrefix(trimmed, "at "))
+		}
+	case stackOmitted.MatchString(s):
+	case strings.HasPrefix(trimmed, "Caused by: "):
+		t.nested = true
+		t.addCause(strings.TrimPrefix(trimmed, "Caused by: "))
+	case strings.HasPrefix(trimmed, "Suppressed: "):
+		t.nested = true
+	case strings.HasPrefix(trimmed, "---> "):
+		t.inner++
+		t.addCause(strings.TrimPrefix(trimmed, "---> "))
+	case strings.HasPrefix(trimmed, "--- End of inner exception stack trace ---"):
+		t.inner = max(t.inner-1, 0)
+	case strings.HasPrefix(trimmed, "--- End of stack trace from previous location"):
+	default:
+		return false
+	}
+	return true
+}
+
+// fingerprint identifies the exception by its type and top frames, without
+// their line numbers and generated class names.
+func (t *stackTrace) fingerprint() string {
+	h := sha1.New()
+	h.Write([]byte(t.typ))
+	for _, f := range t.frames[:min(len(t.frames), exceptionFingerprintFrames)] {
+		h.Write([]byte{'\n'})
+		h.Write([]byte(normalizeFrame(f)))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// normalizeFrame returns the method of a frame: "com.example.App.run" of
+// "app//com.example.App.run(App.java:42)" or
+// "Example.App.Run() in /src/App.cs:line 42", and the function and file of
+// a Node frame, "run /app/index.js" of "run (/app/index.js:42:7)".
+func normalizeFrame(frame string) string {
+	frame = strings.TrimPrefix(frame, "async ")
+	if m := nodeFrameLocation.FindStringSubmatch(frame); m != nil {
+		return strings.TrimSpace(m[1] + " " + m[2])
+	}
+	if i := strings.IndexByte(frame, '('); i > 0 {
+		frame = frame[:i]
+	}
+	// The class loader and module of Java 9+ frames.
+	if i := strings.LastIndexByte(frame, '/'); i >= 0 && !strings.Contains(frame, "$$Lambda") {
+		frame = frame[i+1:]
+	}
+	return strings.TrimSpace(generatedFrameName.ReplaceAllString(frame, "${1}"))
+}
+
+func truncateMessage(message string) string {
+	if len(message) <= maxExceptionMessage {
+		return message
+	}
+	return strings.ToValidUTF8(message[:maxExceptionMessage], "") + "..."
+}
+
+// exceptionScanner reads the stack traces of one log written to it. A
+// stack trace starts at the line before its first frame and gets the time
+// of the last timestamped line up to it.
+type exceptionScanner struct {
+	agg     *exceptionAggregator
+	logName string
+
+	partial []byte
+	format  *logTimestampFormat
+	// prev is the last line that isn't part of a stack trace, and
+	// lastTime the last time of a line.
+	prev     []byte
+	lastTime time.Time
+	trace    *stackTrace
+}
+
+// Write scans the complete lines of p; a trailing partial line is kept for
+// the next write or Flush.
+func (s *exceptionScanner) Write(p []byte) (int, error) {
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+		s.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		s.addLine(data[:i])
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		s.partial = append([]byte(nil), data...)
+	}
+	return len(p), nil
+}
+
+// Flush scans the trailing partial line and adds the last stack trace.
+func (s *exceptionScanner) Flush() {
+	if len(s.partial) > 0 {
+		s.addLine(s.partial)
+		s.partial = nil
+	}
+	s.endTrace()
+}
+
+func (s *exceptionScanner) addLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if s.trace != nil {
+		if s.trace.add(line) {
+			return
+		}
+		s.endTrace()
+	}
+
+	if s.prev != nil && stackFrame.Match(line) {
+		if t := newStackTrace(s.prev, s.lastTime); t != nil {
+			s.trace = t
+			s.prev = nil
+			t.add(line)
+			return
+		}
+	}
+
+	if ts, ok := s.timestamp(line); ok {
+		s.lastTime = ts
+	}
+	s.prev = append(s.prev[:0], line...)
+}
+
+func (s *exceptionScanner) endTrace() {
+	if s.trace != nil {
+		s.agg.add(s.trace, s.logName)
+		s.trace = nil
+	}
+}
+
+// timestamp returns the time of line in the format of the first
+// timestamped line of the log.
+func (s *exceptionScanner) timestamp(line []byte) (time.Time, bool) {
+	now := s.agg.now()
+	if s.format != nil {
+		return s.format.timestamp(line, now)
+	}
+	for _, f := range logTimestampFormats {
+		if ts, ok := f.timestamp(line, now); ok {
+			s.format = f
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// postExceptionsSummary writes summary to exceptions-summary.json and posts
+// it.
+func postExceptionsSummary(endpoint string, summary ExceptionsSummary) (Result, error) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode exceptions summary: %w", err)
+	}
+
+	f, err := createUniqueExceptionsSummaryFile()
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	dstPath := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		return Result{}, fmt.Errorf("failed to write exceptions summary %q: %w", dstPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
+
+	dt := "exceptionsSummary"
+	if summary.Pid > 0 {
+		dt += fmt.Sprintf("&pid=%d", summary.Pid)
+	}
+	msg, ok := PostData(endpoint, dt, f)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// createUniqueExceptionsSummaryFile creates exceptions-summary.json, or
+// N.exceptions-summary.json when it's already taken by another process of
+// the capture. The file is created exclusively, so concurrent captures can't
+// pick the same name.
+func createUniqueExceptionsSummaryFile() (*os.File, error) {
+	path := exceptionsSummaryFile
+	for counter := 2; ; counter++ {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create destination file %q: %w", path, err)
+		}
+		path = fmt.Sprintf("%d.%s", counter, exceptionsSummaryFile)
+	}
+}
@@ -0,0 +1,247 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const javaTraces = `2026-10-19 09:00:00.000 INFO  [main] c.e.App - started
+2026-10-19 09:01:00.000 ERROR [http-1] c.e.OrderController - request failed
+java.lang.IllegalStateException: order 1 is closed
+	at com.example.OrderService.update(OrderService.java:42)
+	at com.example.OrderController$$Lambda$123/0x0000000800c0b040.apply(Unknown Source)
+	at app//com.example.OrderController.put(OrderController.java:17)
+	at java.base/java.lang.Thread.run(Thread.java:833)
+Caused by: java.sql.SQLException: connection closed
+	at com.example.Db.query(Db.java:7)
+	... 4 more
+2026-10-19 09:02:00.000 INFO  [main] c.e.App - still running
+2026-10-19 09:03:00.000 ERROR [http-2] c.e.OrderController - request failed
+java.lang.IllegalStateException: order 2 is closed
+	at com.example.OrderService.update(OrderService.java:43)
+	at com.example.OrderController$$Lambda$456/0x0000000800d0c050.apply(Unknown Source)
+	at app//com.example.OrderController.put(OrderController.java:17)
+2026-10-19 09:04:00.000 ERROR [http-3] c.e.App - failed: java.lang.NullPointerException: Cannot invoke "String.length()"
+	at com.example.Names.normalize(Names.java:3)
+	at com.example.OrderService.update(OrderService.java:40)
+Exception in thread "worker" java.lang.OutOfMemoryError: Java heap space
+	at java.base/java.util.Arrays.copyOf(Arrays.java:3537)
+`
+
+const dotnetTrace = `2026-10-19T09:05:00.0000000Z fail: Example.Api[0]
+System.InvalidOperationException: Checkout failed ---> System.IO.IOException: Disk full
+   at Example.Storage.Write(Byte[] data) in /src/Storage.cs:line 12
+   --- End of inner exception stack trace ---
+   at Example.Checkout.Run(Order order) in /src/Checkout.cs:line 30
+   at Example.Api.Post() in /src/Api.cs:line 8
+2026-10-19T09:06:00.0000000Z info: Example.Api[0]
+`
+
+const nodeTrace = `TypeError: Cannot read properties of undefined (reading 'id')
+    at getUser (/app/src/users.js:12:17)
+    at async /app/src/server.js:40:5
+{ code: 'ERR_X' }
+`
+
+func scanExceptions(a *exceptionAggregator, logName, content string) {
+	s := a.writer(logName)
+	// Writes split lines to check they're joined.
+	for i := 0; i < len(content); i += 50 {
+		s.Write([]byte(content[i:min(i+50, len(content))]))
+	}
+	s.Flush()
+}
+
+func TestExceptionAggregator(t *testing.T) {
+	a := newExceptionAggregator()
+	a.now = func() time.Time { return time.Date(2026, 10, 19, 10, 0, 0, 0, time.Local) }
+
+	scanExceptions(a, "app.log", javaTraces)
+	scanExceptions(a, "api.log", dotnetTrace)
+	scanExceptions(a, "node.log", nodeTrace)
+
+	summary := a.Summary()
+	assert.Equal(t, []string{"app.log", "api.log", "node.log"}, summary.Logs)
+	assert.Equal(t, 6, summary.Total)
+	require.Len(t, summary.Exceptions, 5)
+
+	// The two IllegalStateExceptions differ in message, line numbers and
+	// lambda class only.
+	ise := summary.Exceptions[0]
+	assert.Equal(t, "java.lang.IllegalStateException", ise.Type)
+	assert.Equal(t, 2, ise.Count)
+	assert.Equal(t, "order 1 is closed", ise.Message)
+	assert.Equal(t, []string{"java.sql.SQLException"}, ise.Causes)
+	assert.Equal(t, []string{
+		"com.example.OrderService.update(OrderService.java:42)",
+		"com.example.OrderController$$Lambda$123/0x0000000800c0b040.apply(Unknown Source)",
+		"app//com.example.OrderController.put(OrderController.java:17)",
+		"java.base/java.lang.Thread.run(Thread.java:833)",
+	}, ise.Frames)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 1, 0, 0, time.Local), ise.FirstSeen)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 3, 0, 0, time.Local), ise.LastSeen)
+	assert.Equal(t, []string{"app.log"}, ise.Logs)
+
+	byType := make(map[string]ExceptionStat)
+	for _, s := range summary.Exceptions {
+		byType[s.Type] = s
+	}
+
+	npe := byType["java.lang.NullPointerException"]
+	assert.Equal(t, `Cannot invoke "String.length()"`, npe.Message)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 4, 0, 0, time.Local), npe.FirstSeen)
+
+	oom := byType["java.lang.OutOfMemoryError"]
+	assert.Equal(t, "Java heap space", oom.Message)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 4, 0, 0, time.Local), oom.FirstSeen, "the time of the last timestamped line")
+
+	// The outer frames of .NET come after its inner exception.
+	ioe := byType["System.InvalidOperationException"]
+	assert.Equal(t, "Checkout failed", ioe.Message)
+	assert.Equal(t, []string{"System.IO.IOException"}, ioe.Causes)
+	assert.Equal(t, []string{
+		"Example.Checkout.Run(Order order) in /src/Checkout.cs:line 30",
+		"Example.Api.Post() in /src/Api.cs:line 8",
+	}, ioe.Frames)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 5, 0, 0, time.UTC), ioe.FirstSeen.UTC())
+
+	te := byType["TypeError"]
+	assert.Equal(t, "Cannot read properties of undefined (reading 'id')", te.Message)
+	assert.Equal(t, []string{"getUser (/app/src/users.js:12:17)", "async /app/src/server.js:40:5"}, te.Frames)
+	assert.True(t, te.FirstSeen.IsZero())
+	assert.Equal(t, []string{"node.log"}, te.Logs)
+}
+
+func TestExceptionAggregatorLimit(t *testing.T) {
+	a := newExceptionAggregator()
+	s := a.writer("app.log")
+	for i := range maxExceptionStats + 2 {
+		fmt.Fprintf(s, "java.lang.RuntimeException: boom\n\tat com.example.Job%d.run(Job.java:1)\n", i)
+	}
+	s.Flush()
+
+	summary := a.Summary()
+	assert.Equal(t, maxExceptionStats+2, summary.Total)
+	assert.Equal(t, 2, summary.Dropped)
+	assert.Len(t, summary.Exceptions, maxExceptionStats)
+}
+
+func TestNormalizeFrame(t *testing.T) {
+	tests := map[string]string{
+		"com.example.App.run(App.java:42)":                                 "com.example.App.run",
+		"app//com.example.App.run(App.java:42)":                            "com.example.App.run",
+		"java.base/java.lang.Thread.run(Thread.java:833)":                  "java.lang.Thread.run",
+		"com.example.App$$Lambda$12/0x0000000800c0b040.apply(Unknown Src)": "com.example.App$$Lambda.apply",
+		"com.example.App$$Lambda/0x0000000800c0b040.apply(Unknown Src)":    "com.example.App$$Lambda.apply",
+		"jdk.internal.reflect.GeneratedMethodAccessor17.invoke(Unknown)":   "jdk.internal.reflect.GeneratedMethodAccessor.invoke",
+		"Example.App.Run(String name) in /src/App.cs:line 42":              "Example.App.Run",
+		"run (/app/index.js:42:7)":                                         "run /app/index.js",
+		"async Promise.all (index 0)":                                      "Promise.all",
+		"/app/index.js:42:7":                                               "/app/index.js",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, normalizeFrame(in), in)
+	}
+}
+
+func TestAppLogExceptions(t *testing.T) {
+	oldOnlyCapture := config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture = oldOnlyCapture }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte(javaTraces), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api.log"), []byte(dotnetTrace), 0644))
+
+	al := &AppLog{Paths: config.AppLogs{config.AppLog(filepath.Join(dir, "*.log"))}, LineLimit: -1, Exceptions: true}
+	_, err = al.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(exceptionsSummaryFile)
+	require.NoError(t, err)
+	var summary ExceptionsSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.ElementsMatch(t, []string{"app.log", "api.log"}, summary.Logs)
+	assert.Equal(t, 5, summary.Total)
+	assert.Len(t, summary.Exceptions, 4)
+}
+
+func TestAppLogM3Exceptions(t *testing.T) {
+	oldOnlyCapture := config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture = oldOnlyCapture }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	logPath := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(javaTraces), 0644))
+
+	a := NewAppLogM3()
+	a.Exceptions = true
+	a.SetPaths(map[int]config.AppLogs{42: {config.AppLog(logPath)}})
+
+	// The first cycle only initializes the read position.
+	_, err = a.Run()
+	require.NoError(t, err)
+	assert.False(t, fileExists(exceptionsSummaryFile))
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(strings.SplitAfterN(javaTraces, "\n", 3)[2])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = a.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(exceptionsSummaryFile)
+	require.NoError(t, err)
+	var summary ExceptionsSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+	assert.Equal(t, 42, summary.Pid)
+	assert.Equal(t, []string{"app.log"}, summary.Logs)
+	assert.Equal(t, 4, summary.Total, "the first trace starts with the new lines")
+}
+
+func TestCreateUniqueExceptionsSummaryFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(map[string]bool)
+	for range 8 {
+		wg.Go(func() {
+			f, err := createUniqueExceptionsSummaryFile()
+			require.NoError(t, err)
+			f.Close()
+			mu.Lock()
+			names[f.Name()] = true
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	assert.Len(t, names, 8)
+	assert.True(t, names[exceptionsSummaryFile])
+	assert.True(t, names["8."+exceptionsSummaryFile])
+}
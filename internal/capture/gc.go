@@ -27,6 +27,8 @@ type GC struct {
 	JavaHome string
 	DockerID string
 	GCPath   string
+	// Manifest, when set, records whether GC logging was enabled at runtime.
+	Manifest *Manifest
 }
 
 func (t *GC) Run() (result Result, err error) {
@@ -39,10 +41,19 @@ func (t *GC) Run() (result Result, err error) {
 	}
 
 	if gcFile == nil && t.Pid > 0 {
-		// Attempt 5: jstat (skip in MinimalTouch mode)
-		if config.GlobalConfig.MinimalTouch {
+		// Attempt 5a: enable GC logging at runtime with jcmd VM.log (opt-in, skip in MinimalTouch mode)
+		if config.GlobalConfig.GCRuntimeLogging && !config.GlobalConfig.MinimalTouch {
+			logger.Log("Trying to capture gc log by enabling GC logging at runtime...")
+			gcFile, err = t.captureRuntimeGCLog(fileName)
+			if err != nil {
+				logger.Log("runtime GC logging failed cause %s", err.Error())
+			}
+		}
+
+		// Attempt 5b: jstat (skip in MinimalTouch mode)
+		if gcFile == nil && config.GlobalConfig.MinimalTouch {
 			logger.Log("MinimalTouch mode: skipping jstat GC capture (60-second sampling)")
-		} else {
+		} else if gcFile == nil {
 			logger.Log("Trying to capture gc log using jstat...")
 			gcFile, err = executils.CommandCombinedOutputToFile(fileName,
 				executils.Command{path.Join(config.GlobalConfig.JavaHomePath, "/bin/jstat"), "-gc", "-t", strconv.Itoa(t.Pid), "2000", "30"}, executils.SudoHooker{PID: t.Pid})
@@ -101,6 +112,30 @@ func (t *GC) Run() (result Result, err error) {
 	return
 }
 
+// captureRuntimeGCLog enables GC logging on the target JVM for
+// runtimeGCLogDuration and records in the manifest that the agent did so.
+func (t *GC) captureRuntimeGCLog(fileName string) (*os.File, error) {
+	gcLog := &runtimeGCLog{
+		JavaHome: t.JavaHome,
+		Pid:      t.Pid,
+		Duration: runtimeGCLogDuration,
+	}
+	gcFile, err := gcLog.CaptureToFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Manifest.Set("gcLogging", map[string]any{
+		"enabledByAgent": true,
+		"method":         "jcmd VM.log",
+		"what":           "gc*",
+		"duration":       gcLog.Duration.String(),
+		"configRestored": gcLog.restored,
+	})
+
+	return gcFile, nil
+}
+
 // GetGlobPatternFromGCPath converts GCPath to a glob pattern
 // /tmp/buggyapp-%p-%t.log to /tmp/buggyapp-*1234-*.log
 // /tmp/buggyapp-%pid-%t.log to /tmp/buggyapp-1234-*.log
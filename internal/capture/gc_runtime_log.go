@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/logger"
+)
+
+// runtimeGCLogDuration is how long GC events are collected after logging has
+// been enabled at runtime. It matches the jstat sampling window (2000ms x 30).
+const runtimeGCLogDuration = 60 * time.Second
+
+// runtimeGCLog enables unified GC logging (JEP 158) on a running JVM through
+// jcmd VM.log, collects the log for a while, and then restores the logging
+// configuration the JVM had before.
+type runtimeGCLog struct {
+	JavaHome string
+	Pid      int
+	Duration time.Duration
+	// restored reports whether VM.log list matched the original configuration
+	// once the added output was removed.
+	restored bool
+}
+
+// CaptureToFile collects the runtime GC log into out.
+func (r *runtimeGCLog) CaptureToFile(out string) (*os.File, error) {
+	version, err := targetJavaVersion(r.JavaHome, r.Pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect java version: %w", err)
+	}
+	if version.Major < 9 {
+		return nil, fmt.Errorf("VM.log requires JDK 9+, found %d", version.Major)
+	}
+
+	before, err := jcmdOutput(r.JavaHome, r.Pid, "VM.log list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VM.log configuration: %w", err)
+	}
+
+	// The log file is opened by the target JVM, so it has to be an absolute
+	// path that is also valid inside the target's mount namespace.
+	logPath := filepath.Join(os.TempDir(), fmt.Sprintf("yc-gc-%d-%d.log", r.Pid, time.Now().Unix()))
+	defer r.removeLog(logPath)
+
+	// jcmd's exit code doesn't reliably reflect VM.log errors, so the new
+	// output is verified through VM.log list instead.
+	output, enableErr := jcmdOutput(r.JavaHome, r.Pid, vmLogEnableCommand(logPath))
+	current, err := jcmdOutput(r.JavaHome, r.Pid, "VM.log list")
+	if err != nil {
+		// The output may have been added even though it can't be verified,
+		// and the JVM would keep writing to a removed file.
+		if enableErr == nil {
+			r.restore(logPath, before)
+		}
+		return nil, fmt.Errorf("failed to verify the VM.log configuration: %w", err)
+	}
+	if !slices.ContainsFunc(parseVMLogOutputs(current), func(o string) bool { return strings.Contains(o, logPath) }) {
+		return nil, fmt.Errorf("GC logging was not enabled: %s (%v)", strings.TrimSpace(string(output)), enableErr)
+	}
+
+	logger.Log("GC logging enabled at runtime for pid %d, collecting %s to %s", r.Pid, r.Duration, logPath)
+	time.Sleep(r.Duration)
+
+	r.restore(logPath, before)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gc log file: %w", err)
+	}
+
+	err = copyFile(file, logPath, r.Pid)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to copy runtime gc log %s: %w", logPath, err)
+	}
+
+	return file, nil
+}
+
+// restore removes the output added by CaptureToFile. Removing an output turns
+// off all of its tags, which leaves the remaining outputs exactly as they were.
+func (r *runtimeGCLog) restore(logPath string, before []byte) {
+	_, err := jcmdOutput(r.JavaHome, r.Pid, vmLogDisableCommand(logPath))
+	if err != nil {
+		logger.Log("WARNING: failed to remove the runtime GC log output %s from pid %d: %s", logPath, r.Pid, err)
+		return
+	}
+
+	after, err := jcmdOutput(r.JavaHome, r.Pid, "VM.log list")
+	if err != nil {
+		logger.Log("WARNING: failed to verify the VM.log configuration of pid %d: %s", r.Pid, err)
+		return
+	}
+
+	r.restored = slices.Equal(parseVMLogOutputs(before), parseVMLogOutputs(after))
+	if !r.restored {
+		logger.Log("WARNING: VM.log configuration of pid %d differs from the original.\nBefore:\n%s\nAfter:\n%s", r.Pid, before, after)
+	}
+}
+
+func (r *runtimeGCLog) removeLog(logPath string) {
+	_ = os.Remove(logPath)
+	if runtime.GOOS == "linux" {
+		_ = os.Remove(filepath.Join("/proc", strconv.Itoa(r.Pid), "root", logPath))
+	}
+}
+
+func vmLogEnableCommand(logPath string) string {
+	return fmt.Sprintf("VM.log output=file=%s what=gc* decorators=time,uptime,level,tags", logPath)
+}
+
+func vmLogDisableCommand(logPath string) string {
+	return fmt.Sprintf("VM.log output=file=%s what=all=off", logPath)
+}
+
+// parseVMLogOutputs returns the configured outputs from VM.log list, i.e:
+//
+//	Log output configuration:
+//	 #0: stdout all=warning uptime,level,tags
+//	 #1: stderr all=off uptime,level,tags
+//	 #2: file=gc.log all=off,gc*=info time,uptime,level,tags filecount=5,filesize=20M
+//
+// The "#N:" index is dropped, since it shifts when outputs are removed.
+func parseVMLogOutputs(output []byte) []string {
+	var outputs []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		_, cfg, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		outputs = append(outputs, strings.TrimSpace(cfg))
+	}
+
+	return outputs
+}
@@ -0,0 +1,34 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVMLogOutputs(t *testing.T) {
+	output := []byte(`12345:
+Available log levels: off, trace, debug, info, warning, error
+Available log decorators: time (t), utctime (utc), uptime (u), timemillis (tm), uptimemillis (um), timenanos (tn), uptimenanos (un), hostname (hn), pid (p), tid (ti), level (l), tags (tg)
+Available log tags: add, age, alloc, gc, safepoint
+Described tag sets:
+ logging: Logging for the log framework itself
+Log output configuration:
+ #0: stdout all=warning uptime,level,tags
+ #1: stderr all=off uptime,level,tags
+ #2: file=/tmp/yc-gc-12345-1700000000.log all=off,gc*=info time,uptime,level,tags filecount=5,filesize=20M
+`)
+
+	assert.Equal(t, []string{
+		"stdout all=warning uptime,level,tags",
+		"stderr all=off uptime,level,tags",
+		"file=/tmp/yc-gc-12345-1700000000.log all=off,gc*=info time,uptime,level,tags filecount=5,filesize=20M",
+	}, parseVMLogOutputs(output))
+
+	assert.Empty(t, parseVMLogOutputs([]byte("12345:\nCommand not found\n")))
+}
+
+func TestVMLogCommands(t *testing.T) {
+	assert.Equal(t, "VM.log output=file=/tmp/gc.log what=gc* decorators=time,uptime,level,tags", vmLogEnableCommand("/tmp/gc.log"))
+	assert.Equal(t, "VM.log output=file=/tmp/gc.log what=all=off", vmLogDisableCommand("/tmp/gc.log"))
+}
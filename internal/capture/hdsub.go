@@ -5,11 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
-	"strconv"
-	"strings"
 
-	"yc-agent/internal/capture/executils"
 	"yc-agent/internal/config"
 	"yc-agent/internal/logger"
 )
@@ -73,13 +69,7 @@ func (t *HDSub) CaptureToFile() (*os.File, error) {
 }
 
 func (t *HDSub) isOpenJ9() bool {
-	output, err := executils.CommandCombinedOutput(executils.JavaVersionCommand)
-
-	if err != nil {
-		return false
-	}
-
-	return strings.Contains(string(output), "OpenJ9")
+	return IsOpenJ9(t.Pid)
 }
 
 // captureClassHistogram captures GC.class_histogram data to the writer.
@@ -127,45 +117,7 @@ func (t *HDSub) captureVMFlags(w io.Writer) error {
 // executeJcmd executes the jcmd command with the given parameters, falling back to
 // jattach if needed.
 func (t *HDSub) executeJcmd(w io.Writer, command string) error {
-	// Try using jcmd first
-	err := executils.CommandCombinedOutputToWriter(w,
-		executils.Command{path.Join(t.JavaHome, "bin/jcmd"), strconv.Itoa(t.Pid), command},
-		executils.SudoHooker{PID: t.Pid})
-
-	if err == nil {
-		return nil
-	}
-
-	logger.Log("Failed to run jcmd with err %v. Trying to capture using jattach...", err)
-
-	// Try using jattach as fallback
-	err = executils.CommandCombinedOutputToWriter(w,
-		executils.Command{executils.Executable(), "-p", strconv.Itoa(t.Pid), "-jCmdCaptureMode", command},
-		executils.EnvHooker{"pid": strconv.Itoa(t.Pid)},
-		executils.SudoHooker{PID: t.Pid})
-
-	if err == nil {
-		return nil
-	}
-
-	logger.Log("Failed to capture %s with err %v. Trying to capture using tmp jattach...", command, err)
-
-	// Try using temp jattach as last resort
-	tempPath, err := executils.Copy2TempPath()
-	if err != nil {
-		return fmt.Errorf("failed to create temp jattach: %w", err)
-	}
-
-	err = executils.CommandCombinedOutputToWriter(w,
-		executils.Command{tempPath, "-p", strconv.Itoa(t.Pid), "-jCmdCaptureMode", command},
-		executils.EnvHooker{"pid": strconv.Itoa(t.Pid)},
-		executils.SudoHooker{PID: t.Pid})
-
-	if err != nil {
-		return fmt.Errorf("failed to capture %s: %w", command, err)
-	}
-
-	return nil
+	return executeJcmd(w, t.JavaHome, t.Pid, command)
 }
 
 // UploadCapturedFile uploads the captured file to the configured endpoint.
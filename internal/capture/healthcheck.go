@@ -1,6 +1,7 @@
 package capture
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -8,21 +9,33 @@ import (
 	"net/http/httputil"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 	"yc-agent/internal/capture/executils"
 	"yc-agent/internal/config"
 	"yc-agent/internal/logger"
+
+	"github.com/tidwall/gjson"
 )
 
 const DefaultTimeoutSeconds = 10
 
+// maxHealthCheckBody caps how much of the response body is read for the
+// assertions and the dump.
+const maxHealthCheckBody = 1 << 20
+
 // HealthCheck represents a health check operation for an application endpoint
 type HealthCheck struct {
 	Capture
 
 	AppName string
 	Cfg     config.HealthCheck
+
+	// Passed and Failures are set once Run has evaluated the response
+	// against the expectations of Cfg.
+	Passed   bool
+	Failures []string
 }
 
 // Run executes the health check operation against the configured endpoint
@@ -47,7 +60,9 @@ func (h *HealthCheck) Run() (Result, error) {
 	// Perform health check and write results
 	if err := h.executeAndRecordHealthCheck(outFile); err != nil {
 		logToFileAndLogger(outFile, "Health check failed: %v", err)
+		h.Failures = append(h.Failures, err.Error())
 	}
+	h.recordVerdict(outFile)
 
 	// Upload results
 	dt := fmt.Sprintf("healthCheckEndpoint&fileName=%s&appName=%s", fileName, appName)
@@ -67,6 +82,10 @@ func (h *HealthCheck) executeAndRecordHealthCheck(outFile *os.File) error {
 	ctx, cancel := context.WithTimeout(context.Background(), h.getTimeoutDuration())
 	defer cancel()
 
+	if h.isGRPC() {
+		return h.executeGRPCHealthCheck(ctx, outFile)
+	}
+
 	// Execute HTTP health check
 	resp, rtt, err := h.runHTTPHealthCheck(ctx)
 	if err != nil {
@@ -79,19 +98,130 @@ func (h *HealthCheck) executeAndRecordHealthCheck(outFile *os.File) error {
 
 	defer resp.Body.Close()
 
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
 	// Log response time
 	logToFileAndLogger(outFile, "Round Trip Time: %v", rtt)
 
+	h.Failures = append(h.Failures, h.assertHTTPResponse(resp.StatusCode, body, rtt)...)
+
 	// Dump response to file
 	err = h.dumpResponse(resp, outFile)
 	return err
 }
 
+// recordVerdict sets Passed and writes the outcome of the assertions.
+func (h *HealthCheck) recordVerdict(outFile *os.File) {
+	h.Passed = len(h.Failures) == 0
+	fmt.Fprintln(outFile)
+	if h.Passed {
+		logToFileAndLogger(outFile, "Health check result: PASS")
+		return
+	}
+	logToFileAndLogger(outFile, "Health check result: FAIL")
+	for _, failure := range h.Failures {
+		logToFileAndLogger(outFile, "  - %s", failure)
+	}
+}
+
+// assertHTTPResponse checks the response against the expected status codes,
+// body regex, JSON path and latency SLO, and returns the failed expectations.
+func (h *HealthCheck) assertHTTPResponse(statusCode int, body []byte, rtt time.Duration) []string {
+	var failures []string
+
+	if len(h.Cfg.ExpectedStatus) > 0 {
+		if !slices.Contains(h.Cfg.ExpectedStatus, statusCode) {
+			failures = append(failures, fmt.Sprintf("status %d is not one of %v", statusCode, h.Cfg.ExpectedStatus))
+		}
+	} else if statusCode < 200 || statusCode >= 400 {
+		failures = append(failures, fmt.Sprintf("status %d is not 2xx or 3xx", statusCode))
+	}
+
+	if h.Cfg.BodyRegex != "" {
+		re, err := regexp.Compile(h.Cfg.BodyRegex)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid bodyRegex: %v", err))
+		} else if !re.Match(body) {
+			failures = append(failures, fmt.Sprintf("body does not match %q", h.Cfg.BodyRegex))
+		}
+	}
+
+	if h.Cfg.JSONPath != "" {
+		path := strings.TrimPrefix(strings.TrimPrefix(h.Cfg.JSONPath, "$"), ".")
+		value := gjson.GetBytes(body, path)
+		switch {
+		case !gjson.ValidBytes(body):
+			failures = append(failures, "body is not valid JSON")
+		case !value.Exists():
+			failures = append(failures, fmt.Sprintf("JSON path %s not found", h.Cfg.JSONPath))
+		case h.Cfg.JSONValue != "" && value.String() != h.Cfg.JSONValue:
+			failures = append(failures, fmt.Sprintf("JSON path %s is %q, expected %q", h.Cfg.JSONPath, value.String(), h.Cfg.JSONValue))
+		}
+	}
+
+	failures = append(failures, h.assertLatency(rtt)...)
+
+	return failures
+}
+
+func (h *HealthCheck) assertLatency(rtt time.Duration) []string {
+	if h.Cfg.LatencySLOMs <= 0 {
+		return nil
+	}
+	slo := time.Duration(h.Cfg.LatencySLOMs) * time.Millisecond
+	if rtt > slo {
+		return []string{fmt.Sprintf("round trip time %v exceeds the SLO of %v", rtt, slo)}
+	}
+	return nil
+}
+
+// headerReference matches the ${env:NAME} and ${file:/path} references of a
+// header value.
+var headerReference = regexp.MustCompile(`\$\{(env|file):([^}]*)\}`)
+
+// requestHeaders expands the configured headers. ${env:NAME} is replaced
+// with the environment variable, ${file:/path} with the trimmed content of
+// the file, so tokens don't have to be written in the config. Any other $
+// is kept as it is.
+func (h *HealthCheck) requestHeaders() (http.Header, error) {
+	headers := http.Header{}
+
+	var expandErr error
+	expand := func(ref string) string {
+		m := headerReference.FindStringSubmatch(ref)
+		if m[1] == "env" {
+			return os.Getenv(m[2])
+		}
+		data, err := os.ReadFile(m[2])
+		if err != nil {
+			expandErr = fmt.Errorf("failed to read header value: %w", err)
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	for name, value := range h.Cfg.Headers {
+		headers.Set(name, headerReference.ReplaceAllStringFunc(value, expand))
+		if expandErr != nil {
+			return nil, fmt.Errorf("header %s: %w", name, expandErr)
+		}
+	}
+
+	return headers, nil
+}
+
 // validateEndpoint checks if the endpoint configuration is valid.
 func (h *HealthCheck) validateEndpoint() error {
 	if h.Cfg.Endpoint == "" {
 		return fmt.Errorf("healthcheck endpoint cannot be empty, please check your configuration")
 	}
+	if h.isGRPC() {
+		return nil
+	}
 	if !strings.HasPrefix(h.Cfg.Endpoint, "http") {
 		return fmt.Errorf("healthcheck endpoint must start with http:// or https://")
 	}
@@ -201,11 +331,26 @@ func (h *HealthCheck) buildHealthCheckHTTPRequest(ctx context.Context) (*http.Re
 		reqMethod = "POST"
 		reqBody = strings.NewReader(h.Cfg.HTTPBody)
 	}
+	if h.Cfg.Method != "" {
+		reqMethod = strings.ToUpper(h.Cfg.Method)
+	}
+
+	headers, err := h.requestHeaders()
+	if err != nil {
+		return nil, err
+	}
 
 	req, err := http.NewRequestWithContext(ctx, reqMethod, h.Cfg.Endpoint, reqBody)
 	if req != nil {
+		for name, values := range headers {
+			req.Header[name] = values
+		}
 		req.Header.Set("User-Agent", executils.SCRIPT_VERSION)
 	}
 
 	return req, err
 }
+
+func (h *HealthCheck) isGRPC() bool {
+	return strings.EqualFold(h.Cfg.Type, "grpc")
+}
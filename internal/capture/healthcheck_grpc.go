@@ -0,0 +1,219 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// grpcHealthCheckPath is the method of the standard gRPC health checking
+// protocol (grpc.health.v1.Health/Check).
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatus names the values of HealthCheckResponse.ServingStatus.
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// executeGRPCHealthCheck calls grpc.health.v1.Health/Check over HTTP/2 and
+// records the serving status. The check passes only when the server answers
+// SERVING. The request and response are small enough that the protobuf
+// messages are encoded by hand rather than pulling in a gRPC dependency.
+func (h *HealthCheck) executeGRPCHealthCheck(ctx context.Context, outFile *os.File) error {
+	url, client, err := h.grpcTarget()
+	if err != nil {
+		return err
+	}
+
+	headers, err := h.requestHeaders()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(grpcFrame(encodeHealthCheckRequest(h.Cfg.GRPCService))))
+	if err != nil {
+		return err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	logToFileAndLogger(outFile, "gRPC health check: %s service=%q", url, h.Cfg.GRPCService)
+
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timeout occurred while waiting for a response from %s. The endpoint did not respond within %d seconds",
+				h.Cfg.Endpoint, h.Cfg.TimeoutSecs)
+		}
+		return fmt.Errorf("gRPC health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Trailers are only available once the body has been read to the end.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	rtt := time.Since(startTime)
+	if err != nil {
+		return fmt.Errorf("failed to read gRPC response: %w", err)
+	}
+
+	logToFileAndLogger(outFile, "Round Trip Time: %v", rtt)
+	logToFileAndLogger(outFile, "HTTP Status: %s", resp.Status)
+
+	// A slow response breaches the latency SLO whether it passes or not.
+	defer func() {
+		h.Failures = append(h.Failures, h.assertLatency(rtt)...)
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		h.Failures = append(h.Failures, fmt.Sprintf("HTTP status %d, expected 200", resp.StatusCode))
+		return nil
+	}
+
+	// A gRPC error without a response message is sent as trailers-only,
+	// which arrive as regular headers.
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	logToFileAndLogger(outFile, "grpc-status: %s", grpcStatus)
+	if grpcStatus != "0" {
+		failure := fmt.Sprintf("grpc-status %s", grpcStatus)
+		if grpcStatus == "" {
+			failure = "no grpc-status in the response"
+		}
+		if grpcMessage != "" {
+			failure += ": " + grpcMessage
+		}
+		h.Failures = append(h.Failures, failure)
+		return nil
+	}
+
+	message, err := readGRPCFrame(body)
+	if err != nil {
+		return fmt.Errorf("invalid gRPC response: %w", err)
+	}
+	status, err := decodeHealthCheckResponse(message)
+	if err != nil {
+		return fmt.Errorf("invalid HealthCheckResponse: %w", err)
+	}
+
+	name, ok := grpcServingStatus[status]
+	if !ok {
+		name = fmt.Sprintf("%d", status)
+	}
+	logToFileAndLogger(outFile, "Serving status: %s", name)
+	if status != 1 {
+		h.Failures = append(h.Failures, fmt.Sprintf("serving status is %s, expected SERVING", name))
+	}
+
+	return nil
+}
+
+// grpcTarget maps the grpc:// (plaintext HTTP/2) or grpcs:// (TLS) endpoint
+// to the URL of the health check method and a client speaking HTTP/2 only.
+func (h *HealthCheck) grpcTarget() (string, *http.Client, error) {
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{},
+		Protocols:         &http.Protocols{},
+	}
+
+	var base string
+	switch {
+	case strings.HasPrefix(h.Cfg.Endpoint, "grpc://"):
+		base = "http://" + strings.TrimPrefix(h.Cfg.Endpoint, "grpc://")
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	case strings.HasPrefix(h.Cfg.Endpoint, "grpcs://"):
+		base = "https://" + strings.TrimPrefix(h.Cfg.Endpoint, "grpcs://")
+		transport.Protocols.SetHTTP2(true)
+	default:
+		return "", nil, fmt.Errorf("gRPC health check endpoint should start with grpc:// or grpcs://, got %s", h.Cfg.Endpoint)
+	}
+
+	url := strings.TrimSuffix(base, "/") + grpcHealthCheckPath
+	return url, &http.Client{Transport: transport}, nil
+}
+
+// encodeHealthCheckRequest encodes HealthCheckRequest{service} as protobuf.
+func encodeHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	msg := []byte{0x0a} // field 1, length-delimited
+	msg = binary.AppendUvarint(msg, uint64(len(service)))
+	return append(msg, service...)
+}
+
+// decodeHealthCheckResponse returns the status (field 1) of a
+// HealthCheckResponse; an empty message is UNKNOWN.
+func decodeHealthCheckResponse(msg []byte) (uint64, error) {
+	var status uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("truncated field key")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("truncated varint")
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 2: // length-delimited, skipped
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errors.New("truncated field")
+			}
+			msg = msg[n+int(l):]
+		default:
+			return 0, fmt.Errorf("unexpected wire type %d", key&7)
+		}
+	}
+	return status, nil
+}
+
+// grpcFrame wraps a message in the gRPC length-prefixed framing:
+// an uncompressed flag followed by the big-endian message length.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// readGRPCFrame returns the message of the first frame of a gRPC response.
+func readGRPCFrame(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("response of %d bytes is shorter than a frame header", len(body))
+	}
+	if body[0] != 0 {
+		return nil, errors.New("compressed responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(length) {
+		return nil, fmt.Errorf("frame of %d bytes is truncated", length)
+	}
+	return body[5 : 5+length], nil
+}
@@ -1,10 +1,14 @@
 package capture
 
 import (
+	"encoding/binary"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -118,3 +122,210 @@ func TestSanitizeAppNameForFileName(t *testing.T) {
 		})
 	}
 }
+
+func TestHealthCheck_Assertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"DOWN","components":{"db":{"status":"UP"}}}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		cfg      config.HealthCheck
+		passed   bool
+		failures int
+	}{
+		{"default status range", "/", config.HealthCheck{}, false, 1},
+		{"expected status", "/", config.HealthCheck{ExpectedStatus: []int{200, 503}}, true, 0},
+		{"body regex", "/", config.HealthCheck{ExpectedStatus: []int{503}, BodyRegex: `^\{"status":"UP"`}, false, 1},
+		{"json path exists", "/", config.HealthCheck{ExpectedStatus: []int{503}, JSONPath: "$.components.db.status", JSONValue: "UP"}, true, 0},
+		{"json path value", "/", config.HealthCheck{ExpectedStatus: []int{503}, JSONPath: "status", JSONValue: "UP"}, false, 1},
+		{"json path missing", "/", config.HealthCheck{ExpectedStatus: []int{503}, JSONPath: "components.cache"}, false, 1},
+		{"latency slo", "/slow", config.HealthCheck{ExpectedStatus: []int{503}, LatencySLOMs: 1}, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			tt.cfg.Endpoint = server.URL + tt.path
+			tt.cfg.TimeoutSecs = 2
+			h := &HealthCheck{AppName: "TestApp", Cfg: tt.cfg}
+
+			_, err := h.Run()
+			require.NoError(t, err)
+			assert.Equal(t, tt.passed, h.Passed, h.Failures)
+			assert.Len(t, h.Failures, tt.failures)
+
+			out, err := os.ReadFile("healthCheckEndpoint.TestApp.out")
+			require.NoError(t, err)
+			if tt.passed {
+				assert.Contains(t, string(out), "Health check result: PASS")
+			} else {
+				assert.Contains(t, string(out), "Health check result: FAIL")
+			}
+		})
+	}
+}
+
+func TestHealthCheck_MethodAndHeaders(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	t.Chdir(t.TempDir())
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600))
+	t.Setenv("HC_TENANT", "acme")
+
+	h := &HealthCheck{
+		AppName: "TestApp",
+		Cfg: config.HealthCheck{
+			Endpoint:    server.URL,
+			TimeoutSecs: 2,
+			Method:      "head",
+			Headers: map[string]string{
+				"Authorization": "Bearer ${file:" + tokenFile + "}",
+				"X-Tenant":      "${env:HC_TENANT}",
+				"X-Plain":       "$HC_TENANT-1",
+			},
+		},
+	}
+
+	_, err := h.Run()
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.True(t, h.Passed, h.Failures)
+	assert.Equal(t, http.MethodHead, got.Method)
+	assert.Equal(t, "Bearer s3cret", got.Header.Get("Authorization"))
+	assert.Equal(t, "acme", got.Header.Get("X-Tenant"))
+	assert.Equal(t, "$HC_TENANT-1", got.Header.Get("X-Plain"))
+
+	t.Run("missing header file fails the check", func(t *testing.T) {
+		h := &HealthCheck{
+			AppName: "TestApp",
+			Cfg: config.HealthCheck{
+				Endpoint: server.URL,
+				Headers:  map[string]string{"Authorization": "${file:/nonexistent/token}"},
+			},
+		}
+		_, err := h.Run()
+		require.NoError(t, err)
+		assert.False(t, h.Passed)
+	})
+}
+
+func TestHealthCheck_GRPC(t *testing.T) {
+	var gotService string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != grpcHealthCheckPath || r.Header.Get("Content-Type") != "application/grpc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		msg, err := readGRPCFrame(body)
+		if err == nil && len(msg) > 2 {
+			gotService = string(msg[2:])
+		}
+
+		status := uint64(1)
+		switch gotService {
+		case "slow":
+			time.Sleep(50 * time.Millisecond)
+			w.Header().Set("Grpc-Status", "14")
+			w.WriteHeader(http.StatusOK)
+			return
+		case "down":
+			status = 2
+		case "missing":
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "unknown service")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write(grpcFrame(binary.AppendUvarint([]byte{0x08}, status)))
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = &http.Protocols{}
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	endpoint := "grpc://" + server.Listener.Addr().String()
+
+	tests := []struct {
+		service string
+		passed  bool
+	}{
+		{"", true},
+		{"orders", true},
+		{"down", false},
+		{"missing", false},
+	}
+	for _, tt := range tests {
+		t.Run("service "+tt.service, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			gotService = ""
+
+			h := &HealthCheck{
+				AppName: "TestApp",
+				Cfg: config.HealthCheck{
+					Type:        "grpc",
+					Endpoint:    endpoint,
+					GRPCService: tt.service,
+					TimeoutSecs: 2,
+				},
+			}
+			_, err := h.Run()
+			require.NoError(t, err)
+			assert.Equal(t, tt.service, gotService)
+			assert.Equal(t, tt.passed, h.Passed, h.Failures)
+		})
+	}
+
+	t.Run("slow failing response breaches the latency SLO", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		h := &HealthCheck{
+			AppName: "TestApp",
+			Cfg: config.HealthCheck{
+				Type:         "grpc",
+				Endpoint:     endpoint,
+				GRPCService:  "slow",
+				TimeoutSecs:  2,
+				LatencySLOMs: 10,
+			},
+		}
+		_, err := h.Run()
+		require.NoError(t, err)
+		assert.False(t, h.Passed)
+		require.Len(t, h.Failures, 2)
+		assert.Equal(t, "grpc-status 14", h.Failures[0])
+		assert.Contains(t, h.Failures[1], "exceeds the SLO of 10ms")
+	})
+}
+
+func TestDecodeHealthCheckResponse(t *testing.T) {
+	status, err := decodeHealthCheckResponse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), status)
+
+	status, err = decodeHealthCheckResponse([]byte{0x12, 0x01, 'x', 0x08, 0x02})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), status)
+
+	_, err = decodeHealthCheckResponse([]byte{0x08})
+	assert.Error(t, err)
+}
@@ -0,0 +1,279 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/logger"
+)
+
+const (
+	iostatOutputPath = "iostat.out"
+	// iostatFirstSample is the window of the first report when the capture is
+	// killed before the first interval has elapsed.
+	iostatFirstSample = time.Second
+	// diskSectorSize is the unit of the sector counters of /proc/diskstats,
+	// which is always 512 bytes regardless of the device.
+	diskSectorSize = 512
+)
+
+// IOStat samples /proc/diskstats and writes per-device statistics in the
+// layout of "iostat -x". Like vmstat, it takes a report every
+// VMSTAT_INTERVAL seconds, up to the vmstat sample count, and stops early
+// when killed, once at least one report has been written.
+type IOStat struct {
+	Capture
+	// Interval between reports; defaults to VMSTAT_INTERVAL.
+	Interval time.Duration
+	// Reports to write; defaults to the vmstat sample count.
+	Reports int
+
+	initOnce sync.Once
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// diskStat is a row of /proc/diskstats.
+type diskStat struct {
+	Reads, SectorsRead, ReadMs      uint64
+	Writes, SectorsWritten, WriteMs uint64
+	IOMs, WeightedIOMs              uint64
+}
+
+// DiskIOStat is the activity of a device between two samples.
+type DiskIOStat struct {
+	Device     string
+	ReadsPS    float64
+	WritesPS   float64
+	ReadKBPS   float64
+	WriteKBPS  float64
+	ReadAwait  float64
+	WriteAwait float64
+	Await      float64
+	QueueSize  float64
+	Util       float64
+}
+
+// Run captures and uploads iostat.out.
+func (t *IOStat) Run() (Result, error) {
+	if runtime.GOOS != "linux" {
+		return Result{Msg: "skipped: iostat is only supported on Linux"}, nil
+	}
+
+	file, err := t.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "iostat", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// Kill stops the sampling; the reports written so far are kept. Killed before
+// the first report, the sampling stops after a short one.
+func (t *IOStat) Kill() error {
+	t.stopOnce.Do(func() { close(t.stopChan()) })
+	return nil
+}
+
+func (t *IOStat) stopChan() chan struct{} {
+	t.initOnce.Do(func() { t.stop = make(chan struct{}) })
+	return t.stop
+}
+
+// CaptureToFile writes the reports to iostat.out.
+func (t *IOStat) CaptureToFile() (*os.File, error) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Duration(executils.VMSTAT_INTERVAL) * time.Second
+	}
+	reports := t.Reports
+	if reports <= 0 {
+		reports = vmstatCount
+	}
+
+	file, err := os.Create(iostatOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	prev, err := readDiskStats()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	prevTime := time.Now()
+
+sampling:
+	for i := 0; i < reports; i++ {
+		select {
+		case <-time.After(interval):
+		case <-t.stopChan():
+			if i > 0 {
+				logger.Log("iostat stopped after %d reports", i)
+				break sampling
+			}
+			// Full captures kill iostat as soon as it has started; without
+			// a report, iostat.out would be uploaded empty.
+			time.Sleep(max(iostatFirstSample-time.Since(prevTime), 0))
+			reports = 1
+		}
+
+		cur, err := readDiskStats()
+		if err != nil {
+			logger.Log("failed to read diskstats: %v", err)
+			break
+		}
+		now := time.Now()
+
+		if err := writeIOStatReport(file, now, computeDiskIOStats(prev, cur, now.Sub(prevTime))); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write %s: %w", iostatOutputPath, err)
+		}
+		prev, prevTime = cur, now
+	}
+
+	if err := file.Sync(); err != nil {
+		logger.Log("warning: failed to sync file: %v", err)
+	}
+
+	return file, nil
+}
+
+func readDiskStats() (map[string]diskStat, error) {
+	data, err := os.ReadFile(filepath.Join(procFSRoot, "diskstats"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diskstats: %w", err)
+	}
+	return parseDiskStats(string(data)), nil
+}
+
+// parseDiskStats parses /proc/diskstats, i.e:
+//
+//	8       0 sda 1420 560 94202 1010 2712 2188 124322 8010 0 5340 9021 0 0 0 0
+//
+// Loop and RAM devices and devices that never did any I/O are skipped, as
+// iostat does.
+func parseDiskStats(data string) map[string]diskStat {
+	stats := map[string]diskStat{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+
+		n := make([]uint64, 11)
+		for i := range n {
+			n[i], _ = strconv.ParseUint(fields[3+i], 10, 64)
+		}
+		stat := diskStat{
+			Reads:          n[0],
+			SectorsRead:    n[2],
+			ReadMs:         n[3],
+			Writes:         n[4],
+			SectorsWritten: n[6],
+			WriteMs:        n[7],
+			IOMs:           n[9],
+			WeightedIOMs:   n[10],
+		}
+		if stat.Reads == 0 && stat.Writes == 0 {
+			continue
+		}
+		stats[name] = stat
+	}
+
+	return stats
+}
+
+// computeDiskIOStats computes the iostat -x figures of each device present in
+// both samples, sorted by device name.
+func computeDiskIOStats(prev, cur map[string]diskStat, elapsed time.Duration) []DiskIOStat {
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		return nil
+	}
+	ms := seconds * 1000
+
+	var stats []DiskIOStat
+	for name, c := range cur {
+		p, ok := prev[name]
+		if !ok {
+			continue
+		}
+
+		reads := counterDelta(p.Reads, c.Reads)
+		writes := counterDelta(p.Writes, c.Writes)
+		readMs := counterDelta(p.ReadMs, c.ReadMs)
+		writeMs := counterDelta(p.WriteMs, c.WriteMs)
+
+		s := DiskIOStat{
+			Device:    name,
+			ReadsPS:   reads / seconds,
+			WritesPS:  writes / seconds,
+			ReadKBPS:  counterDelta(p.SectorsRead, c.SectorsRead) * diskSectorSize / 1024 / seconds,
+			WriteKBPS: counterDelta(p.SectorsWritten, c.SectorsWritten) * diskSectorSize / 1024 / seconds,
+			QueueSize: counterDelta(p.WeightedIOMs, c.WeightedIOMs) / ms,
+			Util:      min(counterDelta(p.IOMs, c.IOMs)/ms*100, 100),
+		}
+		if reads > 0 {
+			s.ReadAwait = readMs / reads
+		}
+		if writes > 0 {
+			s.WriteAwait = writeMs / writes
+		}
+		if reads+writes > 0 {
+			s.Await = (readMs + writeMs) / (reads + writes)
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Device < stats[j].Device })
+	return stats
+}
+
+// counterDelta returns the change of a counter, treating a wrap or reset as 0.
+func counterDelta(before, after uint64) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after - before)
+}
+
+// writeIOStatReport writes one report in the iostat -x layout, preceded by
+// its time like the vmstat output:
+//
+//	05:30:45
+//	Device            r/s     w/s     rkB/s     wkB/s  r_await  w_await    await  aqu-sz  %util
+//	sda              1.00    4.20     16.00    120.40     0.50     2.10     1.79    0.01   0.80
+func writeIOStatReport(w io.Writer, at time.Time, stats []DiskIOStat) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n", at.Format("15:04:05"))
+	fmt.Fprintf(&b, "%-12s %9s %9s %11s %11s %8s %8s %8s %7s %6s\n",
+		"Device", "r/s", "w/s", "rkB/s", "wkB/s", "r_await", "w_await", "await", "aqu-sz", "%util")
+	for _, s := range stats {
+		fmt.Fprintf(&b, "%-12s %9.2f %9.2f %11.2f %11.2f %8.2f %8.2f %8.2f %7.2f %6.2f\n",
+			s.Device, s.ReadsPS, s.WritesPS, s.ReadKBPS, s.WriteKBPS, s.ReadAwait, s.WriteAwait, s.Await, s.QueueSize, s.Util)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,133 @@
+package capture
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"yc-agent/internal/config"
+)
+
+func TestParseDiskStats(t *testing.T) {
+	stats := parseDiskStats(`   7       0 loop0 50 0 100 10 0 0 0 0 0 10 10 0 0 0 0
+   8       0 sda 1420 560 94202 1010 2712 2188 124322 8010 0 5340 9021 0 0 0 0
+   8       1 sda1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+ 259       0 nvme0n1 100 0 800 50 200 0 1600 300 1 400 350
+`)
+
+	assert.Equal(t, map[string]diskStat{
+		"sda":     {Reads: 1420, SectorsRead: 94202, ReadMs: 1010, Writes: 2712, SectorsWritten: 124322, WriteMs: 8010, IOMs: 5340, WeightedIOMs: 9021},
+		"nvme0n1": {Reads: 100, SectorsRead: 800, ReadMs: 50, Writes: 200, SectorsWritten: 1600, WriteMs: 300, IOMs: 400, WeightedIOMs: 350},
+	}, stats)
+}
+
+func TestComputeDiskIOStats(t *testing.T) {
+	prev := map[string]diskStat{
+		"sda": {Reads: 100, SectorsRead: 1000, ReadMs: 100, Writes: 200, SectorsWritten: 2000, WriteMs: 400, IOMs: 1000, WeightedIOMs: 500},
+	}
+	cur := map[string]diskStat{
+		"sda": {Reads: 110, SectorsRead: 1200, ReadMs: 150, Writes: 240, SectorsWritten: 4048, WriteMs: 600, IOMs: 2500, WeightedIOMs: 1500},
+		"sdb": {Reads: 1, Writes: 1},
+	}
+
+	stats := computeDiskIOStats(prev, cur, 2*time.Second)
+
+	require.Len(t, stats, 1)
+	assert.Equal(t, DiskIOStat{
+		Device:     "sda",
+		ReadsPS:    5,
+		WritesPS:   20,
+		ReadKBPS:   50,
+		WriteKBPS:  512,
+		ReadAwait:  5,
+		WriteAwait: 5,
+		Await:      5,
+		QueueSize:  0.5,
+		Util:       75,
+	}, stats[0])
+}
+
+func TestWriteIOStatReport(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2026, 10, 19, 5, 30, 45, 0, time.UTC)
+	require.NoError(t, writeIOStatReport(&buf, at, []DiskIOStat{{Device: "sda", ReadsPS: 5, Util: 75}}))
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "05:30:45", lines[0])
+	assert.Equal(t, []string{"Device", "r/s", "w/s", "rkB/s", "wkB/s", "r_await", "w_await", "await", "aqu-sz", "%util"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"sda", "5.00", "0.00", "0.00", "0.00", "0.00", "0.00", "0.00", "0.00", "75.00"}, strings.Fields(lines[2]))
+}
+
+func TestIOStatKill(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "diskstats"), []byte("8 0 sda 1 0 8 1 1 0 8 1 0 1 2\n"), 0644))
+	oldProc := procFSRoot
+	procFSRoot = proc
+	t.Cleanup(func() { procFSRoot = oldProc })
+
+	t.Chdir(t.TempDir())
+
+	task := &IOStat{Interval: 10 * time.Millisecond, Reports: 1000}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = task.Kill()
+	}()
+
+	start := time.Now()
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	assert.Less(t, time.Since(start), 5*time.Second)
+	data, err := os.ReadFile(iostatOutputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "sda")
+}
+
+func TestIOStatKilledRightAway(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("iostat is only supported on Linux")
+	}
+
+	proc := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "diskstats"), []byte("8 0 sda 1 0 8 1 1 0 8 1 0 1 2\n"), 0644))
+	oldProc, oldOnlyCapture := procFSRoot, config.GlobalConfig.OnlyCapture
+	procFSRoot = proc
+	config.GlobalConfig.OnlyCapture = true
+	t.Cleanup(func() { procFSRoot, config.GlobalConfig.OnlyCapture = oldProc, oldOnlyCapture })
+
+	t.Chdir(t.TempDir())
+
+	task := &IOStat{Interval: time.Hour}
+	done := make(chan error)
+	go func() {
+		_, err := task.Run()
+		done <- err
+	}()
+	require.NoError(t, task.Kill())
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("iostat didn't stop when killed")
+	}
+	data, err := os.ReadFile(iostatOutputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "sda")
+}
+
+func TestIOStatSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc/diskstats is only available on Linux")
+	}
+
+	_, err := readDiskStats()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,99 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/capture/java"
+	"yc-agent/internal/logger"
+)
+
+// executeJcmd executes the jcmd command against pid, falling back to the
+// bundled jattach (and then a temp copy of it) if jcmd isn't usable.
+func executeJcmd(w io.Writer, javaHome string, pid int, command string) error {
+	// Try using jcmd first
+	err := executils.CommandCombinedOutputToWriter(w,
+		executils.Command{path.Join(javaHome, "bin/jcmd"), strconv.Itoa(pid), command},
+		executils.SudoHooker{PID: pid})
+
+	if err == nil {
+		return nil
+	}
+
+	logger.Log("Failed to run jcmd with err %v. Trying to capture using jattach...", err)
+
+	// Try using jattach as fallback
+	err = executils.CommandCombinedOutputToWriter(w,
+		executils.Command{executils.Executable(), "-p", strconv.Itoa(pid), "-jCmdCaptureMode", command},
+		executils.EnvHooker{"pid": strconv.Itoa(pid)},
+		executils.SudoHooker{PID: pid})
+
+	if err == nil {
+		return nil
+	}
+
+	logger.Log("Failed to capture %s with err %v. Trying to capture using tmp jattach...", command, err)
+
+	// Try using temp jattach as last resort
+	tempPath, err := executils.Copy2TempPath()
+	if err != nil {
+		return fmt.Errorf("failed to create temp jattach: %w", err)
+	}
+
+	err = executils.CommandCombinedOutputToWriter(w,
+		executils.Command{tempPath, "-p", strconv.Itoa(pid), "-jCmdCaptureMode", command},
+		executils.EnvHooker{"pid": strconv.Itoa(pid)},
+		executils.SudoHooker{PID: pid})
+
+	if err != nil {
+		return fmt.Errorf("failed to capture %s: %w", command, err)
+	}
+
+	return nil
+}
+
+// jcmdOutput runs executeJcmd and returns the collected output.
+func jcmdOutput(javaHome string, pid int, command string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := executeJcmd(&buf, javaHome, pid, command)
+	return buf.Bytes(), err
+}
+
+// targetJavaVersion returns the Java version of the target JVM, as reported by
+// jcmd VM.version. When the target can't be asked, it falls back to the local
+// java on PATH.
+func targetJavaVersion(javaHome string, pid int) (java.JavaVersion, error) {
+	output, err := jcmdOutput(javaHome, pid, "VM.version")
+	if err == nil {
+		if version, ok := parseVMVersion(output); ok {
+			return version, nil
+		}
+	}
+
+	logger.Log("Unable to read the Java version of pid %d from VM.version, falling back to the local java", pid)
+	return java.GetLocalJavaVersion()
+}
+
+// parseVMVersion extracts the JDK version from jcmd VM.version output, i.e:
+//
+//	12345:
+//	OpenJDK 64-Bit Server VM version 21.0.2+13-LTS
+//	JDK 21.0.2
+func parseVMVersion(output []byte) (java.JavaVersion, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if version, found := strings.CutPrefix(line, "JDK "); found {
+			javaVersion := java.ParseJavaVersionString(strings.TrimSpace(version))
+			return javaVersion, javaVersion.Major > 0
+		}
+	}
+
+	return java.JavaVersion{}, false
+}
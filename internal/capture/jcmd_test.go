@@ -0,0 +1,44 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"yc-agent/internal/capture/java"
+)
+
+func TestParseVMVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected java.JavaVersion
+		ok       bool
+	}{
+		{
+			name:     "JDK 21",
+			output:   "12345:\nOpenJDK 64-Bit Server VM version 21.0.2+13-LTS\nJDK 21.0.2\n",
+			expected: java.JavaVersion{Major: 21, Minor: 0, Security: 2},
+			ok:       true,
+		},
+		{
+			name:     "JDK 8",
+			output:   "12345:\nOpenJDK 64-Bit Server VM version 25.392-b08\nJDK 8.0_392\n",
+			expected: java.JavaVersion{Major: 8, Minor: 0, Security: 392},
+			ok:       true,
+		},
+		{
+			name:   "no JDK line",
+			output: "12345:\nCommand not found\n",
+			ok:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := parseVMVersion([]byte(tt.output))
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, version)
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+)
+
+// journalMaxEntries bounds the journal entries of a capture; the last ones
+// of the window are kept.
+const journalMaxEntries = 50000
+
+// syslogPaths are the syslog files searched when the journal can't be read,
+// in order. It is a variable so tests can point it at fixtures.
+var syslogPaths = []string{"/var/log/messages", "/var/log/syslog"}
+
+// syslogTag matches the tag of a syslog line, "java[1234]:" of
+// "Oct 19 09:15:30 host java[1234]: started".
+var syslogTag = regexp.MustCompile(`\s([^\s\[\]:]+)(?:\[(\d+)\])?:\s`)
+
+// Journal captures the log lines a systemd service writes to the journal
+// rather than to a file, which app log auto-discovery can't find.
+//
+// The service of Pid is found from its cgroup, and its journal entries of
+// the window are read with journalctl. When the process isn't a service or
+// the journal can't be read, the syslog lines of the window tagged with its
+// PID or program name are captured instead. Both are uploaded as app logs.
+type Journal struct {
+	Capture
+	Pid int
+	// Window of lines to capture. When zero, lines since the start of Pid
+	// are captured.
+	Window time.Duration
+}
+
+// systemdUnit is the systemd service a process belongs to.
+type systemdUnit struct {
+	Name string
+	// User is set for a service of a user's service manager.
+	User bool
+}
+
+// Run captures and uploads the journal or syslog lines of the process.
+func (j *Journal) Run() (Result, error) {
+	to := time.Now()
+	from := j.since(to)
+
+	unit, err := systemdUnitOf(j.Pid)
+	if err != nil {
+		logger.Log("journal: %v", err)
+	}
+	if unit.Name != "" {
+		result, err := j.captureJournal(unit, from)
+		if err == nil {
+			return result, nil
+		}
+		logger.Log("journal: failed to read the journal of %s, falling back to syslog: %v", unit.Name, err)
+	}
+
+	return j.captureSyslog(unit, from, to)
+}
+
+// since returns the start of the window ending at to.
+func (j *Journal) since(to time.Time) time.Time {
+	if j.Window > 0 {
+		return to.Add(-j.Window)
+	}
+	ts, err := GetProcessStartTimestamp(j.Pid)
+	if err != nil {
+		logger.Log("journal: failed to get the start time of pid %d, capturing the last hour: %v", j.Pid, err)
+		return to.Add(-time.Hour)
+	}
+	return time.Unix(0, ts)
+}
+
+// systemdUnitOf returns the systemd service pid runs in, from the last
+// service of its cgroup path, e.g. "myapp.service" of
+// "0::/system.slice/myapp.service". The name is empty when pid isn't a
+// service.
+func systemdUnitOf(pid int) (systemdUnit, error) {
+	data, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return systemdUnit{}, fmt.Errorf("failed to read cgroup of pid %d: %w", pid, err)
+	}
+
+	unified, controllers := parseProcCgroup(data)
+	path := controllers["systemd"]
+	if path == "" {
+		path = unified
+	}
+
+	var unit systemdUnit
+	for part := range strings.SplitSeq(path, "/") {
+		if !strings.HasSuffix(part, ".service") {
+			continue
+		}
+		// The services of a user run under user@<uid>.service.
+		if strings.HasPrefix(part, "user@") {
+			unit.User = true
+			continue
+		}
+		unit.Name = part
+	}
+	return unit, nil
+}
+
+// captureJournal uploads the journal entries of unit since from.
+func (j *Journal) captureJournal(unit systemdUnit, from time.Time) (Result, error) {
+	cmd := executils.Command{"journalctl", "--output=json", "--no-pager", "--lines=" + strconv.Itoa(journalMaxEntries), fmt.Sprintf("--since=@%d", from.Unix())}
+	if unit.User {
+		cmd = append(cmd, "_SYSTEMD_USER_UNIT="+unit.Name)
+	} else {
+		cmd = append(cmd, "--unit="+unit.Name)
+	}
+
+	dstPath := generateUniqueLogPath("journal-" + unit.Name + ".log")
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	// The entries are written as journalctl outputs them, rather than
+	// holding up to journalMaxEntries of JSON in memory.
+	pr, pw := io.Pipe()
+	c, err := executils.CommandStartInBackgroundToWriter(pw, cmd)
+	if err == nil && c.IsSkipped() {
+		err = errors.New("command skipped")
+	}
+	if err != nil {
+		pw.Close()
+		dst.Close()
+		os.Remove(dstPath)
+		return Result{}, fmt.Errorf("failed to start journalctl: %w", err)
+	}
+	timeout := config.GlobalConfig.CmdTimeout.Duration()
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	timer := time.AfterFunc(timeout, func() {
+		logger.Log("journal: journalctl didn't finish within %s, stopping it", timeout)
+		c.Kill()
+	})
+	done := make(chan error, 1)
+	go func() {
+		err := c.Wait()
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	entries, writeErr := writeJournalEntries(dst, pr)
+	// Unblocks journalctl when the entries couldn't be written.
+	pr.CloseWithError(io.ErrClosedPipe)
+	waitErr := <-done
+	timer.Stop()
+
+	// Without persistent journal files, or with journald not running, the
+	// lines may still be in syslog.
+	if entries == 0 {
+		dst.Close()
+		os.Remove(dstPath)
+		if waitErr != nil {
+			return Result{}, fmt.Errorf("no journal entries: %w", waitErr)
+		}
+		return Result{}, errors.New("no journal entries")
+	}
+	if writeErr != nil && !errors.Is(writeErr, waitErr) {
+		return Result{}, fmt.Errorf("failed to write the journal of %s: %w", unit.Name, writeErr)
+	}
+	if waitErr != nil {
+		logger.Log("journal: journalctl failed after %d entries: %v", entries, waitErr)
+	}
+	if err := dst.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
+	logger.Log("journal: captured %d entries of %s", entries, unit.Name)
+
+	msg, ok := PostData(j.Endpoint(), "applog&logName="+filepath.Base(dstPath), dst)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// writeJournalEntries writes the entries of the journalctl JSON output r to
+// dst as syslog-like lines, "2026-10-19T09:15:30.123456+02:00 host
+// myapp[1234]: message", and returns their count. Lines that aren't entries,
+// like journalctl's notices, are skipped.
+func writeJournalEntries(dst io.Writer, r io.Reader) (int, error) {
+	entries := 0
+	br := bufio.NewReader(r)
+	for {
+		data, readErr := br.ReadBytes('\n')
+		var entry map[string]json.RawMessage
+		if json.Unmarshal(bytes.TrimSpace(data), &entry) == nil {
+			if err := writeJournalEntry(dst, entry); err != nil {
+				return entries, err
+			}
+			entries++
+		}
+		if readErr == io.EOF {
+			return entries, nil
+		}
+		if readErr != nil {
+			return entries, readErr
+		}
+	}
+}
+
+func writeJournalEntry(dst io.Writer, entry map[string]json.RawMessage) error {
+	var prefix []string
+	if usec, err := strconv.ParseInt(journalField(entry, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		prefix = append(prefix, time.UnixMicro(usec).Format("2006-01-02T15:04:05.000000Z07:00"))
+	}
+	if host := journalField(entry, "_HOSTNAME"); host != "" {
+		prefix = append(prefix, host)
+	}
+	ident := journalField(entry, "SYSLOG_IDENTIFIER")
+	if ident == "" {
+		ident = journalField(entry, "_COMM")
+	}
+	if pid := journalField(entry, "_PID"); pid != "" {
+		ident += "[" + pid + "]"
+	}
+	if ident != "" {
+		prefix = append(prefix, ident)
+	}
+
+	_, err := fmt.Fprintf(dst, "%s: %s\n", strings.Join(prefix, " "), journalField(entry, "MESSAGE"))
+	return err
+}
+
+// journalField returns a field of a journal entry. Fields that aren't valid
+// UTF-8 are arrays of bytes.
+func journalField(entry map[string]json.RawMessage, name string) string {
+	raw, ok := entry[name]
+	if !ok {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		b := make([]byte, 0, len(ints))
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+		return strings.ToValidUTF8(string(b), "?")
+	}
+	return ""
+}
+
+// captureSyslog uploads the syslog lines between from and to tagged with
+// the PID of the process, the name of its unit or its command name.
+func (j *Journal) captureSyslog(unit systemdUnit, from, to time.Time) (Result, error) {
+	programs := []string{strings.TrimSuffix(unit.Name, ".service")}
+	if comm, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(j.Pid), "comm")); err == nil {
+		programs = append(programs, strings.TrimSpace(string(comm)))
+	}
+	programs = slices.DeleteFunc(programs, func(p string) bool { return p == "" })
+
+	path := ""
+	for _, p := range syslogPaths {
+		if _, err := os.Stat(p); err == nil {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return Result{Msg: "skipped capturing journal: no journal entries or syslog file", Ok: true}, nil
+	}
+
+	window, err := newLogWindow(path, from, to)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if window == nil {
+		return Result{}, fmt.Errorf("no known timestamp format in %s", path)
+	}
+
+	dstPath := generateUniqueLogPath(fmt.Sprintf("syslog-%d.log", j.Pid))
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create destination file %q: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	filter := &syslogFilter{dst: dst, pid: strconv.Itoa(j.Pid), programs: programs}
+	if _, err := window.extract(filter, path); err != nil {
+		return Result{}, fmt.Errorf("failed to extract the window of %s: %w", path, err)
+	}
+	if err := filter.Flush(); err != nil {
+		return Result{}, fmt.Errorf("failed to write %q: %w", dstPath, err)
+	}
+	if err := dst.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync destination file %q: %w", dstPath, err)
+	}
+	logger.Log("journal: captured %d lines of pid %d from %s", filter.lines, j.Pid, path)
+
+	if filter.lines == 0 {
+		return Result{Msg: fmt.Sprintf("no lines of pid %d in %s", j.Pid, path), Ok: true}, nil
+	}
+
+	msg, ok := PostData(j.Endpoint(), "applog&logName="+filepath.Base(dstPath), dst)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// syslogFilter writes the syslog lines written to it that are tagged with
+// pid, or with one of programs and no PID.
+type syslogFilter struct {
+	dst      io.Writer
+	pid      string
+	programs []string
+
+	partial []byte
+	lines   int
+	err     error
+}
+
+// Write filters the complete lines of p; a trailing partial line is kept
+// for the next write or Flush.
+func (f *syslogFilter) Write(p []byte) (int, error) {
+	data := p
+	if len(f.partial) > 0 {
+		data = append(f.partial, p...)
+		f.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		f.addLine(data[:i+1])
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		f.partial = append([]byte(nil), data...)
+	}
+	return len(p), f.err
+}
+
+// Flush filters the trailing partial line.
+func (f *syslogFilter) Flush() error {
+	if len(f.partial) > 0 {
+		f.addLine(append(f.partial, '\n'))
+		f.partial = nil
+	}
+	return f.err
+}
+
+func (f *syslogFilter) addLine(line []byte) {
+	if f.err != nil || !f.matches(line) {
+		return
+	}
+	if _, err := f.dst.Write(line); err != nil {
+		f.err = err
+		return
+	}
+	f.lines++
+}
+
+func (f *syslogFilter) matches(line []byte) bool {
+	m := syslogTag.FindSubmatch(line)
+	if m == nil {
+		return false
+	}
+	if len(m[2]) > 0 {
+		return string(m[2]) == f.pid
+	}
+	return slices.Contains(f.programs, string(m[1]))
+}
@@ -0,0 +1,153 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdUnitOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup string
+		want   systemdUnit
+	}{
+		{
+			name:   "cgroup v2 service",
+			cgroup: "0::/system.slice/myapp.service\n",
+			want:   systemdUnit{Name: "myapp.service"},
+		},
+		{
+			name:   "cgroup v2 delegated subgroup",
+			cgroup: "0::/system.slice/myapp.service/payload\n",
+			want:   systemdUnit{Name: "myapp.service"},
+		},
+		{
+			name:   "cgroup v1",
+			cgroup: "12:memory:/system.slice/myapp.service\n1:name=systemd:/system.slice/tomcat.service\n",
+			want:   systemdUnit{Name: "tomcat.service"},
+		},
+		{
+			name:   "user service",
+			cgroup: "0::/user.slice/user-1000.slice/user@1000.service/app.slice/myapp.service\n",
+			want:   systemdUnit{Name: "myapp.service", User: true},
+		},
+		{
+			name:   "login session",
+			cgroup: "0::/user.slice/user-1000.slice/session-3.scope\n",
+			want:   systemdUnit{},
+		},
+		{
+			name:   "container",
+			cgroup: "0::/kubepods.slice/pod1/cri-abc.scope\n",
+			want:   systemdUnit{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCgroupFixture(t, tt.cgroup, nil)
+
+			unit, err := systemdUnitOf(42)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, unit)
+		})
+	}
+}
+
+func TestWriteJournalEntries(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 15, 30, 123456000, time.UTC)
+	output := fmt.Sprintf(`{"__REALTIME_TIMESTAMP":"%d","_HOSTNAME":"web1","SYSLOG_IDENTIFIER":"java","_PID":"1234","MESSAGE":"started"}
+-- Boot 1a2b3c --
+{"__REALTIME_TIMESTAMP":"%d","_HOSTNAME":"web1","_COMM":"java","_PID":"1234","MESSAGE":[104,105,255]}
+{"__REALTIME_TIMESTAMP":"%d","MESSAGE":"no newline"}`, at.UnixMicro(), at.Add(time.Second).UnixMicro(), at.Add(2*time.Second).UnixMicro())
+
+	var dst bytes.Buffer
+	entries, err := writeJournalEntries(&dst, strings.NewReader(output))
+	require.NoError(t, err)
+	assert.Equal(t, 3, entries)
+
+	local := func(t time.Time) string { return t.Local().Format("2006-01-02T15:04:05.000000Z07:00") }
+	assert.Equal(t, local(at)+" web1 java[1234]: started\n"+
+		local(at.Add(time.Second))+" web1 java[1234]: hi?\n"+
+		local(at.Add(2*time.Second))+": no newline\n", dst.String())
+}
+
+func TestJournalSyslogFallback(t *testing.T) {
+	oldOnlyCapture, oldSyslogPaths := config.GlobalConfig.OnlyCapture, syslogPaths
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture, syslogPaths = oldOnlyCapture, oldSyslogPaths }()
+
+	// pid 42 isn't a service; its syslog lines are found by PID or name.
+	withCgroupFixture(t, "0::/user.slice/user-1000.slice/session-3.scope\n", nil)
+	require.NoError(t, os.WriteFile(filepath.Join(procFSRoot, "42", "comm"), []byte("myapp\n"), 0644))
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	now := time.Now()
+	line := func(ago time.Duration, tag, msg string) string {
+		return fmt.Sprintf("%s web1 %s: %s\n", now.Add(-ago).Format(time.Stamp), tag, msg)
+	}
+	syslog := line(3*time.Hour, "myapp[42]", "before the window") +
+		line(30*time.Minute, "myapp[42]", "started") +
+		line(29*time.Minute, "sshd[7]", "accepted publickey") +
+		line(28*time.Minute, "myapp[43]", "another instance") +
+		line(27*time.Minute, "myapp", "without a pid") +
+		line(26*time.Minute, "kernel", "eth0 link up") +
+		line(25*time.Minute, "java[42]", "renamed thread")
+	syslogPaths = []string{filepath.Join(dir, "messages-missing"), filepath.Join(dir, "messages")}
+	require.NoError(t, os.WriteFile(syslogPaths[1], []byte(syslog), 0644))
+
+	j := &Journal{Pid: 42, Window: time.Hour}
+	_, err = j.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("1.appLogs.syslog-42.log")
+	require.NoError(t, err)
+	assert.Equal(t, line(30*time.Minute, "myapp[42]", "started")+
+		line(27*time.Minute, "myapp", "without a pid")+
+		line(25*time.Minute, "java[42]", "renamed thread"), string(data))
+}
+
+func TestJournalStreamsJournalctl(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as journalctl")
+	}
+	oldOnlyCapture := config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture = oldOnlyCapture }()
+
+	withCgroupFixture(t, "0::/system.slice/myapp.service\n", nil)
+
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo '{\"__REALTIME_TIMESTAMP\":\"1760865330000000\",\"SYSLOG_IDENTIFIER\":\"myapp\",\"_PID\":\"42\",\"MESSAGE\":\"started\"}'\n" +
+		"echo '{\"MESSAGE\":\"ready\"}'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "journalctl"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Chdir(t.TempDir())
+
+	j := &Journal{Pid: 42, Window: time.Hour}
+	_, err := j.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("1.appLogs.journal-myapp.service.log")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], " myapp[42]: started"), lines[0])
+	assert.Equal(t, ": ready", lines[1])
+}
@@ -51,6 +51,10 @@ func (t *JStack) Run() (result Result, err error) {
 		close(b1)
 		close(b2)
 	}()
+	openJ9 := IsOpenJ9(t.pid)
+	if openJ9 {
+		logger.Log("Detected OpenJ9 JVM for pid %d, capturing javacores", t.pid)
+	}
 	go func() {
 		defer func() {
 			close(e1)
@@ -63,6 +67,15 @@ func (t *JStack) Run() (result Result, err error) {
 			outputFileName := fmt.Sprintf("javacore.%d.out", n)
 			var jstackFile *os.File = nil
 
+			// Thread dump: OpenJ9 javacore via jcmd Dump.java or SIGQUIT
+			if openJ9 {
+				logger.Log("Trying to capture OpenJ9 javacore...")
+				jstackFile, err = captureOpenJ9Javacore(t.javaHome, t.pid, outputFileName)
+				if err != nil {
+					logger.Log("Failed to capture OpenJ9 javacore with err %v", err)
+				}
+			}
+
 			//  Thread dump: Attempt 2a: jattach via self execution with -tdCaptureMode
 			if jstackFile == nil {
 				logger.Log("Trying to capture thread dump using jattach...")
@@ -0,0 +1,326 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	psv3 "github.com/shirou/gopsutil/v3/process"
+)
+
+const jvmAuditOut = "jvm-audit.json"
+
+//go:embed jvm_audit_rules.yaml
+var jvmAuditBuiltinRules []byte
+
+// jvmFlagDefaults are the defaults of the flags the built-in rules look at,
+// used when VM.flags can't be read and the command line doesn't set them.
+var jvmFlagDefaults = map[string]string{
+	"HeapDumpOnOutOfMemoryError": "false",
+	"HeapDumpPath":               "",
+	"ExitOnOutOfMemoryError":     "false",
+	"CrashOnOutOfMemoryError":    "false",
+	"UseContainerSupport":        "true",
+}
+
+// jvmGCLoggingRe matches the command line options that turn on GC logging.
+var jvmGCLoggingRe = regexp.MustCompile(`(^|\s)(-Xlog:(gc|safepoint|all)|-Xloggc:|-verbose:gc|-XX:\+PrintGC|-Xverbosegclog)`)
+
+// JVMAudit checks the configuration of a JVM (flags, command line, container
+// limits and kernel params) against a set of rules and uploads the findings
+// as jvm-audit.json.
+type JVMAudit struct {
+	Capture
+	Pid      int
+	JavaHome string
+	// GCPath is the GC log found for the process, if any.
+	GCPath string
+
+	// Findings is set once Run has evaluated the rules.
+	Findings []AuditFinding
+}
+
+type jvmAuditReport struct {
+	Pid            int               `json:"pid"`
+	RulesEvaluated int               `json:"rulesEvaluated"`
+	Summary        string            `json:"summary"`
+	Findings       []AuditFinding    `json:"findings"`
+	Facts          map[string]string `json:"facts"`
+}
+
+// Run evaluates the rules and uploads the report.
+func (t *JVMAudit) Run() (Result, error) {
+	rules, err := LoadAuditRules(jvmAuditBuiltinRules, config.GlobalConfig.JVMAuditRules)
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+
+	facts := t.collectFacts(rules)
+	t.Findings = EvaluateAuditRules(rules, facts, "")
+
+	file, err := t.writeReport(rules, facts)
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "jvmaudit", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+func (t *JVMAudit) writeReport(rules []AuditRule, facts map[string]string) (*os.File, error) {
+	// The command line may carry secrets (passwords in -D options), so it is
+	// only used by the rules and not uploaded.
+	reported := make(map[string]string, len(facts))
+	for k, v := range facts {
+		if k != "cmdline" {
+			reported[k] = v
+		}
+	}
+
+	data, err := json.MarshalIndent(jvmAuditReport{
+		Pid:            t.Pid,
+		RulesEvaluated: len(rules),
+		Summary:        SummarizeAuditFindings(t.Findings),
+		Findings:       t.Findings,
+		Facts:          reported,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JVM audit: %w", err)
+	}
+
+	file, err := os.Create(jvmAuditOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", jvmAuditOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", jvmAuditOut, err)
+	}
+
+	return file, nil
+}
+
+// collectFacts gathers the facts rules are evaluated against.
+func (t *JVMAudit) collectFacts(rules []AuditRule) map[string]string {
+	facts := map[string]string{}
+
+	var args []string
+	if proc, err := psv3.NewProcess(int32(t.Pid)); err == nil {
+		args, _ = proc.CmdlineSlice()
+	}
+	cmdline := strings.Join(args, " ")
+	facts["cmdline"] = cmdline
+
+	flags := jvmFlagsFromCmdline(args)
+	if output, err := jcmdOutput(t.JavaHome, t.Pid, "VM.flags -all"); err == nil {
+		for name, value := range parseVMFlags(output) {
+			flags[name] = value
+		}
+	} else {
+		logger.Log("Failed to read VM.flags of pid %d, auditing the command line only: %v", t.Pid, err)
+	}
+	for name, value := range jvmFlagDefaults {
+		if _, ok := flags[name]; !ok {
+			flags[name] = value
+		}
+	}
+	for name, value := range flags {
+		facts["flag."+name] = value
+	}
+
+	facts["gcLogging"] = strconv.FormatBool(t.GCPath != "" || jvmGCLoggingRe.MatchString(cmdline))
+
+	cpus := float64(runtime.NumCPU())
+	facts["host.cpus"] = strconv.Itoa(runtime.NumCPU())
+	if vm, err := mem.VirtualMemory(); err == nil {
+		facts["host.memory"] = strconv.FormatUint(vm.Total, 10)
+	}
+
+	if cg, err := ResolveCgroup(t.Pid); err == nil {
+		if limit, ok := cg.MemoryLimit(); ok {
+			facts["cgroup.memoryLimit"] = strconv.FormatInt(limit, 10)
+		}
+		if cores, ok := cg.CPULimit(); ok {
+			facts["cgroup.cpuLimit"] = strconv.FormatFloat(cores, 'f', -1, 64)
+			cpus = min(cpus, cores)
+		}
+	}
+	facts["cpus"] = strconv.FormatFloat(cpus, 'f', -1, 64)
+
+	for name, value := range readKernelFacts(rules) {
+		facts[name] = value
+	}
+
+	return facts
+}
+
+// readKernelFacts returns the kernel.<sysctl> facts referenced by rules, e.g.
+// kernel.vm.overcommit_memory. The params are collected the way the Kernel
+// capture does (sysctl -a); /proc/sys is read for the ones sysctl didn't
+// report, as where it isn't installed.
+func readKernelFacts(rules []AuditRule) map[string]string {
+	var output bytes.Buffer
+	if executils.KernelParam != nil {
+		if err := (&Kernel{}).captureOutput(&output); err != nil {
+			logger.Log("JVM audit: %v", err)
+		}
+	}
+	params := parseSysctlOutput(output.Bytes())
+
+	facts := readSysctlFacts(rules)
+	for _, rule := range rules {
+		for _, c := range rule.Conditions {
+			for _, fact := range []string{c.Fact, c.ValueFact} {
+				sysctl, found := strings.CutPrefix(fact, "kernel.")
+				if !found {
+					continue
+				}
+				if value, ok := params[sysctl]; ok {
+					facts[fact] = value
+				}
+			}
+		}
+	}
+
+	return facts
+}
+
+// readSysctlFacts reads the kernel.<sysctl> facts referenced by rules from
+// /proc/sys, e.g. kernel.vm.max_map_count from /proc/sys/vm/max_map_count.
+func readSysctlFacts(rules []AuditRule) map[string]string {
+	facts := map[string]string{}
+
+	for _, rule := range rules {
+		for _, c := range rule.Conditions {
+			for _, fact := range []string{c.Fact, c.ValueFact} {
+				sysctl, found := strings.CutPrefix(fact, "kernel.")
+				if !found || strings.Contains(sysctl, "..") {
+					continue
+				}
+				if _, done := facts[fact]; done {
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(procFSRoot, "sys", strings.ReplaceAll(sysctl, ".", "/")))
+				if err != nil {
+					continue
+				}
+				facts[fact] = strings.Join(strings.Fields(string(data)), " ")
+			}
+		}
+	}
+
+	return facts
+}
+
+// parseSysctlOutput parses sysctl -a output, i.e:
+//
+//	vm.overcommit_memory = 0
+//	kernel.sched_domain.cpu0.domain0.name = MC
+//
+// Values spanning several fields are joined with single spaces.
+func parseSysctlOutput(output []byte) map[string]string {
+	params := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		params[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), " ")
+	}
+
+	return params
+}
+
+// parseVMFlags parses jcmd VM.flags output. Both the -all table, i.e:
+//
+//	  bool HeapDumpOnOutOfMemoryError               = false                     {manageable} {default}
+//	size_t MaxHeapSize                              = 4171235328                {product} {ergonomic}
+//	 uintx MaxHeapSize                             := 4171235328                {product}
+//
+// and the plain option list (-XX:+UseG1GC -XX:MaxHeapSize=4171235328) are
+// understood. Booleans are reported as "true" or "false".
+func parseVMFlags(output []byte) map[string]string {
+	flags := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "-XX:") {
+			for name, value := range jvmFlagsFromCmdline(strings.Fields(line)) {
+				flags[name] = value
+			}
+			continue
+		}
+
+		left, right, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSuffix(left, ":"))
+		if len(fields) != 2 {
+			continue
+		}
+		value, _, _ := strings.Cut(right, " {")
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "{") {
+			value = ""
+		}
+		flags[fields[1]] = normalizeFlagValue(value)
+	}
+
+	return flags
+}
+
+// jvmFlagsFromCmdline extracts -XX flags and heap sizes from JVM arguments.
+func jvmFlagsFromCmdline(args []string) map[string]string {
+	flags := map[string]string{}
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-XX:+"):
+			flags[arg[len("-XX:+"):]] = "true"
+		case strings.HasPrefix(arg, "-XX:-"):
+			flags[arg[len("-XX:-"):]] = "false"
+		case strings.HasPrefix(arg, "-XX:"):
+			if name, value, found := strings.Cut(arg[len("-XX:"):], "="); found {
+				flags[name] = normalizeFlagValue(value)
+			}
+		case strings.HasPrefix(arg, "-Xmx"):
+			flags["MaxHeapSize"] = normalizeFlagValue(arg[len("-Xmx"):])
+		case strings.HasPrefix(arg, "-Xms"):
+			flags["InitialHeapSize"] = normalizeFlagValue(arg[len("-Xms"):])
+		}
+	}
+
+	return flags
+}
+
+// normalizeFlagValue turns sizes (512m) into bytes and floats (25.000000)
+// into their shortest form, so rules can compare them as written.
+func normalizeFlagValue(value string) string {
+	if value == "" {
+		return value
+	}
+	if n, ok := parseAuditNumber(value); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return value
+}
@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"yc-agent/internal/capture/executils"
+)
+
+func TestParseVMFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]string
+	}{
+		{
+			name: "all table",
+			output: `12345:
+[Global flags]
+     bool HeapDumpOnOutOfMemoryError               = false                                  {manageable} {default}
+    ccstr HeapDumpPath                             =                                        {manageable} {default}
+   size_t MaxHeapSize                              = 4171235328                             {product} {ergonomic}
+   double MaxRAMPercentage                         = 25.000000                              {product} {default}
+`,
+			want: map[string]string{
+				"HeapDumpOnOutOfMemoryError": "false",
+				"HeapDumpPath":               "",
+				"MaxHeapSize":                "4171235328",
+				"MaxRAMPercentage":           "25",
+			},
+		},
+		{
+			name: "jdk8 all table",
+			output: `    uintx MaxHeapSize                              := 4171235328                          {product}
+     bool UseSerialGC                               = false                               {product}
+`,
+			want: map[string]string{
+				"MaxHeapSize": "4171235328",
+				"UseSerialGC": "false",
+			},
+		},
+		{
+			name: "option list",
+			output: `12345:
+-XX:CICompilerCount=4 -XX:+HeapDumpOnOutOfMemoryError -XX:MaxHeapSize=536870912 -XX:-UseContainerSupport
+`,
+			want: map[string]string{
+				"CICompilerCount":            "4",
+				"HeapDumpOnOutOfMemoryError": "true",
+				"MaxHeapSize":                "536870912",
+				"UseContainerSupport":        "false",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseVMFlags([]byte(tt.output)))
+		})
+	}
+}
+
+func TestJVMFlagsFromCmdline(t *testing.T) {
+	flags := jvmFlagsFromCmdline([]string{"java", "-Xms512m", "-Xmx2g", "-XX:+UseSerialGC", "-XX:HeapDumpPath=/dumps", "-jar", "app.jar"})
+
+	assert.Equal(t, map[string]string{
+		"InitialHeapSize": "536870912",
+		"MaxHeapSize":     "2147483648",
+		"UseSerialGC":     "true",
+		"HeapDumpPath":    "/dumps",
+	}, flags)
+}
+
+func TestReadSysctlFacts(t *testing.T) {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "sys", "vm"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "sys", "vm", "max_map_count"), []byte("65530\n"), 0644))
+
+	oldProc := procFSRoot
+	procFSRoot = proc
+	t.Cleanup(func() { procFSRoot = oldProc })
+
+	facts := readSysctlFacts([]AuditRule{{
+		ID: "a",
+		Conditions: []AuditCondition{
+			{Fact: "kernel.vm.max_map_count", Op: "lt", Value: "262144"},
+			{Fact: "kernel.net.core.somaxconn", Op: "lt", Value: "1024"},
+		},
+	}})
+
+	assert.Equal(t, map[string]string{"kernel.vm.max_map_count": "65530"}, facts)
+}
+
+func TestReadKernelFacts(t *testing.T) {
+	oldKernelParam, oldProc := executils.KernelParam, procFSRoot
+	t.Cleanup(func() { executils.KernelParam, procFSRoot = oldKernelParam, oldProc })
+	executils.KernelParam = []string{"printf", "vm.overcommit_memory = 2\nkernel.pid_max = 4194304\n"}
+
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "sys", "vm"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "sys", "vm", "overcommit_memory"), []byte("0\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "sys", "vm", "swappiness"), []byte("60\n"), 0644))
+	procFSRoot = proc
+
+	facts := readKernelFacts([]AuditRule{{
+		ID: "a",
+		Conditions: []AuditCondition{
+			{Fact: "kernel.vm.overcommit_memory", Op: "eq", Value: "2"},
+			{Fact: "kernel.vm.swappiness", Op: "gt", Value: "10"},
+		},
+	}})
+
+	assert.Equal(t, map[string]string{
+		"kernel.vm.overcommit_memory": "2",
+		"kernel.vm.swappiness":        "60",
+	}, facts, "sysctl -a first, /proc/sys for the params it didn't report")
+}
+
+func TestJVMAuditBuiltinRulesFindings(t *testing.T) {
+	rules, err := ParseAuditRules(jvmAuditBuiltinRules)
+	require.NoError(t, err)
+
+	facts := map[string]string{
+		"cmdline":                         "java -Xmx4g -jar app.jar",
+		"flag.MaxHeapSize":                "4294967296",
+		"flag.MaxRAMPercentage":           "25",
+		"flag.HeapDumpOnOutOfMemoryError": "false",
+		"flag.HeapDumpPath":               "",
+		"flag.ExitOnOutOfMemoryError":     "false",
+		"flag.CrashOnOutOfMemoryError":    "false",
+		"flag.UseContainerSupport":        "true",
+		"flag.UseSerialGC":                "false",
+		"flag.MaxMetaspaceSize":           "33554432",
+		"flag.MetaspaceSize":              "21807104",
+		"gcLogging":                       "true",
+		"cgroup.memoryLimit":              "2147483648",
+		"cpus":                            "2",
+		"kernel.vm.overcommit_memory":     "2",
+	}
+
+	var ids []string
+	for _, f := range EvaluateAuditRules(rules, facts, "") {
+		ids = append(ids, f.ID)
+	}
+
+	assert.Equal(t, []string{"heap-exceeds-container-limit", "max-metaspace-tiny", "heap-dump-on-oom-disabled", "strict-overcommit", "exit-on-oom-missing"}, ids)
+}
@@ -0,0 +1,153 @@
+package capture
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+)
+
+const kernelAuditOut = "kernel-audit.json"
+
+//go:embed kernel_audit_rules.yaml
+var kernelAuditBuiltinRules []byte
+
+// sysFSRoot is where sysfs is mounted. It is a variable so tests can point it
+// at a fixture.
+var sysFSRoot = "/sys"
+
+// procLimitNames maps the rows of /proc/<pid>/limits to the ulimit resource
+// names used in the limit.<resource>.soft|hard facts.
+var procLimitNames = map[string]string{
+	"Max cpu time":          "cpu",
+	"Max file size":         "fsize",
+	"Max data size":         "data",
+	"Max stack size":        "stack",
+	"Max core file size":    "core",
+	"Max resident set":      "rss",
+	"Max processes":         "nproc",
+	"Max open files":        "nofile",
+	"Max locked memory":     "memlock",
+	"Max address space":     "as",
+	"Max file locks":        "locks",
+	"Max pending signals":   "sigpending",
+	"Max msgqueue size":     "msgqueue",
+	"Max nice priority":     "nice",
+	"Max realtime priority": "rtprio",
+}
+
+// KernelAudit compares the kernel tuning of the host (sysctls, transparent
+// hugepages, NUMA balancing) and the ulimits of the target process with a
+// baseline for server runtimes, and uploads the deviations as
+// kernel-audit.json. The baseline is a set of audit rules, restricted by
+// their runtimes to the runtime of the target.
+type KernelAudit struct {
+	Capture
+	Pid int
+	// Runtime is java, dotnet or nodejs.
+	Runtime string
+
+	// Findings is set once Run has evaluated the rules.
+	Findings []AuditFinding
+}
+
+type kernelAuditReport struct {
+	Pid            int               `json:"pid"`
+	Runtime        string            `json:"runtime"`
+	RulesEvaluated int               `json:"rulesEvaluated"`
+	Summary        string            `json:"summary"`
+	Findings       []AuditFinding    `json:"findings"`
+	Facts          map[string]string `json:"facts"`
+}
+
+// Run evaluates the baseline and uploads the report.
+func (t *KernelAudit) Run() (Result, error) {
+	if runtime.GOOS != "linux" {
+		return Result{Msg: "skipped: kernel audit is only supported on Linux"}, nil
+	}
+
+	rules, err := LoadAuditRules(kernelAuditBuiltinRules, config.GlobalConfig.KernelAuditRules)
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+
+	facts := collectKernelFacts(t.Pid, rules)
+	t.Findings = EvaluateAuditRules(rules, facts, t.Runtime)
+
+	data, err := json.MarshalIndent(kernelAuditReport{
+		Pid:            t.Pid,
+		Runtime:        t.Runtime,
+		RulesEvaluated: len(rules),
+		Summary:        SummarizeAuditFindings(t.Findings),
+		Findings:       t.Findings,
+		Facts:          facts,
+	}, "", "  ")
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to marshal kernel audit: %w", err)
+	}
+
+	file, err := os.Create(kernelAuditOut)
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to create %s: %w", kernelAuditOut, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to write %s: %w", kernelAuditOut, err)
+	}
+
+	msg, ok := PostData(t.Endpoint(), "kernelaudit", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// collectKernelFacts gathers the facts the kernel rules are evaluated
+// against: the kernel.<sysctl> facts the rules reference, thp.enabled and
+// thp.defrag, numa.nodes and the limit.<resource>.soft|hard of pid.
+func collectKernelFacts(pid int, rules []AuditRule) map[string]string {
+	facts := readSysctlFacts(rules)
+
+	thp := filepath.Join(sysFSRoot, "kernel", "mm", "transparent_hugepage")
+	for _, name := range []string{"enabled", "defrag"} {
+		if data, err := os.ReadFile(filepath.Join(thp, name)); err == nil {
+			facts["thp."+name] = selectedSysfsOption(string(data))
+		}
+	}
+
+	if nodes, err := filepath.Glob(filepath.Join(sysFSRoot, "devices", "system", "node", "node[0-9]*")); err == nil && len(nodes) > 0 {
+		facts["numa.nodes"] = strconv.Itoa(len(nodes))
+	}
+
+	if pid > 0 {
+		if data, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(pid), "limits")); err == nil {
+			for _, limit := range parseProcLimits(string(data)) {
+				name, ok := procLimitNames[limit.Name]
+				if !ok {
+					continue
+				}
+				facts["limit."+name+".soft"] = limit.Soft
+				facts["limit."+name+".hard"] = limit.Hard
+			}
+		} else {
+			logger.Log("Failed to read the limits of pid %d: %v", pid, err)
+		}
+	}
+
+	return facts
+}
+
+// selectedSysfsOption returns the bracketed choice of a sysfs option list
+// such as "always [madvise] never".
+func selectedSysfsOption(data string) string {
+	for _, field := range strings.Fields(data) {
+		if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+			return strings.Trim(field, "[]")
+		}
+	}
+	return strings.TrimSpace(data)
+}
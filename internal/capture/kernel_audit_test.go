@@ -0,0 +1,90 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectedSysfsOption(t *testing.T) {
+	assert.Equal(t, "madvise", selectedSysfsOption("always [madvise] never\n"))
+	assert.Equal(t, "always", selectedSysfsOption("[always] madvise never\n"))
+	assert.Equal(t, "1", selectedSysfsOption("1\n"))
+}
+
+func TestCollectKernelFacts(t *testing.T) {
+	proc := t.TempDir()
+	sys := t.TempDir()
+	files := map[string]string{
+		filepath.Join(proc, "sys/net/core/somaxconn"):                "128\n",
+		filepath.Join(proc, "sys/vm/swappiness"):                     "60\n",
+		filepath.Join(proc, "42/limits"):                             "Limit                     Soft Limit           Hard Limit           Units\nMax open files            1024                 524288               files\nMax processes             unlimited            unlimited            processes\n",
+		filepath.Join(sys, "kernel/mm/transparent_hugepage/enabled"): "[always] madvise never\n",
+		filepath.Join(sys, "kernel/mm/transparent_hugepage/defrag"):  "always defer defer+madvise [madvise] never\n",
+		filepath.Join(sys, "devices/system/node/node0/meminfo"):      "",
+		filepath.Join(sys, "devices/system/node/node1/meminfo"):      "",
+		filepath.Join(sys, "devices/system/node/possible"):           "0-1\n",
+	}
+	for path, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	oldProc, oldSys := procFSRoot, sysFSRoot
+	procFSRoot, sysFSRoot = proc, sys
+	t.Cleanup(func() { procFSRoot, sysFSRoot = oldProc, oldSys })
+
+	rules, err := ParseAuditRules(kernelAuditBuiltinRules)
+	require.NoError(t, err)
+
+	facts := collectKernelFacts(42, rules)
+
+	assert.Equal(t, map[string]string{
+		"kernel.net.core.somaxconn": "128",
+		"kernel.vm.swappiness":      "60",
+		"thp.enabled":               "always",
+		"thp.defrag":                "madvise",
+		"numa.nodes":                "2",
+		"limit.nofile.soft":         "1024",
+		"limit.nofile.hard":         "524288",
+		"limit.nproc.soft":          "unlimited",
+		"limit.nproc.hard":          "unlimited",
+	}, facts)
+}
+
+func TestKernelAuditBuiltinRulesFindings(t *testing.T) {
+	rules, err := ParseAuditRules(kernelAuditBuiltinRules)
+	require.NoError(t, err)
+
+	facts := map[string]string{
+		"kernel.net.core.somaxconn":           "4096",
+		"kernel.net.ipv4.tcp_max_syn_backlog": "512",
+		"kernel.fs.file-max":                  "9223372036854775807",
+		"kernel.fs.nr_open":                   "1048576",
+		"kernel.vm.swappiness":                "60",
+		"kernel.vm.overcommit_memory":         "2",
+		"kernel.vm.max_map_count":             "65530",
+		"kernel.kernel.numa_balancing":        "1",
+		"numa.nodes":                          "1",
+		"thp.enabled":                         "madvise",
+		"thp.defrag":                          "madvise",
+		"limit.nofile.soft":                   "1024",
+		"limit.nofile.hard":                   "524288",
+		"limit.nproc.soft":                    "unlimited",
+		"limit.core.soft":                     "0",
+	}
+
+	ids := func(runtime string) []string {
+		var ids []string
+		for _, f := range EvaluateAuditRules(rules, facts, runtime) {
+			ids = append(ids, f.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"nofile-soft-low", "swappiness-high", "overcommit-strict", "tcp-max-syn-backlog-low", "core-dumps-disabled", "max-map-count-low"}, ids("java"))
+	assert.Equal(t, []string{"nofile-soft-low", "swappiness-high", "tcp-max-syn-backlog-low", "nofile-soft-below-hard", "core-dumps-disabled"}, ids("nodejs"))
+}
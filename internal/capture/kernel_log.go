@@ -0,0 +1,353 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+)
+
+// kmsgPath is the kernel log device. It is a variable so tests can point it
+// at a fixture.
+var kmsgPath = "/dev/kmsg"
+
+// KernelLogEntry is a message of the kernel ring buffer.
+type KernelLogEntry struct {
+	Time     time.Time
+	Facility int
+	Level    int
+	Message  string
+}
+
+var kernelLogLevels = []string{"emerg", "alert", "crit", "err", "warn", "notice", "info", "debug"}
+
+var kernelLogFacilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news"}
+
+// LevelName returns the syslog name of the entry's level, as printed by dmesg -x.
+func (e KernelLogEntry) LevelName() string {
+	return kernelLogLevels[e.Level&7]
+}
+
+// FacilityName returns the syslog name of the entry's facility.
+func (e KernelLogEntry) FacilityName() string {
+	if e.Facility >= 0 && e.Facility < len(kernelLogFacilities) {
+		return kernelLogFacilities[e.Facility]
+	}
+	return strconv.Itoa(e.Facility)
+}
+
+// readKernelLog reads the whole kernel ring buffer, from /dev/kmsg when
+// possible and from "dmesg -r" otherwise. source names where it came from.
+func readKernelLog() (entries []KernelLogEntry, source string, err error) {
+	boot, err := bootTime()
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, kmsgErr := readKmsg()
+	if kmsgErr == nil {
+		return parseKmsg(data, boot), "/dev/kmsg", nil
+	}
+
+	output, err := executils.CommandCombinedOutput(executils.Command{"dmesg", "-r"})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read /dev/kmsg (%v) and dmesg -r: %w", kmsgErr, err)
+	}
+	return parseDmesgRaw(string(output), boot), "dmesg -r", nil
+}
+
+// bootTime derives the wall clock time of boot from /proc/uptime, which is
+// what the monotonic timestamps of kernel messages are relative to. Like
+// dmesg -T, it is off by the time the system spent suspended.
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(procFSRoot, "uptime"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read uptime: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("unexpected uptime format: %q", data)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected uptime format: %q", data)
+	}
+	return time.Now().Add(-time.Duration(uptime * float64(time.Second))), nil
+}
+
+// parseKmsg parses records read from /dev/kmsg:
+//
+//	6,1234,5678901,-;eth0: Link is Down
+//	 SUBSYSTEM=net
+//	 DEVICE=n2
+//
+// The header holds the priority (facility<<3 | level), the sequence number
+// and the microseconds since boot. Continuation lines (dictionary
+// properties) start with a space and are skipped.
+func parseKmsg(data string, boot time.Time) []KernelLogEntry {
+	var entries []KernelLogEntry
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == ' ' {
+			continue
+		}
+		header, message, found := strings.Cut(line, ";")
+		if !found {
+			continue
+		}
+		fields := strings.Split(header, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		prio, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		usec, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, KernelLogEntry{
+			Time:     boot.Add(time.Duration(usec) * time.Microsecond),
+			Facility: prio >> 3,
+			Level:    prio & 7,
+			Message:  message,
+		})
+	}
+
+	return entries
+}
+
+var dmesgRawLine = regexp.MustCompile(`^<(\d+)>\[\s*(\d+)\.(\d+)\] ?(.*)$`)
+
+// parseDmesgRaw parses the output of dmesg -r:
+//
+//	<6>[   12.345678] eth0: Link is Down
+func parseDmesgRaw(data string, boot time.Time) []KernelLogEntry {
+	var entries []KernelLogEntry
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		m := dmesgRawLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		prio, _ := strconv.Atoi(m[1])
+		sec, _ := strconv.ParseInt(m[2], 10, 64)
+		frac := (m[3] + "000000")[:6]
+		usec, _ := strconv.ParseInt(frac, 10, 64)
+		entries = append(entries, KernelLogEntry{
+			Time:     boot.Add(time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond),
+			Facility: prio >> 3,
+			Level:    prio & 7,
+			Message:  m[4],
+		})
+	}
+
+	return entries
+}
+
+// writeKernelLog writes entries in the layout of dmesg -T -x:
+//
+//	kern  :warn  : [Mon Oct 19 05:30:45 2026] eth0: Link is Down
+func writeKernelLog(w io.Writer, entries []KernelLogEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		fmt.Fprintf(bw, "%-6s:%-6s: [%s] %s\n", e.FacilityName(), e.LevelName(), e.Time.Format("Mon Jan _2 15:04:05 2006"), e.Message)
+	}
+	return bw.Flush()
+}
+
+// OOMKill is a process killed by the OOM killer.
+type OOMKill struct {
+	Time    time.Time `json:"time"`
+	Pid     int       `json:"pid"`
+	Process string    `json:"process"`
+	// Target is true when the victim is the captured process.
+	Target bool `json:"target"`
+	// InvokedBy is the process whose allocation triggered the OOM killer.
+	InvokedBy  string `json:"invokedBy,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	// Cgroup is the victim's memory cgroup, OOMCgroup the cgroup whose limit
+	// was hit (an ancestor of Cgroup, or empty for a system-wide OOM).
+	Cgroup     string `json:"cgroup,omitempty"`
+	OOMCgroup  string `json:"oomCgroup,omitempty"`
+	TotalVMKB  int64  `json:"totalVmKB"`
+	AnonRSSKB  int64  `json:"anonRssKB"`
+	FileRSSKB  int64  `json:"fileRssKB"`
+	ShmemRSSKB int64  `json:"shmemRssKB"`
+	RSSKB      int64  `json:"rssKB"`
+	Message    string `json:"message"`
+}
+
+// KernelEvent is a notable kernel message other than an OOM kill.
+type KernelEvent struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Pid     int       `json:"pid,omitempty"`
+	Process string    `json:"process,omitempty"`
+	Device  string    `json:"device,omitempty"`
+	CPU     *int      `json:"cpu,omitempty"`
+	Seconds int       `json:"seconds,omitempty"`
+	Message string    `json:"message"`
+}
+
+// KernelLogSummary is what parseKernelEvents found in the kernel log.
+type KernelLogSummary struct {
+	Counts     map[string]int `json:"counts"`
+	OOMKills   []OOMKill      `json:"oomKills,omitempty"`
+	Segfaults  []KernelEvent  `json:"segfaults,omitempty"`
+	HungTasks  []KernelEvent  `json:"hungTasks,omitempty"`
+	Lockups    []KernelEvent  `json:"lockups,omitempty"`
+	DiskErrors []KernelEvent  `json:"diskErrors,omitempty"`
+	NICErrors  []KernelEvent  `json:"nicErrors,omitempty"`
+}
+
+var (
+	oomInvokedRe    = regexp.MustCompile(`^(.+) invoked oom-killer:`)
+	oomConstraintRe = regexp.MustCompile(`^oom-kill:(.*)$`)
+	oomKilledRe     = regexp.MustCompile(`(?:Memory cgroup out of memory|Out of memory).*: Killed process (\d+) \((.*)\) total-vm:(\d+)kB, anon-rss:(\d+)kB, file-rss:(\d+)kB(?:, shmem-rss:(\d+)kB)?`)
+	segfaultRe      = regexp.MustCompile(`^(.+)\[(\d+)\]: segfault at \S+ ip \S+ sp \S+ error \S+`)
+	trapRe          = regexp.MustCompile(`^traps: (.+?)\[(\d+)\] (.+?) ip:`)
+	hungTaskRe      = regexp.MustCompile(`INFO: task (.+):(\d+) blocked for more than (\d+) seconds`)
+	softLockupRe    = regexp.MustCompile(`BUG: soft lockup - CPU#(\d+) stuck for (\d+)s! \[(.+):(\d+)\]`)
+	hardLockupRe    = regexp.MustCompile(`Watchdog detected hard LOCKUP on cpu (\d+)`)
+	diskErrorRes    = []*regexp.Regexp{
+		regexp.MustCompile(`I/O error, dev ([^, ]+)`),
+		regexp.MustCompile(`Buffer I/O error on dev(?:ice)? ([^, ]+)`),
+		regexp.MustCompile(`EXT4-fs (?:error|warning) \(device ([^)]+)\)`),
+		regexp.MustCompile(`XFS \(([^)]+)\): .*(?:[Ee]rror|[Cc]orruption|[Ss]hutdown)`),
+		regexp.MustCompile(`^(ata\d+)(?:\.\d+)?: .*(?:failed|error|exception)`),
+		regexp.MustCompile(`^nvme (nvme\d+): .*(?:timeout|[Rr]eset|error)`),
+		regexp.MustCompile(`^sd \S+: \[(\w+)\] .*(?:FAILED|error|Sense Key)`),
+	}
+	nicErrorRes = []*regexp.Regexp{
+		regexp.MustCompile(`NETDEV WATCHDOG: (\S+?)(?: \(\S+\))?: transmit queue \d+ timed out`),
+		regexp.MustCompile(`([\w.-]+): (?:NIC )?[Ll]ink is [Dd]own`),
+		regexp.MustCompile(`([\w.-]+): .*(?:Detected (?:Tx|Hardware) Unit Hang|[Tt][Xx] timeout|tx hang|[Rr]eset adapter)`),
+	}
+)
+
+// parseKernelEvents extracts OOM kills, crashes, hung tasks, lockups and
+// disk and NIC errors from entries. targetPid marks the OOM kills of the
+// captured process.
+func parseKernelEvents(entries []KernelLogEntry, targetPid int) KernelLogSummary {
+	summary := KernelLogSummary{Counts: map[string]int{}}
+
+	// An OOM kill is reported as a sequence of messages: "invoked
+	// oom-killer", the memory report, "oom-kill:constraint=..." and finally
+	// "Killed process"; the first and third are kept until the last arrives.
+	var invokedBy string
+	var constraint map[string]string
+
+	for _, e := range entries {
+		msg := e.Message
+
+		if m := oomInvokedRe.FindStringSubmatch(msg); m != nil {
+			invokedBy = m[1]
+			constraint = nil
+			continue
+		}
+		if m := oomConstraintRe.FindStringSubmatch(msg); m != nil {
+			constraint = parseOOMConstraint(m[1])
+			continue
+		}
+		if m := oomKilledRe.FindStringSubmatch(msg); m != nil {
+			kill := OOMKill{Time: e.Time, Process: m[2], InvokedBy: invokedBy, Message: msg}
+			kill.Pid, _ = strconv.Atoi(m[1])
+			kill.TotalVMKB, _ = strconv.ParseInt(m[3], 10, 64)
+			kill.AnonRSSKB, _ = strconv.ParseInt(m[4], 10, 64)
+			kill.FileRSSKB, _ = strconv.ParseInt(m[5], 10, 64)
+			kill.ShmemRSSKB, _ = strconv.ParseInt(m[6], 10, 64)
+			kill.RSSKB = kill.AnonRSSKB + kill.FileRSSKB + kill.ShmemRSSKB
+			kill.Target = targetPid > 0 && kill.Pid == targetPid
+			if constraint != nil && constraint["pid"] == m[1] {
+				kill.Constraint = constraint["constraint"]
+				kill.Cgroup = constraint["task_memcg"]
+				kill.OOMCgroup = constraint["oom_memcg"]
+			}
+			summary.OOMKills = append(summary.OOMKills, kill)
+			invokedBy, constraint = "", nil
+			continue
+		}
+
+		if m := segfaultRe.FindStringSubmatch(msg); m != nil {
+			pid, _ := strconv.Atoi(m[2])
+			summary.Segfaults = append(summary.Segfaults, KernelEvent{Time: e.Time, Kind: "segfault", Pid: pid, Process: m[1], Message: msg})
+			continue
+		}
+		if m := trapRe.FindStringSubmatch(msg); m != nil {
+			pid, _ := strconv.Atoi(m[2])
+			summary.Segfaults = append(summary.Segfaults, KernelEvent{Time: e.Time, Kind: m[3], Pid: pid, Process: m[1], Message: msg})
+			continue
+		}
+		if m := hungTaskRe.FindStringSubmatch(msg); m != nil {
+			pid, _ := strconv.Atoi(m[2])
+			seconds, _ := strconv.Atoi(m[3])
+			summary.HungTasks = append(summary.HungTasks, KernelEvent{Time: e.Time, Kind: "hung task", Pid: pid, Process: m[1], Seconds: seconds, Message: msg})
+			continue
+		}
+		if m := softLockupRe.FindStringSubmatch(msg); m != nil {
+			cpu, _ := strconv.Atoi(m[1])
+			seconds, _ := strconv.Atoi(m[2])
+			pid, _ := strconv.Atoi(m[4])
+			summary.Lockups = append(summary.Lockups, KernelEvent{Time: e.Time, Kind: "soft lockup", Pid: pid, Process: m[3], CPU: &cpu, Seconds: seconds, Message: msg})
+			continue
+		}
+		if m := hardLockupRe.FindStringSubmatch(msg); m != nil {
+			cpu, _ := strconv.Atoi(m[1])
+			summary.Lockups = append(summary.Lockups, KernelEvent{Time: e.Time, Kind: "hard lockup", CPU: &cpu, Message: msg})
+			continue
+		}
+		if device, ok := matchDevice(diskErrorRes, msg); ok {
+			summary.DiskErrors = append(summary.DiskErrors, KernelEvent{Time: e.Time, Kind: "disk error", Device: device, Message: msg})
+			continue
+		}
+		if device, ok := matchDevice(nicErrorRes, msg); ok {
+			summary.NICErrors = append(summary.NICErrors, KernelEvent{Time: e.Time, Kind: "nic error", Device: device, Message: msg})
+			continue
+		}
+	}
+
+	summary.Counts["oomKills"] = len(summary.OOMKills)
+	summary.Counts["segfaults"] = len(summary.Segfaults)
+	summary.Counts["hungTasks"] = len(summary.HungTasks)
+	summary.Counts["lockups"] = len(summary.Lockups)
+	summary.Counts["diskErrors"] = len(summary.DiskErrors)
+	summary.Counts["nicErrors"] = len(summary.NICErrors)
+
+	return summary
+}
+
+// parseOOMConstraint parses the key=value list of an oom-kill message:
+//
+//	constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=abc,mems_allowed=0,oom_memcg=/kubepods/pod1,task_memcg=/kubepods/pod1/abc,task=java,pid=1234,uid=0
+func parseOOMConstraint(data string) map[string]string {
+	values := map[string]string{}
+	for _, field := range strings.Split(data, ",") {
+		if key, value, found := strings.Cut(field, "="); found {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func matchDevice(res []*regexp.Regexp, msg string) (string, bool) {
+	for _, re := range res {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKmsg(t *testing.T) {
+	boot := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	entries := parseKmsg("6,1,1500000,-;eth0: Link is Down\n SUBSYSTEM=net\n DEVICE=n2\n30,2,2000000,-;systemd[1]: Started foo.\ngarbage\n", boot)
+
+	assert.Equal(t, []KernelLogEntry{
+		{Time: boot.Add(1500 * time.Millisecond), Facility: 0, Level: 6, Message: "eth0: Link is Down"},
+		{Time: boot.Add(2 * time.Second), Facility: 3, Level: 6, Message: "systemd[1]: Started foo."},
+	}, entries)
+	assert.Equal(t, "daemon", entries[1].FacilityName())
+	assert.Equal(t, "info", entries[1].LevelName())
+}
+
+func TestParseDmesgRaw(t *testing.T) {
+	boot := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	entries := parseDmesgRaw("<3>[   12.500000] I/O error, dev sda, sector 2048\n<4>[123456.1] x\ndmesg: read kernel buffer failed\n", boot)
+
+	assert.Equal(t, []KernelLogEntry{
+		{Time: boot.Add(12500 * time.Millisecond), Level: 3, Message: "I/O error, dev sda, sector 2048"},
+		{Time: boot.Add(123456*time.Second + 100*time.Millisecond), Level: 4, Message: "x"},
+	}, entries)
+}
+
+func TestWriteKernelLog(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2026, 10, 5, 5, 30, 45, 0, time.UTC)
+	require.NoError(t, writeKernelLog(&buf, []KernelLogEntry{{Time: at, Level: 4, Message: "eth0: Link is Down"}}))
+
+	assert.Equal(t, "kern  :warn  : [Mon Oct  5 05:30:45 2026] eth0: Link is Down\n", buf.String())
+}
+
+func TestParseKernelEvents(t *testing.T) {
+	at := time.Date(2026, 10, 19, 5, 30, 0, 0, time.UTC)
+	var entries []KernelLogEntry
+	for _, msg := range []string{
+		"java invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=0",
+		"Memory cgroup stats for /kubepods/pod1/abc:",
+		"oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=abc,mems_allowed=0,oom_memcg=/kubepods/pod1,task_memcg=/kubepods/pod1/abc,task=java,pid=1234,uid=0",
+		"Memory cgroup out of memory: Killed process 1234 (java) total-vm:8000000kB, anon-rss:2000000kB, file-rss:30000kB, shmem-rss:100kB, UID:0 pgtables:5000kB oom_score_adj:0",
+		"Out of memory: Killed process 99 (node) total-vm:100kB, anon-rss:50kB, file-rss:10kB",
+		"java[4321]: segfault at 0 ip 00007f0000001000 sp 00007ffd00000000 error 4 in libjvm.so[7f0000000000+1000000] likely on CPU 3",
+		"traps: dotnet[555] general protection fault ip:7f0000001000 sp:7ffd00000000 error:0 in libcoreclr.so[7f0000000000+100000]",
+		"INFO: task kworker/u8:2:77 blocked for more than 120 seconds.",
+		"watchdog: BUG: soft lockup - CPU#3 stuck for 23s! [java:1234]",
+		"NMI watchdog: Watchdog detected hard LOCKUP on cpu 2",
+		"blk_update_request: I/O error, dev sdb, sector 12345 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 0",
+		"EXT4-fs error (device sda1): ext4_find_entry:1455: inode #2: comm java: reading directory lblock 0",
+		"NETDEV WATCHDOG: eth0 (ixgbe): transmit queue 2 timed out",
+		"ixgbe 0000:01:00.0 eth1: NIC Link is Down",
+		"eth0: renamed from veth1234",
+	} {
+		entries = append(entries, KernelLogEntry{Time: at, Message: msg})
+	}
+
+	summary := parseKernelEvents(entries, 1234)
+
+	require.Len(t, summary.OOMKills, 2)
+	assert.Equal(t, OOMKill{
+		Time:       at,
+		Pid:        1234,
+		Process:    "java",
+		Target:     true,
+		InvokedBy:  "java",
+		Constraint: "CONSTRAINT_MEMCG",
+		Cgroup:     "/kubepods/pod1/abc",
+		OOMCgroup:  "/kubepods/pod1",
+		TotalVMKB:  8000000,
+		AnonRSSKB:  2000000,
+		FileRSSKB:  30000,
+		ShmemRSSKB: 100,
+		RSSKB:      2030100,
+		Message:    entries[3].Message,
+	}, summary.OOMKills[0])
+	assert.Equal(t, 99, summary.OOMKills[1].Pid)
+	assert.False(t, summary.OOMKills[1].Target)
+	assert.Empty(t, summary.OOMKills[1].InvokedBy)
+	assert.Equal(t, int64(60), summary.OOMKills[1].RSSKB)
+
+	require.Len(t, summary.Segfaults, 2)
+	assert.Equal(t, "segfault", summary.Segfaults[0].Kind)
+	assert.Equal(t, 4321, summary.Segfaults[0].Pid)
+	assert.Equal(t, "general protection fault", summary.Segfaults[1].Kind)
+	assert.Equal(t, "dotnet", summary.Segfaults[1].Process)
+
+	require.Len(t, summary.HungTasks, 1)
+	assert.Equal(t, "kworker/u8:2", summary.HungTasks[0].Process)
+	assert.Equal(t, 120, summary.HungTasks[0].Seconds)
+
+	require.Len(t, summary.Lockups, 2)
+	assert.Equal(t, 3, *summary.Lockups[0].CPU)
+	assert.Equal(t, 23, summary.Lockups[0].Seconds)
+	assert.Equal(t, "hard lockup", summary.Lockups[1].Kind)
+
+	var disks, nics []string
+	for _, e := range summary.DiskErrors {
+		disks = append(disks, e.Device)
+	}
+	for _, e := range summary.NICErrors {
+		nics = append(nics, e.Device)
+	}
+	assert.Equal(t, []string{"sdb", "sda1"}, disks)
+	assert.Equal(t, []string{"eth0", "eth1"}, nics)
+
+	assert.Equal(t, map[string]int{"oomKills": 2, "segfaults": 2, "hungTasks": 1, "lockups": 2, "diskErrors": 2, "nicErrors": 2}, summary.Counts)
+}
+
+func TestKernelLogSince(t *testing.T) {
+	at := time.Date(2026, 10, 19, 5, 30, 0, 0, time.UTC)
+	entries := []KernelLogEntry{{Time: at, Message: "a"}, {Time: at.Add(time.Minute), Message: "b"}}
+
+	assert.Equal(t, entries[1:], kernelLogSince(entries, at.Add(time.Second)))
+	assert.Equal(t, entries, kernelLogSince(entries, at))
+	assert.Empty(t, kernelLogSince(entries, at.Add(time.Hour)))
+}
+
+func TestReadKernelLogFixture(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/dev/kmsg is only available on Linux")
+	}
+
+	proc := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "uptime"), []byte("100.00 350.00\n"), 0644))
+	kmsg := filepath.Join(t.TempDir(), "kmsg")
+	require.NoError(t, os.WriteFile(kmsg, []byte("3,1,50000000,-;I/O error, dev sda, sector 1\n6,2,90000000,-;hello\n"), 0644))
+
+	oldProc, oldKmsg := procFSRoot, kmsgPath
+	procFSRoot, kmsgPath = proc, kmsg
+	t.Cleanup(func() { procFSRoot, kmsgPath = oldProc, oldKmsg })
+
+	entries, source, err := readKernelLog()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/dev/kmsg", source)
+	require.Len(t, entries, 2)
+	assert.WithinDuration(t, time.Now().Add(-50*time.Second), entries[0].Time, 5*time.Second)
+	assert.Equal(t, "hello", entries[1].Message)
+}
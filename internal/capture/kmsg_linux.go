@@ -0,0 +1,45 @@
+//go:build linux
+
+package capture
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// readKmsg reads every record currently in the kernel ring buffer from
+// /dev/kmsg. The device hands out one record per read and blocks at the end
+// of the buffer, so it is read non-blocking until EAGAIN. os.File can't be
+// used for that as its poller would wait instead of returning EAGAIN.
+func readKmsg() (string, error) {
+	fd, err := syscall.Open(kmsgPath, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.Close(fd)
+
+	var b strings.Builder
+	// A record is at most 8 KiB (CONSOLE_EXT_LOG_MAX); a smaller buffer
+	// makes the read fail with EINVAL.
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		switch {
+		case errors.Is(err, syscall.EAGAIN):
+			return b.String(), nil
+		case errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.EINTR):
+			// EPIPE: records were overwritten while reading; the next read
+			// resumes at the oldest one still available.
+			continue
+		case err != nil:
+			if b.Len() > 0 {
+				return b.String(), nil
+			}
+			return "", err
+		case n == 0:
+			return b.String(), nil
+		}
+		b.Write(buf[:n])
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package capture
+
+import "errors"
+
+func readKmsg() (string, error) {
+	return "", errors.New("/dev/kmsg is only available on Linux")
+}
@@ -0,0 +1,578 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"yc-agent/internal/logger"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	kubernetesContextPath = "kubernetes.json"
+	// kubernetesTimeout bounds all the API requests of a capture.
+	kubernetesTimeout = 30 * time.Second
+	// kubernetesMaxEvents is how many of the latest events of the pod are
+	// kept.
+	kubernetesMaxEvents = 50
+	// kubernetesNamespacePath is where the namespace of the pod the agent
+	// runs in is mounted.
+	kubernetesNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// KubernetesContext captures the context of the pod the agent runs in, as a
+// sidecar: its spec and container statuses, its recent events, its node and
+// its owning workload.
+//
+// Every part is read separately, so a part the service account isn't
+// allowed to read is reported as an error in the artifact rather than
+// failing the capture.
+type KubernetesContext struct {
+	Capture
+	// PodName and Namespace select the pod. PodName defaults to the host
+	// name, Namespace to the namespace of the service account, or the one
+	// the pod is found in.
+	PodName   string
+	Namespace string
+	// Client defaults to the in-cluster configuration.
+	Client kubernetes.Interface
+}
+
+// KubernetesContextReport is the content of kubernetes.json.
+type KubernetesContextReport struct {
+	Pod    *PodContext    `json:"pod,omitempty"`
+	Events []EventContext `json:"events,omitempty"`
+	Node   *NodeContext   `json:"node,omitempty"`
+	Owner  *OwnerContext  `json:"owner,omitempty"`
+	// Errors are the parts that couldn't be read, e.g. for lack of RBAC
+	// permissions.
+	Errors []string `json:"errors,omitempty"`
+}
+
+type PodContext struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace"`
+	UID               string            `json:"uid"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	NodeName          string            `json:"nodeName"`
+	ServiceAccount    string            `json:"serviceAccount,omitempty"`
+	QOSClass          string            `json:"qosClass,omitempty"`
+	Phase             string            `json:"phase"`
+	StartTime         *time.Time        `json:"startTime,omitempty"`
+	Conditions        []ConditionStatus `json:"conditions,omitempty"`
+	InitContainers    []ContainerSpec   `json:"initContainers,omitempty"`
+	Containers        []ContainerSpec   `json:"containers"`
+	ContainerStatuses []ContainerState  `json:"containerStatuses,omitempty"`
+}
+
+// ContainerSpec is the spec of a container, with the values of its
+// environment variables redacted.
+type ContainerSpec struct {
+	Name           string                      `json:"name"`
+	Image          string                      `json:"image"`
+	Resources      corev1.ResourceRequirements `json:"resources"`
+	LivenessProbe  *corev1.Probe               `json:"livenessProbe,omitempty"`
+	ReadinessProbe *corev1.Probe               `json:"readinessProbe,omitempty"`
+	StartupProbe   *corev1.Probe               `json:"startupProbe,omitempty"`
+	Env            []EnvSource                 `json:"env,omitempty"`
+	EnvFrom        []string                    `json:"envFrom,omitempty"`
+}
+
+// EnvSource is an environment variable and where its value comes from:
+// value, secret <name>/<key>, configMap <name>/<key>, field <path> or
+// resource <resource>.
+type EnvSource struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Value  string `json:"value,omitempty"`
+}
+
+// ContainerState is the status of a container. OOMKilled is set when its
+// current or last termination was an OOM kill.
+type ContainerState struct {
+	Name            string           `json:"name"`
+	Ready           bool             `json:"ready"`
+	RestartCount    int32            `json:"restartCount"`
+	State           string           `json:"state"`
+	LastTermination *TerminationInfo `json:"lastTermination,omitempty"`
+	OOMKilled       bool             `json:"oomKilled,omitempty"`
+}
+
+type TerminationInfo struct {
+	Reason     string    `json:"reason"`
+	ExitCode   int32     `json:"exitCode"`
+	Signal     int32     `json:"signal,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+type ConditionStatus struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitzero"`
+}
+
+type EventContext struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count,omitempty"`
+	FirstSeen time.Time `json:"firstSeen,omitzero"`
+	LastSeen  time.Time `json:"lastSeen,omitzero"`
+}
+
+type NodeContext struct {
+	Name             string            `json:"name"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Unschedulable    bool              `json:"unschedulable,omitempty"`
+	Conditions       []ConditionStatus `json:"conditions,omitempty"`
+	Capacity         map[string]string `json:"capacity,omitempty"`
+	Allocatable      map[string]string `json:"allocatable,omitempty"`
+	KubeletVersion   string            `json:"kubeletVersion,omitempty"`
+	OSImage          string            `json:"osImage,omitempty"`
+	KernelVersion    string            `json:"kernelVersion,omitempty"`
+	ContainerRuntime string            `json:"containerRuntime,omitempty"`
+}
+
+// OwnerContext is the workload owning the pod: the Deployment of its
+// ReplicaSet, its StatefulSet, or another controller by kind and name only.
+type OwnerContext struct {
+	Kind               string            `json:"kind"`
+	Name               string            `json:"name"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	CreatedAt          time.Time         `json:"createdAt,omitzero"`
+	Generation         int64             `json:"generation,omitempty"`
+	ObservedGeneration int64             `json:"observedGeneration,omitempty"`
+	Replicas           *int32            `json:"replicas,omitempty"`
+	ReadyReplicas      int32             `json:"readyReplicas"`
+	UpdatedReplicas    int32             `json:"updatedReplicas"`
+	AvailableReplicas  int32             `json:"availableReplicas"`
+	Strategy           string            `json:"strategy,omitempty"`
+	ReplicaSet         string            `json:"replicaSet,omitempty"`
+	CurrentRevision    string            `json:"currentRevision,omitempty"`
+	UpdateRevision     string            `json:"updateRevision,omitempty"`
+	Conditions         []ConditionStatus `json:"conditions,omitempty"`
+}
+
+// Run captures the context to kubernetes.json and uploads it.
+func (k *KubernetesContext) Run() (Result, error) {
+	client := k.Client
+	if client == nil {
+		cfg, err := rest.InClusterConfig()
+		if err != nil {
+			return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to configure the in-cluster client: %w", err)
+		}
+		if client, err = kubernetes.NewForConfig(cfg); err != nil {
+			return Result{Msg: err.Error(), Ok: false}, fmt.Errorf("failed to create the kubernetes client: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesTimeout)
+	defer cancel()
+	report := k.collect(ctx, client)
+	for _, e := range report.Errors {
+		logger.Log("kubernetes context: %s", e)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to marshal the kubernetes context: %w", err)
+	}
+	f, err := os.Create(kubernetesContextPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create %s: %w", kubernetesContextPath, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return Result{}, fmt.Errorf("failed to write %s: %w", kubernetesContextPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		return Result{}, fmt.Errorf("failed to sync %s: %w", kubernetesContextPath, err)
+	}
+
+	msg, ok := PostData(k.Endpoint(), "kubernetes", f)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// collect reads every part of the context, recording the ones it can't.
+func (k *KubernetesContext) collect(ctx context.Context, client kubernetes.Interface) KubernetesContextReport {
+	var report KubernetesContextReport
+	fail := func(what string, err error) {
+		if apierrors.IsForbidden(err) {
+			what += " (forbidden, check the RBAC permissions of the service account)"
+		}
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	podName := k.PodName
+	if podName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			fail("get the pod name", err)
+			return report
+		}
+		podName = hostname
+	}
+	namespace := k.Namespace
+	if namespace == "" {
+		namespace = podNamespace(ctx, client, podName)
+	}
+	if namespace == "" {
+		report.Errors = append(report.Errors, fmt.Sprintf("namespace of pod %s not found", podName))
+		return report
+	}
+
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		fail(fmt.Sprintf("get pod %s/%s", namespace, podName), err)
+		return report
+	}
+	report.Pod = newPodContext(pod)
+
+	events, err := client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + podName,
+	})
+	if err != nil {
+		fail("list the events of the pod", err)
+	} else {
+		report.Events = newEventContexts(events.Items, pod.UID)
+	}
+
+	if pod.Spec.NodeName != "" {
+		node, err := client.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			fail("get node "+pod.Spec.NodeName, err)
+		} else {
+			report.Node = newNodeContext(node)
+		}
+	}
+
+	report.Owner, err = podOwner(ctx, client, pod)
+	if err != nil {
+		fail("get the owner of the pod", err)
+	}
+
+	return report
+}
+
+// podNamespace returns the namespace of the service account, or the first
+// namespace with a pod named podName.
+func podNamespace(ctx context.Context, client kubernetes.Interface, podName string) string {
+	if data, err := os.ReadFile(kubernetesNamespacePath); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.Log("kubernetes context: failed to list namespaces: %v", err)
+		return ""
+	}
+	for _, ns := range namespaces.Items {
+		if _, err := client.CoreV1().Pods(ns.Name).Get(ctx, podName, metav1.GetOptions{}); err == nil {
+			return ns.Name
+		}
+	}
+	return ""
+}
+
+func newPodContext(pod *corev1.Pod) *PodContext {
+	p := &PodContext{
+		Name:           pod.Name,
+		Namespace:      pod.Namespace,
+		UID:            string(pod.UID),
+		Labels:         pod.Labels,
+		NodeName:       pod.Spec.NodeName,
+		ServiceAccount: pod.Spec.ServiceAccountName,
+		QOSClass:       string(pod.Status.QOSClass),
+		Phase:          string(pod.Status.Phase),
+	}
+	if pod.Status.StartTime != nil {
+		p.StartTime = &pod.Status.StartTime.Time
+	}
+	for _, c := range pod.Status.Conditions {
+		p.Conditions = append(p.Conditions, ConditionStatus{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	for _, c := range pod.Spec.InitContainers {
+		p.InitContainers = append(p.InitContainers, newContainerSpec(c))
+	}
+	for _, c := range pod.Spec.Containers {
+		p.Containers = append(p.Containers, newContainerSpec(c))
+	}
+	for _, s := range slices.Concat(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses) {
+		p.ContainerStatuses = append(p.ContainerStatuses, newContainerState(s))
+	}
+	return p
+}
+
+func newContainerSpec(c corev1.Container) ContainerSpec {
+	spec := ContainerSpec{
+		Name:           c.Name,
+		Image:          c.Image,
+		Resources:      c.Resources,
+		LivenessProbe:  c.LivenessProbe,
+		ReadinessProbe: c.ReadinessProbe,
+		StartupProbe:   c.StartupProbe,
+	}
+	for _, e := range c.Env {
+		spec.Env = append(spec.Env, newEnvSource(e))
+	}
+	for _, e := range c.EnvFrom {
+		switch {
+		case e.ConfigMapRef != nil:
+			spec.EnvFrom = append(spec.EnvFrom, "configMap "+e.Prefix+e.ConfigMapRef.Name)
+		case e.SecretRef != nil:
+			spec.EnvFrom = append(spec.EnvFrom, "secret "+e.Prefix+e.SecretRef.Name)
+		}
+	}
+	return spec
+}
+
+// newEnvSource describes where the value of e comes from. Literal values are
+// redacted, as they may be credentials.
+func newEnvSource(e corev1.EnvVar) EnvSource {
+	env := EnvSource{Name: e.Name, Source: "value"}
+	switch from := e.ValueFrom; {
+	case from == nil:
+		if e.Value != "" {
+			env.Value = redactedValue
+		}
+	case from.SecretKeyRef != nil:
+		env.Source = "secret " + from.SecretKeyRef.Name + "/" + from.SecretKeyRef.Key
+	case from.ConfigMapKeyRef != nil:
+		env.Source = "configMap " + from.ConfigMapKeyRef.Name + "/" + from.ConfigMapKeyRef.Key
+	case from.FieldRef != nil:
+		env.Source = "field " + from.FieldRef.FieldPath
+	case from.ResourceFieldRef != nil:
+		env.Source = "resource " + from.ResourceFieldRef.Resource
+	default:
+		env.Source = "other"
+	}
+	return env
+}
+
+func newContainerState(s corev1.ContainerStatus) ContainerState {
+	state := ContainerState{Name: s.Name, Ready: s.Ready, RestartCount: s.RestartCount}
+	switch {
+	case s.State.Running != nil:
+		state.State = "running"
+	case s.State.Waiting != nil:
+		state.State = "waiting: " + s.State.Waiting.Reason
+	case s.State.Terminated != nil:
+		state.State = "terminated: " + s.State.Terminated.Reason
+		state.OOMKilled = s.State.Terminated.Reason == "OOMKilled"
+	}
+	if t := s.LastTerminationState.Terminated; t != nil {
+		state.LastTermination = &TerminationInfo{
+			Reason:     t.Reason,
+			ExitCode:   t.ExitCode,
+			Signal:     t.Signal,
+			Message:    t.Message,
+			StartedAt:  t.StartedAt.Time,
+			FinishedAt: t.FinishedAt.Time,
+		}
+		state.OOMKilled = state.OOMKilled || t.Reason == "OOMKilled"
+	}
+	return state
+}
+
+// newEventContexts returns the latest events of the pod uid, the latest
+// first. Events are filtered again as not every client honors field
+// selectors.
+func newEventContexts(events []corev1.Event, uid types.UID) []EventContext {
+	var contexts []EventContext
+	for _, e := range events {
+		if e.InvolvedObject.Kind != "Pod" || (e.InvolvedObject.UID != "" && e.InvolvedObject.UID != uid) {
+			continue
+		}
+		first, last := e.FirstTimestamp.Time, e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		if first.IsZero() {
+			first = last
+		}
+		contexts = append(contexts, EventContext{
+			Type:      e.Type,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     e.Count,
+			FirstSeen: first,
+			LastSeen:  last,
+		})
+	}
+	slices.SortStableFunc(contexts, func(a, b EventContext) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return contexts[:min(len(contexts), kubernetesMaxEvents)]
+}
+
+func newNodeContext(node *corev1.Node) *NodeContext {
+	n := &NodeContext{
+		Name:             node.Name,
+		Labels:           node.Labels,
+		Unschedulable:    node.Spec.Unschedulable,
+		Capacity:         resourceList(node.Status.Capacity),
+		Allocatable:      resourceList(node.Status.Allocatable),
+		KubeletVersion:   node.Status.NodeInfo.KubeletVersion,
+		OSImage:          node.Status.NodeInfo.OSImage,
+		KernelVersion:    node.Status.NodeInfo.KernelVersion,
+		ContainerRuntime: node.Status.NodeInfo.ContainerRuntimeVersion,
+	}
+	for _, c := range node.Status.Conditions {
+		n.Conditions = append(n.Conditions, ConditionStatus{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return n
+}
+
+func resourceList(l corev1.ResourceList) map[string]string {
+	if len(l) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(l))
+	for name, q := range l {
+		m[string(name)] = q.String()
+	}
+	return m
+}
+
+// podOwner returns the workload owning pod, following a ReplicaSet to its
+// Deployment. It returns nil for a pod without a controller.
+func podOwner(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) (*OwnerContext, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil, nil
+	}
+
+	switch ref.Kind {
+	case "ReplicaSet":
+		rs, err := client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return &OwnerContext{Kind: ref.Kind, Name: ref.Name}, fmt.Errorf("get replicaset %s: %w", ref.Name, err)
+		}
+		rsRef := metav1.GetControllerOf(rs)
+		if rsRef == nil || rsRef.Kind != "Deployment" {
+			return newReplicaSetOwner(rs), nil
+		}
+		d, err := client.AppsV1().Deployments(pod.Namespace).Get(ctx, rsRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return &OwnerContext{Kind: rsRef.Kind, Name: rsRef.Name, ReplicaSet: rs.Name}, fmt.Errorf("get deployment %s: %w", rsRef.Name, err)
+		}
+		owner := newDeploymentOwner(d)
+		owner.ReplicaSet = rs.Name
+		return owner, nil
+	case "StatefulSet":
+		s, err := client.AppsV1().StatefulSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return &OwnerContext{Kind: ref.Kind, Name: ref.Name}, fmt.Errorf("get statefulset %s: %w", ref.Name, err)
+		}
+		return newStatefulSetOwner(s), nil
+	default:
+		return &OwnerContext{Kind: ref.Kind, Name: ref.Name}, nil
+	}
+}
+
+func newOwnerContext(kind string, meta metav1.ObjectMeta) *OwnerContext {
+	return &OwnerContext{
+		Kind:        kind,
+		Name:        meta.Name,
+		Labels:      meta.Labels,
+		Annotations: ownerAnnotations(meta.Annotations),
+		CreatedAt:   meta.CreationTimestamp.Time,
+		Generation:  meta.Generation,
+	}
+}
+
+// ownerAnnotations drops the last applied configuration, a copy of the whole
+// object with possibly secret values.
+func ownerAnnotations(annotations map[string]string) map[string]string {
+	const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+	if _, ok := annotations[lastApplied]; !ok {
+		return annotations
+	}
+	filtered := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		if k != lastApplied {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+func newDeploymentOwner(d *appsv1.Deployment) *OwnerContext {
+	o := newOwnerContext("Deployment", d.ObjectMeta)
+	o.ObservedGeneration = d.Status.ObservedGeneration
+	o.Replicas = d.Spec.Replicas
+	o.ReadyReplicas = d.Status.ReadyReplicas
+	o.UpdatedReplicas = d.Status.UpdatedReplicas
+	o.AvailableReplicas = d.Status.AvailableReplicas
+	o.Strategy = string(d.Spec.Strategy.Type)
+	for _, c := range d.Status.Conditions {
+		o.Conditions = append(o.Conditions, ConditionStatus{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return o
+}
+
+func newStatefulSetOwner(s *appsv1.StatefulSet) *OwnerContext {
+	o := newOwnerContext("StatefulSet", s.ObjectMeta)
+	o.ObservedGeneration = s.Status.ObservedGeneration
+	o.Replicas = s.Spec.Replicas
+	o.ReadyReplicas = s.Status.ReadyReplicas
+	o.UpdatedReplicas = s.Status.UpdatedReplicas
+	o.AvailableReplicas = s.Status.AvailableReplicas
+	o.Strategy = string(s.Spec.UpdateStrategy.Type)
+	o.CurrentRevision = s.Status.CurrentRevision
+	o.UpdateRevision = s.Status.UpdateRevision
+	for _, c := range s.Status.Conditions {
+		o.Conditions = append(o.Conditions, ConditionStatus{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return o
+}
+
+func newReplicaSetOwner(rs *appsv1.ReplicaSet) *OwnerContext {
+	o := newOwnerContext("ReplicaSet", rs.ObjectMeta)
+	o.ObservedGeneration = rs.Status.ObservedGeneration
+	o.Replicas = rs.Spec.Replicas
+	o.ReadyReplicas = rs.Status.ReadyReplicas
+	o.AvailableReplicas = rs.Status.AvailableReplicas
+	return o
+}
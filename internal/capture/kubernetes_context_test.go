@@ -0,0 +1,219 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func kubernetesFixtures() []runtime.Object {
+	controller := true
+	replicas := int32(3)
+	at := metav1.NewTime(time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC))
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "shop",
+			Annotations: map[string]string{
+				"deployment.kubernetes.io/revision":                "7",
+				"kubectl.kubernetes.io/last-applied-configuration": `{"password":"hunter2"}`,
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: 2, UpdatedReplicas: 3, AvailableReplicas: 2},
+	}
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-5d4f",
+			Namespace:       "shop",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-5d4f-x7k2p",
+			Namespace:       "shop",
+			UID:             "pod-uid",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d4f", Controller: &controller}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "shop/web:1.2",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+				},
+				LivenessProbe: &corev1.Probe{
+					ProbeHandler:     corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/health"}},
+					FailureThreshold: 3,
+				},
+				Env: []corev1.EnvVar{
+					{Name: "DB_PASSWORD", Value: "hunter2"},
+					{Name: "API_KEY", ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "api"}, Key: "key"},
+					}},
+					{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{
+						FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+					}},
+				},
+				EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "web-config"}}}},
+			}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "app",
+				RestartCount: 4,
+				State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason: "OOMKilled", ExitCode: 137, FinishedAt: at,
+				}},
+			}},
+		},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("7Gi"), corev1.ResourceCPU: resource.MustParse("3800m")},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue, Reason: "KubeletHasInsufficientMemory"},
+			},
+		},
+	}
+	event := func(name, reason string, last time.Time, uid string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "shop"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web-5d4f-x7k2p", UID: types.UID(uid)},
+			Type:           corev1.EventTypeWarning,
+			Reason:         reason,
+			LastTimestamp:  metav1.NewTime(last),
+		}
+	}
+
+	return []runtime.Object{
+		deployment, replicaSet, pod, node,
+		event("e1", "BackOff", at.Add(time.Minute), "pod-uid"),
+		event("e2", "Unhealthy", at.Add(2*time.Minute), "pod-uid"),
+		// An event of a former pod of the same name.
+		event("e3", "Killing", at.Add(3*time.Minute), "old-uid"),
+	}
+}
+
+func TestKubernetesContextCollect(t *testing.T) {
+	client := fake.NewClientset(kubernetesFixtures()...)
+	k := &KubernetesContext{PodName: "web-5d4f-x7k2p", Namespace: "shop", Client: client}
+
+	report := k.collect(context.Background(), client)
+	assert.Empty(t, report.Errors)
+
+	require.NotNil(t, report.Pod)
+	require.Len(t, report.Pod.Containers, 1)
+	app := report.Pod.Containers[0]
+	assert.Equal(t, "512Mi", app.Resources.Limits.Memory().String())
+	require.NotNil(t, app.LivenessProbe)
+	assert.Equal(t, "/health", app.LivenessProbe.HTTPGet.Path)
+	assert.Equal(t, []EnvSource{
+		{Name: "DB_PASSWORD", Source: "value", Value: redactedValue},
+		{Name: "API_KEY", Source: "secret api/key"},
+		{Name: "POD_IP", Source: "field status.podIP"},
+	}, app.Env)
+	assert.Equal(t, []string{"configMap web-config"}, app.EnvFrom)
+
+	require.Len(t, report.Pod.ContainerStatuses, 1)
+	status := report.Pod.ContainerStatuses[0]
+	assert.Equal(t, int32(4), status.RestartCount)
+	assert.Equal(t, "running", status.State)
+	assert.True(t, status.OOMKilled)
+	require.NotNil(t, status.LastTermination)
+	assert.Equal(t, int32(137), status.LastTermination.ExitCode)
+
+	require.Len(t, report.Events, 2)
+	assert.Equal(t, "Unhealthy", report.Events[0].Reason, "the latest first")
+	assert.Equal(t, "BackOff", report.Events[1].Reason)
+
+	require.NotNil(t, report.Node)
+	assert.Equal(t, map[string]string{"memory": "7Gi", "cpu": "3800m"}, report.Node.Allocatable)
+	assert.Equal(t, "MemoryPressure", report.Node.Conditions[0].Type)
+
+	require.NotNil(t, report.Owner)
+	assert.Equal(t, "Deployment", report.Owner.Kind)
+	assert.Equal(t, "web", report.Owner.Name)
+	assert.Equal(t, "web-5d4f", report.Owner.ReplicaSet)
+	assert.Equal(t, int32(3), *report.Owner.Replicas)
+	assert.Equal(t, int32(2), report.Owner.AvailableReplicas)
+	assert.Equal(t, "RollingUpdate", report.Owner.Strategy)
+	assert.Equal(t, map[string]string{"deployment.kubernetes.io/revision": "7"}, report.Owner.Annotations)
+}
+
+func TestKubernetesContextForbidden(t *testing.T) {
+	oldOnlyCapture := config.GlobalConfig.OnlyCapture
+	config.GlobalConfig.OnlyCapture = true
+	defer func() { config.GlobalConfig.OnlyCapture = oldOnlyCapture }()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	// The service account may read its pod only.
+	client := fake.NewClientset(kubernetesFixtures()...)
+	for _, resource := range []string{"nodes", "events", "replicasets"} {
+		client.PrependReactor("*", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			gr := schema.GroupResource{Group: action.GetResource().Group, Resource: action.GetResource().Resource}
+			return true, nil, apierrors.NewForbidden(gr, "", nil)
+		})
+	}
+
+	k := &KubernetesContext{PodName: "web-5d4f-x7k2p", Namespace: "shop", Client: client}
+	_, err = k.Run()
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(kubernetesContextPath)
+	require.NoError(t, err)
+	var report KubernetesContextReport
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	require.NotNil(t, report.Pod)
+	assert.Equal(t, "web-5d4f-x7k2p", report.Pod.Name)
+	assert.Nil(t, report.Node)
+	assert.Empty(t, report.Events)
+	require.NotNil(t, report.Owner)
+	assert.Equal(t, "ReplicaSet", report.Owner.Kind)
+	require.Len(t, report.Errors, 3)
+	for _, e := range report.Errors {
+		assert.Contains(t, e, "forbidden, check the RBAC permissions")
+	}
+}
+
+func TestKubernetesContextPodNotFound(t *testing.T) {
+	client := fake.NewClientset()
+	k := &KubernetesContext{PodName: "web", Namespace: "shop", Client: client}
+
+	report := k.collect(context.Background(), client)
+	assert.Nil(t, report.Pod)
+	require.Len(t, report.Errors, 1)
+	assert.Contains(t, report.Errors[0], "get pod shop/web")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"yc-agent/internal/config"
 	"yc-agent/internal/logger"
@@ -18,12 +19,17 @@ const lpM3OutputPath = "lp.out"
 type LPM3 struct {
 	Capture
 	Pids map[int]string
+	// Frequencies are the current M3 cadences of adaptive M3 by pid.
+	Frequencies map[int]time.Duration
 }
 
 type LogicalProcess struct {
 	ProcessName string
 	CommandLine string
 	ProcessId   int
+	// M3Frequency is the current M3 cadence of the process in seconds,
+	// reported with adaptive M3.
+	M3Frequency int `json:",omitempty"`
 }
 
 // NewLPM3 creates a new LPM3 capture instance.
@@ -81,7 +87,12 @@ func (p *LPM3) captureOutput(f *os.File) error {
 		}
 
 		for _, process := range processes {
-			logicalProcesses = append(logicalProcesses, LogicalProcess(process))
+			logicalProcesses = append(logicalProcesses, LogicalProcess{
+				ProcessName: process.ProcessName,
+				ProcessId:   process.ProcessId,
+				CommandLine: process.CommandLine,
+				M3Frequency: int(p.Frequencies[process.ProcessId].Seconds()),
+			})
 		}
 	} else {
 		for pid := range p.Pids {
@@ -107,6 +118,7 @@ func (p *LPM3) captureOutput(f *os.File) error {
 				ProcessName: psName,
 				ProcessId:   pid,
 				CommandLine: cmdLine,
+				M3Frequency: int(p.Frequencies[pid].Seconds()),
 			})
 		}
 	}
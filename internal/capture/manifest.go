@@ -0,0 +1,85 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const manifestOutputPath = "manifest.json"
+
+// Manifest records how the artifacts of a capture were produced, e.g. when
+// the agent changed a setting of the target while capturing. Capture tasks
+// add entries concurrently; the manifest is written and uploaded once all
+// of them have finished. A nil *Manifest ignores all entries.
+type Manifest struct {
+	Capture
+	mu      sync.Mutex
+	entries map[string]any
+}
+
+// NewManifest creates an empty Manifest.
+func NewManifest() *Manifest {
+	return &Manifest{entries: map[string]any{}}
+}
+
+// Set records value under key, replacing any previous value.
+func (m *Manifest) Set(key string, value any) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+}
+
+// Len returns the number of recorded entries.
+func (m *Manifest) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Run writes the manifest to manifest.json and uploads it.
+func (m *Manifest) Run() (Result, error) {
+	file, err := m.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(m.Endpoint(), "manifest", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile writes the recorded entries as JSON to manifest.json.
+func (m *Manifest) CaptureToFile() (*os.File, error) {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.entries, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	file, err := os.Create(manifestOutputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest file: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write manifest file: %w", err)
+	}
+
+	if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		file.Close()
+		return nil, fmt.Errorf("failed to sync manifest file: %w", err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,17 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestNil(t *testing.T) {
+	var m *Manifest
+	m.Set("gcLogging", true)
+	assert.Equal(t, 0, m.Len())
+
+	m = NewManifest()
+	m.Set("gcLogging", true)
+	assert.Equal(t, 1, m.Len())
+}
@@ -0,0 +1,522 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/logger"
+)
+
+const netConnectionsOut = "net-connections.json"
+
+// netConnectionsMaxPeers bounds the number of peers in the report.
+const netConnectionsMaxPeers = 100
+
+// tcpStates are the socket states of /proc/net/tcp (include/net/tcp_states.h).
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// netCounters are the /proc/net/snmp and /proc/net/netstat counters sampled
+// over the capture window.
+var netCounters = []string{
+	"Tcp.ActiveOpens",
+	"Tcp.PassiveOpens",
+	"Tcp.AttemptFails",
+	"Tcp.EstabResets",
+	"Tcp.CurrEstab",
+	"Tcp.InErrs",
+	"Tcp.OutSegs",
+	"Tcp.RetransSegs",
+	"Tcp.OutRsts",
+	"TcpExt.ListenOverflows",
+	"TcpExt.ListenDrops",
+	"TcpExt.TCPTimeouts",
+	"TcpExt.TCPSynRetrans",
+	"TcpExt.TCPLostRetransmit",
+	"TcpExt.TCPBacklogDrop",
+	"TcpExt.SyncookiesSent",
+	"TcpExt.TCPAbortOnTimeout",
+}
+
+// NetConnections analyzes the TCP connections of the target process: its
+// sockets (from /proc/<pid>/fd) are looked up in the tcp tables of its network
+// namespace and grouped by state and peer, listen sockets are checked for a
+// full accept queue, and the TCP counters are sampled over the capture window
+// for retransmits and listen overflows.
+type NetConnections struct {
+	Capture
+	Pid int
+	// Interval between counter samples; defaults to VMSTAT_INTERVAL.
+	Interval time.Duration
+	// Samples to take; defaults to the vmstat sample count.
+	Samples int
+}
+
+// TCPConn is a row of /proc/net/tcp{,6}.
+type TCPConn struct {
+	Local  string
+	Remote string
+	State  string
+	// TxQueue and RxQueue are Send-Q and Recv-Q; for a listen socket RxQueue
+	// is the number of connections waiting to be accepted.
+	TxQueue int64
+	RxQueue int64
+	Inode   uint64
+}
+
+// NetPeer groups the connections with one remote endpoint. Inbound
+// connections (to one of the process's listen ports) are grouped by remote
+// address and local port, since their remote ports are ephemeral.
+type NetPeer struct {
+	Peer      string         `json:"peer"`
+	Direction string         `json:"direction"`
+	Total     int            `json:"total"`
+	States    map[string]int `json:"states"`
+	CloseWait int            `json:"closeWait"`
+	// TimeWait counts the TIME_WAIT entries with this peer on a local port
+	// the process listens on or has bound. They no longer belong to a
+	// process, so the ones on other ports are only counted in the
+	// namespace-wide netConnectionsReport.TimeWait.
+	TimeWait int `json:"timeWait"`
+}
+
+// NetListener is a listen socket of the process.
+type NetListener struct {
+	Local string `json:"local"`
+	// RecvQ is the current accept queue length.
+	RecvQ int64 `json:"recvQ"`
+	// Limit is net.core.somaxconn, the upper bound of the accept queue; the
+	// backlog the application asked for isn't exposed in /proc.
+	Limit int64 `json:"limit,omitempty"`
+	// Full is set when the accept queue has reached the limit.
+	Full bool `json:"full,omitempty"`
+}
+
+// NetCounterSample is one sample of the TCP counters.
+type NetCounterSample struct {
+	Time   time.Time        `json:"time"`
+	Values map[string]int64 `json:"values"`
+}
+
+type netConnectionsReport struct {
+	Pid         int            `json:"pid"`
+	CapturedAt  time.Time      `json:"capturedAt"`
+	Sockets     int            `json:"sockets"`
+	Connections int            `json:"connections"`
+	States      map[string]int `json:"states"`
+	// TimeWait counts every TIME_WAIT entry of the network namespace, which
+	// includes the ones of other processes sharing it (host network).
+	TimeWait int       `json:"timeWait"`
+	Peers    []NetPeer `json:"peers"`
+	// PeersTruncated is set when there were more than netConnectionsMaxPeers.
+	PeersTruncated bool               `json:"peersTruncated,omitempty"`
+	Listeners      []NetListener      `json:"listeners"`
+	Counters       []NetCounterSample `json:"counters"`
+	// CounterDeltas is the change of each counter over the window.
+	CounterDeltas map[string]int64 `json:"counterDeltas,omitempty"`
+	// RetransmitPercent is RetransSegs / OutSegs over the window.
+	RetransmitPercent float64 `json:"retransmitPercent"`
+}
+
+// Run captures and uploads the analysis.
+func (t *NetConnections) Run() (Result, error) {
+	if runtime.GOOS != "linux" {
+		return Result{Msg: "skipped: process network analysis is only supported on Linux"}, nil
+	}
+
+	file, err := t.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "netconn", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile writes the analysis to net-connections.json.
+func (t *NetConnections) CaptureToFile() (*os.File, error) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Duration(executils.VMSTAT_INTERVAL) * time.Second
+	}
+	samples := t.Samples
+	if samples <= 0 {
+		samples = vmstatCount
+	}
+
+	report, err := analyzeProcessConnections(t.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range samples {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		values, err := readNetCounters(t.Pid)
+		if err != nil {
+			logger.Log("Failed to read TCP counters of pid %d: %v", t.Pid, err)
+			break
+		}
+		report.Counters = append(report.Counters, NetCounterSample{Time: time.Now(), Values: values})
+	}
+	report.CounterDeltas, report.RetransmitPercent = netCounterDeltas(report.Counters)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal network analysis: %w", err)
+	}
+
+	file, err := os.Create(netConnectionsOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", netConnectionsOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", netConnectionsOut, err)
+	}
+
+	return file, nil
+}
+
+// analyzeProcessConnections groups the TCP connections of pid.
+func analyzeProcessConnections(pid int) (*netConnectionsReport, error) {
+	inodes, err := processSocketInodes(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	var conns []TCPConn
+	for _, table := range []string{"tcp", "tcp6"} {
+		c, err := readTCPTable(filepath.Join(procFSRoot, strconv.Itoa(pid), "net", table))
+		if err != nil {
+			continue
+		}
+		conns = append(conns, c...)
+	}
+
+	somaxconn := int64(0)
+	if data, err := os.ReadFile(filepath.Join(procFSRoot, "sys", "net", "core", "somaxconn")); err == nil {
+		somaxconn, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	return groupConnections(pid, conns, inodes, somaxconn), nil
+}
+
+func groupConnections(pid int, conns []TCPConn, inodes map[uint64]bool, somaxconn int64) *netConnectionsReport {
+	report := &netConnectionsReport{
+		Pid:        pid,
+		CapturedAt: time.Now(),
+		Sockets:    len(inodes),
+		States:     map[string]int{},
+		Peers:      []NetPeer{},
+		Listeners:  []NetListener{},
+	}
+
+	// Listen ports first, to tell inbound from outbound connections.
+	listenPorts := map[string]bool{}
+	for _, c := range conns {
+		if c.State != "LISTEN" || !inodes[c.Inode] {
+			continue
+		}
+		listenPorts[endpointPort(c.Local)] = true
+		listener := NetListener{Local: c.Local, RecvQ: c.RxQueue, Limit: somaxconn}
+		listener.Full = somaxconn > 0 && c.RxQueue >= somaxconn
+		report.Listeners = append(report.Listeners, listener)
+	}
+
+	// The ports of the process's sockets tell its TIME_WAIT entries from the
+	// ones of other processes of the namespace.
+	boundPorts := map[string]bool{}
+	for _, c := range conns {
+		if inodes[c.Inode] {
+			boundPorts[endpointPort(c.Local)] = true
+		}
+	}
+
+	peers := map[string]*NetPeer{}
+	peer := func(c TCPConn) *NetPeer {
+		key, direction := c.Remote, "outbound"
+		if port := endpointPort(c.Local); listenPorts[port] {
+			key, direction = endpointHost(c.Remote)+" -> :"+port, "inbound"
+		}
+		p, ok := peers[key]
+		if !ok {
+			p = &NetPeer{Peer: key, Direction: direction, States: map[string]int{}}
+			peers[key] = p
+		}
+		return p
+	}
+
+	for _, c := range conns {
+		switch {
+		case c.State == "LISTEN":
+			continue
+		case c.State == "TIME_WAIT":
+			// TIME_WAIT sockets have no owner (inode 0) anymore.
+			report.TimeWait++
+			if boundPorts[endpointPort(c.Local)] {
+				peer(c).TimeWait++
+			}
+			continue
+		case !inodes[c.Inode]:
+			continue
+		}
+
+		report.Connections++
+		report.States[c.State]++
+
+		p := peer(c)
+		p.Total++
+		p.States[c.State]++
+		if c.State == "CLOSE_WAIT" {
+			p.CloseWait++
+		}
+	}
+
+	for _, p := range peers {
+		if p.Total > 0 || p.TimeWait > 0 {
+			report.Peers = append(report.Peers, *p)
+		}
+	}
+	slices.SortFunc(report.Peers, func(a, b NetPeer) int {
+		if a.Total+a.TimeWait != b.Total+b.TimeWait {
+			return (b.Total + b.TimeWait) - (a.Total + a.TimeWait)
+		}
+		return strings.Compare(a.Peer, b.Peer)
+	})
+	if len(report.Peers) > netConnectionsMaxPeers {
+		report.Peers = report.Peers[:netConnectionsMaxPeers]
+		report.PeersTruncated = true
+	}
+
+	return report
+}
+
+// processSocketInodes returns the inodes of the sockets pid has open.
+func processSocketInodes(pid int) (map[uint64]bool, error) {
+	dir := filepath.Join(procFSRoot, strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fds of pid %d: %w", pid, err)
+	}
+
+	inodes := map[uint64]bool{}
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		// socket:[12345]
+		inode, found := strings.CutPrefix(target, "socket:[")
+		if !found {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64); err == nil {
+			inodes[n] = true
+		}
+	}
+
+	return inodes, nil
+}
+
+// readTCPTable parses /proc/net/tcp or /proc/net/tcp6, i.e:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	 0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 31784 1 ...
+func readTCPTable(path string) ([]TCPConn, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var conns []TCPConn
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err := decodeProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		remote, err := decodeProcNetAddr(fields[2])
+		if err != nil {
+			continue
+		}
+		state, ok := tcpStates[fields[3]]
+		if !ok {
+			state = fields[3]
+		}
+		tx, rx, _ := strings.Cut(fields[4], ":")
+		txQueue, _ := strconv.ParseInt(tx, 16, 64)
+		rxQueue, _ := strconv.ParseInt(rx, 16, 64)
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+
+		conns = append(conns, TCPConn{
+			Local:   local,
+			Remote:  remote,
+			State:   state,
+			TxQueue: txQueue,
+			RxQueue: rxQueue,
+			Inode:   inode,
+		})
+	}
+
+	return conns, scanner.Err()
+}
+
+// decodeProcNetAddr decodes "0100007F:1F90" into "127.0.0.1:8080". Addresses
+// are stored as host-endian 32-bit words, i.e. little-endian on x86 and arm64.
+func decodeProcNetAddr(s string) (string, error) {
+	addr, port, found := strings.Cut(s, ":")
+	if !found {
+		return "", fmt.Errorf("malformed address %q", s)
+	}
+
+	raw, err := hex.DecodeString(addr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", fmt.Errorf("malformed address %q", s)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("malformed port %q", s)
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(p, 10)), nil
+}
+
+func endpointPort(endpoint string) string {
+	_, port, _ := net.SplitHostPort(endpoint)
+	return port
+}
+
+func endpointHost(endpoint string) string {
+	host, _, _ := net.SplitHostPort(endpoint)
+	return host
+}
+
+// readNetCounters reads netCounters from /proc/<pid>/net/snmp and netstat,
+// i.e. of the target's network namespace.
+func readNetCounters(pid int) (map[string]int64, error) {
+	values := map[string]int64{}
+	var firstErr error
+
+	for _, name := range []string{"snmp", "netstat"} {
+		data, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(pid), "net", name))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for key, value := range parseProcNetSNMP(string(data)) {
+			if slices.Contains(netCounters, key) {
+				values[key] = value
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, firstErr
+	}
+	return values, nil
+}
+
+// parseProcNetSNMP parses the header/value line pairs of /proc/net/snmp and
+// /proc/net/netstat into "Prefix.Name" keys, i.e:
+//
+//	Tcp: RtoAlgorithm RtoMin ... RetransSegs
+//	Tcp: 1 200 ... 1234
+func parseProcNetSNMP(data string) map[string]int64 {
+	values := map[string]int64{}
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		prefix, names, found := strings.Cut(lines[i], ":")
+		if !found {
+			continue
+		}
+		valuePrefix, numbers, found := strings.Cut(lines[i+1], ":")
+		if !found || valuePrefix != prefix {
+			continue
+		}
+		i++
+
+		nameFields := strings.Fields(names)
+		numberFields := strings.Fields(numbers)
+		if len(nameFields) != len(numberFields) {
+			continue
+		}
+		for j, name := range nameFields {
+			if n, err := strconv.ParseInt(numberFields[j], 10, 64); err == nil {
+				values[prefix+"."+name] = n
+			}
+		}
+	}
+
+	return values
+}
+
+// netCounterDeltas returns the change of each counter between the first and
+// last sample, and the retransmit percentage over the window. CurrEstab is a
+// gauge, so it's left out of the deltas.
+func netCounterDeltas(samples []NetCounterSample) (map[string]int64, float64) {
+	if len(samples) < 2 {
+		return nil, 0
+	}
+
+	first, last := samples[0].Values, samples[len(samples)-1].Values
+	deltas := map[string]int64{}
+	for key, value := range last {
+		if key == "Tcp.CurrEstab" {
+			continue
+		}
+		if before, ok := first[key]; ok {
+			deltas[key] = value - before
+		}
+	}
+
+	retransmitPercent := 0.0
+	if out := deltas["Tcp.OutSegs"]; out > 0 {
+		retransmitPercent = roundPercent(float64(deltas["Tcp.RetransSegs"]) / float64(out))
+	}
+
+	return deltas, retransmitPercent
+}
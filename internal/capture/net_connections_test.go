@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeProcNetAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0100007F:1F90", "127.0.0.1:8080"},
+		{"00000000:0016", "0.0.0.0:22"},
+		{"00000000000000000000000001000000:0050", "[::1]:80"},
+		{"0000000000000000FFFF00000100007F:1F90", "127.0.0.1:8080"},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeProcNetAddr(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	_, err := decodeProcNetAddr("zz:0050")
+	assert.Error(t, err)
+}
+
+func TestParseProcNetSNMP(t *testing.T) {
+	values := parseProcNetSNMP(`Ip: Forwarding DefaultTTL
+Ip: 1 64
+Tcp: RtoAlgorithm OutSegs RetransSegs
+Tcp: 1 1000 25
+`)
+
+	assert.Equal(t, map[string]int64{
+		"Ip.Forwarding":    1,
+		"Ip.DefaultTTL":    64,
+		"Tcp.RtoAlgorithm": 1,
+		"Tcp.OutSegs":      1000,
+		"Tcp.RetransSegs":  25,
+	}, values)
+}
+
+func TestGroupConnections(t *testing.T) {
+	conns := []TCPConn{
+		{Local: "0.0.0.0:8080", Remote: "0.0.0.0:0", State: "LISTEN", RxQueue: 128, Inode: 1},
+		{Local: "0.0.0.0:9090", Remote: "0.0.0.0:0", State: "LISTEN", Inode: 99},
+		{Local: "10.0.0.5:8080", Remote: "10.0.0.9:51000", State: "ESTABLISHED", Inode: 2},
+		{Local: "10.0.0.5:8080", Remote: "10.0.0.9:51001", State: "CLOSE_WAIT", Inode: 3},
+		{Local: "10.0.0.5:8080", Remote: "10.0.0.9:51002", State: "TIME_WAIT"},
+		// Another process's connection, in a shared network namespace.
+		{Local: "10.0.0.5:45000", Remote: "10.0.0.8:443", State: "TIME_WAIT"},
+		{Local: "10.0.0.5:40000", Remote: "10.0.0.7:5432", State: "ESTABLISHED", Inode: 4},
+		{Local: "10.0.0.5:40001", Remote: "10.0.0.7:5432", State: "CLOSE_WAIT", Inode: 5},
+		{Local: "10.0.0.5:40002", Remote: "10.0.0.7:5432", State: "ESTABLISHED", Inode: 100},
+	}
+	inodes := map[uint64]bool{1: true, 2: true, 3: true, 4: true, 5: true}
+
+	report := groupConnections(42, conns, inodes, 128)
+
+	assert.Equal(t, 5, report.Sockets)
+	assert.Equal(t, 4, report.Connections)
+	assert.Equal(t, map[string]int{"ESTABLISHED": 2, "CLOSE_WAIT": 2}, report.States)
+	assert.Equal(t, 2, report.TimeWait)
+	assert.Equal(t, []NetListener{{Local: "0.0.0.0:8080", RecvQ: 128, Limit: 128, Full: true}}, report.Listeners)
+	assert.Equal(t, []NetPeer{
+		{Peer: "10.0.0.9 -> :8080", Direction: "inbound", Total: 2, States: map[string]int{"ESTABLISHED": 1, "CLOSE_WAIT": 1}, CloseWait: 1, TimeWait: 1},
+		{Peer: "10.0.0.7:5432", Direction: "outbound", Total: 2, States: map[string]int{"ESTABLISHED": 1, "CLOSE_WAIT": 1}, CloseWait: 1},
+	}, report.Peers)
+}
+
+func TestNetCounterDeltas(t *testing.T) {
+	deltas, retransmit := netCounterDeltas([]NetCounterSample{
+		{Values: map[string]int64{"Tcp.OutSegs": 1000, "Tcp.RetransSegs": 10, "Tcp.CurrEstab": 5, "TcpExt.ListenOverflows": 0}},
+		{Values: map[string]int64{"Tcp.OutSegs": 3000, "Tcp.RetransSegs": 50, "Tcp.CurrEstab": 9, "TcpExt.ListenOverflows": 3}},
+	})
+
+	assert.Equal(t, map[string]int64{"Tcp.OutSegs": 2000, "Tcp.RetransSegs": 40, "TcpExt.ListenOverflows": 3}, deltas)
+	assert.Equal(t, 2.0, retransmit)
+}
+
+func TestNetConnectionsSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc/net is only available on Linux")
+	}
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	t.Chdir(t.TempDir())
+
+	task := &NetConnections{Pid: os.Getpid(), Interval: time.Millisecond, Samples: 2}
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	_, err = os.Stat(filepath.Join(".", netConnectionsOut))
+	require.NoError(t, err)
+
+	report, err := analyzeProcessConnections(os.Getpid())
+	require.NoError(t, err)
+
+	var locals []string
+	for _, l := range report.Listeners {
+		locals = append(locals, l.Local)
+	}
+	assert.Contains(t, locals, listener.Addr().String())
+}
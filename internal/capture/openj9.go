@@ -0,0 +1,324 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+
+	psv3 "github.com/shirou/gopsutil/v3/process"
+)
+
+// openJ9JavacoreTimeout bounds how long we wait for a javacore to appear
+// after SIGQUIT.
+const openJ9JavacoreTimeout = 30 * time.Second
+
+// openJ9DumpWrittenRe matches the path OpenJ9's jcmd Dump.* commands report,
+// i.e: "Dump written to /opt/app/javacore.20261019.050000.1234.0001.txt".
+var openJ9DumpWrittenRe = regexp.MustCompile(`Dump written to (\S+)`)
+
+// IsOpenJ9 reports whether pid runs on an OpenJ9 (or IBM J9) JVM. On Linux the
+// target's mapped libraries are checked; otherwise, or when they can't be
+// read, the local java is asked.
+func IsOpenJ9(pid int) bool {
+	if runtime.GOOS == "linux" && pid > 0 {
+		maps, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+		if err == nil {
+			return bytes.Contains(maps, []byte("libj9vm"))
+		}
+	}
+
+	output, err := executils.CommandCombinedOutput(executils.JavaVersionCommand)
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(output), "OpenJ9")
+}
+
+// captureOpenJ9Javacore triggers a javacore on an OpenJ9 JVM and copies it to
+// out. jcmd Dump.java is tried first, since it reports where the file went;
+// SIGQUIT (the default javacore trigger) is the fallback.
+func captureOpenJ9Javacore(javaHome string, pid int, out string) (*os.File, error) {
+	javacore, err := openJ9Dump(javaHome, pid, "Dump.java")
+	if err != nil {
+		logger.Log("OpenJ9 Dump.java failed: %v. Trying SIGQUIT...", err)
+
+		javacore, err = signalOpenJ9Javacore(pid, openJ9JavacoreTimeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger.Log("OpenJ9 javacore written to %s", javacore)
+
+	file, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", out, err)
+	}
+
+	if err := copyFile(file, javacore, pid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to copy javacore %s: %w", javacore, err)
+	}
+	removeOpenJ9Dump(javacore, pid)
+
+	return file, nil
+}
+
+// removeOpenJ9Dump removes a dump the JVM wrote once it has been copied, so
+// that the dumps of every capture don't pile up on the host. Like copyFile,
+// it falls back to the path inside the target's container.
+func removeOpenJ9Dump(dumpPath string, pid int) {
+	err := os.Remove(dumpPath)
+	if errors.Is(err, fs.ErrNotExist) && runtime.GOOS == "linux" {
+		err = os.Remove(filepath.Join("/proc", strconv.Itoa(pid), "root", dumpPath))
+	}
+	if err != nil {
+		logger.Log("failed to remove OpenJ9 dump %s: %v", dumpPath, err)
+	}
+}
+
+// openJ9Dump runs one of OpenJ9's jcmd Dump.* commands and returns the path
+// of the produced file.
+func openJ9Dump(javaHome string, pid int, command string) (string, error) {
+	output, err := jcmdOutput(javaHome, pid, command)
+	if err != nil {
+		return "", err
+	}
+
+	m := openJ9DumpWrittenRe.FindSubmatch(output)
+	if m == nil {
+		return "", fmt.Errorf("no dump path in %s output: %s", command, strings.TrimSpace(string(output)))
+	}
+
+	return string(m[1]), nil
+}
+
+// openJ9JavacoreDirs returns the directories OpenJ9 may write javacores to,
+// in order of precedence: -Xdump:java:file=, -Xdump:directory=,
+// IBM_JAVACOREDIR, the working directory and finally the temp directory,
+// which OpenJ9 falls back to when the others aren't writable.
+func openJ9JavacoreDirs(pid int) []string {
+	var args, env []string
+	cwd := ""
+
+	if proc, err := psv3.NewProcess(int32(pid)); err == nil {
+		args, _ = proc.CmdlineSlice()
+		env, _ = proc.Environ()
+		cwd, _ = proc.Cwd()
+	}
+
+	return javacoreDirsFromSettings(args, env, cwd)
+}
+
+func javacoreDirsFromSettings(args, env []string, cwd string) []string {
+	var dirs []string
+	add := func(dir string) {
+		if dir == "" {
+			return
+		}
+		if !filepath.IsAbs(dir) && cwd != "" {
+			dir = filepath.Join(cwd, dir)
+		}
+		dir = filepath.Clean(dir)
+		for _, d := range dirs {
+			if d == dir {
+				return
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+
+	for _, arg := range args {
+		options, found := strings.CutPrefix(arg, "-Xdump:java:")
+		if !found {
+			continue
+		}
+		for option := range strings.SplitSeq(options, ",") {
+			if file, found := strings.CutPrefix(option, "file="); found {
+				add(filepath.Dir(file))
+			}
+		}
+	}
+
+	for _, arg := range args {
+		if dir, found := strings.CutPrefix(arg, "-Xdump:directory="); found {
+			add(dir)
+		}
+	}
+
+	for _, e := range env {
+		if dir, found := strings.CutPrefix(e, "IBM_JAVACOREDIR="); found {
+			add(dir)
+		}
+	}
+
+	add(cwd)
+
+	tmp := "/tmp"
+	for _, e := range env {
+		if dir, found := strings.CutPrefix(e, "TMPDIR="); found && dir != "" {
+			tmp = dir
+		}
+	}
+	add(tmp)
+
+	return dirs
+}
+
+// javacoreFiles lists javacore.*.txt files in dirs. On Linux, each dir is also
+// looked up through /proc/<pid>/root so javacores written inside a container
+// are found.
+func javacoreFiles(pid int, dirs []string) map[string]time.Time {
+	files := map[string]time.Time{}
+
+	for _, dir := range dirs {
+		candidates := []string{dir}
+		if runtime.GOOS == "linux" {
+			candidates = append(candidates, filepath.Join("/proc", strconv.Itoa(pid), "root", dir))
+		}
+
+		for _, candidate := range candidates {
+			matches, err := filepath.Glob(filepath.Join(candidate, "javacore.*.txt"))
+			if err != nil {
+				continue
+			}
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil || info.IsDir() {
+					continue
+				}
+				files[match] = info.ModTime()
+			}
+		}
+	}
+
+	return files
+}
+
+// isJavacoreComplete reports whether a javacore has been fully written; OpenJ9
+// ends every javacore with the END OF DUMP marker.
+func isJavacoreComplete(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	complete := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "END OF DUMP") {
+			complete = true
+		}
+	}
+
+	return complete
+}
+
+// openJ9DumpFile is an extra OpenJ9 dump copied into the current directory.
+type openJ9DumpFile struct {
+	kind string
+	name string
+}
+
+// captureOpenJ9Dumps collects the extra OpenJ9 dumps requested with
+// -openj9Dumps (snap, system) into the current directory.
+func captureOpenJ9Dumps(javaHome string, pid int, kinds []string) []openJ9DumpFile {
+	var collected []openJ9DumpFile
+
+	for _, kind := range kinds {
+		command, ok := openJ9DumpCommands[kind]
+		if !ok {
+			logger.Log("Unsupported OpenJ9 dump type %q, supported: snap, system", kind)
+			continue
+		}
+
+		dumpPath, err := openJ9Dump(javaHome, pid, command)
+		if err != nil {
+			logger.Log("Failed to capture OpenJ9 %s dump: %v", kind, err)
+			continue
+		}
+
+		name := filepath.Base(dumpPath)
+		file, err := os.Create(name)
+		if err != nil {
+			logger.Log("Failed to create %s: %v", name, err)
+			continue
+		}
+		err = copyFile(file, dumpPath, pid)
+		file.Close()
+		if err != nil {
+			logger.Log("Failed to copy OpenJ9 %s dump %s: %v", kind, dumpPath, err)
+			continue
+		}
+		removeOpenJ9Dump(dumpPath, pid)
+
+		collected = append(collected, openJ9DumpFile{kind: kind, name: name})
+	}
+
+	return collected
+}
+
+var openJ9DumpCommands = map[string]string{
+	"snap":   "Dump.snap",
+	"system": "Dump.system",
+}
+
+// OpenJ9Dumps captures the extra OpenJ9 dumps configured with -openj9Dumps
+// and uploads each of them.
+type OpenJ9Dumps struct {
+	Capture
+	Pid      int
+	JavaHome string
+}
+
+// Run captures and uploads the configured dumps.
+func (t *OpenJ9Dumps) Run() (Result, error) {
+	kinds := ParseOpenJ9DumpKinds(config.GlobalConfig.OpenJ9Dumps)
+	if len(kinds) == 0 {
+		return Result{Msg: "no OpenJ9 dumps requested"}, nil
+	}
+
+	var msgs []string
+	ok := false
+	for _, dump := range captureOpenJ9Dumps(t.JavaHome, t.Pid, kinds) {
+		file, err := os.Open(dump.name)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", dump.name, err))
+			continue
+		}
+		// System dumps can be as large as the heap, so no timeout is applied,
+		// same as for heap dumps.
+		msg, uploaded := PostDataWithTimeout(t.Endpoint(), fmt.Sprintf("openj9%s&fileName=%s", dump.kind, dump.name), file, 0*time.Second)
+		file.Close()
+		ok = ok || uploaded
+		msgs = append(msgs, fmt.Sprintf("%s: %s", dump.name, msg))
+	}
+
+	return Result{Msg: strings.Join(msgs, "\n"), Ok: ok}, nil
+}
+
+// ParseOpenJ9DumpKinds parses the comma separated -openj9Dumps value.
+func ParseOpenJ9DumpKinds(value string) []string {
+	var kinds []string
+	for kind := range strings.SplitSeq(value, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package capture
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"yc-agent/internal/logger"
+)
+
+// signalOpenJ9Javacore sends SIGQUIT to pid, which makes OpenJ9 write a
+// javacore, and waits for a new, complete javacore.*.txt to show up in one
+// of the directories OpenJ9 writes to.
+func signalOpenJ9Javacore(pid int, timeout time.Duration) (string, error) {
+	dirs := openJ9JavacoreDirs(pid)
+	before := javacoreFiles(pid, dirs)
+	sentAt := time.Now()
+
+	if err := syscall.Kill(pid, syscall.SIGQUIT); err != nil {
+		return "", fmt.Errorf("failed sending SIGQUIT to pid %d: %w", pid, err)
+	}
+	logger.Log("OpenJ9: sent SIGQUIT to pid %d, polling %v for a javacore", pid, dirs)
+
+	deadline := sentAt.Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(250 * time.Millisecond)
+
+		for path, mt := range javacoreFiles(pid, dirs) {
+			if prev, existed := before[path]; (!existed || mt.After(prev)) && isJavacoreComplete(path) {
+				return path, nil
+			}
+		}
+
+		if !IsProcessExists(pid) {
+			return "", fmt.Errorf("process %d died before a javacore appeared", pid)
+		}
+	}
+
+	return "", fmt.Errorf("timed out after %s waiting for a javacore from pid %d in %v", timeout, pid, dirs)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package capture
+
+import (
+	"fmt"
+	"time"
+)
+
+// signalOpenJ9Javacore is unsupported on Windows, where there is no SIGQUIT
+// to deliver to another process; jcmd Dump.java is the only trigger there.
+func signalOpenJ9Javacore(pid int, timeout time.Duration) (string, error) {
+	return "", fmt.Errorf("triggering a javacore by signal is not supported on Windows (pid %d)", pid)
+}
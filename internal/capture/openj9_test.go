@@ -0,0 +1,78 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJavacoreDirsFromSettings(t *testing.T) {
+	args := []string{
+		"java",
+		"-Xdump:java:events=user,file=/dumps/java/javacore.%pid.%seq.txt",
+		"-Xdump:directory=logs",
+		"-jar", "app.jar",
+	}
+	env := []string{"PATH=/usr/bin", "IBM_JAVACOREDIR=/var/javacores", "TMPDIR=/scratch"}
+
+	dirs := javacoreDirsFromSettings(args, env, "/opt/app")
+	assert.Equal(t, []string{"/dumps/java", "/opt/app/logs", "/var/javacores", "/opt/app", "/scratch"}, dirs)
+
+	assert.Equal(t, []string{"/opt/app", "/tmp"}, javacoreDirsFromSettings(nil, nil, "/opt/app"))
+}
+
+func TestJavacoreFilesAndCompleteness(t *testing.T) {
+	dir := t.TempDir()
+	complete := filepath.Join(dir, "javacore.20261019.050000.1234.0001.txt")
+	partial := filepath.Join(dir, "javacore.20261019.050010.1234.0002.txt")
+	require.NoError(t, os.WriteFile(complete, []byte("0SECTION       TITLE subcomponent dump routine\n0SECTION       END OF DUMP\n"), 0644))
+	require.NoError(t, os.WriteFile(partial, []byte("0SECTION       TITLE subcomponent dump routine\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "heapdump.phd"), []byte("x"), 0644))
+
+	files := javacoreFiles(-1, []string{dir})
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, complete)
+
+	assert.True(t, isJavacoreComplete(complete))
+	assert.False(t, isJavacoreComplete(partial))
+}
+
+func TestParseOpenJ9DumpKinds(t *testing.T) {
+	assert.Equal(t, []string{"snap", "system"}, ParseOpenJ9DumpKinds(" Snap, system ,"))
+	assert.Empty(t, ParseOpenJ9DumpKinds(""))
+}
+
+func TestOpenJ9DumpWrittenRe(t *testing.T) {
+	m := openJ9DumpWrittenRe.FindStringSubmatch("1234:\nDump written to /opt/app/javacore.20261019.050000.1234.0001.txt\n")
+	require.Len(t, m, 2)
+	assert.Equal(t, "/opt/app/javacore.20261019.050000.1234.0001.txt", m[1])
+}
+
+func TestCaptureOpenJ9JavacoreRemovesTheJavacore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as jcmd")
+	}
+
+	dumps := t.TempDir()
+	javacore := filepath.Join(dumps, "javacore.20261019.050000.42.0001.txt")
+	javaHome := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(javaHome, "bin"), 0755))
+	script := "#!/bin/sh\n" +
+		"echo '1TISIGINFO     Dump Event \"user\"' > " + javacore + "\n" +
+		"echo 'Dump written to " + javacore + "'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(javaHome, "bin", "jcmd"), []byte(script), 0755))
+	t.Chdir(t.TempDir())
+
+	file, err := captureOpenJ9Javacore(javaHome, os.Getpid(), "javacore.1.out")
+	require.NoError(t, err)
+	file.Close()
+
+	data, err := os.ReadFile("javacore.1.out")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "1TISIGINFO")
+	assert.NoFileExists(t, javacore)
+}
@@ -0,0 +1,434 @@
+package capture
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/config"
+	"yc-agent/internal/logger"
+)
+
+const (
+	probesOut = "probes.json"
+	// defaultProbeCount is how many times a probe is repeated by default.
+	defaultProbeCount = 3
+)
+
+// resolvConfPath lists the nameservers dns probes query by default. It is a
+// variable so tests can point it at a fixture.
+var resolvConfPath = "/etc/resolv.conf"
+
+// Probes checks that the dependencies of the application are reachable
+// from the host: TCP connect, DNS resolution per resolver, TLS handshake and
+// HTTP GET, each repeated a few times. Unlike ping, it works where ICMP is
+// blocked and tells whether the service itself answers.
+type Probes struct {
+	Capture
+	Cfg config.Probes
+}
+
+// ProbeResult is the outcome of a probe, or of a dns probe against one
+// resolver. Latencies are in milliseconds, over the successful attempts.
+type ProbeResult struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Target    string   `json:"target"`
+	Resolver  string   `json:"resolver,omitempty"`
+	Attempts  int      `json:"attempts"`
+	Successes int      `json:"successes"`
+	MinMs     float64  `json:"minMs"`
+	AvgMs     float64  `json:"avgMs"`
+	MaxMs     float64  `json:"maxMs"`
+	Errors    []string `json:"errors,omitempty"`
+	// Addresses are the resolved addresses (dns) or the peer address
+	// (tcp, tls).
+	Addresses []string       `json:"addresses,omitempty"`
+	TLS       *ProbeTLSInfo  `json:"tls,omitempty"`
+	HTTP      *ProbeHTTPInfo `json:"http,omitempty"`
+
+	samples []float64
+}
+
+// ProbeTLSInfo describes the TLS session and the certificate chain the
+// server presented.
+type ProbeTLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	ServerName  string `json:"serverName"`
+	// Verified is true when the chain verifies against the system roots for
+	// ServerName; VerifyError tells why it doesn't.
+	Verified    bool        `json:"verified"`
+	VerifyError string      `json:"verifyError,omitempty"`
+	Chain       []ProbeCert `json:"chain"`
+}
+
+// ProbeCert is a certificate of the chain, leaf first.
+type ProbeCert struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	DNSNames     []string  `json:"dnsNames,omitempty"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	DaysToExpiry int       `json:"daysToExpiry"`
+}
+
+// ProbeHTTPInfo is the response of an http probe and the phases of its last
+// successful attempt, in milliseconds.
+type ProbeHTTPInfo struct {
+	StatusCode int     `json:"statusCode"`
+	Proto      string  `json:"proto"`
+	DNSMs      float64 `json:"dnsMs"`
+	ConnectMs  float64 `json:"connectMs"`
+	TLSMs      float64 `json:"tlsMs"`
+	TTFBMs     float64 `json:"ttfbMs"`
+}
+
+type probesReport struct {
+	Time    time.Time     `json:"time"`
+	Results []ProbeResult `json:"results"`
+}
+
+// Run runs the probes and uploads probes.json.
+func (p *Probes) Run() (Result, error) {
+	file, err := p.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(p.Endpoint(), "probes", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile runs the probes one after the other and writes the results
+// to probes.json.
+func (p *Probes) CaptureToFile() (*os.File, error) {
+	report := probesReport{Time: time.Now()}
+	for _, probe := range p.Cfg {
+		report.Results = append(report.Results, runProbe(probe)...)
+	}
+
+	for _, r := range report.Results {
+		logger.Log("Probe %s %s %s%s: %d/%d ok, min/avg/max %.2f/%.2f/%.2f ms",
+			r.Name, r.Type, r.Target, probeResolverSuffix(r.Resolver), r.Successes, r.Attempts, r.MinMs, r.AvgMs, r.MaxMs)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal probes: %w", err)
+	}
+
+	file, err := os.Create(probesOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", probesOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", probesOut, err)
+	}
+
+	return file, nil
+}
+
+func probeResolverSuffix(resolver string) string {
+	if resolver == "" {
+		return ""
+	}
+	return " @" + resolver
+}
+
+// runProbe repeats probe Count times. A dns probe yields a result per
+// resolver.
+func runProbe(probe config.Probe) []ProbeResult {
+	count := probe.Count
+	if count <= 0 {
+		count = defaultProbeCount
+	}
+	timeout := time.Duration(probe.TimeoutSecs) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeoutSeconds * time.Second
+	}
+	name := probe.Name
+	if name == "" {
+		name = probe.Target
+	}
+
+	newResult := func() ProbeResult {
+		return ProbeResult{Name: name, Type: probe.Type, Target: probe.Target}
+	}
+
+	switch strings.ToLower(probe.Type) {
+	case "tcp":
+		r := newResult()
+		repeatProbe(&r, count, func() error { return probeTCP(&r, probe.Target, timeout) })
+		return []ProbeResult{r}
+	case "tls":
+		r := newResult()
+		repeatProbe(&r, count, func() error { return probeTLS(&r, probe.Target, probe.ServerName, timeout) })
+		return []ProbeResult{r}
+	case "http", "https":
+		r := newResult()
+		repeatProbe(&r, count, func() error { return probeHTTP(&r, probe.Target, timeout) })
+		return []ProbeResult{r}
+	case "dns":
+		resolvers := probe.Resolvers
+		if len(resolvers) == 0 {
+			resolvers = systemNameservers()
+		}
+		if len(resolvers) == 0 {
+			// The system resolver, whatever it is configured with.
+			resolvers = []string{""}
+		}
+		var results []ProbeResult
+		for _, resolver := range resolvers {
+			r := newResult()
+			r.Resolver = resolver
+			repeatProbe(&r, count, func() error { return probeDNS(&r, probe.Target, resolver, timeout) })
+			results = append(results, r)
+		}
+		return results
+	default:
+		r := newResult()
+		r.Errors = []string{fmt.Sprintf("unknown probe type %q, expected tcp, dns, tls or http", probe.Type)}
+		return []ProbeResult{r}
+	}
+}
+
+// repeatProbe runs attempt count times and aggregates the latencies of the
+// successful attempts; attempt records its own latency in r.samples.
+func repeatProbe(r *ProbeResult, count int, attempt func() error) {
+	for range count {
+		r.Attempts++
+		if err := attempt(); err != nil {
+			if msg := err.Error(); !slices.Contains(r.Errors, msg) {
+				r.Errors = append(r.Errors, msg)
+			}
+			continue
+		}
+		r.Successes++
+	}
+
+	if len(r.samples) == 0 {
+		return
+	}
+	r.MinMs, r.MaxMs = math.Inf(1), 0
+	var sum float64
+	for _, ms := range r.samples {
+		r.MinMs = min(r.MinMs, ms)
+		r.MaxMs = max(r.MaxMs, ms)
+		sum += ms
+	}
+	r.AvgMs = roundMs(sum / float64(len(r.samples)))
+}
+
+func durationMs(d time.Duration) float64 {
+	return roundMs(float64(d) / float64(time.Millisecond))
+}
+
+func roundMs(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+func probeTCP(r *ProbeResult, target string, timeout time.Duration) error {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", target, timeout)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	defer conn.Close()
+
+	r.samples = append(r.samples, durationMs(elapsed))
+	r.Addresses = []string{conn.RemoteAddr().String()}
+	return nil
+}
+
+// probeTLS measures the TLS handshake, without the TCP connect. The chain is
+// verified separately so that an invalid certificate is reported rather
+// than failing the probe.
+func probeTLS(r *ProbeResult, target, serverName string, timeout time.Duration) error {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(target)
+	}
+
+	rawConn, err := net.DialTimeout("tcp", target, timeout)
+	if err != nil {
+		return err
+	}
+	defer rawConn.Close()
+	_ = rawConn.SetDeadline(time.Now().Add(timeout))
+
+	conn := tls.Client(rawConn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	start := time.Now()
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake: %w", err)
+	}
+	r.samples = append(r.samples, durationMs(time.Since(start)))
+	r.Addresses = []string{rawConn.RemoteAddr().String()}
+
+	if r.TLS == nil {
+		r.TLS = describeTLS(conn.ConnectionState(), serverName, time.Now())
+	}
+	return nil
+}
+
+func describeTLS(state tls.ConnectionState, serverName string, now time.Time) *ProbeTLSInfo {
+	info := &ProbeTLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  serverName,
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, ProbeCert{
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			DNSNames:     cert.DNSNames,
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			DaysToExpiry: int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		})
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		info.VerifyError = "no certificate presented"
+		return info
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	if err != nil {
+		info.VerifyError = err.Error()
+	} else {
+		info.Verified = true
+	}
+
+	return info
+}
+
+// probeHTTP times a GET of target on a fresh connection.
+func probeHTTP(r *ProbeResult, target string, timeout time.Duration) error {
+	if _, err := url.ParseRequestURI(target); err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var dnsStart, connectStart, tlsStart, start time.Time
+	info := &ProbeHTTPInfo{}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { info.DNSMs = durationMs(time.Since(dnsStart)) },
+		ConnectStart:      func(string, string) { connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { info.ConnectMs = durationMs(time.Since(connectStart)) },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { info.TLSMs = durationMs(time.Since(tlsStart)) },
+		GotFirstResponseByte: func() {
+			info.TTFBMs = durationMs(time.Since(start))
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", executils.SCRIPT_VERSION)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:              http.ProxyFromEnvironment,
+			DisableKeepAlives:  true,
+			DisableCompression: true,
+			ForceAttemptHTTP2:  true,
+		},
+		Timeout: timeout,
+	}
+
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	info.StatusCode = resp.StatusCode
+	info.Proto = resp.Proto
+	r.HTTP = info
+	r.samples = append(r.samples, durationMs(elapsed))
+	return nil
+}
+
+// probeDNS times the resolution of host through resolver, or the system
+// resolver when resolver is empty.
+func probeDNS(r *ProbeResult, host, resolver string, timeout time.Duration) error {
+	res := net.DefaultResolver
+	if resolver != "" {
+		server := resolver
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		res = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := res.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	r.samples = append(r.samples, durationMs(time.Since(start)))
+	slices.Sort(addrs)
+	r.Addresses = addrs
+	return nil
+}
+
+// systemNameservers returns the nameservers of resolv.conf.
+func systemNameservers() []string {
+	data, err := os.ReadFile(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
@@ -0,0 +1,136 @@
+package capture
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"yc-agent/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	results := runProbe(config.Probe{Name: "db", Type: "tcp", Target: listener.Addr().String(), Count: 2})
+
+	require.Len(t, results, 1)
+	r := results[0]
+	assert.Equal(t, "db", r.Name)
+	assert.Equal(t, 2, r.Attempts)
+	assert.Equal(t, 2, r.Successes)
+	assert.Empty(t, r.Errors)
+	assert.LessOrEqual(t, r.MinMs, r.AvgMs)
+	assert.LessOrEqual(t, r.AvgMs, r.MaxMs)
+	assert.Equal(t, []string{listener.Addr().String()}, r.Addresses)
+}
+
+func TestProbeTCPRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	results := runProbe(config.Probe{Type: "tcp", Target: addr, Count: 2, TimeoutSecs: 1})
+
+	require.Len(t, results, 1)
+	assert.Equal(t, addr, results[0].Name)
+	assert.Equal(t, 0, results[0].Successes)
+	assert.Len(t, results[0].Errors, 1)
+}
+
+func TestProbeTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	results := runProbe(config.Probe{Type: "tls", Target: server.Listener.Addr().String(), ServerName: "example.com", Count: 1})
+
+	require.Len(t, results, 1)
+	r := results[0]
+	assert.Equal(t, 1, r.Successes)
+	require.NotNil(t, r.TLS)
+	assert.Equal(t, "example.com", r.TLS.ServerName)
+	assert.NotEmpty(t, r.TLS.Version)
+	// httptest uses a self-signed certificate.
+	assert.False(t, r.TLS.Verified)
+	assert.NotEmpty(t, r.TLS.VerifyError)
+	require.NotEmpty(t, r.TLS.Chain)
+	assert.Contains(t, r.TLS.Chain[0].DNSNames, "example.com")
+	assert.Positive(t, r.TLS.Chain[0].DaysToExpiry)
+}
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	results := runProbe(config.Probe{Type: "http", Target: server.URL + "/health", Count: 3})
+
+	require.Len(t, results, 1)
+	r := results[0]
+	assert.Equal(t, 3, r.Successes)
+	require.NotNil(t, r.HTTP)
+	assert.Equal(t, http.StatusNoContent, r.HTTP.StatusCode)
+	assert.Equal(t, "HTTP/1.1", r.HTTP.Proto)
+}
+
+func TestProbeDNS(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte("# comment\nsearch example.com\n"), 0644))
+	oldResolvConf := resolvConfPath
+	resolvConfPath = resolvConf
+	t.Cleanup(func() { resolvConfPath = oldResolvConf })
+
+	results := runProbe(config.Probe{Type: "dns", Target: "localhost", Count: 1})
+
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Resolver)
+	assert.Equal(t, 1, results[0].Successes, results[0].Errors)
+	assert.NotEmpty(t, results[0].Addresses)
+}
+
+func TestSystemNameservers(t *testing.T) {
+	resolvConf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte("nameserver 10.0.0.2\noptions ndots:5\nnameserver 8.8.8.8\n"), 0644))
+	oldResolvConf := resolvConfPath
+	resolvConfPath = resolvConf
+	t.Cleanup(func() { resolvConfPath = oldResolvConf })
+
+	assert.Equal(t, []string{"10.0.0.2", "8.8.8.8"}, systemNameservers())
+}
+
+func TestProbesCaptureToFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	task := &Probes{Cfg: config.Probes{{Name: "bogus", Type: "icmp", Target: "example.com"}}}
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	data, err := os.ReadFile(probesOut)
+	require.NoError(t, err)
+
+	var report probesReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Len(t, report.Results, 1)
+	assert.True(t, strings.HasPrefix(report.Results[0].Errors[0], "unknown probe type"))
+}
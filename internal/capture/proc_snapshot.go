@@ -0,0 +1,480 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const procSnapshotOut = "proc-snapshot.json"
+
+// procTreeMaxDescendants bounds the number of descendants listed in the
+// process tree, e.g. for a shell that forked thousands of children.
+const procTreeMaxDescendants = 200
+
+// ProcSnapshot captures what /proc knows about the target process: status,
+// limits, memory rollup, I/O, scheduler stats, OOM score, cgroup, mounts,
+// open fds by type and the process tree. It reads /proc directly, so it also
+// works in distroless containers without ps or top.
+type ProcSnapshot struct {
+	Capture
+	Pid int
+}
+
+// ProcSnapshotReport is the content of proc-snapshot.json.
+type ProcSnapshotReport struct {
+	Pid         int               `json:"pid"`
+	CapturedAt  time.Time         `json:"capturedAt"`
+	Status      map[string]string `json:"status,omitempty"`
+	Limits      []ProcLimit       `json:"limits,omitempty"`
+	SmapsRollup map[string]int64  `json:"smapsRollup,omitempty"`
+	IO          map[string]int64  `json:"io,omitempty"`
+	Sched       map[string]string `json:"sched,omitempty"`
+	OOMScore    *int              `json:"oomScore,omitempty"`
+	OOMScoreAdj *int              `json:"oomScoreAdj,omitempty"`
+	Cgroup      []string          `json:"cgroup,omitempty"`
+	Mounts      []ProcMount       `json:"mounts,omitempty"`
+	FDs         *ProcFDCounts     `json:"fds,omitempty"`
+	Tree        *ProcTree         `json:"processTree,omitempty"`
+	// Errors lists the files that couldn't be read, by name.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ProcLimit is a row of /proc/<pid>/limits.
+type ProcLimit struct {
+	Name  string `json:"name"`
+	Soft  string `json:"soft"`
+	Hard  string `json:"hard"`
+	Units string `json:"units,omitempty"`
+}
+
+// ProcMount is an entry of /proc/<pid>/mountinfo.
+type ProcMount struct {
+	MountPoint string `json:"mountPoint"`
+	Root       string `json:"root"`
+	FSType     string `json:"fsType"`
+	Source     string `json:"source"`
+	Options    string `json:"options"`
+}
+
+// ProcFDCounts counts the open file descriptors of a process by type.
+type ProcFDCounts struct {
+	Total     int `json:"total"`
+	Socket    int `json:"socket"`
+	Pipe      int `json:"pipe"`
+	File      int `json:"file"`
+	AnonInode int `json:"anonInode"`
+	Other     int `json:"other"`
+	// AnonInodeKinds breaks anon inodes down, e.g. [eventpoll], [eventfd].
+	AnonInodeKinds map[string]int `json:"anonInodeKinds,omitempty"`
+}
+
+// ProcTree is the target's ancestors (parent first) and descendants.
+type ProcTree struct {
+	Ancestors []ProcTreeNode `json:"ancestors"`
+	// Process is the target process itself.
+	Process     ProcTreeNode   `json:"process"`
+	Descendants []ProcTreeNode `json:"descendants"`
+	// Truncated is set when there were more than procTreeMaxDescendants.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ProcTreeNode is a process of the tree.
+type ProcTreeNode struct {
+	Pid     int    `json:"pid"`
+	Ppid    int    `json:"ppid"`
+	Comm    string `json:"comm"`
+	Cmdline string `json:"cmdline"`
+}
+
+// Run snapshots the process and uploads the report.
+func (t *ProcSnapshot) Run() (Result, error) {
+	if runtime.GOOS != "linux" {
+		return Result{Msg: "skipped: /proc snapshot is only supported on Linux"}, nil
+	}
+
+	file, err := t.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "procsnapshot", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile writes the snapshot to proc-snapshot.json.
+func (t *ProcSnapshot) CaptureToFile() (*os.File, error) {
+	report, err := SnapshotProc(t.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal /proc snapshot: %w", err)
+	}
+
+	file, err := os.Create(procSnapshotOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", procSnapshotOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", procSnapshotOut, err)
+	}
+
+	return file, nil
+}
+
+// SnapshotProc reads the /proc entries of pid. Files that can't be read
+// (permissions, older kernels) are reported in Errors; only a missing process
+// is an error.
+func SnapshotProc(pid int) (*ProcSnapshotReport, error) {
+	dir := filepath.Join(procFSRoot, strconv.Itoa(pid))
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("process %d not found in %s: %w", pid, procFSRoot, err)
+	}
+
+	report := &ProcSnapshotReport{Pid: pid, CapturedAt: time.Now(), Errors: map[string]string{}}
+	read := func(name string) (string, bool) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			report.Errors[name] = err.Error()
+			return "", false
+		}
+		return string(data), true
+	}
+
+	if data, ok := read("status"); ok {
+		report.Status = parseProcColonFile(data)
+	}
+	if data, ok := read("limits"); ok {
+		report.Limits = parseProcLimits(data)
+	}
+	if data, ok := read("smaps_rollup"); ok {
+		report.SmapsRollup = parseProcKBFile(data)
+	}
+	if data, ok := read("io"); ok {
+		report.IO = parseProcKBFile(data)
+	}
+	if data, ok := read("sched"); ok {
+		report.Sched = parseProcColonFile(data)
+	}
+	if data, ok := read("oom_score"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(data)); err == nil {
+			report.OOMScore = &n
+		}
+	}
+	if data, ok := read("oom_score_adj"); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(data)); err == nil {
+			report.OOMScoreAdj = &n
+		}
+	}
+	if data, ok := read("cgroup"); ok {
+		report.Cgroup = strings.Split(strings.TrimSpace(data), "\n")
+	}
+	if data, ok := read("mountinfo"); ok {
+		report.Mounts = parseMountInfo(data)
+	}
+
+	if fds, err := countProcFDs(pid); err != nil {
+		report.Errors["fd"] = err.Error()
+	} else {
+		report.FDs = fds
+	}
+
+	report.Tree = buildProcTree(pid)
+
+	if len(report.Errors) == 0 {
+		report.Errors = nil
+	}
+
+	return report, nil
+}
+
+// parseProcColonFile parses "Key:\tvalue" files such as status, and the
+// "key   :   value" lines of sched.
+func parseProcColonFile(data string) map[string]string {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		// Skips the "java (1234, #threads: 50)" header of sched.
+		if key == "" || strings.ContainsAny(key, "(#") {
+			continue
+		}
+		values[key] = strings.Join(strings.Fields(value), " ")
+	}
+
+	return values
+}
+
+// parseProcKBFile parses numeric "Key: value [kB]" files such as
+// smaps_rollup and io. Values are kept in the file's unit (kB for
+// smaps_rollup, bytes for io).
+func parseProcKBFile(data string) map[string]int64 {
+	values := map[string]int64{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			values[strings.TrimSpace(key)] = n
+		}
+	}
+
+	return values
+}
+
+// parseProcLimits parses /proc/<pid>/limits, i.e:
+//
+//	Limit                     Soft Limit           Hard Limit           Units
+//	Max open files            1048576              1048576              files
+//	Max cpu time              unlimited            unlimited            seconds
+//
+// The columns are aligned under the header, so they are split by position.
+func parseProcLimits(data string) []ProcLimit {
+	lines := strings.Split(strings.TrimRight(data, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+
+	header := lines[0]
+	softAt := strings.Index(header, "Soft Limit")
+	hardAt := strings.Index(header, "Hard Limit")
+	unitsAt := strings.Index(header, "Units")
+	if softAt < 0 || hardAt < softAt || unitsAt < hardAt {
+		return nil
+	}
+
+	column := func(line string, from, to int) string {
+		if from >= len(line) {
+			return ""
+		}
+		if to < 0 || to > len(line) {
+			to = len(line)
+		}
+		return strings.TrimSpace(line[from:to])
+	}
+
+	var limits []ProcLimit
+	for _, line := range lines[1:] {
+		limits = append(limits, ProcLimit{
+			Name:  column(line, 0, softAt),
+			Soft:  column(line, softAt, hardAt),
+			Hard:  column(line, hardAt, unitsAt),
+			Units: column(line, unitsAt, -1),
+		})
+	}
+
+	return limits
+}
+
+// parseMountInfo parses /proc/<pid>/mountinfo, i.e:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfo(data string) []ProcMount {
+	var mounts []ProcMount
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 6 || len(fields) < sep+3 {
+			continue
+		}
+		mounts = append(mounts, ProcMount{
+			Root:       fields[3],
+			MountPoint: fields[4],
+			Options:    fields[5],
+			FSType:     fields[sep+1],
+			Source:     fields[sep+2],
+		})
+	}
+
+	return mounts
+}
+
+// countProcFDs classifies the open fds of pid by the target of their
+// /proc/<pid>/fd link.
+func countProcFDs(pid int) (*ProcFDCounts, error) {
+	dir := filepath.Join(procFSRoot, strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := &ProcFDCounts{}
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			// The fd was closed in the meantime.
+			continue
+		}
+		counts.Total++
+
+		switch {
+		case strings.HasPrefix(target, "socket:"):
+			counts.Socket++
+		case strings.HasPrefix(target, "pipe:"):
+			counts.Pipe++
+		case strings.HasPrefix(target, "anon_inode:"):
+			counts.AnonInode++
+			if counts.AnonInodeKinds == nil {
+				counts.AnonInodeKinds = map[string]int{}
+			}
+			counts.AnonInodeKinds[strings.TrimPrefix(target, "anon_inode:")]++
+		case strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "/dev/"):
+			counts.File++
+		default:
+			counts.Other++
+		}
+	}
+
+	return counts, nil
+}
+
+// procStat holds the fields of /proc/<pid>/stat (or task/<tid>/stat) the
+// agent uses.
+type procStat struct {
+	Pid       int
+	Comm      string
+	State     string
+	Ppid      int
+	Utime     uint64
+	Stime     uint64
+	StartTime uint64
+	Processor int
+}
+
+// parseProcStat parses /proc/<pid>/stat. comm is in parentheses and may
+// contain spaces and parentheses, so the fields are taken after the last ')'.
+func parseProcStat(data string) (procStat, error) {
+	start := strings.IndexByte(data, '(')
+	end := strings.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return procStat{}, fmt.Errorf("malformed stat: %q", data)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(data[:start]))
+	if err != nil {
+		return procStat{}, fmt.Errorf("malformed stat pid: %w", err)
+	}
+
+	// fields[0] is field 3 (state) of proc(5).
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("malformed stat: only %d fields", len(fields)+2)
+	}
+
+	stat := procStat{Pid: pid, Comm: data[start+1 : end], State: fields[0]}
+	stat.Ppid, _ = strconv.Atoi(fields[1])
+	stat.Utime, _ = strconv.ParseUint(fields[11], 10, 64)
+	stat.Stime, _ = strconv.ParseUint(fields[12], 10, 64)
+	stat.StartTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	if len(fields) > 36 {
+		stat.Processor, _ = strconv.Atoi(fields[36])
+	}
+
+	return stat, nil
+}
+
+func readProcCmdline(pid int) string {
+	data, err := os.ReadFile(filepath.Join(procFSRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	// Arguments may carry secrets, as passwords in -D options.
+	return strings.TrimSpace(strings.Join(redactCmdlineArgs(args), " "))
+}
+
+// buildProcTree walks the parents of pid up to init, pid itself and its
+// descendants.
+func buildProcTree(pid int) *ProcTree {
+	stats := map[int]procStat{}
+	children := map[int][]int{}
+
+	entries, _ := os.ReadDir(procFSRoot)
+	for _, entry := range entries {
+		p, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(procFSRoot, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		stat, err := parseProcStat(string(data))
+		if err != nil {
+			continue
+		}
+		stats[p] = stat
+		children[stat.Ppid] = append(children[stat.Ppid], p)
+	}
+
+	node := func(p int) ProcTreeNode {
+		return ProcTreeNode{Pid: p, Ppid: stats[p].Ppid, Comm: stats[p].Comm, Cmdline: readProcCmdline(p)}
+	}
+
+	tree := &ProcTree{Ancestors: []ProcTreeNode{}, Process: node(pid), Descendants: []ProcTreeNode{}}
+
+	seen := map[int]bool{pid: true}
+	for p := stats[pid].Ppid; p > 0 && !seen[p]; p = stats[p].Ppid {
+		seen[p] = true
+		if _, ok := stats[p]; !ok {
+			break
+		}
+		tree.Ancestors = append(tree.Ancestors, node(p))
+	}
+
+	queue := sortedPids(children[pid])
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if len(tree.Descendants) == procTreeMaxDescendants {
+			tree.Truncated = true
+			break
+		}
+		tree.Descendants = append(tree.Descendants, node(p))
+		queue = append(queue, sortedPids(children[p])...)
+	}
+
+	return tree
+}
+
+func sortedPids(pids []int) []int {
+	sorted := slices.Clone(pids)
+	slices.Sort(sorted)
+	return sorted
+}
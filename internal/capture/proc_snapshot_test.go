@@ -0,0 +1,123 @@
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat, err := parseProcStat("1234 (java (main) x) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 75 0 0 20 0 42 0 9876 1000000 500 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n")
+	require.NoError(t, err)
+
+	assert.Equal(t, procStat{Pid: 1234, Comm: "java (main) x", State: "S", Ppid: 1, Utime: 250, Stime: 75, StartTime: 9876, Processor: 3}, stat)
+
+	_, err = parseProcStat("garbage")
+	assert.Error(t, err)
+}
+
+func TestParseProcLimits(t *testing.T) {
+	limits := parseProcLimits(`Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max open files            1024                 524288               files
+Max processes             63459                63459                processes
+`)
+
+	require.Len(t, limits, 3)
+	assert.Equal(t, ProcLimit{Name: "Max open files", Soft: "1024", Hard: "524288", Units: "files"}, limits[1])
+}
+
+func TestParseMountInfo(t *testing.T) {
+	mounts := parseMountInfo(`36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+600 550 0:52 / /sys/fs/cgroup ro,nosuid - cgroup2 cgroup rw
+`)
+
+	assert.Equal(t, []ProcMount{
+		{MountPoint: "/mnt2", Root: "/mnt1", FSType: "ext3", Source: "/dev/root", Options: "rw,noatime"},
+		{MountPoint: "/sys/fs/cgroup", Root: "/", FSType: "cgroup2", Source: "cgroup", Options: "ro,nosuid"},
+	}, mounts)
+}
+
+func TestSnapshotProcFixture(t *testing.T) {
+	proc := t.TempDir()
+	files := map[string]string{
+		"1/stat":           "1 (init) S 0 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		"1/cmdline":        "/sbin/init\x00",
+		"10/stat":          "10 (java) S 1 10 10 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		"10/cmdline":       "java\x00-Ddb.password=hunter2\x00-jar\x00app.jar\x00",
+		"10/status":        "Name:\tjava\nVmRSS:\t  1024 kB\nThreads:\t42\n",
+		"10/io":            "rchar: 100\nwchar: 200\nread_bytes: 4096\n",
+		"10/smaps_rollup":  "00400000-7ffc [rollup]\nRss:  1024 kB\nPss:  900 kB\n",
+		"10/sched":         "java (10, #threads: 42)\n-------------------------------------------------------------------\nse.exec_start                                :      12345.678\nnr_switches                                  :                 7\n",
+		"10/oom_score":     "666\n",
+		"10/oom_score_adj": "-500\n",
+		"10/cgroup":        "0::/docker/abc\n",
+		"11/stat":          "11 (sh) S 10 10 10 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+		"11/cmdline":       "sh\x00-c\x00sleep 5\x00--password\x00hunter2\x00",
+		"12/stat":          "12 (sleep) S 11 10 10 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0",
+	}
+	for name, content := range files {
+		path := filepath.Join(proc, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	fdDir := filepath.Join(proc, "10", "fd")
+	require.NoError(t, os.MkdirAll(fdDir, 0755))
+	for fd, target := range map[string]string{
+		"0": "/dev/null",
+		"1": "pipe:[100]",
+		"3": "socket:[200]",
+		"4": "socket:[201]",
+		"5": "anon_inode:[eventpoll]",
+		"6": "/opt/app/app.jar",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(fdDir, fd)))
+	}
+
+	oldProc := procFSRoot
+	procFSRoot = proc
+	t.Cleanup(func() { procFSRoot = oldProc })
+
+	report, err := SnapshotProc(10)
+	require.NoError(t, err)
+
+	assert.Equal(t, "42", report.Status["Threads"])
+	assert.Equal(t, int64(900), report.SmapsRollup["Pss"])
+	assert.Equal(t, int64(4096), report.IO["read_bytes"])
+	assert.Equal(t, map[string]string{"se.exec_start": "12345.678", "nr_switches": "7"}, report.Sched)
+	assert.Equal(t, 666, *report.OOMScore)
+	assert.Equal(t, -500, *report.OOMScoreAdj)
+	assert.Equal(t, []string{"0::/docker/abc"}, report.Cgroup)
+	assert.Contains(t, report.Errors, "limits")
+
+	assert.Equal(t, &ProcFDCounts{
+		Total: 6, Socket: 2, Pipe: 1, File: 1, AnonInode: 1, Other: 1,
+		AnonInodeKinds: map[string]int{"[eventpoll]": 1},
+	}, report.FDs)
+
+	assert.Equal(t, []ProcTreeNode{{Pid: 1, Ppid: 0, Comm: "init", Cmdline: "/sbin/init"}}, report.Tree.Ancestors)
+	assert.Equal(t, ProcTreeNode{Pid: 10, Ppid: 1, Comm: "java", Cmdline: "java -Ddb.password=<redacted> -jar app.jar"}, report.Tree.Process)
+	assert.Equal(t, []ProcTreeNode{
+		{Pid: 11, Ppid: 10, Comm: "sh", Cmdline: "sh -c sleep 5 --password <redacted>"},
+		{Pid: 12, Ppid: 11, Comm: "sleep", Cmdline: ""},
+	}, report.Tree.Descendants)
+}
+
+func TestSnapshotProcSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is only available on Linux")
+	}
+
+	report, err := SnapshotProc(os.Getpid())
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, report.Status["Name"])
+	assert.NotEmpty(t, report.Limits)
+	require.NotNil(t, report.FDs)
+	assert.Positive(t, report.FDs.Total)
+}
@@ -27,10 +27,16 @@ func GetProcessStartTimestamp(pid int) (int64, error) {
 		return 0, fmt.Errorf("process not found: %d", pid)
 	}
 
-	tm, err := time.Parse("Mon Jan 2 15:04:05 2006", value)
+	tm, err := parsePSStartTime(value, time.Local)
 	if err != nil {
 		return 0, fmt.Errorf("failed parsing process start time for pid=%d: %w", pid, err)
 	}
 
 	return tm.UnixNano(), nil
 }
+
+// parsePSStartTime parses the lstart column of ps, which is printed in the
+// local time of the host, loc.
+func parsePSStartTime(value string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("Mon Jan 2 15:04:05 2006", value, loc)
+}
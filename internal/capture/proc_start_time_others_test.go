@@ -0,0 +1,17 @@
+//go:build !windows
+
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePSStartTime(t *testing.T) {
+	tm, err := parsePSStartTime("Mon Oct 19 09:15:30 2026", time.FixedZone("CEST", 2*60*60))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 19, 7, 15, 30, 0, time.UTC), tm.UTC())
+}
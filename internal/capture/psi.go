@@ -0,0 +1,298 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/capture/executils"
+	"yc-agent/internal/logger"
+)
+
+const psiOut = "psi.json"
+
+// psiResources are the resources PSI reports on, both system-wide under
+// /proc/pressure and per cgroup as <resource>.pressure.
+var psiResources = []string{"cpu", "memory", "io"}
+
+// PSI samples Linux Pressure Stall Information over the capture window:
+// the share of time tasks were stalled waiting for CPU, memory or I/O, both
+// system-wide and for the target's cgroup. Unlike the run queue and iowait
+// columns of vmstat, it measures lost time directly.
+type PSI struct {
+	Capture
+	Pid int
+	// Interval between samples; defaults to VMSTAT_INTERVAL.
+	Interval time.Duration
+	// Samples to take; defaults to the vmstat sample count.
+	Samples int
+}
+
+// PSILine is one line of a pressure file. The averages are percentages,
+// Total is the cumulative stall time in microseconds.
+type PSILine struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// PSIPressure is the content of a pressure file. "some" is the time at least
+// one task was stalled, "full" the time all non-idle tasks were stalled at
+// once; the system-wide cpu file has no meaningful "full" line.
+type PSIPressure struct {
+	Some *PSILine `json:"some,omitempty"`
+	Full *PSILine `json:"full,omitempty"`
+}
+
+// PSISample is the pressure of every resource at one point in time.
+type PSISample struct {
+	Time   time.Time              `json:"time"`
+	System map[string]PSIPressure `json:"system,omitempty"`
+	Cgroup map[string]PSIPressure `json:"cgroup,omitempty"`
+}
+
+// PSISummary is the stall time of one resource over the sampled window.
+type PSISummary struct {
+	// Scope is "system" or "cgroup".
+	Scope    string `json:"scope"`
+	Resource string `json:"resource"`
+	// SomePercent and FullPercent are the stall time over the window as a
+	// percentage of the wall time.
+	SomePercent   float64 `json:"somePercent"`
+	FullPercent   float64 `json:"fullPercent"`
+	PeakSomeAvg10 float64 `json:"peakSomeAvg10"`
+	PeakFullAvg10 float64 `json:"peakFullAvg10"`
+}
+
+type psiReport struct {
+	Pid       int    `json:"pid"`
+	Supported bool   `json:"supported"`
+	Status    string `json:"status"`
+	// CgroupPath is empty when the cgroup pressure files aren't available.
+	CgroupPath   string       `json:"cgroupPath,omitempty"`
+	CgroupStatus string       `json:"cgroupStatus,omitempty"`
+	Interval     string       `json:"interval"`
+	Summary      []PSISummary `json:"summary,omitempty"`
+	Samples      []PSISample  `json:"samples,omitempty"`
+}
+
+// Run samples PSI and uploads the time series.
+func (t *PSI) Run() (Result, error) {
+	if runtime.GOOS != "linux" {
+		return Result{Msg: "skipped: PSI is only supported on Linux"}, nil
+	}
+
+	file, err := t.CaptureToFile()
+	if err != nil {
+		return Result{Msg: err.Error(), Ok: false}, err
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "psi", file)
+	return Result{Msg: msg, Ok: ok}, nil
+}
+
+// CaptureToFile samples PSI into psi.json. When the kernel doesn't support
+// PSI the file is still written, with supported=false and the reason.
+func (t *PSI) CaptureToFile() (*os.File, error) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Duration(executils.VMSTAT_INTERVAL) * time.Second
+	}
+	samples := t.Samples
+	if samples <= 0 {
+		samples = vmstatCount
+	}
+
+	report := psiReport{Pid: t.Pid, Interval: interval.String()}
+
+	if _, err := readSystemPressure(); err != nil {
+		report.Status = fmt.Sprintf("not supported on this kernel: %v", err)
+		logger.Log("PSI %s", report.Status)
+		return writePSIReport(report)
+	}
+	report.Supported = true
+	report.Status = "ok"
+
+	var cg *Cgroup
+	if t.Pid > 0 {
+		cg, report.CgroupStatus = resolvePressureCgroup(t.Pid)
+		if cg != nil {
+			report.CgroupPath = cg.Path
+		}
+	}
+
+	logger.Log("Sampling PSI every %s", interval)
+
+	for i := range samples {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		sample := PSISample{Time: time.Now()}
+		sample.System, _ = readSystemPressure()
+		if cg != nil {
+			sample.Cgroup = readCgroupPressure(cg)
+		}
+		report.Samples = append(report.Samples, sample)
+	}
+	report.Summary = summarizePSISamples(report.Samples)
+
+	return writePSIReport(report)
+}
+
+func writePSIReport(report psiReport) (*os.File, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PSI: %w", err)
+	}
+
+	file, err := os.Create(psiOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", psiOut, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", psiOut, err)
+	}
+
+	return file, nil
+}
+
+// readSystemPressure reads /proc/pressure/*. It fails when the directory is
+// missing (CONFIG_PSI off) or the files can't be read (booted with psi=0,
+// where reads return EOPNOTSUPP).
+func readSystemPressure() (map[string]PSIPressure, error) {
+	pressure := map[string]PSIPressure{}
+	for _, resource := range psiResources {
+		data, err := os.ReadFile(filepath.Join(procFSRoot, "pressure", resource))
+		if err != nil {
+			return nil, err
+		}
+		pressure[resource] = parsePSI(string(data))
+	}
+	return pressure, nil
+}
+
+// resolvePressureCgroup returns the cgroup of pid when it has pressure
+// files, otherwise the reason it doesn't.
+func resolvePressureCgroup(pid int) (*Cgroup, string) {
+	cg, err := ResolveCgroup(pid)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if cg.Version != 2 {
+		return nil, "cgroup pressure is only available on cgroup v2"
+	}
+	if _, err := cg.ReadFile("cpu", "cpu.pressure"); err != nil {
+		return nil, fmt.Sprintf("cgroup pressure not available: %v", err)
+	}
+	return cg, ""
+}
+
+func readCgroupPressure(cg *Cgroup) map[string]PSIPressure {
+	pressure := map[string]PSIPressure{}
+	for _, resource := range psiResources {
+		if data, err := cg.ReadFile(resource, resource+".pressure"); err == nil {
+			pressure[resource] = parsePSI(data)
+		}
+	}
+	return pressure
+}
+
+// parsePSI parses a pressure file:
+//
+//	some avg10=0.12 avg60=0.05 avg300=0.01 total=123456
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=4567
+func parsePSI(data string) PSIPressure {
+	var pressure PSIPressure
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		line := &PSILine{}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			switch key {
+			case "avg10":
+				line.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				line.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				line.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				line.Total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = line
+		case "full":
+			pressure.Full = line
+		}
+	}
+
+	return pressure
+}
+
+// summarizePSISamples computes the stall time of each resource between the
+// first and the last sample, and the peak 10s averages.
+func summarizePSISamples(samples []PSISample) []PSISummary {
+	if len(samples) == 0 {
+		return nil
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := float64(last.Time.Sub(first.Time).Microseconds())
+
+	var summaries []PSISummary
+	for _, scope := range []string{"system", "cgroup"} {
+		pick := func(s PSISample) map[string]PSIPressure {
+			if scope == "system" {
+				return s.System
+			}
+			return s.Cgroup
+		}
+
+		for _, resource := range psiResources {
+			before, ok := pick(first)[resource]
+			if !ok {
+				continue
+			}
+			after := pick(last)[resource]
+
+			summary := PSISummary{Scope: scope, Resource: resource}
+			if elapsed > 0 {
+				if before.Some != nil && after.Some != nil {
+					summary.SomePercent = roundPercent(counterDelta(before.Some.Total, after.Some.Total) / elapsed)
+				}
+				if before.Full != nil && after.Full != nil {
+					summary.FullPercent = roundPercent(counterDelta(before.Full.Total, after.Full.Total) / elapsed)
+				}
+			}
+			for _, s := range samples {
+				p := pick(s)[resource]
+				if p.Some != nil {
+					summary.PeakSomeAvg10 = max(summary.PeakSomeAvg10, p.Some.Avg10)
+				}
+				if p.Full != nil {
+					summary.PeakFullAvg10 = max(summary.PeakFullAvg10, p.Full.Avg10)
+				}
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+
+	return summaries
+}
@@ -0,0 +1,96 @@
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePSI(t *testing.T) {
+	pressure := parsePSI("some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=789\n")
+
+	assert.Equal(t, PSIPressure{
+		Some: &PSILine{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 123456},
+		Full: &PSILine{Total: 789},
+	}, pressure)
+
+	assert.Equal(t, PSIPressure{Some: &PSILine{Avg10: 2, Total: 10}}, parsePSI("some avg10=2.00 total=10\n"))
+}
+
+func TestSummarizePSISamples(t *testing.T) {
+	start := time.Date(2026, 10, 19, 5, 30, 0, 0, time.UTC)
+	pressure := func(someAvg10 float64, someTotal, fullTotal uint64) map[string]PSIPressure {
+		return map[string]PSIPressure{"memory": {
+			Some: &PSILine{Avg10: someAvg10, Total: someTotal},
+			Full: &PSILine{Total: fullTotal},
+		}}
+	}
+
+	summary := summarizePSISamples([]PSISample{
+		{Time: start, System: pressure(1, 1_000_000, 0), Cgroup: pressure(2, 0, 0)},
+		{Time: start.Add(5 * time.Second), System: pressure(8, 1_500_000, 100_000), Cgroup: pressure(30, 2_000_000, 1_000_000)},
+		{Time: start.Add(10 * time.Second), System: pressure(4, 2_000_000, 100_000), Cgroup: pressure(20, 2_500_000, 1_000_000)},
+	})
+
+	assert.Equal(t, []PSISummary{
+		{Scope: "system", Resource: "memory", SomePercent: 10, FullPercent: 1, PeakSomeAvg10: 8},
+		{Scope: "cgroup", Resource: "memory", SomePercent: 25, FullPercent: 10, PeakSomeAvg10: 30},
+	}, summary)
+}
+
+func TestPSICaptureToFile(t *testing.T) {
+	withCgroupFixture(t, "0::/kubepods/pod1/abc\n", map[string]string{
+		"cgroup.controllers":                "cpu memory io",
+		"kubepods/pod1/abc/cpu.pressure":    "some avg10=0.00 avg60=0.00 avg300=0.00 total=10\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=5\n",
+		"kubepods/pod1/abc/memory.pressure": "some avg10=3.00 avg60=0.00 avg300=0.00 total=20\nfull avg10=1.00 avg60=0.00 avg300=0.00 total=10\n",
+		"kubepods/pod1/abc/io.pressure":     "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	})
+	for _, resource := range psiResources {
+		path := filepath.Join(procFSRoot, "pressure", resource)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("some avg10=0.50 avg60=0.00 avg300=0.00 total=100\n"), 0644))
+	}
+
+	t.Chdir(t.TempDir())
+
+	task := &PSI{Pid: 42, Interval: time.Millisecond, Samples: 2}
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	var report psiReport
+	data, err := os.ReadFile(psiOut)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.True(t, report.Supported)
+	assert.Equal(t, "/kubepods/pod1/abc", report.CgroupPath)
+	require.Len(t, report.Samples, 2)
+	assert.Equal(t, 0.5, report.Samples[0].System["io"].Some.Avg10)
+	assert.Equal(t, uint64(10), report.Samples[0].Cgroup["memory"].Full.Total)
+	assert.Len(t, report.Summary, 6)
+}
+
+func TestPSINotSupported(t *testing.T) {
+	withCgroupFixture(t, "0::/\n", nil)
+	t.Chdir(t.TempDir())
+
+	task := &PSI{Pid: 42, Interval: time.Millisecond, Samples: 2}
+	file, err := task.CaptureToFile()
+	require.NoError(t, err)
+	file.Close()
+
+	var report psiReport
+	data, err := os.ReadFile(psiOut)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+
+	assert.False(t, report.Supported)
+	assert.Contains(t, report.Status, "not supported on this kernel")
+	assert.Empty(t, report.Samples)
+}
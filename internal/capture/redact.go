@@ -0,0 +1,32 @@
+package capture
+
+import (
+	"slices"
+	"strings"
+)
+
+// redactedValue replaces the values of environment variables and command
+// line arguments that may be credentials.
+const redactedValue = "<redacted>"
+
+// redactCmdlineArgs masks the values of the arguments named like a secret
+// (see sensitiveEnvNamePattern), either -Dname=value, --name=value or
+// --name value.
+func redactCmdlineArgs(args []string) []string {
+	redacted := slices.Clone(args)
+	for i, arg := range redacted {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, found := strings.Cut(arg, "=")
+		if !sensitiveEnvNamePattern.MatchString(strings.TrimLeft(name, "-")) {
+			continue
+		}
+		if found {
+			redacted[i] = name + "=" + redactedValue
+		} else if i+1 < len(redacted) && !strings.HasPrefix(redacted[i+1], "-") {
+			redacted[i+1] = redactedValue
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,15 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactCmdlineArgs(t *testing.T) {
+	args := []string{"java", "-Ddb.password=hunter2", "-Xmx2g", "-jar", "app.jar", "--api-token", "abc", "--auth-debug", "--port=8080"}
+
+	assert.Equal(t, []string{"java", "-Ddb.password=<redacted>", "-Xmx2g", "-jar", "app.jar", "--api-token", "<redacted>", "--auth-debug", "--port=8080"},
+		redactCmdlineArgs(args))
+	assert.Equal(t, "-Ddb.password=hunter2", args[1], "the arguments are left as is")
+}
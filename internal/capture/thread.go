@@ -21,6 +21,11 @@ type ThreadDump struct {
 	TdPath            string // Path to an existing thread dump file
 	JavaHome          string
 	TdCaptureDuration time.Duration
+	// JSONDump additionally captures a JSON thread dump (JDK 21+), which
+	// includes virtual threads, and uploads it as a separate artifact.
+	JSONDump bool
+	// Manifest, when set, records the thread counts of the JSON thread dump.
+	Manifest *Manifest
 }
 
 // Run executes the thread dump capture and uploads the captured file
@@ -33,9 +38,59 @@ func (t *ThreadDump) Run() (Result, error) {
 	defer capturedFile.Close()
 
 	result := t.UploadCapturedFile(capturedFile)
+
+	if t.JSONDump && t.TdPath == "" && t.Pid > 0 {
+		result.Msg += "\n\nJSON thread dump: " + t.captureAndUploadJSONThreadDump().Msg
+	}
+
+	if r, ok := t.uploadThreadCPU(); ok {
+		result.Msg += "\n\nThread CPU: " + r.Msg
+	}
+
 	return result, nil
 }
 
+// captureAndUploadJSONThreadDump captures the JSON thread dump and uploads it
+// as its own artifact, so the jstack-format threaddump.out stays unchanged.
+func (t *ThreadDump) captureAndUploadJSONThreadDump() Result {
+	file, stats, err := t.captureJSONThreadDump()
+	if err != nil {
+		logger.Log("Skipped JSON thread dump: %v", err)
+		return Result{Msg: err.Error(), Ok: false}
+	}
+	defer file.Close()
+
+	logger.Log("Captured JSON thread dump: %d threads, %d virtual", stats.Threads, stats.VirtualThreads)
+	t.Manifest.Set("threadDumpJson", map[string]any{
+		"file":            tdJSONOut,
+		"threads":         stats.Threads,
+		"virtualThreads":  stats.VirtualThreads,
+		"platformThreads": stats.PlatformThreads,
+		"containers":      stats.Containers,
+	})
+
+	msg, ok := PostData(t.Endpoint(), "tdjson", file)
+	return Result{Msg: msg, Ok: ok}
+}
+
+// uploadThreadCPU uploads the native thread CPU samples TopH took alongside
+// the thread dumps as their own artifact, so the top -H output appended to
+// threaddump.out stays unchanged. It reports false when there is no sample.
+func (t *ThreadDump) uploadThreadCPU() (Result, bool) {
+	file, err := appendThreadCPUFiles()
+	if err != nil {
+		logger.Log("Skipped thread CPU samples: %v", err)
+		return Result{Msg: err.Error(), Ok: false}, true
+	}
+	if file == nil {
+		return Result{}, false
+	}
+	defer file.Close()
+
+	msg, ok := PostData(t.Endpoint(), "threadcpu", file)
+	return Result{Msg: msg, Ok: ok}, true
+}
+
 // CaptureToFile attempts to obtain a thread dump either by copying an existing file
 // or by capturing from a running process. It returns the file containing the thread dump.
 func (t *ThreadDump) CaptureToFile() (*os.File, error) {
@@ -0,0 +1,241 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yc-agent/internal/logger"
+)
+
+// threadCPUSampleInterval is the time between the two samples of the thread
+// CPU sampler. TopH runs alongside the thread dump of the same iteration, so
+// the window covers the moment javacore.N.out is taken.
+const threadCPUSampleInterval = 2 * time.Second
+
+// clockTicksPerSecond is USER_HZ, the unit of utime/stime in /proc/*/stat. It
+// is 100 on every mainstream Linux architecture.
+const clockTicksPerSecond = 100
+
+// threadCPUFormatVersion identifies the layout written by writeThreadCPU.
+const threadCPUFormatVersion = "yc-threadcpu/1"
+
+const (
+	// threadCPUOutputPattern names the sample TopH takes alongside the Nth
+	// thread dump.
+	threadCPUOutputPattern = "threadcpu.%d.out"
+	// threadCPUOut gathers the samples of a capture for the upload.
+	threadCPUOut = "threadcpu.out"
+)
+
+// ThreadCPU is the CPU usage of one thread between two samples.
+type ThreadCPU struct {
+	Tid int
+	// State is the state letter of /proc/<pid>/task/<tid>/stat (R, S, D, ...).
+	State string
+	// CPUPercent is the share of one CPU used over the window, as in top.
+	CPUPercent float64
+	// CPUTime is the total user+system time of the thread at the second sample.
+	CPUTime time.Duration
+	Comm    string
+}
+
+// NID returns the tid in hex, as printed in the nid field of Java thread dumps.
+func (t ThreadCPU) NID() string {
+	return "0x" + strconv.FormatInt(int64(t.Tid), 16)
+}
+
+// ThreadCPUSample is the result of SampleThreadCPU.
+type ThreadCPUSample struct {
+	Pid     int
+	Start   time.Time
+	End     time.Time
+	Threads []ThreadCPU
+}
+
+// SampleThreadCPU reads /proc/<pid>/task/*/stat twice, interval apart, and
+// computes the CPU usage of each thread, busiest first. Threads that exited
+// before the second sample are left out; threads started in between are
+// measured from their start.
+func SampleThreadCPU(pid int, interval time.Duration) (*ThreadCPUSample, error) {
+	first, err := readTaskStats(pid)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+
+	time.Sleep(interval)
+
+	second, err := readTaskStats(pid)
+	if err != nil {
+		return nil, err
+	}
+	end := time.Now()
+
+	return computeThreadCPU(pid, first, second, start, end), nil
+}
+
+func computeThreadCPU(pid int, first, second map[int]procStat, start, end time.Time) *ThreadCPUSample {
+	sample := &ThreadCPUSample{Pid: pid, Start: start, End: end}
+	elapsedTicks := end.Sub(start).Seconds() * clockTicksPerSecond
+
+	for tid, after := range second {
+		ticks := after.Utime + after.Stime
+		var used uint64
+		if before, ok := first[tid]; ok {
+			if prev := before.Utime + before.Stime; ticks >= prev {
+				used = ticks - prev
+			}
+		} else {
+			used = ticks
+		}
+
+		percent := 0.0
+		if elapsedTicks > 0 {
+			percent = float64(used) / elapsedTicks * 100
+		}
+
+		sample.Threads = append(sample.Threads, ThreadCPU{
+			Tid:        tid,
+			State:      after.State,
+			CPUPercent: percent,
+			CPUTime:    time.Duration(ticks) * time.Second / clockTicksPerSecond,
+			Comm:       after.Comm,
+		})
+	}
+
+	slices.SortFunc(sample.Threads, func(a, b ThreadCPU) int {
+		if a.CPUPercent != b.CPUPercent {
+			if a.CPUPercent > b.CPUPercent {
+				return -1
+			}
+			return 1
+		}
+		return a.Tid - b.Tid
+	})
+
+	return sample
+}
+
+// readTaskStats reads the stat of every thread of pid. The comm of the stat
+// file is truncated the same way as task/<tid>/comm (15 chars), so comm isn't
+// read separately unless stat's is empty.
+func readTaskStats(pid int) (map[int]procStat, error) {
+	dir := filepath.Join(procFSRoot, strconv.Itoa(pid), "task")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list threads of pid %d: %w", pid, err)
+	}
+
+	stats := map[int]procStat{}
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "stat"))
+		if err != nil {
+			// The thread exited in the meantime.
+			continue
+		}
+		stat, err := parseProcStat(string(data))
+		if err != nil {
+			continue
+		}
+		if stat.Comm == "" {
+			if comm, err := os.ReadFile(filepath.Join(dir, entry.Name(), "comm")); err == nil {
+				stat.Comm = strings.TrimSpace(string(comm))
+			}
+		}
+		stats[tid] = stat
+	}
+
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("no threads found for pid %d", pid)
+	}
+
+	return stats, nil
+}
+
+// writeThreadCPU writes a sample in the yc-threadcpu/1 format: a few "# key:
+// value" header lines, then a tab separated table with one row per thread,
+// busiest first:
+//
+//	# yc-threadcpu/1
+//	# pid: 1234
+//	# javacore: javacore.1.out
+//	# start: 2026-10-19T05:30:45.123Z
+//	# end: 2026-10-19T05:30:47.124Z
+//	# threads: 2
+//	TID	NID	STATE	%CPU	TIME_MS	COMMAND
+//	1250	0x4e2	R	98.5	123450	C2 CompilerThre
+//	1234	0x4d2	S	0.0	850	java
+//
+// %CPU is the share of one CPU over [start, end] (it can exceed 100 only
+// through rounding), TIME_MS the thread's total CPU time at end and NID the
+// tid in hex, matching nid= in the javacore named in the header.
+func writeThreadCPU(w io.Writer, sample *ThreadCPUSample, javacore string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n", threadCPUFormatVersion)
+	fmt.Fprintf(&b, "# pid: %d\n", sample.Pid)
+	if javacore != "" {
+		fmt.Fprintf(&b, "# javacore: %s\n", javacore)
+	}
+	fmt.Fprintf(&b, "# start: %s\n", sample.Start.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "# end: %s\n", sample.End.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "# threads: %d\n", len(sample.Threads))
+	b.WriteString("TID\tNID\tSTATE\t%CPU\tTIME_MS\tCOMMAND\n")
+
+	for _, t := range sample.Threads {
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%.1f\t%d\t%s\n",
+			t.Tid, t.NID(), t.State, t.CPUPercent, t.CPUTime.Milliseconds(), strings.ReplaceAll(t.Comm, "\t", " "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// appendThreadCPUFiles concatenates the threadcpu.<N>.out samples, in the
+// order of the thread dumps, into threadcpu.out. Each sample starts with its
+// own "# yc-threadcpu/1" header. It returns nil when there is no sample.
+func appendThreadCPUFiles() (*os.File, error) {
+	var samples []int
+	matches, _ := filepath.Glob("threadcpu.*.out")
+	for _, match := range matches {
+		var n int
+		if _, err := fmt.Sscanf(match, threadCPUOutputPattern, &n); err == nil && fmt.Sprintf(threadCPUOutputPattern, n) == match {
+			samples = append(samples, n)
+		}
+	}
+	if len(samples) == 0 {
+		return nil, nil
+	}
+	slices.Sort(samples)
+
+	file, err := os.Create(threadCPUOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", threadCPUOut, err)
+	}
+	for _, n := range samples {
+		data, err := os.ReadFile(fmt.Sprintf(threadCPUOutputPattern, n))
+		if err != nil {
+			logger.Log("failed to read thread CPU sample %d: %v", n, err)
+			continue
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write %s: %w", threadCPUOut, err)
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to rewind %s: %w", threadCPUOut, err)
+	}
+	return file, nil
+}
@@ -0,0 +1,111 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeThreadCPU(t *testing.T) {
+	start := time.Date(2026, 10, 19, 5, 30, 45, 0, time.UTC)
+	end := start.Add(2 * time.Second)
+
+	first := map[int]procStat{
+		100: {Pid: 100, Comm: "java", State: "S", Utime: 50, Stime: 10},
+		101: {Pid: 101, Comm: "C2 CompilerThre", State: "R", Utime: 1000, Stime: 0},
+		102: {Pid: 102, Comm: "exited", State: "S", Utime: 5, Stime: 5},
+	}
+	second := map[int]procStat{
+		100: {Pid: 100, Comm: "java", State: "S", Utime: 50, Stime: 10},
+		101: {Pid: 101, Comm: "C2 CompilerThre", State: "R", Utime: 1150, Stime: 40},
+		103: {Pid: 103, Comm: "new", State: "R", Utime: 20, Stime: 0},
+	}
+
+	sample := computeThreadCPU(100, first, second, start, end)
+
+	require.Len(t, sample.Threads, 3)
+	assert.Equal(t, ThreadCPU{Tid: 101, State: "R", CPUPercent: 95, CPUTime: 11900 * time.Millisecond, Comm: "C2 CompilerThre"}, sample.Threads[0])
+	assert.Equal(t, ThreadCPU{Tid: 103, State: "R", CPUPercent: 10, CPUTime: 200 * time.Millisecond, Comm: "new"}, sample.Threads[1])
+	assert.Equal(t, ThreadCPU{Tid: 100, State: "S", CPUPercent: 0, CPUTime: 600 * time.Millisecond, Comm: "java"}, sample.Threads[2])
+	assert.Equal(t, "0x65", sample.Threads[0].NID())
+}
+
+func TestWriteThreadCPU(t *testing.T) {
+	start := time.Date(2026, 10, 19, 5, 30, 45, 0, time.UTC)
+	sample := &ThreadCPUSample{
+		Pid:   1234,
+		Start: start,
+		End:   start.Add(2 * time.Second),
+		Threads: []ThreadCPU{
+			{Tid: 1250, State: "R", CPUPercent: 98.46, CPUTime: 123450 * time.Millisecond, Comm: "C2 CompilerThre"},
+			{Tid: 1234, State: "S", CPUPercent: 0, CPUTime: 850 * time.Millisecond, Comm: "java"},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeThreadCPU(&buf, sample, "javacore.1.out"))
+
+	assert.Equal(t, `# yc-threadcpu/1
+# pid: 1234
+# javacore: javacore.1.out
+# start: 2026-10-19T05:30:45Z
+# end: 2026-10-19T05:30:47Z
+# threads: 2
+TID	NID	STATE	%CPU	TIME_MS	COMMAND
+1250	0x4e2	R	98.5	123450	C2 CompilerThre
+1234	0x4d2	S	0.0	850	java
+`, buf.String())
+}
+
+func TestSampleThreadCPUSelf(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc is only available on Linux")
+	}
+
+	sample, err := SampleThreadCPU(os.Getpid(), 10*time.Millisecond)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, sample.Threads)
+	assert.True(t, sample.End.After(sample.Start))
+}
+
+func TestTopH_CaptureThreadCPU(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("native thread CPU sampling is only available on Linux")
+	}
+
+	t.Chdir(t.TempDir())
+
+	for _, n := range []int{10, 2} {
+		topH := &TopH{Pid: os.Getpid(), N: n}
+		require.NoError(t, topH.captureThreadCPU())
+	}
+	assert.NoFileExists(t, "topdashH.2.out", "top -H output is left to CaptureToFile")
+
+	file, err := appendThreadCPUFiles()
+	require.NoError(t, err)
+	require.NotNil(t, file)
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# yc-threadcpu/1\n"))
+	second := strings.Index(string(data), "# javacore: javacore.2.out\n")
+	tenth := strings.Index(string(data), "# javacore: javacore.10.out\n")
+	assert.True(t, second >= 0 && tenth > second, "the samples are in the order of the thread dumps")
+}
+
+func TestAppendThreadCPUFilesWithoutSamples(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	file, err := appendThreadCPUFiles()
+	require.NoError(t, err)
+	assert.Nil(t, file)
+}
@@ -0,0 +1,139 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tdJSONOut = "threaddump.json"
+
+// jsonThreadDumpMinJavaMajor is the first JDK with Thread.dump_to_file.
+const jsonThreadDumpMinJavaMajor = 21
+
+// ThreadDumpStats summarizes a JSON thread dump.
+type ThreadDumpStats struct {
+	Threads         int `json:"threads"`
+	VirtualThreads  int `json:"virtualThreads"`
+	PlatformThreads int `json:"platformThreads"`
+	Containers      int `json:"containers"`
+}
+
+// jsonThreadDump is the subset of the jcmd Thread.dump_to_file -format=json
+// document needed to summarize it.
+type jsonThreadDump struct {
+	ThreadDump struct {
+		ThreadContainers []struct {
+			Container string `json:"container"`
+			Threads   []struct {
+				Tid     string   `json:"tid"`
+				Name    string   `json:"name"`
+				Virtual *bool    `json:"virtual"`
+				Stack   []string `json:"stack"`
+			} `json:"threads"`
+		} `json:"threadContainers"`
+	} `json:"threadDump"`
+}
+
+// captureJSONThreadDump captures a JSON thread dump (JDK 21+) into
+// threaddump.json in the current directory. Unlike jstack, this format
+// includes virtual threads and the containers they were started in.
+func (t *ThreadDump) captureJSONThreadDump() (*os.File, ThreadDumpStats, error) {
+	version, err := targetJavaVersion(t.JavaHome, t.Pid)
+	if err != nil {
+		return nil, ThreadDumpStats{}, fmt.Errorf("failed to detect java version: %w", err)
+	}
+	if version.Major < jsonThreadDumpMinJavaMajor {
+		return nil, ThreadDumpStats{}, fmt.Errorf("JSON thread dumps require JDK %d+, found %d", jsonThreadDumpMinJavaMajor, version.Major)
+	}
+
+	// The dump is written by the target JVM, so the path has to be absolute
+	// and valid inside the target's mount namespace.
+	dumpPath := filepath.Join(os.TempDir(), fmt.Sprintf("yc-threaddump-%d-%d.json", t.Pid, time.Now().Unix()))
+	defer func() {
+		_ = os.Remove(dumpPath)
+		if runtime.GOOS == "linux" {
+			_ = os.Remove(filepath.Join("/proc", strconv.Itoa(t.Pid), "root", dumpPath))
+		}
+	}()
+
+	output, err := jcmdOutput(t.JavaHome, t.Pid, "Thread.dump_to_file -format=json "+dumpPath)
+	if err != nil {
+		return nil, ThreadDumpStats{}, fmt.Errorf("failed to run Thread.dump_to_file: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	file, err := os.Create(tdJSONOut)
+	if err != nil {
+		return nil, ThreadDumpStats{}, fmt.Errorf("failed to create %s: %w", tdJSONOut, err)
+	}
+
+	if err := copyFile(file, dumpPath, t.Pid); err != nil {
+		file.Close()
+		return nil, ThreadDumpStats{}, fmt.Errorf("failed to copy %s: %w, output: %s", dumpPath, err, strings.TrimSpace(string(output)))
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, ThreadDumpStats{}, fmt.Errorf("failed to rewind %s: %w", tdJSONOut, err)
+	}
+
+	stats, err := parseJSONThreadDump(file)
+	if err != nil {
+		file.Close()
+		return nil, ThreadDumpStats{}, err
+	}
+
+	return file, stats, nil
+}
+
+// parseJSONThreadDump counts the threads of a JSON thread dump. Threads are
+// virtual when marked as such; older JDKs (21) don't emit the "virtual"
+// field, so there a thread is virtual when its stack is rooted at
+// VirtualThread.run. A thread may be listed in more than one container, so
+// threads are counted once per tid.
+func parseJSONThreadDump(r io.Reader) (ThreadDumpStats, error) {
+	var dump jsonThreadDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return ThreadDumpStats{}, fmt.Errorf("failed to decode JSON thread dump: %w", err)
+	}
+
+	stats := ThreadDumpStats{Containers: len(dump.ThreadDump.ThreadContainers)}
+	seen := map[string]bool{}
+	for _, container := range dump.ThreadDump.ThreadContainers {
+		for _, thread := range container.Threads {
+			if seen[thread.Tid] {
+				continue
+			}
+			seen[thread.Tid] = true
+
+			stats.Threads++
+			if isVirtualThread(thread.Virtual, thread.Stack) {
+				stats.VirtualThreads++
+			} else {
+				stats.PlatformThreads++
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func isVirtualThread(virtual *bool, stack []string) bool {
+	if virtual != nil {
+		return *virtual
+	}
+
+	for _, frame := range stack {
+		if strings.Contains(frame, "java.lang.VirtualThread.run(") {
+			return true
+		}
+	}
+
+	return false
+}
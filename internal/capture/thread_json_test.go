@@ -0,0 +1,56 @@
+package capture
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONThreadDump(t *testing.T) {
+	dump := `{
+  "threadDump": {
+    "processId": "12345",
+    "time": "2026-10-19T05:00:00.000000Z",
+    "runtimeVersion": "21.0.2+13-LTS",
+    "threadContainers": [
+      {
+        "container": "<root>",
+        "parent": null,
+        "owner": null,
+        "threads": [
+          {"tid": "1", "name": "main", "stack": ["java.base/java.lang.Thread.sleep(Thread.java:509)", "App.main(App.java:10)"]},
+          {"tid": "21", "name": "", "stack": ["java.base/java.lang.VirtualThread.park(VirtualThread.java:582)", "java.base/java.lang.VirtualThread.run(VirtualThread.java:309)"]}
+        ],
+        "threadCount": "2"
+      },
+      {
+        "container": "java.util.concurrent.ThreadPerTaskExecutor@4e50df2e",
+        "parent": "<root>",
+        "owner": null,
+        "threads": [
+          {"tid": "21", "name": "", "stack": ["java.base/java.lang.VirtualThread.run(VirtualThread.java:309)"]},
+          {"tid": "22", "name": "worker", "virtual": true, "stack": []},
+          {"tid": "23", "name": "carrier", "virtual": false, "stack": ["java.base/java.lang.VirtualThread.run(VirtualThread.java:309)"]}
+        ],
+        "threadCount": "3"
+      }
+    ]
+  }
+}`
+
+	stats, err := parseJSONThreadDump(strings.NewReader(dump))
+	require.NoError(t, err)
+	assert.Equal(t, ThreadDumpStats{
+		Threads:         4,
+		VirtualThreads:  2,
+		PlatformThreads: 2,
+		Containers:      2,
+	}, stats)
+}
+
+func TestParseJSONThreadDump_Invalid(t *testing.T) {
+	_, err := parseJSONThreadDump(strings.NewReader("Full thread dump"))
+	assert.Error(t, err)
+}
@@ -114,7 +114,9 @@ func (t *Top) UploadCapturedFile(file *os.File) Result {
 	return Result{Msg: msg, Ok: ok}
 }
 
-// TopH captures "top -H" (threads) data for a specific process.
+// TopH captures "top -H" (threads) data for a specific process. On Linux the
+// threads are also sampled natively from /proc over the same window into
+// threadcpu.<N>.out (see writeThreadCPU for the format).
 type TopH struct {
 	Capture
 	Pid int
@@ -125,8 +127,8 @@ type TopH struct {
 // and then returns a Result.
 // (Note that unlike Top, TopH does not upload the captured file.)
 func (t *TopH) Run() (Result, error) {
-	// If the primary topH command isn’t configured, skip capturing.
-	if len(executils.TopH) == 0 {
+	// If neither the native sampler nor the primary topH command is available, skip capturing.
+	if runtime.GOOS != "linux" && len(executils.TopH) == 0 {
 		return Result{Msg: "skipped capturing TopH", Ok: false}, nil
 	}
 
@@ -137,6 +139,28 @@ func (t *TopH) Run() (Result, error) {
 
 	logger.Log("Collection of top dash H data started for PID %d.", t.Pid)
 
+	var native chan error
+	if runtime.GOOS == "linux" {
+		native = make(chan error, 1)
+		go func() { native <- t.captureThreadCPU() }()
+	}
+
+	result, err := t.captureTopH()
+
+	if native != nil {
+		if err := <-native; err != nil {
+			logger.Log("native thread CPU sampling failed: %v", err)
+		}
+	}
+	return result, err
+}
+
+func (t *TopH) captureTopH() (Result, error) {
+	// If the primary topH command isn’t configured, skip capturing.
+	if len(executils.TopH) == 0 {
+		return Result{Msg: "skipped capturing TopH", Ok: false}, nil
+	}
+
 	capturedFile, err := t.CaptureToFile()
 	if err != nil {
 		return Result{Msg: err.Error(), Ok: false}, err
@@ -168,6 +192,28 @@ func (t *TopH) CaptureToFile() (*os.File, error) {
 	return file, nil
 }
 
+// captureThreadCPU samples the threads from /proc into threadcpu.<N>.out. The
+// file is removed on failure.
+func (t *TopH) captureThreadCPU() error {
+	sample, err := SampleThreadCPU(t.Pid, threadCPUSampleInterval)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf(threadCPUOutputPattern, t.N)
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	if err := writeThreadCPU(file, sample, fmt.Sprintf("javacore.%d.out", t.N)); err != nil {
+		_ = os.Remove(fileName)
+		return err
+	}
+	return nil
+}
+
 // captureOutput builds and executes the primary topH command (adding the dynamic
 // PID argument). If that fails and a fallback command is available, it resets the file and retries.
 func (t *TopH) captureOutput(f *os.File) error {
@@ -34,6 +34,12 @@ type Options struct {
 	ThreadDumpPath    string   `yaml:"tdPath" usage:"The thread dump file to be uploaded while it exists"`
 	TDCaptureDuration Duration `yaml:"tdCaptureDuration" usage:"Total duration to capture thread dumps (e.g., 10m, 30s)"`
 	GCPath            string   `yaml:"gcPath" usage:"The gc log file to be uploaded while it exists"`
+	GCRuntimeLogging  bool     `yaml:"gcRuntimeLogging" usage:"Enable GC logging at runtime (jcmd VM.log, JDK 9+) when the target has no GC log. The previous logging configuration is restored afterwards. Default is false"`
+	OpenJ9Dumps       string   `yaml:"openj9Dumps" usage:"Extra OpenJ9 dumps to capture, comma separated: snap, system. Default is none"`
+	JVMAuditRules     string   `yaml:"jvmAuditRules" usage:"YAML file with JVM audit rules, merged into the built-in rules by id. A rule with 'disabled: true' turns a built-in rule off"`
+	KernelAuditRules  string   `yaml:"kernelAuditRules" usage:"YAML file with kernel baseline rules, merged into the built-in rules by id. A rule with 'disabled: true' turns a built-in rule off"`
+	DMesgWindow       Duration `yaml:"dmesgWindow" usage:"Window of kernel messages to capture (e.g., 2h, 30m). Default is since the target process started; widen it to see an OOM kill of the previous instance"`
+	JournalWindow     Duration `yaml:"journalWindow" usage:"Window of the systemd journal lines of the target service, or of its syslog lines when it has no journal, to capture as app logs (e.g., 2h, 30m). Default is since the target process started"`
 	JavaHomePath      string   `yaml:"j" usage:"The java home path to be used. Default will try to use os env 'JAVA_HOME' if 'JAVA_HOME' is not empty, for example: /usr/lib/jvm/java-8-openjdk-amd64"`
 	DeferDelete       bool     `yaml:"d" usage:"Delete logs folder created during analyse"`
 
@@ -47,6 +53,9 @@ type Options struct {
 
 	M3                   bool          `arg:"m3" usage:"Run in m3 mode, default is false"`
 	M3Frequency          Duration      `yaml:"m3Frequency" usage:"Frequency of m3 mode, default is 3 minutes"`
+	M3Jitter             Duration      `yaml:"m3Jitter" usage:"Maximum random offset of m3 cycles from the wall clock boundaries of m3Frequency, so agents started together don't report at the same time, default is 0"`
+	M3OverrunPolicy      string        `yaml:"m3OverrunPolicy" usage:"What to do when an m3 cycle takes longer than m3Frequency: skip (default) skips the missed cycles, queue runs one cycle right away"`
+	TriggerMaxCaptures   int           `yaml:"triggerMaxCapturesPerHour" usage:"Maximum number of incident captures started by local triggers in m3 mode per hour, default is 4"`
 	ProcessTokens        ProcessTokens `yaml:"processTokens" usage:"Process tokens of m3 mode"`
 	ExcludeProcessTokens ProcessTokens `yaml:"excludeTokens" usage:"Process exclude tokens of m3 mode"`
 
@@ -79,15 +88,23 @@ type Options struct {
 	LogFileMaxCount uint   `yaml:"logFileMaxCount" usage:"Max count of the log files"`
 	LogLevel        string `yaml:"logLevel" usage:"Log level: trace, debug, info, warn, error, fatal, panic, disable."`
 
-	AppLog          string  `yaml:"appLog" usage:"The target application’s log file path"`
-	AppLogs         AppLogs `yaml:"appLogs" usage:"The target application’s log file paths"`
-	AppLogLineCount int     `yaml:"appLogLineCount" usage:"Number of last lines from the log file should be uploaded. Set to -1 to upload all lines, 0 to skip log transmission"`
+	AppLog           string   `yaml:"appLog" usage:"The target application’s log file path"`
+	AppLogs          AppLogs  `yaml:"appLogs" usage:"The target application’s log file paths"`
+	AppLogLineCount  int      `yaml:"appLogLineCount" usage:"Number of last lines from the log file should be uploaded. Set to -1 to upload all lines, 0 to skip log transmission"`
+	AppLogWindow     Duration `yaml:"appLogWindow" usage:"Upload the log lines of this window before the capture (e.g., 15m) instead of the last appLogLineCount lines, searching the rotated and compressed files next to the log too. Logs without a known timestamp format fall back to appLogLineCount"`
+	AppLogExceptions bool     `yaml:"appLogExceptions" usage:"Aggregate the Java, .NET and Node stack traces of the uploaded app log lines by exception type and top frames into exceptions-summary.json, with their counts and first and last seen times. In m3 mode it aggregates the new lines of every cycle"`
+
+	AppLogDiscovery AppLogDiscovery `yaml:"appLogDiscovery"`
 
 	StoragePath string `yaml:"storagePath" usage:"The storage path to save the captured files"`
 
 	Kubernetes bool `yaml:"kubernetes" usage:"pass true for Kubernetes field"`
 
 	HealthChecks  HealthChecks `yaml:"healthChecks"`
+	Probes        Probes       `yaml:"probes"`
+	Triggers      Triggers     `yaml:"triggers"`
+	AdaptiveM3    AdaptiveM3   `yaml:"adaptiveM3"`
+	Schedules     Schedules    `yaml:"schedules"`
 	BoomiUser     string       `yaml:"boomiUser" usage:"username for Boomi account"`
 	BoomiPassword string       `yaml:"boomiPassword" usage:"password for Boomi account"`
 	Boomi         bool         `yaml:"boomi" usage:"pass true for Boomi field to capture boomi detail"`
@@ -108,6 +125,9 @@ type Options struct {
 	AccessLogFormats AccessLogFormats `yaml:"accessLogFormats" usage:"Access log formats corresponding to access log files"`
 
 	AccessLogSources AccessLogSources `yaml:"accessLogSources" usage:"Access log sources corresponding to access log files"`
+	AccessLogSummary string           `yaml:"accessLogSummary" usage:"Summarize the new access log lines of every m3 cycle on the agent (counts, status classes, latency percentiles, top slow and failing URLs): off (default) uploads the raw lines only, on uploads the summary alongside them, only uploads the summary instead of them"`
+
+	AccessLogDurationUnit string `yaml:"accessLogDurationUnit" usage:"Unit of the %D duration in the access log formats: us (default) as Apache httpd and Tomcat 10.1+ write it, or ms as Tomcat before 10.1 writes it"`
 
 	// Dotnet runtime support
 	AppRuntime     string `yaml:"appRuntime" usage:"Override target application runtime: java, dotnet, or nodejs. Default is auto-detect"`
@@ -142,9 +162,134 @@ type HealthCheck struct {
 	Endpoint    string `yaml:"endpoint"`
 	HTTPBody    string `yaml:"httpBody"`
 	TimeoutSecs int    `yaml:"timeoutSecs"`
+	// Type is http (default) or grpc, which calls grpc.health.v1.Health/Check
+	// on a grpc://host:port (plaintext) or grpcs://host:port endpoint.
+	Type string `yaml:"type"`
+	// GRPCService is the service name sent in the gRPC health check request;
+	// empty checks the server as a whole.
+	GRPCService string `yaml:"grpcService"`
+	// Method defaults to GET, or POST when HTTPBody is set.
+	Method string `yaml:"method"`
+	// Headers are added to the request. ${env:NAME} in a value is replaced
+	// with the environment variable and ${file:/path} with the trimmed
+	// content of the file, e.g. "Bearer ${file:/var/run/secrets/token}".
+	Headers map[string]string `yaml:"headers"`
+	// ExpectedStatus lists the passing HTTP status codes; default is 200-399.
+	ExpectedStatus []int `yaml:"expectedStatus"`
+	// BodyRegex must match the response body.
+	BodyRegex string `yaml:"bodyRegex"`
+	// JSONPath must exist in the JSON response body, e.g. "status" or
+	// "$.components.db.status", and equal JSONValue when it is set.
+	JSONPath  string `yaml:"jsonPath"`
+	JSONValue string `yaml:"jsonValue"`
+	// LatencySLOMs fails the check when the round trip takes longer.
+	LatencySLOMs int `yaml:"latencySloMs"`
 }
 type HealthChecks map[string]HealthCheck
 
+// Probe checks that a dependency of the application (database, cache,
+// downstream service) is reachable and measures its latency.
+type Probe struct {
+	Name string `yaml:"name"`
+	// Type is tcp, dns, tls or http.
+	Type string `yaml:"type"`
+	// Target is host:port for tcp and tls, a host name for dns and a URL
+	// for http.
+	Target string `yaml:"target"`
+	// Resolvers are the DNS servers (host or host:port) a dns probe queries,
+	// each measured separately. Default is the nameservers of
+	// /etc/resolv.conf, or the system resolver.
+	Resolvers []string `yaml:"resolvers"`
+	// ServerName overrides the TLS server name, which defaults to the host
+	// of Target.
+	ServerName  string `yaml:"serverName"`
+	Count       int    `yaml:"count"`
+	TimeoutSecs int    `yaml:"timeoutSecs"`
+}
+type Probes []Probe
+
+// Trigger is a condition evaluated locally on every M3 cycle. When it holds
+// for Cycles consecutive cycles, a full incident capture of the process is
+// started without waiting for the server to ask for it.
+type Trigger struct {
+	Name string `yaml:"name"`
+	// AppName restricts the trigger to the processes of one application
+	// (the name of the matching process token); empty applies to all.
+	AppName string `yaml:"appName"`
+	// Metric is one of:
+	//   cpu          CPU usage since the previous cycle, percent of one core
+	//   rss          resident memory in MB
+	//   threads      thread count
+	//   fds          open file descriptor count
+	//   gcPause      longest GC pause in the new part of the GC log, in ms
+	//   healthCheck  the health check of the application fails
+	//   appLog       Pattern matches a new line of the application logs
+	Metric string `yaml:"metric"`
+	// Threshold is the value the metric has to exceed; unused for
+	// healthCheck and appLog.
+	Threshold float64 `yaml:"threshold"`
+	// Pattern is the regular expression of the appLog metric.
+	Pattern string `yaml:"pattern"`
+	// Cycles is the number of consecutive M3 cycles the condition has to
+	// hold before the trigger fires; default is 1.
+	Cycles int `yaml:"cycles"`
+	// Cooldown is the minimum time between two captures by this trigger
+	// for the same process; default is 30m.
+	Cooldown Duration `yaml:"cooldown"`
+}
+type Triggers []Trigger
+
+// AdaptiveM3 tightens the M3 cadence of a process to Frequency while one of
+// its Signals holds, and relaxes it back to m3Frequency after QuietPeriod
+// without any.
+type AdaptiveM3 struct {
+	// Frequency is the tightened cadence, shorter than m3Frequency.
+	Frequency Duration `yaml:"frequency"`
+	// QuietPeriod is how long no signal has to hold before the cadence
+	// relaxes; default is 10m.
+	QuietPeriod Duration `yaml:"quietPeriod"`
+	// Signals are conditions like the ones of triggers, evaluated against
+	// the previous cycle; Cooldown is unused.
+	Signals Triggers `yaml:"signals"`
+}
+
+// AppLogDiscovery selects the app logs among the files a process has open.
+// Globs with a / match the path the process opened, others its file name.
+type AppLogDiscovery struct {
+	// Include are globs of files to discover besides *.log, *log*.* and
+	// catalina.out, e.g. *.txt.
+	Include []string `yaml:"include"`
+	// Exclude are globs of files not to discover, besides archives and
+	// libraries like *.jar and *.so.
+	Exclude []string `yaml:"exclude"`
+	// MinSize and MaxSize bound the size of the files in bytes; 0 is no
+	// bound.
+	MinSize int64 `yaml:"minSize"`
+	MaxSize int64 `yaml:"maxSize"`
+}
+
+// Schedule runs full captures on a cron schedule in the long-running agent,
+// e.g. every weekday at peak hours. Times are in the zone of TimezoneID.
+type Schedule struct {
+	Name string `yaml:"name"`
+	// Cron is a five field expression (minute hour day-of-month month
+	// day-of-week), e.g. "0 10,14 * * MON-FRI", or one of @hourly, @daily,
+	// @weekly, @monthly and @yearly.
+	Cron string `yaml:"cron"`
+	// ProcessTokens select the target processes like processTokens of m3
+	// mode, which are used when it is empty.
+	ProcessTokens        ProcessTokens `yaml:"processTokens"`
+	ExcludeProcessTokens ProcessTokens `yaml:"excludeTokens"`
+	// HeapDump overrides the hd option for the captures of the schedule.
+	HeapDump *bool `yaml:"hd"`
+	// Tags are added to the configured tags, along with schedule:<name>.
+	Tags string `yaml:"tags"`
+	// Artifacts restricts the captures to a subset, e.g. [gc, threadDump,
+	// top]; empty captures everything.
+	Artifacts []string `yaml:"artifacts"`
+}
+type Schedules []Schedule
+
 // UrlParams
 type UrlParams string
 type UrlParamsSlice []UrlParams
@@ -298,6 +443,9 @@ func defaultConfig() Config {
 			AppRuntime:        "",
 			DotnetToolPath:    "", // Empty string, will auto-discover during validation
 
+			M3OverrunPolicy:    "skip",
+			TriggerMaxCaptures: 4,
+
 			NodejsCaptureMode:        "hook",
 			NodejsReportSignal:       "SIGUSR2",
 			NodejsHeapdumpSignal:     "SIGUSR2",
@@ -481,7 +629,7 @@ func registerFlags(flagSetName string) (*flag.FlagSet, map[int]interface{}) {
 			flagSet.Var(durationPtr, name, usage)
 			result[i] = durationPtr
 			continue
-		case HealthChecks:
+		case HealthChecks, Probes, Triggers, AdaptiveM3, Schedules, AppLogDiscovery:
 			// Ignore this due to nested structure, we don't support this via CLI for now.
 			continue
 		}
@@ -555,7 +703,7 @@ func EffectiveFlags() string {
 
 		// Skip nested structures not expressible as a single flag value.
 		switch curElem.Field(i).Interface().(type) {
-		case HealthChecks, []Command:
+		case HealthChecks, Probes, Triggers, AdaptiveM3, Schedules, AppLogDiscovery, []Command:
 			continue
 		}
 